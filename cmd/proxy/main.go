@@ -20,6 +20,7 @@ const version = "1.0.0"
 func main() {
 	configPath := flag.String("config", "config.yaml", "Path to configuration file")
 	showVersion := flag.Bool("version", false, "Show version and exit")
+	strictLogLevel := flag.Bool("strict-log-level", false, "Exit on an invalid logging.level instead of falling back to info")
 	flag.Parse()
 
 	if *showVersion {
@@ -38,7 +39,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	log, err := logger.New(cfg.Logging.Level, cfg.Logging.Format)
+	newLogger := logger.NewWithFallback
+	if *strictLogLevel {
+		newLogger = logger.New
+	}
+	log, err := newLogger(cfg.Logging.Level, cfg.Logging.Format)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create logger: %v\n", err)
 		os.Exit(1)
@@ -49,11 +54,16 @@ func main() {
 		zap.String("version", version),
 		zap.String("config", *configPath))
 
+	for _, warning := range cfg.Warnings() {
+		log.Warn("Suspicious configuration", zap.String("warning", warning))
+	}
+
 	server, err := proxy.NewServer(cfg, log)
 	if err != nil {
 		log.Fatal("Failed to create server", zap.Error(err))
 		os.Exit(2)
 	}
+	server.SetVersion(version)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -61,6 +71,19 @@ func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	go func() {
+		for range reloadCh {
+			newCfg, err := config.Load(*configPath)
+			if err != nil {
+				log.Error("Config reload failed, keeping current config", zap.Error(err))
+				continue
+			}
+			server.Reload(newCfg)
+		}
+	}()
+
 	errCh := make(chan error, 1)
 
 	go func() {
@@ -3,7 +3,9 @@ module proxy-kp
 go 1.25.5
 
 require (
+	github.com/andybalholm/brotli v1.2.5
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.20.1
 	go.uber.org/zap v1.27.1
 	golang.org/x/time v0.14.0
 	gopkg.in/yaml.v3 v3.0.1
@@ -2,22 +2,65 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"proxy-kp/pkg/access"
+	"proxy-kp/pkg/health"
+	tlsconfig "proxy-kp/pkg/tls"
+
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server      ServerConfig      `yaml:"server"`
-	TLS         TLSConfig         `yaml:"tls"`
-	Backends    []BackendConfig   `yaml:"backends"`
-	HealthCheck HealthCheckConfig `yaml:"health_check"`
-	Cache       CacheConfig       `yaml:"cache"`
-	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
-	Logging     LoggingConfig     `yaml:"logging"`
+	Server         ServerConfig         `yaml:"server"`
+	TLS            TLSConfig            `yaml:"tls"`
+	Backends       []BackendConfig      `yaml:"backends"`
+	HealthCheck    HealthCheckConfig    `yaml:"health_check"`
+	Cache          CacheConfig          `yaml:"cache"`
+	RateLimit      RateLimitConfig      `yaml:"rate_limit"`
+	Logging        LoggingConfig        `yaml:"logging"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	Admin          AdminConfig          `yaml:"admin"`
+	Proxy          ProxyConfig          `yaml:"proxy"`
+	Routes         []RouteConfig        `yaml:"routes"`
+	Routing        RoutingConfig        `yaml:"routing"`
+	Upstreams      []UpstreamConfig     `yaml:"upstreams"`
+	Summary        SummaryConfig        `yaml:"summary"`
+	Shadow         ShadowConfig         `yaml:"shadow"`
+	Compression    CompressionConfig    `yaml:"compression"`
+	Headers        HeadersConfig        `yaml:"headers"`
+	WebSocket      WebSocketConfig      `yaml:"websocket"`
+
+	// BackendsDefaultWeight is the weight given to backends that omit
+	// weight, in the top-level pool and in every upstream. Defaults to 1.
+	BackendsDefaultWeight float64 `yaml:"backends_default_weight"`
+	// Balancer is the strategy every pool uses to pick a backend:
+	// round_robin (smooth weighted, the default), least_conn or ip_hash.
+	Balancer string `yaml:"balancer"`
+	// SlowBackendPenalty lowers a round_robin backend's weight while its
+	// latency EWMA is above this multiple of the pool median, in proportion
+	// to the excess. 0 disables it.
+	SlowBackendPenalty float64 `yaml:"slow_backend_penalty"`
 }
 
+const (
+	RateLimitTokenBucket   = "token_bucket"
+	RateLimitSlidingWindow = "sliding_window"
+)
+
+const (
+	BalancerRoundRobin = "round_robin"
+	BalancerLeastConn  = "least_conn"
+	BalancerIPHash     = "ip_hash"
+)
+
 type ServerConfig struct {
 	Port         int           `yaml:"port"`
 	Host         string        `yaml:"host"`
@@ -25,43 +68,580 @@ type ServerConfig struct {
 	HTTPSPort    int           `yaml:"https_port"`
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
+	MaxBackends  int           `yaml:"max_backends"`
+	// MaxConnsPerIP caps simultaneous TCP connections per client IP; 0
+	// disables the limit.
+	MaxConnsPerIP int `yaml:"max_conns_per_ip"`
+	// HTTPPorts and HTTPSPorts add listeners next to HTTPPort and HTTPSPort;
+	// every listener serves the same handler. When a list is set the single
+	// port may be omitted.
+	HTTPPorts  []int `yaml:"http_ports"`
+	HTTPSPorts []int `yaml:"https_ports"`
+	// PingPath, when set, is answered by the proxy itself with 200 and its
+	// version instead of being proxied.
+	PingPath string `yaml:"ping_path"`
+	// MaxRequestBody caps request bodies in bytes; 0 means no limit.
+	// BodyLimits override it for matching requests, first match wins.
+	MaxRequestBody int64             `yaml:"max_request_body"`
+	BodyLimits     []BodyLimitConfig `yaml:"body_limits"`
+	// MaxHeaderBytes caps the total size of request headers; larger
+	// requests are rejected with 431 before reaching a backend. 0 means no
+	// limit.
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+	// DefaultHost is used for HTTP/1.0 requests that carry no Host header.
+	// When empty, such requests are rejected with 400.
+	DefaultHost string `yaml:"default_host"`
+	// Expvar publishes core counters through the expvar package, served at
+	// /debug/vars on the admin listener.
+	Expvar ExpvarConfig `yaml:"expvar"`
+	// LocalPaths are answered by the proxy itself instead of being proxied,
+	// for noise such as /favicon.ico or /.well-known/ probes.
+	LocalPaths []LocalPathConfig `yaml:"local_paths"`
+	// SessionAffinity pins clients to a backend with a signed cookie.
+	SessionAffinity SessionAffinityConfig `yaml:"session_affinity"`
+	// TrustedProxies lists the IPs and CIDRs of load balancers in front of
+	// the proxy. For requests from them the client IP is the rightmost
+	// X-Forwarded-For entry that is not a trusted proxy.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// SessionAffinityConfig stores the backend chosen for a client's first
+// request in a signed cookie and sends later requests carrying it to the same
+// backend while it stays available. Without a Secret a random one is
+// generated at startup, so cookies do not survive restarts or work across
+// replicas.
+type SessionAffinityConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	CookieName string `yaml:"cookie_name"`
+	Secret     string `yaml:"secret"`
+	// MaxAge of the cookie; 0 makes it a session cookie.
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// LocalPathConfig answers requests for Path with Status (default 204) and
+// Body. A Path ending in "*" matches every path with that prefix.
+type LocalPathConfig struct {
+	Path   string `yaml:"path"`
+	Status int    `yaml:"status"`
+	Body   string `yaml:"body"`
+}
+
+// ExpvarConfig enables the core counters served at GET /debug/vars.
+type ExpvarConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// BodyLimitConfig applies MaxBytes to requests matching PathPrefix and
+// ContentType. Either may be empty, but not both. ContentType matches the
+// media type without parameters and may be a wildcard such as "multipart/*".
+type BodyLimitConfig struct {
+	PathPrefix  string `yaml:"path_prefix"`
+	ContentType string `yaml:"content_type"`
+	MaxBytes    int64  `yaml:"max_bytes"`
+}
+
+// ListenHTTPPorts returns http_port followed by http_ports, without duplicates.
+func (s ServerConfig) ListenHTTPPorts() []int {
+	return mergePorts(s.HTTPPort, s.HTTPPorts)
+}
+
+// ListenHTTPSPorts returns https_port followed by https_ports, without
+// duplicates.
+func (s ServerConfig) ListenHTTPSPorts() []int {
+	return mergePorts(s.HTTPSPort, s.HTTPSPorts)
+}
+
+func mergePorts(port int, extra []int) []int {
+	ports := make([]int, 0, len(extra)+1)
+	seen := make(map[int]bool, len(extra)+1)
+	for _, p := range append([]int{port}, extra...) {
+		if p == 0 || seen[p] {
+			continue
+		}
+		seen[p] = true
+		ports = append(ports, p)
+	}
+	return ports
 }
 
 type TLSConfig struct {
-	Enabled bool   `yaml:"enabled"`
+	Enabled  bool   `yaml:"enabled"`
 	CertFile string `yaml:"cert_file"`
 	KeyFile  string `yaml:"key_file"`
+	// DisableSessionTickets turns off TLS session ticket resumption.
+	DisableSessionTickets bool `yaml:"disable_session_tickets"`
+	// SessionTicketRotation replaces ticket keys on this interval; 0 keeps
+	// Go's built-in key management.
+	SessionTicketRotation time.Duration `yaml:"session_ticket_rotation"`
+	// ALPNProtocols lists the protocols offered during ALPN; empty offers
+	// both "h2" and "http/1.1". Omit "h2" to serve HTTP/1.1 only.
+	ALPNProtocols []string `yaml:"alpn_protocols"`
+	// MinVersion is the lowest TLS version accepted ("1.0" to "1.3");
+	// empty means 1.2. MinVersionByPort overrides it for single HTTPS
+	// listeners, e.g. TLS 1.3 only on the public port.
+	MinVersion       string         `yaml:"min_version"`
+	MinVersionByPort map[int]string `yaml:"min_version_by_port"`
 }
 
 type BackendConfig struct {
-	URL    string `yaml:"url"`
-	Weight int    `yaml:"weight"`
+	URL string `yaml:"url"`
+	// Weight may be fractional; pools normalize weights to integers with
+	// the same ratio before balancing.
+	Weight float64 `yaml:"weight"`
+	// RequestHeaders are set on every request proxied to this backend,
+	// replacing any client-supplied value.
+	RequestHeaders map[string]string `yaml:"request_headers"`
+	// Priority is the backend's tier: 0 for primaries, higher numbers for
+	// standby tiers. Tiers only affect health check scheduling, via
+	// health_check.tier_intervals.
+	Priority int `yaml:"priority"`
+
+	weightSet bool
+}
+
+// UnmarshalYAML records whether weight was present, so that Validate rejects an
+// explicit non-positive weight while an omitted one takes
+// backends_default_weight.
+func (b *BackendConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain BackendConfig
+	if err := node.Decode((*plain)(b)); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "weight" {
+			b.weightSet = true
+		}
+	}
+	return nil
+}
+
+// validWeight reports whether the backend's weight is acceptable: omitted, or
+// explicitly set to a positive value.
+func (b BackendConfig) validWeight() bool {
+	return b.Weight > 0 || (!b.weightSet && b.Weight == 0)
 }
 
 type HealthCheckConfig struct {
-	Interval         time.Duration `yaml:"interval"`
-	Timeout          time.Duration `yaml:"timeout"`
-	Endpoint         string        `yaml:"endpoint"`
-	FailureThreshold int           `yaml:"failure_threshold"`
-	RecoveryInterval time.Duration `yaml:"recovery_interval"`
+	Interval            time.Duration `yaml:"interval"`
+	Timeout             time.Duration `yaml:"timeout"`
+	Endpoint            string        `yaml:"endpoint"`
+	FailureThreshold    int           `yaml:"failure_threshold"`
+	RecoveryInterval    time.Duration `yaml:"recovery_interval"`
+	MinHealthy          int           `yaml:"min_healthy"`
+	MinHealthyReadiness bool          `yaml:"min_healthy_readiness"`
+	WebhookURL          string        `yaml:"webhook_url"`
+	WebhookTimeout      time.Duration `yaml:"webhook_timeout"`
+	WebhookRetries      int           `yaml:"webhook_retries"`
+	// JSONChecks maps dot-separated field paths in the health response body
+	// to the values they must hold, e.g. {"status": "UP", "db": "UP"}.
+	JSONChecks map[string]string `yaml:"json_checks"`
+	// TierIntervals probes backends of a priority tier at a longer interval
+	// than Interval, e.g. {1: 30s} for standby backends.
+	TierIntervals map[int]time.Duration `yaml:"tier_intervals"`
 }
 
 type CacheConfig struct {
-	Enabled bool          `yaml:"enabled"`
-	TTL     time.Duration `yaml:"ttl"`
+	Enabled           bool          `yaml:"enabled"`
+	TTL               time.Duration `yaml:"ttl"`
+	ServeStaleOnError bool          `yaml:"serve_stale_on_error"`
+	// MaxStaleAge caps how long past expiry an entry may still be served
+	// stale; 0 means no cap.
+	MaxStaleAge time.Duration  `yaml:"max_stale_age"`
+	Prefetch    PrefetchConfig `yaml:"prefetch"`
+	// TTLByStatus overrides TTL per status code ("301") or class ("3xx").
+	// Listed statuses other than 200 become cacheable.
+	TTLByStatus map[string]time.Duration `yaml:"ttl_by_status"`
+	// Backend selects the store: "memory" (default) or "redis".
+	Backend string           `yaml:"backend"`
+	Redis   RedisCacheConfig `yaml:"redis"`
+	// MaxConcurrentWrites caps simultaneous cache stores; writes beyond it
+	// are skipped. 0 means unlimited.
+	MaxConcurrentWrites int `yaml:"max_concurrent_writes"`
+	// DebugHeaders adds X-Cache-Backend, the backend that produced the
+	// entry, to cache hits.
+	DebugHeaders bool `yaml:"debug_headers"`
+	// MaxEntries and MaxBytes bound the memory cache; once full, the least
+	// recently used entries are evicted. 0 means unbounded.
+	MaxEntries int   `yaml:"max_entries"`
+	MaxBytes   int64 `yaml:"max_bytes"`
+	// CleanupInterval is how often expired entries are removed from the
+	// memory cache. ExpiredRetention keeps them that long past expiry for
+	// stale serving and revalidation; it defaults to MaxStaleAge, or TTL
+	// when that is unset.
+	CleanupInterval  time.Duration `yaml:"cleanup_interval"`
+	ExpiredRetention time.Duration `yaml:"expired_retention"`
+}
+
+type RedisCacheConfig struct {
+	Addr      string        `yaml:"addr"`
+	Password  string        `yaml:"password"`
+	DB        int           `yaml:"db"`
+	KeyPrefix string        `yaml:"key_prefix"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+type PrefetchConfig struct {
+	Enabled       bool `yaml:"enabled"`
+	MaxConcurrent int  `yaml:"max_concurrent"`
 }
 
 type RateLimitConfig struct {
-	Enabled           bool `yaml:"enabled"`
-	RequestsPerMinute int  `yaml:"requests_per_minute"`
-	Burst             int  `yaml:"burst"`
+	Enabled           bool              `yaml:"enabled"`
+	RequestsPerMinute int               `yaml:"requests_per_minute"`
+	Burst             int               `yaml:"burst"`
+	Fingerprint       FingerprintConfig `yaml:"fingerprint"`
+	// MaxClients caps the per-client buckets tracked; past it, new clients
+	// share one overflow bucket until cleanup frees room. 0 means no cap.
+	// The overflow bucket defaults to RequestsPerMinute and Burst.
+	MaxClients                int `yaml:"max_clients"`
+	OverflowRequestsPerMinute int `yaml:"overflow_requests_per_minute"`
+	OverflowBurst             int `yaml:"overflow_burst"`
+	// Scope is "per_ip" (the default) for a bucket per client or "global"
+	// for one bucket shared by all requests, capping total throughput.
+	Scope string `yaml:"scope"`
+	// Algorithm is token_bucket (the default), which refills continuously
+	// and allows bursts, or sliding_window, which allows at most
+	// RequestsPerMinute over any trailing minute and ignores Burst.
+	Algorithm string `yaml:"algorithm"`
+	// Allowlist holds IPs and CIDRs whose requests are never rate limited,
+	// e.g. internal monitoring.
+	Allowlist []string `yaml:"allowlist"`
+}
+
+// FingerprintConfig keys rate limit buckets on the client IP plus a hash of
+// the User-Agent and the listed headers, instead of the IP alone.
+type FingerprintConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Headers []string `yaml:"headers"`
+}
+
+type CircuitBreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	FailureThreshold int           `yaml:"failure_threshold"`
+	OpenTimeout      time.Duration `yaml:"open_timeout"`
+}
+
+type AdminConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Host is the admin listener's bind address. It defaults to 127.0.0.1
+	// rather than server.host, so the admin API is local unless opened up.
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// Token must be sent as "Authorization: Bearer <token>" to the endpoints
+	// that add or remove backends, purge the cache or reset a client's rate
+	// limit. Without it those endpoints are disabled.
+	Token string `yaml:"token"`
+	// AuditLog is where admin action audit entries are written: "stdout",
+	// "stderr" or a file path. Defaults to stdout, apart from the app log.
+	AuditLog   string           `yaml:"audit_log"`
+	TopClients TopClientsConfig `yaml:"top_clients"`
+}
+
+// TopClientsConfig tracks the client IPs sending the most requests for the
+// admin /top-clients endpoint. At most Capacity IPs are tracked; when full,
+// a new IP replaces the least active one and inherits its count, so counts
+// of the heaviest clients stay accurate while memory stays bounded.
+type TopClientsConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	Capacity int  `yaml:"capacity"`
+}
+
+type ProxyConfig struct {
+	StreamThreshold       int64         `yaml:"stream_threshold"`
+	LatencyAlertThreshold time.Duration `yaml:"latency_alert_threshold"`
+	ExpectContinueTimeout time.Duration `yaml:"expect_continue_timeout"`
+	MaxGlobalConcurrent   int           `yaml:"max_global_concurrent"`
+	GlobalConcurrentWait  time.Duration `yaml:"global_concurrent_wait"`
+	// HandleOptions answers OPTIONS requests (including "OPTIONS *") with
+	// 204 and an Allow header from AllowedMethods instead of forwarding them.
+	// OptionsPaths limits this to the given path prefixes. CORS preflights
+	// are always forwarded.
+	HandleOptions  bool        `yaml:"handle_options"`
+	OptionsPaths   []string    `yaml:"options_paths"`
+	AllowedMethods []string    `yaml:"allowed_methods"`
+	Retry          RetryConfig `yaml:"retry"`
+	// DialTimeout bounds connecting to a backend, TLSHandshakeTimeout its
+	// TLS handshake and ResponseHeaderTimeout the wait for response headers
+	// once the request is sent (0 = no limit). RequestTimeout bounds the
+	// whole exchange, including reading the body.
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	RequestTimeout        time.Duration `yaml:"request_timeout"`
+	// MaxIdleConns and MaxIdleConnsPerHost cap the keep-alive connections
+	// kept open to backends in total and per backend; IdleConnTimeout
+	// closes connections idle for longer. It defaults to 50s, below the 60s
+	// idle timeout of common load balancers (AWS ALB and ELB, GCP's internal
+	// load balancer) and many NATs, so the proxy closes an idle connection
+	// before one of them can drop it silently. MaxConnsPerHost caps all
+	// connections to one backend, idle or not, and defaults to 256; requests
+	// over it wait for a connection. DisableKeepAlives opens a new
+	// connection for every backend request.
+	MaxIdleConns        int           `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout"`
+	MaxConnsPerHost     int           `yaml:"max_conns_per_host"`
+	DisableKeepAlives   bool          `yaml:"disable_keep_alives"`
+	// MaxHops rejects requests that have already passed through the proxy
+	// this many times with 508, breaking loops where a backend sends
+	// requests back through the proxy. 0 disables loop detection.
+	MaxHops int `yaml:"max_hops"`
+	// MinIdleConnsPerBackend keeps this many keep-alive connections open to
+	// each available backend, re-dialing them in the background after idle
+	// periods. 0 disables the warm pool.
+	MinIdleConnsPerBackend int `yaml:"min_idle_conns_per_backend"`
+	// StripGetBody drops bodies sent with GET, HEAD or DELETE requests
+	// before forwarding; RejectGetBody answers such requests with 400
+	// instead.
+	StripGetBody  bool `yaml:"strip_get_body"`
+	RejectGetBody bool `yaml:"reject_get_body"`
+	// BodyRewrite rules replace text in response bodies of the listed
+	// content types, in order. Only bodies up to StreamThreshold that are
+	// not content-encoded are rewritten; others pass through unchanged.
+	BodyRewrite []BodyRewriteConfig `yaml:"body_rewrite"`
+	// UpstreamProxyURL sends backend requests and health checks through an
+	// HTTP, HTTPS or SOCKS5 egress proxy instead of the HTTP_PROXY and
+	// HTTPS_PROXY environment variables. Backends whose host matches an
+	// UpstreamNoProxy entry are reached directly; entries are a host
+	// (also matching its subdomains), ".domain" (subdomains only), an IP,
+	// a CIDR or "*".
+	UpstreamProxyURL string   `yaml:"upstream_proxy_url"`
+	UpstreamNoProxy  []string `yaml:"upstream_no_proxy"`
+	// MaxResponseHeaderBytes caps the total size of backend response
+	// headers (0 = no limit). OversizedResponseHeaders picks what happens
+	// to a response over it: "reject" (default) answers 502, "strip" drops
+	// its largest headers until it fits.
+	MaxResponseHeaderBytes   int    `yaml:"max_response_header_bytes"`
+	OversizedResponseHeaders string `yaml:"oversized_response_headers"`
+	// IdempotencyTTL is how long the response to a POST or PATCH carrying
+	// an Idempotency-Key is kept and replayed to repeats of that key for
+	// the same URL instead of forwarding them. 0 disables deduplication.
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl"`
+	// ServerTiming adds a Server-Timing header with the backend request
+	// duration and cache status to responses.
+	ServerTiming bool `yaml:"server_timing"`
+	// DNSCacheTTL caches backend hostname lookups for this long instead of
+	// resolving on every dial; 0 disables the cache.
+	DNSCacheTTL time.Duration `yaml:"dns_cache_ttl"`
+}
+
+// BodyRewriteConfig replaces every occurrence of From with To in response
+// bodies whose media type matches one of ContentTypes ("text/*" matches any
+// text type).
+type BodyRewriteConfig struct {
+	ContentTypes []string `yaml:"content_types"`
+	From         string   `yaml:"from"`
+	To           string   `yaml:"to"`
+}
+
+// RetryConfig controls retrying idempotent requests on another
+// backend after a connection-level failure or a status listed in OnStatus.
+type RetryConfig struct {
+	// Attempts is how many retries one request may make; 0 disables retries.
+	Attempts int `yaml:"attempts"`
+	// BudgetRatio caps retries to this fraction of the requests seen over
+	// the last minute, so a partial outage cannot multiply backend load.
+	BudgetRatio float64 `yaml:"budget_ratio"`
+	// MinRetries per minute are allowed regardless of BudgetRatio, so low
+	// traffic can still retry.
+	MinRetries int `yaml:"min_retries"`
+	// OnStatus lists backend response statuses, e.g. 502 and 503, that are
+	// retried like connection failures. The response is discarded unless no
+	// retry is left, in which case it is passed to the client.
+	OnStatus []int `yaml:"on_status"`
+}
+
+type UpstreamConfig struct {
+	Name     string          `yaml:"name"`
+	Backends []BackendConfig `yaml:"backends"`
+	// HealthCheck overrides the top-level health_check settings for this
+	// upstream's backends; unset fields inherit them.
+	HealthCheck HealthCheckOverride `yaml:"health_check"`
+}
+
+// HealthCheckOverride holds the per-upstream health check settings. Zero
+// values inherit the top-level HealthCheckConfig.
+type HealthCheckOverride struct {
+	Interval         time.Duration     `yaml:"interval"`
+	Timeout          time.Duration     `yaml:"timeout"`
+	Endpoint         string            `yaml:"endpoint"`
+	FailureThreshold int               `yaml:"failure_threshold"`
+	RecoveryInterval time.Duration     `yaml:"recovery_interval"`
+	JSONChecks       map[string]string `yaml:"json_checks"`
+}
+
+// UpstreamHealthCheck returns the health check settings for upstream: the
+// top-level ones with the upstream's overrides applied.
+func (c *Config) UpstreamHealthCheck(upstream UpstreamConfig) HealthCheckConfig {
+	hc := c.HealthCheck
+	o := upstream.HealthCheck
+	if o.Interval > 0 {
+		hc.Interval = o.Interval
+	}
+	if o.Timeout > 0 {
+		hc.Timeout = o.Timeout
+	}
+	if o.Endpoint != "" {
+		hc.Endpoint = o.Endpoint
+	}
+	if o.FailureThreshold > 0 {
+		hc.FailureThreshold = o.FailureThreshold
+	}
+	if o.RecoveryInterval > 0 {
+		hc.RecoveryInterval = o.RecoveryInterval
+	}
+	if len(o.JSONChecks) > 0 {
+		hc.JSONChecks = o.JSONChecks
+	}
+	return hc
+}
+
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Algorithm is the preferred encoding when the client accepts several
+	// equally; defaults to gzip.
+	Algorithm string `yaml:"algorithm"`
+	// Level trades speed (1) for ratio (9); 0 uses the encoder's default.
+	Level int `yaml:"level"`
+}
+
+const (
+	CompressionGzip    = "gzip"
+	CompressionDeflate = "deflate"
+	CompressionBrotli  = "br"
+	CompressionZstd    = "zstd"
+)
+
+type HeadersConfig struct {
+	Response ResponseHeadersConfig `yaml:"response"`
+}
+
+type ResponseHeadersConfig struct {
+	Strip []string `yaml:"strip"`
+}
+
+// WebSocketConfig bounds proxied WebSocket connections.
+type WebSocketConfig struct {
+	// IdleTimeout closes a connection after no data flowed in either
+	// direction for this long. Defaults to 60s.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// MaxConnectionDuration closes a connection this long after the
+	// upgrade; 0 means no limit.
+	MaxConnectionDuration time.Duration `yaml:"max_connection_duration"`
+	// MaxMessageSize closes a connection when either side sends a message
+	// whose payload exceeds this many bytes; 0 means no limit.
+	MaxMessageSize int64 `yaml:"max_message_size"`
+}
+
+type ShadowConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	URL     string `yaml:"url"`
+	// SampleRate is the fraction of requests mirrored. It defaults to 1 when
+	// omitted; an explicit 0 mirrors nothing.
+	SampleRate float64       `yaml:"sample_rate"`
+	Timeout    time.Duration `yaml:"timeout"`
+	// MaxInFlight caps mirrored requests awaiting the shadow upstream;
+	// requests sampled past it are dropped and counted. Defaults to 100.
+	MaxInFlight int `yaml:"max_in_flight"`
+
+	sampleRateSet bool
+}
+
+// UnmarshalYAML records whether sample_rate was present, so that an explicit
+// 0 is kept rather than defaulted to 1.
+func (s *ShadowConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain ShadowConfig
+	if err := node.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "sample_rate" {
+			s.sampleRateSet = true
+		}
+	}
+	return nil
+}
+
+const (
+	NoMatchDefaultUpstream = "default_upstream"
+	NoMatchNotFound        = "404"
+	NoMatchCustom          = "custom"
+)
+
+// RoutingConfig controls requests that match none of the configured routes.
+type RoutingConfig struct {
+	NoMatch         string `yaml:"no_match"`
+	DefaultUpstream string `yaml:"default_upstream"`
+	NoMatchStatus   int    `yaml:"no_match_status"`
+	NoMatchBody     string `yaml:"no_match_body"`
+}
+
+type RouteConfig struct {
+	Name     string           `yaml:"name"`
+	Match    RouteMatchConfig `yaml:"match"`
+	Upstream string           `yaml:"upstream"`
+	Access   *AccessConfig    `yaml:"access"`
+	Auth     *AuthConfig      `yaml:"auth"`
+}
+
+type RouteMatchConfig struct {
+	PathPrefix string `yaml:"path_prefix"`
+	PathRegex  string `yaml:"path_regex"`
+	// ClientCIDRs matches the client IP against addresses and CIDR ranges.
+	ClientCIDRs []string `yaml:"client_cidrs"`
+}
+
+type AccessConfig struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// SummaryConfig controls /proxy/summary on the public listener. The endpoint
+// is answered by the proxy itself and never forwarded to a backend; when no
+// access list is configured it only admits loopback clients.
+type SummaryConfig struct {
+	Enabled bool         `yaml:"enabled"`
+	Access  AccessConfig `yaml:"access"`
+}
+
+type AuthConfig struct {
+	Realm string            `yaml:"realm"`
+	Users map[string]string `yaml:"users"`
 }
 
 type LoggingConfig struct {
-	Level  string `yaml:"level"`
-	Format string `yaml:"format"`
+	Level         string          `yaml:"level"`
+	Format        string          `yaml:"format"`
+	VerboseTiming bool            `yaml:"verbose_timing"`
+	RequestID     RequestIDConfig `yaml:"request_id"`
+}
+
+const (
+	RequestIDUniquifyNone        = "none"
+	RequestIDUniquifyAlways      = "always"
+	RequestIDUniquifyOnCollision = "on_collision"
+)
+
+// RequestIDConfig controls whether a client-supplied X-Request-Id is reused
+// and how duplicates are kept apart in logs.
+type RequestIDConfig struct {
+	// Honor reuses a valid incoming X-Request-Id instead of generating one.
+	Honor bool `yaml:"honor"`
+	// Uniquify appends a short suffix to honored IDs: on every request
+	// ("always"), only when the same ID was seen within CollisionWindow
+	// ("on_collision"), or never ("none").
+	Uniquify        string        `yaml:"uniquify"`
+	CollisionWindow time.Duration `yaml:"collision_window"`
 }
 
+const (
+	defaultMaxBackends = 256
+
+	// weightRatioWarning is the max/min backend weight ratio within a pool
+	// above which Warnings flags the pool as likely misconfigured.
+	weightRatioWarning = 100
+)
+
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -87,16 +667,64 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("server host cannot be empty")
 	}
 
-	if c.Server.HTTPPort <= 0 || c.Server.HTTPPort > 65535 {
-		return fmt.Errorf("invalid HTTP port: %d", c.Server.HTTPPort)
+	if c.Server.HTTPPort != 0 || len(c.Server.HTTPPorts) == 0 {
+		if c.Server.HTTPPort <= 0 || c.Server.HTTPPort > 65535 {
+			return fmt.Errorf("invalid HTTP port: %d", c.Server.HTTPPort)
+		}
+	}
+	for _, port := range c.Server.HTTPPorts {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid HTTP port: %d", port)
+		}
 	}
 
-	if c.Server.HTTPSPort <= 0 || c.Server.HTTPSPort > 65535 {
-		return fmt.Errorf("invalid HTTPS port: %d", c.Server.HTTPSPort)
+	if c.Server.HTTPSPort != 0 || len(c.Server.HTTPSPorts) == 0 {
+		if c.Server.HTTPSPort <= 0 || c.Server.HTTPSPort > 65535 {
+			return fmt.Errorf("invalid HTTPS port: %d", c.Server.HTTPSPort)
+		}
+	}
+	for _, port := range c.Server.HTTPSPorts {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid HTTPS port: %d", port)
+		}
 	}
 
-	if c.TLS.Enabled && c.Server.HTTPPort == c.Server.HTTPSPort {
-		return fmt.Errorf("HTTP and HTTPS ports must be different")
+	if c.TLS.Enabled {
+		for _, port := range c.Server.ListenHTTPSPorts() {
+			if slices.Contains(c.Server.ListenHTTPPorts(), port) {
+				return fmt.Errorf("HTTP and HTTPS ports must be different")
+			}
+		}
+	}
+
+	if c.Server.PingPath != "" && !strings.HasPrefix(c.Server.PingPath, "/") {
+		return fmt.Errorf("server ping_path must start with /: %q", c.Server.PingPath)
+	}
+	if c.Server.MaxRequestBody < 0 {
+		return fmt.Errorf("server max_request_body cannot be negative")
+	}
+	if c.Server.MaxHeaderBytes < 0 {
+		return fmt.Errorf("server max_header_bytes cannot be negative")
+	}
+	for i, limit := range c.Server.BodyLimits {
+		if limit.PathPrefix == "" && limit.ContentType == "" {
+			return fmt.Errorf("server body_limits[%d] needs path_prefix or content_type", i)
+		}
+		if limit.MaxBytes <= 0 {
+			return fmt.Errorf("server body_limits[%d] max_bytes must be positive", i)
+		}
+	}
+
+	if c.Server.SessionAffinity.MaxAge < 0 {
+		return fmt.Errorf("server session_affinity max_age cannot be negative")
+	}
+	for i, local := range c.Server.LocalPaths {
+		if !strings.HasPrefix(local.Path, "/") {
+			return fmt.Errorf("server local_paths[%d] path must start with /: %q", i, local.Path)
+		}
+		if local.Status != 0 && (local.Status < 200 || local.Status > 599) {
+			return fmt.Errorf("invalid server local_paths[%d] status: %d", i, local.Status)
+		}
 	}
 
 	if len(c.Backends) == 0 {
@@ -107,9 +735,46 @@ func (c *Config) Validate() error {
 		if backend.URL == "" {
 			return fmt.Errorf("backend %d: URL cannot be empty", i)
 		}
-		if backend.Weight <= 0 {
+		if !backend.validWeight() {
 			return fmt.Errorf("backend %d: weight must be positive", i)
 		}
+		if backend.Priority < 0 {
+			return fmt.Errorf("backend %d: priority cannot be negative", i)
+		}
+	}
+	if c.BackendsDefaultWeight < 0 {
+		return fmt.Errorf("backends_default_weight must be positive")
+	}
+	switch c.Balancer {
+	case "", BalancerRoundRobin, BalancerLeastConn, BalancerIPHash:
+	default:
+		return fmt.Errorf("balancer must be %s, %s or %s, got %q", BalancerRoundRobin, BalancerLeastConn, BalancerIPHash, c.Balancer)
+	}
+	if c.SlowBackendPenalty != 0 {
+		if c.SlowBackendPenalty < 1 {
+			return fmt.Errorf("slow_backend_penalty must be at least 1 (or 0 to disable)")
+		}
+		if c.Balancer != "" && c.Balancer != BalancerRoundRobin {
+			return fmt.Errorf("slow_backend_penalty only applies to the %s balancer", BalancerRoundRobin)
+		}
+	}
+
+	if c.Server.MaxConnsPerIP < 0 {
+		return fmt.Errorf("server max_conns_per_ip cannot be negative")
+	}
+	if c.Server.MaxBackends < 0 {
+		return fmt.Errorf("server max_backends cannot be negative")
+	}
+	maxBackends := c.Server.MaxBackends
+	if maxBackends == 0 {
+		maxBackends = defaultMaxBackends
+	}
+	total := len(c.Backends)
+	for _, upstream := range c.Upstreams {
+		total += len(upstream.Backends)
+	}
+	if total > maxBackends {
+		return fmt.Errorf("too many backends: %d configured, max_backends is %d", total, maxBackends)
 	}
 
 	if c.TLS.Enabled {
@@ -125,6 +790,30 @@ func (c *Config) Validate() error {
 		if _, err := os.Stat(c.TLS.KeyFile); os.IsNotExist(err) {
 			return fmt.Errorf("TLS key file does not exist: %s", c.TLS.KeyFile)
 		}
+		if c.TLS.SessionTicketRotation < 0 {
+			return fmt.Errorf("TLS session_ticket_rotation must not be negative")
+		}
+		if c.TLS.DisableSessionTickets && c.TLS.SessionTicketRotation > 0 {
+			return fmt.Errorf("TLS session_ticket_rotation has no effect when session tickets are disabled")
+		}
+		for _, proto := range c.TLS.ALPNProtocols {
+			if proto != "h2" && proto != "http/1.1" {
+				return fmt.Errorf("TLS alpn_protocols: unsupported protocol %q", proto)
+			}
+		}
+		if c.TLS.MinVersion != "" {
+			if _, err := tlsconfig.ParseVersion(c.TLS.MinVersion); err != nil {
+				return fmt.Errorf("TLS min_version: %w", err)
+			}
+		}
+		for port, version := range c.TLS.MinVersionByPort {
+			if !slices.Contains(c.Server.ListenHTTPSPorts(), port) {
+				return fmt.Errorf("TLS min_version_by_port: port %d is not an HTTPS port", port)
+			}
+			if _, err := tlsconfig.ParseVersion(version); err != nil {
+				return fmt.Errorf("TLS min_version_by_port[%d]: %w", port, err)
+			}
+		}
 	}
 
 	if c.HealthCheck.Interval <= 0 {
@@ -140,9 +829,302 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("health check recovery interval must be positive")
 	}
 
+	if c.HealthCheck.MinHealthy < 0 {
+		return fmt.Errorf("health check min_healthy cannot be negative")
+	}
+	if c.HealthCheck.MinHealthy > len(c.Backends) {
+		return fmt.Errorf("health check min_healthy (%d) exceeds number of backends (%d)", c.HealthCheck.MinHealthy, len(c.Backends))
+	}
+
+	if c.HealthCheck.WebhookTimeout < 0 {
+		return fmt.Errorf("health check webhook timeout cannot be negative")
+	}
+	if _, err := health.NewJSONMatcher(c.HealthCheck.JSONChecks); err != nil {
+		return fmt.Errorf("health_check json_checks: %w", err)
+	}
+	if c.HealthCheck.WebhookRetries < 0 {
+		return fmt.Errorf("health check webhook retries cannot be negative")
+	}
+	for tier, interval := range c.HealthCheck.TierIntervals {
+		if tier < 0 || interval <= 0 {
+			return fmt.Errorf("health check tier_intervals: tier %d needs a non-negative tier and a positive interval", tier)
+		}
+	}
+
+	for status, ttl := range c.Cache.TTLByStatus {
+		if !validStatusKey(status) {
+			return fmt.Errorf("cache ttl_by_status: invalid status %q", status)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("cache ttl_by_status: TTL for %s must be positive", status)
+		}
+	}
+	switch c.Cache.Backend {
+	case "", "memory":
+	case "redis":
+		if c.Cache.Redis.Addr == "" {
+			return fmt.Errorf("cache redis addr is required when backend is redis")
+		}
+		if c.Cache.Redis.DB < 0 || c.Cache.Redis.Timeout < 0 {
+			return fmt.Errorf("cache redis db and timeout cannot be negative")
+		}
+	default:
+		return fmt.Errorf("invalid cache backend: %q", c.Cache.Backend)
+	}
+	if c.Cache.Prefetch.MaxConcurrent < 0 {
+		return fmt.Errorf("cache prefetch max_concurrent cannot be negative")
+	}
+	if c.Cache.MaxConcurrentWrites < 0 {
+		return fmt.Errorf("cache max_concurrent_writes cannot be negative")
+	}
 	if c.Cache.TTL < 0 {
 		return fmt.Errorf("cache TTL cannot be negative")
 	}
+	if c.Cache.CleanupInterval < 0 || c.Cache.ExpiredRetention < 0 {
+		return fmt.Errorf("cache cleanup_interval and expired_retention cannot be negative")
+	}
+	if c.Cache.MaxEntries < 0 || c.Cache.MaxBytes < 0 {
+		return fmt.Errorf("cache max_entries and max_bytes cannot be negative")
+	}
+
+	if c.CircuitBreaker.FailureThreshold < 0 {
+		return fmt.Errorf("circuit breaker failure threshold cannot be negative")
+	}
+	if c.CircuitBreaker.OpenTimeout < 0 {
+		return fmt.Errorf("circuit breaker open timeout cannot be negative")
+	}
+
+	if _, err := access.NewMatcher(c.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("server trusted_proxies: %w", err)
+	}
+
+	if c.Summary.Enabled {
+		if _, err := access.NewPolicy(c.Summary.Access.Allow, c.Summary.Access.Deny); err != nil {
+			return fmt.Errorf("summary: access: %w", err)
+		}
+	}
+
+	if c.Admin.Enabled {
+		if c.Admin.Port < 0 || c.Admin.Port > 65535 {
+			return fmt.Errorf("invalid admin port: %d", c.Admin.Port)
+		}
+		if slices.Contains(c.Server.ListenHTTPPorts(), c.Admin.Port) || (c.TLS.Enabled && slices.Contains(c.Server.ListenHTTPSPorts(), c.Admin.Port)) {
+			return fmt.Errorf("admin port must differ from HTTP and HTTPS ports")
+		}
+		if c.Admin.TopClients.Capacity < 0 {
+			return fmt.Errorf("admin top_clients capacity cannot be negative")
+		}
+	}
+
+	if c.Proxy.StreamThreshold < 0 {
+		return fmt.Errorf("proxy stream threshold cannot be negative")
+	}
+	if c.Proxy.LatencyAlertThreshold < 0 {
+		return fmt.Errorf("proxy latency alert threshold cannot be negative")
+	}
+	if c.Proxy.ExpectContinueTimeout < 0 {
+		return fmt.Errorf("proxy expect continue timeout cannot be negative")
+	}
+	if c.Proxy.MaxGlobalConcurrent < 0 {
+		return fmt.Errorf("proxy max global concurrent cannot be negative")
+	}
+	if c.Proxy.GlobalConcurrentWait < 0 {
+		return fmt.Errorf("proxy global concurrent wait cannot be negative")
+	}
+	if c.Proxy.DialTimeout < 0 || c.Proxy.TLSHandshakeTimeout < 0 || c.Proxy.ResponseHeaderTimeout < 0 || c.Proxy.RequestTimeout < 0 {
+		return fmt.Errorf("proxy dial, TLS handshake, response header and request timeouts cannot be negative")
+	}
+	if c.Proxy.MaxHops < 0 {
+		return fmt.Errorf("proxy max_hops cannot be negative")
+	}
+	if c.Proxy.MinIdleConnsPerBackend < 0 {
+		return fmt.Errorf("proxy min_idle_conns_per_backend cannot be negative")
+	}
+	if c.Proxy.MaxIdleConns < 0 || c.Proxy.MaxIdleConnsPerHost < 0 || c.Proxy.IdleConnTimeout < 0 {
+		return fmt.Errorf("proxy max_idle_conns, max_idle_conns_per_host and idle_conn_timeout cannot be negative")
+	}
+	if c.Proxy.UpstreamProxyURL != "" {
+		u, err := url.Parse(c.Proxy.UpstreamProxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy upstream_proxy_url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			return fmt.Errorf("proxy upstream_proxy_url must use http, https or socks5, got %q", u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("proxy upstream_proxy_url must include a host")
+		}
+	}
+	for _, entry := range c.Proxy.UpstreamNoProxy {
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("invalid proxy upstream_no_proxy entry %q: %w", entry, err)
+			}
+		}
+	}
+	if c.Proxy.MaxConnsPerHost < 0 {
+		return fmt.Errorf("proxy max_conns_per_host cannot be negative")
+	}
+	if c.Proxy.MaxConnsPerHost > 0 && c.Proxy.MinIdleConnsPerBackend > c.Proxy.MaxConnsPerHost {
+		return fmt.Errorf("proxy min_idle_conns_per_backend cannot exceed max_conns_per_host")
+	}
+	if c.Proxy.DisableKeepAlives && c.Proxy.MinIdleConnsPerBackend > 0 {
+		return fmt.Errorf("proxy min_idle_conns_per_backend requires keep-alives")
+	}
+	if c.Proxy.DNSCacheTTL < 0 {
+		return fmt.Errorf("proxy dns_cache_ttl cannot be negative")
+	}
+	if c.Proxy.IdempotencyTTL < 0 {
+		return fmt.Errorf("proxy idempotency_ttl cannot be negative")
+	}
+	if c.Proxy.MaxResponseHeaderBytes < 0 {
+		return fmt.Errorf("proxy max_response_header_bytes cannot be negative")
+	}
+	switch c.Proxy.OversizedResponseHeaders {
+	case "", "reject", "strip":
+	default:
+		return fmt.Errorf("invalid proxy oversized_response_headers: %q (expected reject or strip)", c.Proxy.OversizedResponseHeaders)
+	}
+	if c.Proxy.StripGetBody && c.Proxy.RejectGetBody {
+		return fmt.Errorf("proxy strip_get_body and reject_get_body are mutually exclusive")
+	}
+	for i, rule := range c.Proxy.BodyRewrite {
+		if rule.From == "" {
+			return fmt.Errorf("proxy body_rewrite[%d] from cannot be empty", i)
+		}
+		if len(rule.ContentTypes) == 0 {
+			return fmt.Errorf("proxy body_rewrite[%d] needs at least one content type", i)
+		}
+	}
+	if c.Proxy.Retry.Attempts < 0 || c.Proxy.Retry.MinRetries < 0 {
+		return fmt.Errorf("proxy retry attempts and min_retries cannot be negative")
+	}
+	if c.Proxy.Retry.BudgetRatio < 0 || c.Proxy.Retry.BudgetRatio > 1 {
+		return fmt.Errorf("proxy retry budget_ratio must be between 0.0 and 1.0")
+	}
+	for _, status := range c.Proxy.Retry.OnStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("proxy retry on_status has invalid status %d", status)
+		}
+	}
+	for _, method := range c.Proxy.AllowedMethods {
+		if method == "" || method != strings.ToUpper(method) || strings.ContainsAny(method, " ,") {
+			return fmt.Errorf("proxy allowed_methods: invalid method %q", method)
+		}
+	}
+
+	upstreams := make(map[string]bool, len(c.Upstreams))
+	for i, upstream := range c.Upstreams {
+		if upstream.Name == "" {
+			return fmt.Errorf("upstream %d: name cannot be empty", i)
+		}
+		if upstreams[upstream.Name] {
+			return fmt.Errorf("upstream %d: duplicate name %q", i, upstream.Name)
+		}
+		upstreams[upstream.Name] = true
+
+		if len(upstream.Backends) == 0 {
+			return fmt.Errorf("upstream %s: at least one backend is required", upstream.Name)
+		}
+		for j, backend := range upstream.Backends {
+			if backend.URL == "" {
+				return fmt.Errorf("upstream %s: backend %d: URL cannot be empty", upstream.Name, j)
+			}
+			if !backend.validWeight() {
+				return fmt.Errorf("upstream %s: backend %d: weight must be positive", upstream.Name, j)
+			}
+			if backend.Priority < 0 {
+				return fmt.Errorf("upstream %s: backend %d: priority cannot be negative", upstream.Name, j)
+			}
+		}
+
+		hc := upstream.HealthCheck
+		if hc.Interval < 0 || hc.Timeout < 0 || hc.FailureThreshold < 0 || hc.RecoveryInterval < 0 {
+			return fmt.Errorf("upstream %s: health_check interval, timeout, failure_threshold and recovery_interval cannot be negative", upstream.Name)
+		}
+		if _, err := health.NewJSONMatcher(hc.JSONChecks); err != nil {
+			return fmt.Errorf("upstream %s: health_check json_checks: %w", upstream.Name, err)
+		}
+	}
+
+	for i, route := range c.Routes {
+		if route.Match.PathPrefix == "" && route.Match.PathRegex == "" && len(route.Match.ClientCIDRs) == 0 {
+			return fmt.Errorf("route %d: match requires path_prefix, path_regex or client_cidrs", i)
+		}
+		if _, err := access.NewMatcher(route.Match.ClientCIDRs); err != nil {
+			return fmt.Errorf("route %d: client_cidrs: %w", i, err)
+		}
+		if route.Match.PathRegex != "" {
+			if _, err := regexp.Compile(route.Match.PathRegex); err != nil {
+				return fmt.Errorf("route %d: invalid path_regex %q: %w", i, route.Match.PathRegex, err)
+			}
+		}
+		if route.Upstream != "" && !upstreams[route.Upstream] {
+			return fmt.Errorf("route %d: unknown upstream %q", i, route.Upstream)
+		}
+		if route.Access != nil {
+			if _, err := access.NewPolicy(route.Access.Allow, route.Access.Deny); err != nil {
+				return fmt.Errorf("route %d: access: %w", i, err)
+			}
+		}
+		if route.Auth != nil && len(route.Auth.Users) == 0 {
+			return fmt.Errorf("route %d: auth requires at least one user", i)
+		}
+	}
+
+	switch c.Routing.NoMatch {
+	case "", NoMatchDefaultUpstream, NoMatchNotFound, NoMatchCustom:
+	default:
+		return fmt.Errorf("invalid routing no_match action: %q", c.Routing.NoMatch)
+	}
+	if c.Routing.DefaultUpstream != "" && !upstreams[c.Routing.DefaultUpstream] {
+		return fmt.Errorf("routing: unknown default upstream %q", c.Routing.DefaultUpstream)
+	}
+	if c.Routing.NoMatchStatus != 0 && (c.Routing.NoMatchStatus < 200 || c.Routing.NoMatchStatus > 599) {
+		return fmt.Errorf("invalid routing no_match_status: %d", c.Routing.NoMatchStatus)
+	}
+
+	switch c.Logging.RequestID.Uniquify {
+	case "", RequestIDUniquifyNone, RequestIDUniquifyAlways, RequestIDUniquifyOnCollision:
+	default:
+		return fmt.Errorf("invalid logging request_id uniquify mode: %q", c.Logging.RequestID.Uniquify)
+	}
+	if c.Logging.RequestID.CollisionWindow < 0 {
+		return fmt.Errorf("logging request_id collision_window must not be negative")
+	}
+
+	if c.Shadow.Enabled && c.Shadow.URL == "" {
+		return fmt.Errorf("shadow url is required when shadow traffic is enabled")
+	}
+	if c.Shadow.SampleRate < 0 || c.Shadow.SampleRate > 1 {
+		return fmt.Errorf("shadow sample_rate must be between 0.0 and 1.0")
+	}
+	if c.Shadow.Timeout < 0 {
+		return fmt.Errorf("shadow timeout cannot be negative")
+	}
+	if c.Shadow.MaxInFlight < 0 {
+		return fmt.Errorf("shadow max_in_flight cannot be negative")
+	}
+
+	if c.Cache.MaxStaleAge < 0 {
+		return fmt.Errorf("cache max_stale_age cannot be negative")
+	}
+
+	switch c.Compression.Algorithm {
+	case "", CompressionGzip, CompressionDeflate, CompressionBrotli, CompressionZstd:
+	default:
+		return fmt.Errorf("unknown compression algorithm %q", c.Compression.Algorithm)
+	}
+	if c.Compression.Level < 0 || c.Compression.Level > 9 {
+		return fmt.Errorf("compression level must be between 1 and 9, or 0 for the default")
+	}
+
+	if c.WebSocket.IdleTimeout < 0 || c.WebSocket.MaxConnectionDuration < 0 {
+		return fmt.Errorf("websocket idle_timeout and max_connection_duration cannot be negative")
+	}
+	if c.WebSocket.MaxMessageSize < 0 {
+		return fmt.Errorf("websocket max_message_size cannot be negative")
+	}
 
 	if c.RateLimit.RequestsPerMinute <= 0 {
 		return fmt.Errorf("rate limit requests per minute must be positive")
@@ -150,15 +1132,118 @@ func (c *Config) Validate() error {
 	if c.RateLimit.Burst <= 0 {
 		return fmt.Errorf("rate limit burst must be positive")
 	}
+	if c.RateLimit.MaxClients < 0 || c.RateLimit.OverflowRequestsPerMinute < 0 || c.RateLimit.OverflowBurst < 0 {
+		return fmt.Errorf("rate limit max_clients, overflow_requests_per_minute and overflow_burst cannot be negative")
+	}
+	if _, err := access.NewMatcher(c.RateLimit.Allowlist); err != nil {
+		return fmt.Errorf("rate limit allowlist: %w", err)
+	}
+	switch c.RateLimit.Algorithm {
+	case "", RateLimitTokenBucket, RateLimitSlidingWindow:
+	default:
+		return fmt.Errorf("rate limit algorithm must be %s or %s, got %q", RateLimitTokenBucket, RateLimitSlidingWindow, c.RateLimit.Algorithm)
+	}
+	switch c.RateLimit.Scope {
+	case "", "per_ip":
+	case "global":
+		if c.RateLimit.Fingerprint.Enabled {
+			return fmt.Errorf("rate limit fingerprint has no effect with the global scope")
+		}
+	default:
+		return fmt.Errorf("rate limit scope must be per_ip or global, got %q", c.RateLimit.Scope)
+	}
 
 	return nil
 }
 
+// validStatusKey accepts a status code such as "301" or a class such as "3xx".
+func validStatusKey(key string) bool {
+	if len(key) != 3 || key[0] < '1' || key[0] > '5' {
+		return false
+	}
+	if key[1:] == "xx" {
+		return true
+	}
+	code, err := strconv.Atoi(key)
+	return err == nil && code >= 100
+}
+
+// Warnings reports configuration that is valid but probably a mistake, such
+// as a pool whose backend weights differ by orders of magnitude.
+func (c *Config) Warnings() []string {
+	var warnings []string
+
+	if w := weightImbalance("backends", c.Backends); w != "" {
+		warnings = append(warnings, w)
+	}
+	for _, upstream := range c.Upstreams {
+		if w := weightImbalance("upstream "+upstream.Name, upstream.Backends); w != "" {
+			warnings = append(warnings, w)
+		}
+	}
+
+	return warnings
+}
+
+func weightImbalance(pool string, backends []BackendConfig) string {
+	if len(backends) < 2 {
+		return ""
+	}
+
+	lightest, heaviest := backends[0], backends[0]
+	for _, b := range backends[1:] {
+		if b.Weight < lightest.Weight {
+			lightest = b
+		}
+		if b.Weight > heaviest.Weight {
+			heaviest = b
+		}
+	}
+
+	if lightest.Weight <= 0 || heaviest.Weight/lightest.Weight < weightRatioWarning {
+		return ""
+	}
+	return fmt.Sprintf("%s: weight of %s (%g) is %.0fx that of %s (%g)",
+		pool, heaviest.URL, heaviest.Weight, heaviest.Weight/lightest.Weight, lightest.URL, lightest.Weight)
+}
+
+// defaultWeights gives backends that omitted weight the configured default.
+func (c *Config) defaultWeights(backends []BackendConfig) {
+	for i := range backends {
+		if backends[i].Weight == 0 {
+			backends[i].Weight = c.BackendsDefaultWeight
+		}
+	}
+}
+
 func (c *Config) setDefaults() {
-	if c.Server.HTTPPort == 0 {
+	if c.Server.MaxBackends == 0 {
+		c.Server.MaxBackends = defaultMaxBackends
+	}
+
+	if c.BackendsDefaultWeight == 0 {
+		c.BackendsDefaultWeight = 1
+	}
+	if c.Balancer == "" {
+		c.Balancer = BalancerRoundRobin
+	}
+	if c.Server.SessionAffinity.CookieName == "" {
+		c.Server.SessionAffinity.CookieName = "PROXYKP_BACKEND"
+	}
+	for i := range c.Server.LocalPaths {
+		if c.Server.LocalPaths[i].Status == 0 {
+			c.Server.LocalPaths[i].Status = 204
+		}
+	}
+	c.defaultWeights(c.Backends)
+	for _, upstream := range c.Upstreams {
+		c.defaultWeights(upstream.Backends)
+	}
+
+	if c.Server.HTTPPort == 0 && len(c.Server.HTTPPorts) == 0 {
 		c.Server.HTTPPort = 8080
 	}
-	if c.Server.HTTPSPort == 0 {
+	if c.Server.HTTPSPort == 0 && len(c.Server.HTTPSPorts) == 0 {
 		c.Server.HTTPSPort = 8443
 	}
 
@@ -185,9 +1270,34 @@ func (c *Config) setDefaults() {
 		c.HealthCheck.RecoveryInterval = 15 * time.Second
 	}
 
+	if c.HealthCheck.WebhookTimeout == 0 {
+		c.HealthCheck.WebhookTimeout = 5 * time.Second
+	}
+
 	if c.Cache.TTL == 0 {
 		c.Cache.TTL = 60 * time.Second
 	}
+	if c.Cache.CleanupInterval == 0 {
+		c.Cache.CleanupInterval = time.Minute
+	}
+	if c.Cache.ExpiredRetention == 0 {
+		c.Cache.ExpiredRetention = c.Cache.MaxStaleAge
+		if c.Cache.ExpiredRetention == 0 {
+			c.Cache.ExpiredRetention = c.Cache.TTL
+		}
+	}
+	if c.Cache.Backend == "" {
+		c.Cache.Backend = "memory"
+	}
+	if c.Cache.Redis.KeyPrefix == "" {
+		c.Cache.Redis.KeyPrefix = "proxy-kp:"
+	}
+	if c.Cache.Redis.Timeout == 0 {
+		c.Cache.Redis.Timeout = 500 * time.Millisecond
+	}
+	if c.Cache.Prefetch.MaxConcurrent == 0 {
+		c.Cache.Prefetch.MaxConcurrent = 4
+	}
 
 	if c.RateLimit.RequestsPerMinute == 0 {
 		c.RateLimit.RequestsPerMinute = 600
@@ -195,6 +1305,113 @@ func (c *Config) setDefaults() {
 	if c.RateLimit.Burst == 0 {
 		c.RateLimit.Burst = 100
 	}
+	if c.RateLimit.Algorithm == "" {
+		c.RateLimit.Algorithm = RateLimitTokenBucket
+	}
+	if c.RateLimit.Scope == "" {
+		c.RateLimit.Scope = "per_ip"
+	}
+	if c.RateLimit.OverflowRequestsPerMinute == 0 {
+		c.RateLimit.OverflowRequestsPerMinute = c.RateLimit.RequestsPerMinute
+	}
+	if c.RateLimit.OverflowBurst == 0 {
+		c.RateLimit.OverflowBurst = c.RateLimit.Burst
+	}
+
+	if c.CircuitBreaker.FailureThreshold == 0 {
+		c.CircuitBreaker.FailureThreshold = 5
+	}
+	if c.CircuitBreaker.OpenTimeout == 0 {
+		c.CircuitBreaker.OpenTimeout = 30 * time.Second
+	}
+
+	if c.Admin.Host == "" {
+		c.Admin.Host = "127.0.0.1"
+	}
+	if c.Admin.Port == 0 {
+		c.Admin.Port = 9090
+	}
+	if c.Admin.AuditLog == "" {
+		c.Admin.AuditLog = "stdout"
+	}
+	if c.Admin.TopClients.Capacity == 0 {
+		c.Admin.TopClients.Capacity = 1000
+	}
+
+	if len(c.Summary.Access.Allow) == 0 && len(c.Summary.Access.Deny) == 0 {
+		c.Summary.Access.Allow = []string{"127.0.0.1", "::1"}
+	}
+
+	if c.Proxy.StreamThreshold == 0 {
+		c.Proxy.StreamThreshold = 1 << 20
+	}
+	if c.Proxy.ExpectContinueTimeout == 0 {
+		c.Proxy.ExpectContinueTimeout = time.Second
+	}
+	if c.Proxy.GlobalConcurrentWait == 0 {
+		c.Proxy.GlobalConcurrentWait = 100 * time.Millisecond
+	}
+	if len(c.Proxy.AllowedMethods) == 0 {
+		c.Proxy.AllowedMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	}
+	if c.Proxy.DialTimeout == 0 {
+		c.Proxy.DialTimeout = 30 * time.Second
+	}
+	if c.Proxy.TLSHandshakeTimeout == 0 {
+		c.Proxy.TLSHandshakeTimeout = 10 * time.Second
+	}
+	if c.Proxy.RequestTimeout == 0 {
+		c.Proxy.RequestTimeout = 30 * time.Second
+	}
+	if c.Proxy.MaxIdleConns == 0 {
+		c.Proxy.MaxIdleConns = 100
+	}
+	if c.Proxy.MaxIdleConnsPerHost == 0 {
+		c.Proxy.MaxIdleConnsPerHost = 32
+	}
+	if c.Proxy.OversizedResponseHeaders == "" {
+		c.Proxy.OversizedResponseHeaders = "reject"
+	}
+	if c.Proxy.IdleConnTimeout == 0 {
+		c.Proxy.IdleConnTimeout = 50 * time.Second
+	}
+	if c.Proxy.MaxConnsPerHost == 0 {
+		c.Proxy.MaxConnsPerHost = max(256, c.Proxy.MinIdleConnsPerBackend)
+	}
+	if c.Proxy.Retry.BudgetRatio == 0 {
+		c.Proxy.Retry.BudgetRatio = 0.2
+	}
+	if c.Proxy.Retry.MinRetries == 0 {
+		c.Proxy.Retry.MinRetries = 3
+	}
+
+	if c.Compression.Algorithm == "" {
+		c.Compression.Algorithm = CompressionGzip
+	}
+
+	if c.WebSocket.IdleTimeout == 0 {
+		c.WebSocket.IdleTimeout = 60 * time.Second
+	}
+
+	if c.Routing.NoMatch == "" {
+		c.Routing.NoMatch = NoMatchDefaultUpstream
+	}
+	if c.Routing.NoMatchStatus == 0 || c.Routing.NoMatch == NoMatchNotFound {
+		c.Routing.NoMatchStatus = 404
+	}
+	if c.Routing.NoMatchBody == "" {
+		c.Routing.NoMatchBody = "Not Found"
+	}
+
+	if c.Shadow.SampleRate == 0 && !c.Shadow.sampleRateSet {
+		c.Shadow.SampleRate = 1
+	}
+	if c.Shadow.Timeout == 0 {
+		c.Shadow.Timeout = 10 * time.Second
+	}
+	if c.Shadow.MaxInFlight == 0 {
+		c.Shadow.MaxInFlight = 100
+	}
 
 	if c.Logging.Level == "" {
 		c.Logging.Level = "info"
@@ -202,4 +1419,10 @@ func (c *Config) setDefaults() {
 	if c.Logging.Format == "" {
 		c.Logging.Format = "json"
 	}
+	if c.Logging.RequestID.Uniquify == "" {
+		c.Logging.RequestID.Uniquify = RequestIDUniquifyOnCollision
+	}
+	if c.Logging.RequestID.CollisionWindow == 0 {
+		c.Logging.RequestID.CollisionWindow = 10 * time.Second
+	}
 }
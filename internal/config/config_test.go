@@ -0,0 +1,460 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const baseConfig = `
+server:
+  host: "127.0.0.1"
+  http_port: 8080
+  https_port: 8443
+backends:
+  - url: "http://localhost:8001"
+    weight: 1
+health_check:
+  interval: 5s
+  timeout: 2s
+  failure_threshold: 3
+  recovery_interval: 15s
+rate_limit:
+  requests_per_minute: 600
+  burst: 100
+`
+
+func writeConfig(t *testing.T, extra string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(baseConfig+extra), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoad_Base(t *testing.T) {
+	cfg, err := Load(writeConfig(t, ""))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Backends) != 1 {
+		t.Errorf("Expected 1 backend, got %d", len(cfg.Backends))
+	}
+	if cfg.Proxy.MaxConnsPerHost != 256 || cfg.Proxy.IdleConnTimeout != 50*time.Second {
+		t.Errorf("Expected backend pool defaults of 256 conns and 50s idle timeout, got %d and %v",
+			cfg.Proxy.MaxConnsPerHost, cfg.Proxy.IdleConnTimeout)
+	}
+}
+
+func TestLoad_InvalidRouteRegex(t *testing.T) {
+	_, err := Load(writeConfig(t, `
+routes:
+  - name: broken
+    match:
+      path_regex: "^/images/(.*"
+`))
+	if err == nil {
+		t.Fatal("Expected invalid regex to fail validation")
+	}
+	if !strings.Contains(err.Error(), "^/images/(.*") {
+		t.Errorf("Expected error to name the offending pattern, got %v", err)
+	}
+}
+
+func TestLoad_RouteUnknownUpstream(t *testing.T) {
+	_, err := Load(writeConfig(t, `
+routes:
+  - match:
+      path_prefix: "/images"
+    upstream: images
+`))
+	if err == nil {
+		t.Fatal("Expected unknown upstream to fail validation")
+	}
+}
+
+func TestLoad_RoutingDefaults(t *testing.T) {
+	cfg, err := Load(writeConfig(t, ""))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Routing.NoMatch != NoMatchDefaultUpstream {
+		t.Errorf("Expected no_match default %q, got %q", NoMatchDefaultUpstream, cfg.Routing.NoMatch)
+	}
+	if cfg.Routing.NoMatchStatus != 404 || cfg.Routing.NoMatchBody != "Not Found" {
+		t.Errorf("Unexpected no-match response defaults: %d %q", cfg.Routing.NoMatchStatus, cfg.Routing.NoMatchBody)
+	}
+}
+
+func TestLoad_RoutingInvalidNoMatch(t *testing.T) {
+	_, err := Load(writeConfig(t, `
+routing:
+  no_match: redirect
+`))
+	if err == nil {
+		t.Fatal("Expected unknown no_match action to fail validation")
+	}
+}
+
+func TestLoad_MaxBackendsExceeded(t *testing.T) {
+	_, err := Load(writeConfig(t, `
+upstreams:
+  - name: images
+    backends:
+      - url: "http://localhost:8002"
+        weight: 1
+      - url: "http://localhost:8003"
+        weight: 1
+`))
+	if err != nil {
+		t.Fatalf("Load failed under the default cap: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := strings.Replace(baseConfig, "https_port: 8443", "https_port: 8443\n  max_backends: 2", 1) + `
+upstreams:
+  - name: images
+    backends:
+      - url: "http://localhost:8002"
+        weight: 1
+      - url: "http://localhost:8003"
+        weight: 1
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	_, err = Load(path)
+	if err == nil {
+		t.Fatal("Expected exceeding max_backends to fail validation")
+	}
+	if !strings.Contains(err.Error(), "max_backends") {
+		t.Errorf("Expected error to mention max_backends, got %v", err)
+	}
+}
+
+func TestWarnings_WeightImbalance(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `
+upstreams:
+  - name: api
+    backends:
+      - url: "http://localhost:8002"
+        weight: 1000
+      - url: "http://localhost:8003"
+        weight: 1
+`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	warnings := cfg.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %v", warnings)
+	}
+	if !strings.Contains(warnings[0], "upstream api") || !strings.Contains(warnings[0], "1000x") {
+		t.Errorf("Expected warning to name the pool and ratio, got %q", warnings[0])
+	}
+}
+
+func TestWarnings_BalancedWeights(t *testing.T) {
+	cfg, err := Load(writeConfig(t, ""))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if warnings := cfg.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+}
+
+func TestLoad_CacheTTLByStatus(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `
+cache:
+  enabled: true
+  ttl_by_status:
+    "301": 6h
+    "4xx": 10s
+`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Cache.TTLByStatus["301"] != 6*time.Hour {
+		t.Errorf("Expected 301 TTL of 6h, got %v", cfg.Cache.TTLByStatus["301"])
+	}
+
+	_, err = Load(writeConfig(t, `
+cache:
+  ttl_by_status:
+    "3x": 1h
+`))
+	if err == nil {
+		t.Fatal("Expected invalid status key to fail validation")
+	}
+}
+
+func TestLoad_FractionalWeights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := strings.Replace(baseConfig, "weight: 1", "weight: 1.5", 1)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Backends[0].Weight != 1.5 {
+		t.Errorf("Expected weight 1.5, got %v", cfg.Backends[0].Weight)
+	}
+
+	data = strings.Replace(baseConfig, "weight: 1", "weight: -0.5", 1)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Expected negative weight to fail validation")
+	}
+}
+
+func TestLoad_OmittedWeightsDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+
+	write(strings.Replace(baseConfig, "    weight: 1\n", "", 1) +
+		"upstreams:\n  - name: images\n    backends:\n      - url: \"http://localhost:8004\"\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Backends[0].Weight != 1 {
+		t.Errorf("Expected omitted weight to default to 1, got %v", cfg.Backends[0].Weight)
+	}
+	if w := cfg.Upstreams[0].Backends[0].Weight; w != 1 {
+		t.Errorf("Expected omitted upstream weight to default to 1, got %v", w)
+	}
+
+	write(strings.Replace(baseConfig, "    weight: 1\n", "", 1) + "backends_default_weight: 5\n")
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Backends[0].Weight != 5 {
+		t.Errorf("Expected configured default weight 5, got %v", cfg.Backends[0].Weight)
+	}
+
+	write(strings.Replace(baseConfig, "weight: 1", "weight: 0", 1))
+	if _, err := Load(path); err == nil {
+		t.Error("Expected explicit zero weight to fail validation")
+	}
+}
+
+func TestLoad_CacheBackend(t *testing.T) {
+	cfg, err := Load(writeConfig(t, ""))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Cache.Backend != "memory" {
+		t.Errorf("Expected memory cache by default, got %q", cfg.Cache.Backend)
+	}
+
+	if _, err := Load(writeConfig(t, `
+cache:
+  backend: redis
+`)); err == nil {
+		t.Error("Expected redis backend without addr to fail validation")
+	}
+
+	if _, err := Load(writeConfig(t, `
+cache:
+  backend: memcached
+`)); err == nil {
+		t.Error("Expected unknown cache backend to fail validation")
+	}
+}
+
+func TestLoad_SummaryAccess(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "summary:\n  enabled: true\n"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Summary.Access.Allow) != 2 {
+		t.Errorf("Expected summary to default to loopback, got %v", cfg.Summary.Access.Allow)
+	}
+
+	if _, err := Load(writeConfig(t, "summary:\n  enabled: true\n  access:\n    allow: [\"not-an-ip\"]\n")); err == nil {
+		t.Error("Expected invalid summary allow entry to be rejected")
+	}
+}
+
+func TestLoad_MultiplePorts(t *testing.T) {
+	cfg, err := Load(writeConfig(t, ""))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if ports := cfg.Server.ListenHTTPPorts(); len(ports) != 1 || ports[0] != 8080 {
+		t.Errorf("Expected only http_port without http_ports, got %v", ports)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := strings.Replace(baseConfig, "  http_port: 8080\n", "  http_ports: [80, 8080, 80]\n", 1)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if ports := cfg.Server.ListenHTTPPorts(); len(ports) != 2 || ports[0] != 80 || ports[1] != 8080 {
+		t.Errorf("Expected http_ports [80 8080] without duplicates, got %v", ports)
+	}
+
+	if _, err := Load(writeConfig(t, "admin:\n  enabled: true\n  port: 8080\n")); err == nil {
+		t.Error("Expected admin port colliding with an HTTP port to fail validation")
+	}
+}
+
+func TestLoad_HealthCheckJSONChecks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(checks string) {
+		t.Helper()
+		data := strings.Replace(baseConfig, "  recovery_interval: 15s\n", "  recovery_interval: 15s\n  json_checks:\n"+checks, 1)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+
+	write("    status: \"UP\"\n    db.status: \"UP\"\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.HealthCheck.JSONChecks["db.status"] != "UP" {
+		t.Errorf("Expected db.status check, got %v", cfg.HealthCheck.JSONChecks)
+	}
+
+	write("    db..status: \"UP\"\n")
+	if _, err := Load(path); err == nil {
+		t.Error("Expected invalid json_checks path to fail validation")
+	}
+}
+
+func TestLoad_BodyLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(limits string) {
+		t.Helper()
+		data := strings.Replace(baseConfig, "  https_port: 8443\n", "  https_port: 8443\n  body_limits:\n"+limits, 1)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+
+	write("    - content_type: \"application/json\"\n      max_bytes: 1024\n")
+	if _, err := Load(path); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	write("    - max_bytes: 1024\n")
+	if _, err := Load(path); err == nil {
+		t.Error("Expected a rule without path_prefix or content_type to fail validation")
+	}
+
+	write("    - path_prefix: \"/upload\"\n")
+	if _, err := Load(path); err == nil {
+		t.Error("Expected a rule without max_bytes to fail validation")
+	}
+}
+
+func TestLoad_ShadowSampleRate(t *testing.T) {
+	cases := []struct {
+		extra string
+		want  float64
+	}{
+		{"shadow:\n  url: http://shadow:8005\n", 1},
+		{"shadow:\n  url: http://shadow:8005\n  sample_rate: 0\n", 0},
+		{"shadow:\n  url: http://shadow:8005\n  sample_rate: 0.25\n", 0.25},
+	}
+
+	for _, tc := range cases {
+		cfg, err := Load(writeConfig(t, tc.extra))
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if cfg.Shadow.SampleRate != tc.want {
+			t.Errorf("%q: expected sample_rate %v, got %v", tc.extra, tc.want, cfg.Shadow.SampleRate)
+		}
+		if cfg.Shadow.MaxInFlight != 100 {
+			t.Errorf("Expected max_in_flight to default to 100, got %d", cfg.Shadow.MaxInFlight)
+		}
+	}
+}
+
+func TestLoad_CompressionAlgorithm(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "compression:\n  enabled: true\n"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Compression.Algorithm != CompressionGzip {
+		t.Errorf("Expected gzip by default, got %q", cfg.Compression.Algorithm)
+	}
+
+	for _, algorithm := range []string{CompressionBrotli, CompressionZstd} {
+		cfg, err := Load(writeConfig(t, "compression:\n  algorithm: "+algorithm+"\n"))
+		if err != nil {
+			t.Errorf("Expected %s to load: %v", algorithm, err)
+		} else if cfg.Compression.Algorithm != algorithm {
+			t.Errorf("Expected algorithm %s, got %q", algorithm, cfg.Compression.Algorithm)
+		}
+	}
+
+	for _, extra := range []string{
+		"compression:\n  algorithm: lz4\n",
+		"compression:\n  level: 10\n",
+	} {
+		if _, err := Load(writeConfig(t, extra)); err == nil {
+			t.Errorf("Expected %q to fail validation", extra)
+		}
+	}
+}
+
+func TestLoad_UpstreamHealthCheckOverride(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `
+upstreams:
+  - name: images
+    backends:
+      - url: "http://localhost:8002"
+    health_check:
+      interval: 30s
+      endpoint: "/status"
+`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	hc := cfg.UpstreamHealthCheck(cfg.Upstreams[0])
+	if hc.Interval != 30*time.Second || hc.Endpoint != "/status" {
+		t.Errorf("Expected overridden interval and endpoint, got %v %q", hc.Interval, hc.Endpoint)
+	}
+	if hc.Timeout != cfg.HealthCheck.Timeout || hc.FailureThreshold != cfg.HealthCheck.FailureThreshold {
+		t.Errorf("Expected unset fields inherited, got timeout %v threshold %d", hc.Timeout, hc.FailureThreshold)
+	}
+
+	_, err = Load(writeConfig(t, `
+upstreams:
+  - name: images
+    backends:
+      - url: "http://localhost:8002"
+    health_check:
+      interval: -1s
+`))
+	if err == nil {
+		t.Error("Expected a negative upstream health check interval to be rejected")
+	}
+}
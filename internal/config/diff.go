@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Change is one difference between two configurations. For a backend or
+// upstream that was added, Old is empty; for one that was removed, New is.
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("%s: added %s", c.Path, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: removed %s", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+	}
+}
+
+// redacted replaces values of secret settings in a diff.
+const redacted = "<redacted>"
+
+// Diff lists what differs between old and new. Backends are compared by URL
+// per pool so additions, removals, weight and priority changes are reported
+// individually, and upstreams by name; every other setting is reported by
+// its YAML path.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	changes = append(changes, diffBackends("backends", old.Backends, new.Backends)...)
+	changes = append(changes, diffUpstreams(old.Upstreams, new.Upstreams)...)
+
+	oldValue, newValue := reflect.ValueOf(*old), reflect.ValueOf(*new)
+	configType := oldValue.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		name := yamlName(configType.Field(i))
+		if name == "backends" || name == "upstreams" {
+			continue
+		}
+		changes = append(changes, diffValues(name, oldValue.Field(i), newValue.Field(i))...)
+	}
+	return changes
+}
+
+func diffUpstreams(old, new []UpstreamConfig) []Change {
+	var changes []Change
+	oldByName := make(map[string]UpstreamConfig, len(old))
+	for _, upstream := range old {
+		oldByName[upstream.Name] = upstream
+	}
+	newNames := make(map[string]bool, len(new))
+	for _, upstream := range new {
+		newNames[upstream.Name] = true
+		previous, ok := oldByName[upstream.Name]
+		if !ok {
+			changes = append(changes, Change{Path: "upstreams", New: upstream.Name})
+			continue
+		}
+		changes = append(changes, diffBackends("upstreams."+upstream.Name+".backends", previous.Backends, upstream.Backends)...)
+		changes = append(changes, diffValues("upstreams."+upstream.Name+".health_check",
+			reflect.ValueOf(previous.HealthCheck), reflect.ValueOf(upstream.HealthCheck))...)
+	}
+	for _, upstream := range old {
+		if !newNames[upstream.Name] {
+			changes = append(changes, Change{Path: "upstreams", Old: upstream.Name})
+		}
+	}
+	return changes
+}
+
+func diffBackends(path string, old, new []BackendConfig) []Change {
+	var changes []Change
+	oldByURL := make(map[string]BackendConfig, len(old))
+	for _, backend := range old {
+		oldByURL[backend.URL] = backend
+	}
+	newURLs := make(map[string]bool, len(new))
+	for _, backend := range new {
+		newURLs[backend.URL] = true
+		previous, ok := oldByURL[backend.URL]
+		if !ok {
+			changes = append(changes, Change{Path: path, New: backend.URL})
+			continue
+		}
+		prefix := fmt.Sprintf("%s[%s]", path, backend.URL)
+		if previous.Weight != backend.Weight {
+			changes = append(changes, Change{
+				Path: prefix + ".weight",
+				Old:  fmt.Sprint(previous.Weight),
+				New:  fmt.Sprint(backend.Weight),
+			})
+		}
+		if previous.Priority != backend.Priority {
+			changes = append(changes, Change{
+				Path: prefix + ".priority",
+				Old:  fmt.Sprint(previous.Priority),
+				New:  fmt.Sprint(backend.Priority),
+			})
+		}
+		changes = append(changes, diffRequestHeaders(prefix+".request_headers", previous.RequestHeaders, backend.RequestHeaders)...)
+	}
+	for _, backend := range old {
+		if !newURLs[backend.URL] {
+			changes = append(changes, Change{Path: path, Old: backend.URL})
+		}
+	}
+	return changes
+}
+
+// diffRequestHeaders reports each header whose value differs by name only,
+// since request headers often carry credentials for the backend.
+func diffRequestHeaders(path string, old, new map[string]string) []Change {
+	var changes []Change
+	names := slices.Sorted(maps.Keys(new))
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		oldValue, inOld := old[name]
+		newValue, inNew := new[name]
+		if inOld && inNew && oldValue == newValue {
+			continue
+		}
+		change := Change{Path: fmt.Sprintf("%s[%s]", path, name)}
+		if inOld {
+			change.Old = redacted
+		}
+		if inNew {
+			change.New = redacted
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// diffValues descends into structs and reports every other differing value
+// as a whole.
+func diffValues(path string, old, new reflect.Value) []Change {
+	if old.Kind() == reflect.Pointer {
+		if old.IsNil() || new.IsNil() {
+			if old.IsNil() != new.IsNil() {
+				return []Change{valueChange(path, old, new)}
+			}
+			return nil
+		}
+		old, new = old.Elem(), new.Elem()
+	}
+
+	if old.Kind() != reflect.Struct {
+		if reflect.DeepEqual(old.Interface(), new.Interface()) {
+			return nil
+		}
+		return []Change{valueChange(path, old, new)}
+	}
+
+	var changes []Change
+	for i := 0; i < old.NumField(); i++ {
+		field := old.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		changes = append(changes, diffValues(path+"."+yamlName(field), old.Field(i), new.Field(i))...)
+	}
+	return changes
+}
+
+func valueChange(path string, old, new reflect.Value) Change {
+	if isSecret(path) {
+		return Change{Path: path, Old: redacted, New: redacted}
+	}
+	return Change{Path: path, Old: formatValue(old), New: formatValue(new)}
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return "none"
+	}
+	// Lists of sections such as routes may embed credentials, so only their
+	// size is shown.
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct {
+		return fmt.Sprintf("(%d entries)", v.Len())
+	}
+	s := fmt.Sprint(v.Interface())
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+// isSecret reports whether path holds credentials, whose values must not
+// reach the logs.
+func isSecret(path string) bool {
+	last := path[strings.LastIndex(path, ".")+1:]
+	return slices.Contains([]string{"password", "users", "secret", "token"}, last)
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiff_ReportsBackendsAndSettings(t *testing.T) {
+	old := &Config{
+		Backends: []BackendConfig{
+			{URL: "http://a:8001", Weight: 1},
+			{URL: "http://b:8002", Weight: 1},
+		},
+		RateLimit: RateLimitConfig{Enabled: true, RequestsPerMinute: 600, Burst: 100},
+		Cache:     CacheConfig{Redis: RedisCacheConfig{Password: "old-secret"}},
+		Admin:     AdminConfig{Token: "old-token"},
+	}
+	new := &Config{
+		Backends: []BackendConfig{
+			{URL: "http://a:8001", Weight: 3},
+			{URL: "http://c:8003", Weight: 1},
+		},
+		RateLimit: RateLimitConfig{Enabled: true, RequestsPerMinute: 1200, Burst: 100},
+		Cache:     CacheConfig{Redis: RedisCacheConfig{Password: "new-secret"}},
+		Admin:     AdminConfig{Token: "new-token"},
+	}
+
+	got := Diff(old, new)
+	want := []Change{
+		{Path: "backends[http://a:8001].weight", Old: "1", New: "3"},
+		{Path: "backends", New: "http://c:8003"},
+		{Path: "backends", Old: "http://b:8002"},
+		{Path: "cache.redis.password", Old: redacted, New: redacted},
+		{Path: "rate_limit.requests_per_minute", Old: "600", New: "1200"},
+		{Path: "admin.token", Old: redacted, New: redacted},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Unexpected diff:\n got  %v\n want %v", got, want)
+	}
+}
+
+func TestDiff_ReportsUpstreamHealthCheck(t *testing.T) {
+	old := &Config{Upstreams: []UpstreamConfig{{
+		Name:        "images",
+		HealthCheck: HealthCheckOverride{Endpoint: "/health"},
+	}}}
+	new := &Config{Upstreams: []UpstreamConfig{{
+		Name:        "images",
+		HealthCheck: HealthCheckOverride{Endpoint: "/ready", Interval: 5 * time.Second},
+	}}}
+
+	got := Diff(old, new)
+	want := []Change{
+		{Path: "upstreams.images.health_check.interval", Old: "0s", New: "5s"},
+		{Path: "upstreams.images.health_check.endpoint", Old: "/health", New: "/ready"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Unexpected diff:\n got  %v\n want %v", got, want)
+	}
+}
+
+func TestDiff_ReportsBackendPriority(t *testing.T) {
+	old := &Config{
+		Backends:  []BackendConfig{{URL: "http://a:8001", Weight: 1}},
+		Upstreams: []UpstreamConfig{{Name: "images", Backends: []BackendConfig{{URL: "http://i:8001", Weight: 1, Priority: 1}}}},
+	}
+	new := &Config{
+		Backends:  []BackendConfig{{URL: "http://a:8001", Weight: 1, Priority: 2}},
+		Upstreams: []UpstreamConfig{{Name: "images", Backends: []BackendConfig{{URL: "http://i:8001", Weight: 1}}}},
+	}
+
+	got := Diff(old, new)
+	want := []Change{
+		{Path: "backends[http://a:8001].priority", Old: "0", New: "2"},
+		{Path: "upstreams.images.backends[http://i:8001].priority", Old: "1", New: "0"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Unexpected diff:\n got  %v\n want %v", got, want)
+	}
+}
+
+func TestDiff_RedactsBackendRequestHeaders(t *testing.T) {
+	old := &Config{Backends: []BackendConfig{{URL: "http://a:8001", Weight: 1, RequestHeaders: map[string]string{
+		"Authorization": "Bearer old-token",
+		"X-Api-Key":     "old-key",
+		"X-Tenant":      "acme",
+	}}}}
+	new := &Config{Backends: []BackendConfig{{URL: "http://a:8001", Weight: 1, RequestHeaders: map[string]string{
+		"Authorization": "Bearer new-token",
+		"X-Tenant":      "acme",
+		"X-Trace":       "on",
+	}}}}
+
+	got := Diff(old, new)
+	want := []Change{
+		{Path: "backends[http://a:8001].request_headers[Authorization]", Old: redacted, New: redacted},
+		{Path: "backends[http://a:8001].request_headers[X-Api-Key]", Old: redacted},
+		{Path: "backends[http://a:8001].request_headers[X-Trace]", New: redacted},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Unexpected diff:\n got  %v\n want %v", got, want)
+	}
+}
+
+func TestDiff_UnchangedIsEmpty(t *testing.T) {
+	cfg := &Config{
+		Backends:  []BackendConfig{{URL: "http://a:8001", Weight: 1}},
+		Upstreams: []UpstreamConfig{{Name: "images", Backends: []BackendConfig{{URL: "http://i:8001", Weight: 1}}}},
+		Routes:    []RouteConfig{{Name: "images", Upstream: "images"}},
+	}
+	same := *cfg
+	if changes := Diff(cfg, &same); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+}
@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/circuit"
+	"proxy-kp/pkg/health"
+
+	"go.uber.org/zap"
+)
+
+const metricBackendSelections = "proxy_backend_selections"
+
+type backendStatusResponse struct {
+	URL          string  `json:"url"`
+	Healthy      bool    `json:"healthy"`
+	FailureCount int     `json:"failure_count"`
+	Circuit      string  `json:"circuit"`
+	LatencyP99Ms float64 `json:"latency_p99_ms"`
+	Weight       int     `json:"weight"`
+	Selections   int64   `json:"selections"`
+}
+
+type poolStatusResponse struct {
+	Backends []backendStatusResponse `json:"backends"`
+	Healthy  int                     `json:"healthy"`
+	Total    int                     `json:"total"`
+}
+
+// statusResponse reports the default pool at the top level and each named
+// upstream under upstreams.
+type statusResponse struct {
+	poolStatusResponse
+	Upstreams map[string]poolStatusResponse `json:"upstreams,omitempty"`
+}
+
+func (s *Server) adminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	mux.HandleFunc("POST /selections/reset", s.handleResetSelections)
+	mux.HandleFunc("POST /backends", s.requireAdminToken("backend.add", s.handleAddBackend))
+	mux.HandleFunc("DELETE /backends", s.requireAdminToken("backend.remove", s.handleRemoveBackend))
+	mux.HandleFunc("GET /top-clients", s.handleTopClients)
+	mux.HandleFunc("GET /debug/vars", s.handleDebugVars)
+	mux.HandleFunc("GET /cache", s.handleCacheEntries)
+	mux.HandleFunc("POST /cache/purge", s.requireAdminToken("cache.purge", s.handleCachePurge))
+	mux.HandleFunc("GET /ratelimit/inspect", s.handleRateLimitInspect)
+	mux.HandleFunc("POST /ratelimit/reset", s.requireAdminToken("ratelimit.reset", s.handleRateLimitReset))
+	return mux
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	resp := statusResponse{poolStatusResponse: poolStatus(s.balancer, s.healthChecker)}
+	if len(s.upstreams) > 0 {
+		resp.Upstreams = make(map[string]poolStatusResponse, len(s.upstreams))
+		for name, pool := range s.upstreams {
+			resp.Upstreams[name] = poolStatus(pool, s.upstreamCheckers[name])
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// poolStatus reports pool's backends, with consecutive health check failures
+// as counted by checker.
+func poolStatus(pool balancer.Balancer, checker *health.Checker) poolStatusResponse {
+	backends := pool.GetBackends()
+
+	resp := poolStatusResponse{
+		Backends: make([]backendStatusResponse, 0, len(backends)),
+		Healthy:  pool.HealthyCount(),
+		Total:    len(backends),
+	}
+
+	for _, b := range backends {
+		state := circuit.StateClosed
+		if breaker := b.Breaker(); breaker != nil {
+			state = breaker.State()
+		}
+		p99, _ := b.LatencyPercentile(0.99)
+		resp.Backends = append(resp.Backends, backendStatusResponse{
+			URL:          b.URL,
+			Healthy:      b.IsHealthy(),
+			FailureCount: checker.GetFailureCount(b.URL),
+			Circuit:      state.String(),
+			LatencyP99Ms: float64(p99) / float64(time.Millisecond),
+			Weight:       b.Weight,
+			Selections:   b.Selections(),
+		})
+	}
+	return resp
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	for pool, b := range s.pools() {
+		for _, backend := range b.GetBackends() {
+			s.metrics.Gauge(metricBackendSelections, "pool", pool, "backend", backend.URL).Set(float64(backend.Selections()))
+			p99, _ := backend.LatencyPercentile(0.99)
+			s.metrics.Gauge(metricLatencyP99, "backend", backend.URL).Set(p99.Seconds())
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := s.metrics.WriteText(w); err != nil {
+		s.logger.Error("Failed to write metrics", zap.Error(err))
+	}
+}
+
+// handleResetSelections zeroes the per-backend selection counters of every
+// pool and returns the counts they had, keyed by pool then backend URL.
+func (s *Server) handleResetSelections(w http.ResponseWriter, r *http.Request) {
+	snapshot := make(map[string]map[string]int64)
+	for pool, b := range s.pools() {
+		snapshot[pool] = b.ResetSelections()
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+	s.recordAudit(r, "selections.reset", nil, http.StatusOK, nil)
+}
+
+// requireAdminToken rejects requests without "Authorization: Bearer" and
+// the configured admin token. With no token configured the endpoint is
+// disabled.
+func (s *Server) requireAdminToken(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.config.Admin.Token
+		if token == "" {
+			s.adminError(w, r, action, nil, http.StatusForbidden, fmt.Errorf("endpoint disabled, admin.token is not set"))
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.adminError(w, r, action, nil, http.StatusUnauthorized, fmt.Errorf("invalid admin token"))
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), adminPrincipalKey, "admin-token")))
+	}
+}
+
+type addBackendRequest struct {
+	Pool           string            `json:"pool"`
+	URL            string            `json:"url"`
+	Weight         int               `json:"weight"`
+	RequestHeaders map[string]string `json:"request_headers,omitempty"`
+	Priority       int               `json:"priority,omitempty"`
+}
+
+// handleAddBackend adds a backend to a pool at runtime. The pool defaults to
+// "default" and the weight to 1. The backend is not written to the config
+// file: a reload that changes the pool's backends resets the pool to the
+// configured list and drops it.
+func (s *Server) handleAddBackend(w http.ResponseWriter, r *http.Request) {
+	var req addBackendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.adminError(w, r, "backend.add", nil, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err))
+		return
+	}
+	if req.Pool == "" {
+		req.Pool = "default"
+	}
+	if req.Weight == 0 {
+		req.Weight = 1
+	}
+	params := map[string]string{"pool": req.Pool, "url": req.URL, "weight": strconv.Itoa(req.Weight)}
+
+	if u, err := url.Parse(req.URL); err != nil || u.Scheme == "" || u.Host == "" || req.Weight < 0 || req.Priority < 0 {
+		s.adminError(w, r, "backend.add", params, http.StatusBadRequest, fmt.Errorf("url must be absolute, weight positive and priority not negative"))
+		return
+	}
+	pool, ok := s.pools()[req.Pool]
+	if !ok {
+		s.adminError(w, r, "backend.add", params, http.StatusNotFound, fmt.Errorf("unknown pool %q", req.Pool))
+		return
+	}
+	for _, b := range pool.GetBackends() {
+		if b.URL == req.URL {
+			s.adminError(w, r, "backend.add", params, http.StatusConflict, fmt.Errorf("backend %s already in pool %q", req.URL, req.Pool))
+			return
+		}
+	}
+
+	pool.AddBackend(newPoolBackend(s.config, config.BackendConfig{
+		URL:            req.URL,
+		RequestHeaders: req.RequestHeaders,
+		Priority:       req.Priority,
+	}, req.Weight, s.metrics, s.logger))
+	s.logger.Info("Backend added via admin API",
+		zap.String("pool", req.Pool),
+		zap.String("url", req.URL),
+		zap.Int("weight", req.Weight))
+
+	writeJSON(w, http.StatusCreated, req)
+	s.recordAudit(r, "backend.add", params, http.StatusCreated, nil)
+}
+
+// handleRemoveBackend removes the backend given by the url query parameter
+// from the pool query parameter (default "default"). Like additions, the
+// removal lasts until a reload changes the pool's backends.
+func (s *Server) handleRemoveBackend(w http.ResponseWriter, r *http.Request) {
+	poolName := r.URL.Query().Get("pool")
+	if poolName == "" {
+		poolName = "default"
+	}
+	backendURL := r.URL.Query().Get("url")
+	params := map[string]string{"pool": poolName, "url": backendURL}
+
+	pool, ok := s.pools()[poolName]
+	if !ok {
+		s.adminError(w, r, "backend.remove", params, http.StatusNotFound, fmt.Errorf("unknown pool %q", poolName))
+		return
+	}
+	var removed *balancer.Backend
+	for _, b := range pool.GetBackends() {
+		if b.URL == backendURL {
+			removed = b
+		}
+	}
+	if removed == nil || !pool.RemoveBackend(backendURL) {
+		s.adminError(w, r, "backend.remove", params, http.StatusNotFound, fmt.Errorf("backend %s not in pool %q", backendURL, poolName))
+		return
+	}
+	detachBreaker(s.metrics, removed)
+	s.logger.Info("Backend removed via admin API",
+		zap.String("pool", poolName),
+		zap.String("url", backendURL))
+
+	w.WriteHeader(http.StatusNoContent)
+	s.recordAudit(r, "backend.remove", params, http.StatusNoContent, nil)
+}
+
+// adminError answers a failed admin action and records it in the audit log.
+func (s *Server) adminError(w http.ResponseWriter, r *http.Request, action string, params map[string]string, status int, err error) {
+	http.Error(w, err.Error(), status)
+	s.recordAudit(r, action, params, status, err)
+}
+
+// pools returns the default backend pool and every named upstream.
+func (s *Server) pools() map[string]balancer.Balancer {
+	pools := make(map[string]balancer.Balancer, len(s.upstreams)+1)
+	for name, b := range s.upstreams {
+		pools[name] = b
+	}
+	pools["default"] = s.balancer
+	return pools
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,471 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAdmin_ReadyzFlipsBelowMinHealthy(t *testing.T) {
+	cfg := testConfig("http://localhost:8001", "http://localhost:8002")
+	cfg.HealthCheck.MinHealthy = 2
+	cfg.HealthCheck.MinHealthyReadiness = true
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	mux := s.adminMux()
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("Expected 200 with all backends healthy, got %d", code)
+	}
+
+	s.balancer.SetHealthy("http://localhost:8001", false)
+	s.monitor.Evaluate()
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 below min_healthy, got %d", code)
+	}
+	if v := s.metrics.Gauge(metricBelowMinHealthy).Value(); v != 1 {
+		t.Errorf("Expected below-min gauge 1, got %v", v)
+	}
+
+	s.balancer.SetHealthy("http://localhost:8001", true)
+	s.monitor.Evaluate()
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("Expected 200 after recovery, got %d", code)
+	}
+	if v := s.metrics.Gauge(metricBelowMinHealthy).Value(); v != 0 {
+		t.Errorf("Expected below-min gauge 0, got %v", v)
+	}
+}
+
+func TestAdmin_ReadyzVerboseReportsBlockingCheck(t *testing.T) {
+	cfg := testConfig("http://localhost:8001", "http://localhost:8002")
+	cfg.HealthCheck.MinHealthy = 2
+	cfg.HealthCheck.MinHealthyReadiness = true
+	cfg.Proxy.MinIdleConnsPerBackend = 1
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	mux := s.adminMux()
+
+	ready := func() (int, readinessResponse) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz?verbose=true", nil))
+		var body readinessResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Invalid JSON %q: %v", rec.Body.String(), err)
+		}
+		return rec.Code, body
+	}
+	blocking := func(body readinessResponse) []string {
+		var reasons []string
+		for _, check := range body.Checks {
+			if !check.Ready {
+				reasons = append(reasons, check.Name+": "+check.Reason)
+			}
+		}
+		return reasons
+	}
+	expect := func(state string, wantCode int, want ...string) {
+		t.Helper()
+		code, body := ready()
+		got := blocking(body)
+		if code != wantCode || body.Ready != (wantCode == http.StatusOK) || strings.Join(got, "; ") != strings.Join(want, "; ") {
+			t.Errorf("%s: expected %d blocked by %q, got %d (ready=%v) blocked by %q", state, wantCode, want, code, body.Ready, got)
+		}
+	}
+
+	expect("warming up", http.StatusServiceUnavailable, "warm_up: warming up")
+
+	s.warmer.warmed.Store(true)
+	expect("ready", http.StatusOK)
+
+	s.balancer.SetHealthy("http://localhost:8001", false)
+	s.monitor.Evaluate()
+	expect("below min_healthy", http.StatusServiceUnavailable, "min_healthy: 1 healthy backends, below min_healthy 2")
+
+	s.balancer.SetHealthy("http://localhost:8002", false)
+	s.monitor.Evaluate()
+	expect("no healthy backends", http.StatusServiceUnavailable,
+		"backends: 0 healthy backends", "min_healthy: 0 healthy backends, below min_healthy 2")
+
+	s.balancer.SetHealthy("http://localhost:8001", true)
+	s.balancer.SetHealthy("http://localhost:8002", true)
+	s.monitor.Evaluate()
+	s.draining.Store(true)
+	expect("draining", http.StatusServiceUnavailable, "shutdown: draining")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || strings.TrimSpace(rec.Body.String()) != "draining" {
+		t.Errorf("Expected plain 503 with the blocking reason by default, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdmin_BackendSelectionCounters(t *testing.T) {
+	first := namedBackend("first")
+	defer first.Close()
+	second := namedBackend("second")
+	defer second.Close()
+
+	cfg := testConfig(first.URL, second.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Backends[0].Weight = 3
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.middleware.Chain(s.handler)
+	for i := 0; i < 8; i++ {
+		serveFrom(h, "192.168.1.1:5000", "/fair")
+	}
+	mux := s.adminMux()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status statusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Invalid status JSON: %v", err)
+	}
+	got := map[string]int64{}
+	for _, b := range status.Backends {
+		got[b.URL] = b.Selections
+	}
+	if got[first.URL] != 6 || got[second.URL] != 2 {
+		t.Errorf("Expected 6:2 selections for 3:1 weights, got %v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `proxy_backend_selections{pool="default",backend="` + first.URL + `"} 6`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("Expected %q in metrics output, got:\n%s", want, rec.Body.String())
+	}
+	if want := `proxy_backend_latency_p99_seconds{backend="` + first.URL + `"}`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("Expected %q in metrics output, got:\n%s", want, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/selections/reset", nil))
+	var snapshot map[string]map[string]int64
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("Invalid reset JSON: %v", err)
+	}
+	if snapshot["default"][second.URL] != 2 {
+		t.Errorf("Expected reset snapshot to carry prior counts, got %v", snapshot)
+	}
+	for _, b := range s.balancer.GetBackends() {
+		if b.Selections() != 0 {
+			t.Errorf("%s: expected counter reset, got %d", b.URL, b.Selections())
+		}
+	}
+}
+
+func TestAdmin_BackendAddIsAudited(t *testing.T) {
+	cfg := testConfig("http://localhost:8001")
+	cfg.Admin.Token = "secret"
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	core, logs := observer.New(zap.InfoLevel)
+	s.SetAuditLogger(logger.FromZap(zap.New(core)))
+	mux := s.adminMux()
+	authed := func(method, target, body string) *http.Request {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		return req
+	}
+
+	req := authed(http.MethodPost, "/backends", `{"url":"http://localhost:8002","weight":2}`)
+	req.RemoteAddr = "10.1.2.3:4000"
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if n := len(s.balancer.GetBackends()); n != 2 {
+		t.Errorf("Expected backend to be added, pool has %d", n)
+	}
+
+	entries := logs.FilterMessage("Admin action").All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["action"] != "backend.add" || fields["source_ip"] != "10.1.2.3" || fields["principal"] != "admin-token" || fields["result"] != "success" {
+		t.Errorf("Unexpected audit fields: %v", fields)
+	}
+	params, _ := fields["params"].(map[string]string)
+	if params["url"] != "http://localhost:8002" || params["pool"] != "default" || params["weight"] != "2" {
+		t.Errorf("Unexpected audit params: %v", fields["params"])
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, authed(http.MethodPost, "/backends", `{"url":"http://localhost:8002"}`))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate backend, got %d", rec.Code)
+	}
+	entries = logs.FilterMessage("Admin action").All()
+	if len(entries) != 2 || entries[1].ContextMap()["result"] != "failure" {
+		t.Errorf("Expected the rejected add to be audited as a failure, got %d entries", len(entries))
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, authed(http.MethodDelete, "/backends?url=http://localhost:8002", ""))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on remove, got %d", rec.Code)
+	}
+	if n := logs.FilterMessage("Admin action").Len(); n != 3 {
+		t.Errorf("Expected remove to be audited, got %d entries", n)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/backends", strings.NewReader(`{"url":"http://localhost:8003"}`)))
+	entries = logs.FilterMessage("Admin action").All()
+	if len(entries) != 4 || entries[3].ContextMap()["principal"] != "anonymous" {
+		t.Errorf("Expected the unauthenticated add to be audited as anonymous, got %d entries", len(entries))
+	}
+}
+
+func TestAdmin_BackendChangesRequireToken(t *testing.T) {
+	cfg := testConfig("http://localhost:8001")
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	mux := s.adminMux()
+	add := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/backends", strings.NewReader(`{"url":"http://localhost:8002"}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := add("anything"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 without a configured token, got %d", code)
+	}
+
+	s.config.Admin.Token = "secret"
+	if code := add(""); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", code)
+	}
+	if code := add("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %d", code)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/backends?url=http://localhost:8001", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 on remove without a token, got %d", rec.Code)
+	}
+	if n := len(s.balancer.GetBackends()); n != 1 {
+		t.Errorf("Expected pool unchanged, has %d backends", n)
+	}
+}
+
+func TestAdmin_BackendAddKeepsHeadersAndPriority(t *testing.T) {
+	cfg := testConfig("http://localhost:8001")
+	cfg.Admin.Token = "secret"
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/backends",
+		strings.NewReader(`{"url":"http://localhost:8002","request_headers":{"X-Tenant":"a"},"priority":2}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	s.adminMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, b := range s.balancer.GetBackends() {
+		if b.URL != "http://localhost:8002" {
+			continue
+		}
+		if b.Priority() != 2 {
+			t.Errorf("Expected priority 2, got %d", b.Priority())
+		}
+		if got := b.RequestHeaders()["X-Tenant"]; got != "a" {
+			t.Errorf("Expected request header X-Tenant=a, got %q", got)
+		}
+		return
+	}
+	t.Fatal("Expected backend to be added")
+}
+
+func TestServer_PerUpstreamHealthChecks(t *testing.T) {
+	type probes struct {
+		mu    sync.Mutex
+		paths map[string]int
+	}
+	probeBackend := func(p *probes, healthy string) *httptest.Server {
+		p.paths = make(map[string]int)
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.mu.Lock()
+			p.paths[r.URL.Path]++
+			p.mu.Unlock()
+			if r.URL.Path != healthy {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	}
+	var fastProbes, slowProbes probes
+	fast := probeBackend(&fastProbes, "/fast-health")
+	defer fast.Close()
+	slow := probeBackend(&slowProbes, "/slow-health")
+	defer slow.Close()
+	def := namedBackend("default")
+	defer def.Close()
+
+	cfg := testConfig(def.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Upstreams = []config.UpstreamConfig{
+		{
+			Name:        "fast",
+			Backends:    []config.BackendConfig{{URL: fast.URL, Weight: 1}},
+			HealthCheck: config.HealthCheckOverride{Interval: 20 * time.Millisecond, Endpoint: "/fast-health"},
+		},
+		{
+			Name:        "slow",
+			Backends:    []config.BackendConfig{{URL: slow.URL, Weight: 1}},
+			HealthCheck: config.HealthCheckOverride{Interval: 200 * time.Millisecond, Endpoint: "/slow-health"},
+		},
+	}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	for _, checker := range s.upstreamCheckers {
+		checker.Start(context.Background())
+		defer checker.Stop()
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	fastProbes.mu.Lock()
+	fastCount, fastOther := fastProbes.paths["/fast-health"], len(fastProbes.paths)
+	fastProbes.mu.Unlock()
+	slowProbes.mu.Lock()
+	slowCount, slowOther := slowProbes.paths["/slow-health"], len(slowProbes.paths)
+	slowProbes.mu.Unlock()
+
+	if fastCount < 5 {
+		t.Errorf("Expected the fast upstream probed every 20ms, got %d probes", fastCount)
+	}
+	if slowCount < 1 || slowCount > 2 {
+		t.Errorf("Expected the slow upstream probed every 200ms, got %d probes", slowCount)
+	}
+	if fastOther != 1 || slowOther != 1 {
+		t.Errorf("Expected each upstream probed only on its own endpoint, got %v and %v", fastProbes.paths, slowProbes.paths)
+	}
+
+	rec := httptest.NewRecorder()
+	s.adminMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status statusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Invalid status JSON: %v", err)
+	}
+	for _, name := range []string{"fast", "slow"} {
+		pool, ok := status.Upstreams[name]
+		if !ok || pool.Total != 1 || pool.Healthy != 1 {
+			t.Errorf("Expected upstream %s reported with 1 of 1 healthy, got %+v", name, pool)
+		}
+	}
+	if status.Total != 1 {
+		t.Errorf("Expected the default pool at the top level, got %d backends", status.Total)
+	}
+}
+
+func TestAdmin_StatusReportsUnhealthyBackend(t *testing.T) {
+	live := namedBackend("live")
+	defer live.Close()
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+
+	cfg := testConfig(live.URL, dead.URL)
+	cfg.HealthCheck.Interval = 10 * time.Millisecond
+	cfg.HealthCheck.FailureThreshold = 2
+	cfg.HealthCheck.RecoveryInterval = time.Hour
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.healthChecker.Start(ctx)
+	defer s.healthChecker.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.balancer.HealthyCount() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the dead backend to be marked unhealthy")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	s.adminMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var status struct {
+		Healthy  *int `json:"healthy"`
+		Total    *int `json:"total"`
+		Backends []struct {
+			URL          *string `json:"url"`
+			Healthy      *bool   `json:"healthy"`
+			FailureCount *int    `json:"failure_count"`
+			Weight       *int    `json:"weight"`
+		} `json:"backends"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Invalid status JSON: %v", err)
+	}
+	if status.Healthy == nil || *status.Healthy != 1 || status.Total == nil || *status.Total != 2 {
+		t.Fatalf("Expected 1 of 2 backends healthy, got %s", rec.Body.String())
+	}
+	for _, b := range status.Backends {
+		if b.URL == nil || b.Healthy == nil || b.FailureCount == nil || b.Weight == nil {
+			t.Fatalf("Expected url, healthy, failure_count and weight for every backend, got %s", rec.Body.String())
+		}
+		switch *b.URL {
+		case live.URL:
+			if !*b.Healthy || *b.FailureCount != 0 {
+				t.Errorf("Expected the live backend healthy without failures, got %s", rec.Body.String())
+			}
+		case dead.URL:
+			if *b.Healthy || *b.FailureCount < 2 {
+				t.Errorf("Expected the dead backend unhealthy with at least 2 failures, got %s", rec.Body.String())
+			}
+		}
+	}
+}
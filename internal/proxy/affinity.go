@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+)
+
+// sessionAffinity pins clients to backends with a cookie holding a backend
+// ID and its HMAC, so clients cannot pick a backend by forging one. A nil
+// *sessionAffinity pins nothing.
+type sessionAffinity struct {
+	cookie string
+	secret []byte
+	maxAge int
+}
+
+func newSessionAffinity(cfg config.SessionAffinityConfig) *sessionAffinity {
+	if !cfg.Enabled {
+		return nil
+	}
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &sessionAffinity{
+		cookie: cfg.CookieName,
+		secret: secret,
+		maxAge: int(cfg.MaxAge.Seconds()),
+	}
+}
+
+// backendID identifies a backend in the cookie without exposing its URL.
+func backendID(backend *balancer.Backend) string {
+	sum := sha256.Sum256([]byte(backend.URL))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (a *sessionAffinity) sign(id string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (a *sessionAffinity) value(backend *balancer.Backend) string {
+	id := backendID(backend)
+	return id + "." + a.sign(id)
+}
+
+// pinned returns the available backend of pool named by r's affinity cookie,
+// or nil when there is no valid cookie or that backend cannot take traffic.
+func (a *sessionAffinity) pinned(r *http.Request, pool balancer.Balancer) *balancer.Backend {
+	if a == nil {
+		return nil
+	}
+	cookie, err := r.Cookie(a.cookie)
+	if err != nil {
+		return nil
+	}
+	id, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(a.sign(id))) {
+		return nil
+	}
+	for _, backend := range pool.GetBackends() {
+		if backendID(backend) == id {
+			if backend.IsAvailable() && !backend.Drained() {
+				return backend
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// setCookie pins the client to backend unless its cookie already does.
+func (a *sessionAffinity) setCookie(w http.ResponseWriter, r *http.Request, backend *balancer.Backend) {
+	if a == nil {
+		return
+	}
+	value := a.value(backend)
+	if cookie, err := r.Cookie(a.cookie); err == nil && cookie.Value == value {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     a.cookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   a.maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestServer_SessionAffinityCookie(t *testing.T) {
+	a := namedBackend("a")
+	defer a.Close()
+	b := namedBackend("b")
+	defer b.Close()
+
+	cfg := testConfig(a.URL, b.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Server.SessionAffinity = config.SessionAffinityConfig{Enabled: true, CookieName: "PROXYKP_BACKEND", Secret: "test-secret"}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.middleware.Chain(s.handler)
+
+	serve := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/session", nil)
+		req.RemoteAddr = "192.168.1.1:5000"
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	affinityCookie := func(rec *httptest.ResponseRecorder) *http.Cookie {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "PROXYKP_BACKEND" {
+				return c
+			}
+		}
+		return nil
+	}
+
+	first := serve(nil)
+	cookie := affinityCookie(first)
+	if cookie == nil {
+		t.Fatal("Expected the first response to set the affinity cookie")
+	}
+	pinned := first.Body.String()
+
+	for i := 0; i < 4; i++ {
+		rec := serve(cookie)
+		if rec.Body.String() != pinned {
+			t.Fatalf("Request %d: expected pinned backend %s, got %s", i, pinned, rec.Body.String())
+		}
+		if affinityCookie(rec) != nil {
+			t.Errorf("Request %d: expected no new cookie while the pin holds", i)
+		}
+	}
+
+	last := "0"
+	if strings.HasSuffix(cookie.Value, last) {
+		last = "1"
+	}
+	forged := &http.Cookie{Name: "PROXYKP_BACKEND", Value: cookie.Value[:len(cookie.Value)-1] + last}
+	if rec := serve(forged); affinityCookie(rec) == nil {
+		t.Error("Expected a forged cookie to be ignored and replaced")
+	}
+
+	pinnedURL := a.URL
+	if pinned == "b" {
+		pinnedURL = b.URL
+	}
+	s.balancer.SetHealthy(pinnedURL, false)
+
+	rec := serve(cookie)
+	moved := rec.Body.String()
+	if moved == pinned {
+		t.Fatalf("Expected the unhealthy pinned backend %s to be avoided", pinned)
+	}
+	rewritten := affinityCookie(rec)
+	if rewritten == nil || rewritten.Value == cookie.Value {
+		t.Fatal("Expected the cookie rewritten to the new backend")
+	}
+	for i := 0; i < 2; i++ {
+		if rec := serve(rewritten); rec.Body.String() != moved {
+			t.Errorf("Expected the rewritten cookie to pin %s, got %s", moved, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"net/http"
+
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// SetAuditLogger sets the sink for admin action audit entries.
+func (s *Server) SetAuditLogger(audit *logger.Logger) {
+	s.audit = audit
+}
+
+const adminPrincipalKey contextKey = "adminPrincipal"
+
+// recordAudit writes one audit entry for an admin action. Entries identify
+// the caller by source IP and principal: "admin-token" once requireAdminToken
+// has validated the bearer token, "anonymous" for endpoints without it and
+// for rejected requests.
+func (s *Server) recordAudit(r *http.Request, action string, params map[string]string, status int, err error) {
+	result := "success"
+	if status >= http.StatusBadRequest {
+		result = "failure"
+	}
+	principal, ok := r.Context().Value(adminPrincipalKey).(string)
+	if !ok {
+		principal = "anonymous"
+	}
+
+	fields := []zap.Field{
+		zap.String("action", action),
+		zap.String("source_ip", getClientIP(r)),
+		zap.String("principal", principal),
+		zap.Any("params", params),
+		zap.Int("status", status),
+		zap.String("result", result),
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	s.audit.Zap().Info("Admin action", fields...)
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"proxy-kp/internal/config"
+)
+
+// bodyLimits picks the request body size limit for a request: the first
+// matching rule, otherwise the global limit. A nil *bodyLimits imposes no
+// limit.
+type bodyLimits struct {
+	global int64
+	rules  []config.BodyLimitConfig
+}
+
+func newBodyLimits(cfg config.ServerConfig) *bodyLimits {
+	if cfg.MaxRequestBody == 0 && len(cfg.BodyLimits) == 0 {
+		return nil
+	}
+	return &bodyLimits{global: cfg.MaxRequestBody, rules: cfg.BodyLimits}
+}
+
+// limitFor returns the body size limit for r in bytes, or 0 for no limit.
+func (l *bodyLimits) limitFor(r *http.Request) int64 {
+	if l == nil {
+		return 0
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	for _, rule := range l.rules {
+		if rule.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+			continue
+		}
+		if rule.ContentType != "" && !matchesMediaType(rule.ContentType, mediaType) {
+			continue
+		}
+		return rule.MaxBytes
+	}
+	return l.global
+}
+
+func matchesMediaType(pattern, mediaType string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, strings.ToLower(prefix)+"/")
+	}
+	return strings.EqualFold(pattern, mediaType)
+}
+
+// unexpectedBody reports whether r carries a body although its method
+// defines no meaning for one.
+func unexpectedBody(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return r.ContentLength != 0
+	}
+	return false
+}
+
+// bodyTooLarge reports whether err comes from reading past a body limit set
+// with http.MaxBytesReader.
+func bodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// headerBytes approximates the wire size of r's header block: each field as
+// "Name: value\r\n", plus the Host line.
+func headerBytes(r *http.Request) int {
+	return len("Host: \r\n") + len(r.Host) + fieldBytes(r.Header)
+}
+
+// fieldBytes approximates the wire size of h's fields, each written as
+// "Name: value\r\n".
+func fieldBytes(h http.Header) int {
+	size := 0
+	for name, values := range h {
+		for _, v := range values {
+			size += len(name) + len(v) + len(": \r\n")
+		}
+	}
+	return size
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestServer_BodyLimitsPerContentType(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Server.MaxRequestBody = 1000
+	cfg.Server.BodyLimits = []config.BodyLimitConfig{
+		{ContentType: "application/json", MaxBytes: 10},
+		{PathPrefix: "/upload", ContentType: "multipart/*", MaxBytes: 100},
+	}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.publicHandler()
+
+	cases := []struct {
+		name        string
+		path        string
+		contentType string
+		size        int
+		chunked     bool
+		want        int
+	}{
+		{"small json", "/api", "application/json", 10, false, http.StatusOK},
+		{"large json", "/api", "application/json; charset=utf-8", 11, false, http.StatusRequestEntityTooLarge},
+		{"large chunked json", "/api", "application/json", 50, true, http.StatusRequestEntityTooLarge},
+		{"multipart under its limit", "/upload/file", "multipart/form-data; boundary=x", 80, false, http.StatusOK},
+		{"multipart over its limit", "/upload/file", "multipart/form-data; boundary=x", 101, false, http.StatusRequestEntityTooLarge},
+		{"multipart outside prefix uses global", "/other", "multipart/form-data; boundary=x", 500, false, http.StatusOK},
+		{"over global limit", "/other", "text/plain", 1001, false, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(strings.Repeat("a", tc.size))
+			if tc.chunked {
+				// Hide the length so the request is sent without Content-Length.
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, tc.path, body)
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.chunked {
+				req.ContentLength = -1
+			}
+			req.RemoteAddr = "192.168.1.1:5000"
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Errorf("Expected %d, got %d: %s", tc.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_RejectsOversizedHeaders(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Server.MaxHeaderBytes = 1024
+
+	core, logs := observer.New(zap.InfoLevel)
+	s, err := NewServer(cfg, logger.FromZap(zap.New(core)))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.publicHandler()
+
+	small := httptest.NewRequest(http.MethodGet, "/", nil)
+	small.Header.Set("X-Small", "value")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, small)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for small headers, got %d", rec.Code)
+	}
+
+	// No single header is over the limit; only their sum is.
+	big := httptest.NewRequest(http.MethodGet, "/", nil)
+	big.RemoteAddr = "203.0.113.7:4000"
+	for i := 0; i < 8; i++ {
+		big.Header.Add("X-Filler", strings.Repeat("a", 200))
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, big)
+
+	if rec.Code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("Expected 431, got %d", rec.Code)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("Expected oversized request not to reach the backend, got %d backend hits", n)
+	}
+
+	events := logs.FilterMessage("Request headers exceed limit").All()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 oversized header event, got %d", len(events))
+	}
+	if ip := events[0].ContextMap()["client_ip"]; ip != "203.0.113.7" {
+		t.Errorf("Expected client_ip 203.0.113.7, got %v", ip)
+	}
+}
+
+func TestHandler_StripGetBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Body-Length", strconv.Itoa(len(body)))
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20, StripGetBody: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/page", strings.NewReader("unexpected"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-Body-Length"); got != "0" {
+		t.Errorf("Expected GET body stripped before forwarding, backend read %s bytes", got)
+	}
+	if _, _, found := c.Get(getCacheKey(httptest.NewRequest(http.MethodGet, "/page", nil))); !found {
+		t.Error("Expected response cached under the bodyless GET key")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/submit", strings.NewReader("payload"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Body-Length"); got != "7" {
+		t.Errorf("Expected POST body forwarded, backend read %s bytes", got)
+	}
+}
+
+func TestHandler_RejectGetBody(t *testing.T) {
+	backend := namedBackend("a")
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20, RejectGetBody: true})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/item", strings.NewReader("unexpected")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for DELETE with a body, got %d", rec.Code)
+	}
+}
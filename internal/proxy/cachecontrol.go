@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// responseTTL applies the backend's caching headers to ttl, the configured
+// TTL for a response, and reports whether the response may be stored at
+// all. no-store, private and no-cache responses are not stored, the last
+// because the proxy does not revalidate entries. s-maxage, then max-age,
+// then Expires override ttl; a lifetime of zero or less means not storing.
+func responseTTL(h http.Header, ttl time.Duration, now time.Time) (time.Duration, bool) {
+	directives := parseCacheControl(h.Values("Cache-Control"))
+	for _, name := range []string{"no-store", "private", "no-cache"} {
+		if _, ok := directives[name]; ok {
+			return 0, false
+		}
+	}
+
+	for _, name := range []string{"s-maxage", "max-age"} {
+		value, ok := directives[name]
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds <= 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if expires := h.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid date, commonly "0", means already expired.
+			return 0, false
+		}
+		if date, err := http.ParseTime(h.Get("Date")); err == nil {
+			now = date
+		}
+		if !at.After(now) {
+			return 0, false
+		}
+		return at.Sub(now), true
+	}
+
+	return ttl, true
+}
+
+// parseCacheControl returns the directives of Cache-Control header values
+// by lower-cased name, with unquoted values ("" for directives without one).
+func parseCacheControl(values []string) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+)
+
+func TestResponseTTL(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	configured := time.Minute
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		wantTTL   time.Duration
+		wantStore bool
+	}{
+		{"no headers", http.Header{}, configured, true},
+		{"no-store", http.Header{"Cache-Control": {"no-store"}}, 0, false},
+		{"private", http.Header{"Cache-Control": {"private, max-age=600"}}, 0, false},
+		{"no-cache", http.Header{"Cache-Control": {"no-cache"}}, 0, false},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=600"}}, 10 * time.Minute, true},
+		{"max-age zero", http.Header{"Cache-Control": {"max-age=0"}}, 0, false},
+		{"s-maxage wins", http.Header{"Cache-Control": {"max-age=600, s-maxage=30"}}, 30 * time.Second, true},
+		{"quoted and split", http.Header{"Cache-Control": {"public", `Max-Age="90"`}}, 90 * time.Second, true},
+		{"max-age over expires", http.Header{
+			"Cache-Control": {"max-age=5"},
+			"Expires":       {now.Add(time.Hour).Format(http.TimeFormat)},
+		}, 5 * time.Second, true},
+		{"expires", http.Header{
+			"Date":    {now.Format(http.TimeFormat)},
+			"Expires": {now.Add(2 * time.Hour).Format(http.TimeFormat)},
+		}, 2 * time.Hour, true},
+		{"expires past", http.Header{"Expires": {now.Add(-time.Hour).Format(http.TimeFormat)}}, 0, false},
+		{"expires invalid", http.Header{"Expires": {"0"}}, 0, false},
+	}
+	for _, tt := range tests {
+		ttl, store := responseTTL(tt.header, configured, now)
+		if ttl != tt.wantTTL || store != tt.wantStore {
+			t.Errorf("%s: expected (%s, %v), got (%s, %v)", tt.name, tt.wantTTL, tt.wantStore, ttl, store)
+		}
+	}
+}
+
+func TestHandler_HonorsBackendCacheControl(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/max-age":
+			w.Header().Set("Cache-Control", "max-age=3600")
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	for _, path := range []string{"/no-store", "/max-age"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if _, found := c.GetEntry(getCacheKey(httptest.NewRequest(http.MethodGet, "/no-store", nil))); found {
+		t.Error("Expected a no-store response not to be cached")
+	}
+	entry, found := c.GetEntry(getCacheKey(httptest.NewRequest(http.MethodGet, "/max-age", nil)))
+	if !found {
+		t.Fatal("Expected a max-age response to be cached")
+	}
+	if remaining := time.Until(entry.ExpiresAt); remaining < 59*time.Minute || remaining > time.Hour {
+		t.Errorf("Expected max-age=3600 to override the 1m TTL, entry expires in %s", remaining)
+	}
+}
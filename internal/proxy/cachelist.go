@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxy-kp/pkg/cache"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCacheListLimit = 100
+	maxCacheListLimit     = 1000
+)
+
+// cacheLister is implemented by stores that can enumerate their entries;
+// the Redis store cannot.
+type cacheLister interface {
+	Keys() []string
+	Info(key string) (cache.EntryInfo, bool)
+}
+
+type cacheEntryResponse struct {
+	Key          string  `json:"key"`
+	Status       int     `json:"status"`
+	SizeBytes    int64   `json:"size_bytes"`
+	Backend      string  `json:"backend,omitempty"`
+	AgeSeconds   float64 `json:"age_seconds"`
+	TTLRemaining float64 `json:"ttl_remaining_seconds"`
+	Expired      bool    `json:"expired"`
+}
+
+type cacheListResponse struct {
+	Total   int                  `json:"total"`
+	Offset  int                  `json:"offset"`
+	Limit   int                  `json:"limit"`
+	Entries []cacheEntryResponse `json:"entries"`
+}
+
+// handleCacheEntries lists cached entries by key, without their bodies. The
+// limit (default 100, at most 1000) and offset query parameters page
+// through large caches.
+func (s *Server) handleCacheEntries(w http.ResponseWriter, r *http.Request) {
+	lister, ok := s.cache.(cacheLister)
+	if !ok {
+		http.Error(w, "cache store does not support listing", http.StatusNotImplemented)
+		return
+	}
+
+	limit, ok := queryInt(w, r, "limit", defaultCacheListLimit)
+	if !ok {
+		return
+	}
+	offset, ok := queryInt(w, r, "offset", 0)
+	if !ok {
+		return
+	}
+	limit = min(limit, maxCacheListLimit)
+
+	// Sorted so pages stay stable while requests reorder the LRU list.
+	keys := lister.Keys()
+	slices.Sort(keys)
+
+	resp := cacheListResponse{
+		Total:   len(keys),
+		Offset:  offset,
+		Limit:   limit,
+		Entries: []cacheEntryResponse{},
+	}
+	// Clamped before adding so a huge offset cannot overflow the end.
+	start := min(offset, len(keys))
+	end := start + min(limit, len(keys)-start)
+	now := time.Now()
+	for _, key := range keys[start:end] {
+		info, found := lister.Info(key)
+		if !found {
+			continue
+		}
+		remaining := info.ExpiresAt.Sub(now)
+		resp.Entries = append(resp.Entries, cacheEntryResponse{
+			Key:          info.Key,
+			Status:       info.StatusCode,
+			SizeBytes:    info.Size,
+			Backend:      info.Backend,
+			AgeSeconds:   now.Sub(info.CreatedAt).Seconds(),
+			TTLRemaining: max(remaining, 0).Seconds(),
+			Expired:      remaining < 0,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleCachePurge removes the cached entries whose URL starts with the
+// prefix query parameter, e.g. /assets/, and reports how many it removed.
+func (s *Server) handleCachePurge(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	params := map[string]string{"prefix": prefix}
+	if !strings.HasPrefix(prefix, "/") {
+		s.adminError(w, r, "cache.purge", params, http.StatusBadRequest, errors.New("prefix must be a path starting with /"))
+		return
+	}
+
+	purged := s.cache.DeletePrefix(prefix)
+	s.logger.Info("Cache purged by prefix",
+		zap.String("prefix", prefix),
+		zap.Int("purged", purged))
+	writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+	s.recordAudit(r, "cache.purge", params, http.StatusOK, nil)
+}
+
+// queryInt parses the non-negative integer query parameter name, falling
+// back to def when it is absent. On a bad value it answers 400 and returns
+// false.
+func queryInt(w http.ResponseWriter, r *http.Request, name string, def int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		http.Error(w, name+" must be a non-negative integer", http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestAdmin_CacheListsEntryMetadata(t *testing.T) {
+	s, err := NewServer(testConfig("http://localhost:8001"), logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	s.cache.SetWithTTL("GET:/a", http.StatusOK, []byte("0123456789"), http.Header{}, time.Minute)
+	s.cache.SetWithTTL("GET:/b", http.StatusNotFound, []byte("gone"), http.Header{}, -time.Second)
+	entry := cache.NewEntry("GET:/c", []byte("c"), http.Header{}, time.Hour)
+	entry.Backend = "http://localhost:8001"
+	s.cache.SetEntry(entry)
+
+	list := func(query string) cacheListResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.adminMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cache"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var resp cacheListResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	resp := list("")
+	if resp.Total != 3 || len(resp.Entries) != 3 {
+		t.Fatalf("Expected 3 entries, got total %d, listed %d", resp.Total, len(resp.Entries))
+	}
+	a, b, c := resp.Entries[0], resp.Entries[1], resp.Entries[2]
+	if a.Key != "GET:/a" || a.Status != http.StatusOK || a.SizeBytes != int64(len("GET:/a")+10) || a.Expired {
+		t.Errorf("Unexpected metadata for GET:/a: %+v", a)
+	}
+	if a.TTLRemaining <= 55 || a.TTLRemaining > 60 {
+		t.Errorf("Expected about 60s remaining for GET:/a, got %f", a.TTLRemaining)
+	}
+	if b.Key != "GET:/b" || b.Status != http.StatusNotFound || !b.Expired || b.TTLRemaining != 0 {
+		t.Errorf("Expected GET:/b to be reported expired with status 404, got %+v", b)
+	}
+	if c.Backend != "http://localhost:8001" {
+		t.Errorf("Expected the backend of GET:/c, got %+v", c)
+	}
+
+	page := list("?limit=1&offset=1")
+	if page.Total != 3 || len(page.Entries) != 1 || page.Entries[0].Key != "GET:/b" {
+		t.Errorf("Expected page with only GET:/b, got %+v", page)
+	}
+	if past := list("?offset=10"); len(past.Entries) != 0 {
+		t.Errorf("Expected no entries past the end, got %d", len(past.Entries))
+	}
+	if huge := list("?offset=9223372036854775807"); len(huge.Entries) != 0 {
+		t.Errorf("Expected no entries for a huge offset, got %d", len(huge.Entries))
+	}
+
+	rec := httptest.NewRecorder()
+	s.adminMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cache?limit=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative limit, got %d", rec.Code)
+	}
+}
+
+func TestAdmin_CachePurgeByPrefix(t *testing.T) {
+	cfg := testConfig("http://localhost:8001")
+	cfg.Admin.Token = "secret"
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	purge := func(target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.adminMux().ServeHTTP(rec, req)
+		return rec
+	}
+	for _, path := range []string{"/assets/a.js", "/assets/b.css?v=2", "/index.html"} {
+		s.cache.Set(getCacheKey(httptest.NewRequest(http.MethodGet, path, nil)), []byte("x"), http.Header{})
+	}
+
+	if rec := purge("/cache/purge?prefix=/assets/", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without the admin token, got %d", rec.Code)
+	}
+	if s.cache.Size() != 3 {
+		t.Fatalf("Expected an unauthorized purge to leave the cache alone, got %d entries", s.cache.Size())
+	}
+
+	rec := purge("/cache/purge?prefix=/assets/", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var resp map[string]int
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp["purged"] != 2 {
+		t.Errorf("Expected 2 purged, got %v", resp)
+	}
+	if s.cache.Size() != 1 {
+		t.Errorf("Expected only /index.html left, got %d entries", s.cache.Size())
+	}
+
+	if rec := purge("/cache/purge", "secret"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a prefix, got %d", rec.Code)
+	}
+}
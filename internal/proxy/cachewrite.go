@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"sync"
+
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/metrics"
+)
+
+const metricCacheWritesSkipped = "proxy_cache_writes_skipped_total"
+
+// cacheWriter bounds concurrent cache stores and collapses concurrent writes
+// of the same key. A write that finds its key already being stored, or no free
+// slot, is skipped: the response is still served and a later miss refills the
+// cache. A max of zero leaves total concurrency unlimited.
+type cacheWriter struct {
+	store   cache.Store
+	slots   chan struct{}
+	skipped *metrics.Counter
+
+	mu      sync.Mutex
+	writing map[string]struct{}
+}
+
+func newCacheWriter(store cache.Store, max int, registry *metrics.Registry) *cacheWriter {
+	cw := &cacheWriter{
+		store:   store,
+		skipped: registry.Counter(metricCacheWritesSkipped),
+		writing: make(map[string]struct{}),
+	}
+	if max > 0 {
+		cw.slots = make(chan struct{}, max)
+	}
+	return cw
+}
+
+// set stores entry and reports whether it did.
+func (cw *cacheWriter) set(entry *cache.Entry) bool {
+	key := entry.Key
+	cw.mu.Lock()
+	if _, busy := cw.writing[key]; busy {
+		cw.mu.Unlock()
+		cw.skipped.Inc()
+		return false
+	}
+	cw.writing[key] = struct{}{}
+	cw.mu.Unlock()
+
+	defer func() {
+		cw.mu.Lock()
+		delete(cw.writing, key)
+		cw.mu.Unlock()
+	}()
+
+	if cw.slots != nil {
+		select {
+		case cw.slots <- struct{}{}:
+			defer func() { <-cw.slots }()
+		default:
+			cw.skipped.Inc()
+			return false
+		}
+	}
+
+	cw.store.SetEntry(entry)
+	return true
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+// slowStore delays writes and records how many ran at once, overall and per
+// key.
+type slowStore struct {
+	cache.Store
+	active    atomic.Int32
+	maxActive atomic.Int32
+	writes    atomic.Int32
+
+	mu        sync.Mutex
+	perKey    map[string]int
+	maxPerKey int
+}
+
+func (s *slowStore) SetEntry(entry *cache.Entry) {
+	key := entry.Key
+	n := s.active.Add(1)
+	for {
+		max := s.maxActive.Load()
+		if n <= max || s.maxActive.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	s.mu.Lock()
+	s.perKey[key]++
+	if s.perKey[key] > s.maxPerKey {
+		s.maxPerKey = s.perKey[key]
+	}
+	s.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	s.Store.SetEntry(entry)
+	s.writes.Add(1)
+
+	s.mu.Lock()
+	s.perKey[key]--
+	s.mu.Unlock()
+	s.active.Add(-1)
+}
+
+func TestHandler_CacheWritesAreBounded(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("body " + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	store := &slowStore{Store: cache.NewCache(time.Minute), perKey: make(map[string]int)}
+	b := balancer.NewSRR()
+	b.AddBackend(balancer.NewBackend(backend.URL, 1))
+	cacheCfg := config.CacheConfig{Enabled: true, TTL: time.Minute, MaxConcurrentWrites: 3}
+	registry := metrics.NewRegistry()
+	handler := NewHandler(b, nil, store, logger.FromZap(zap.NewNop()), registry, cacheCfg, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	paths := make([]string, 0, 40)
+	for i := 0; i < 20; i++ {
+		paths = append(paths, fmt.Sprintf("/distinct/%d", i))
+		paths = append(paths, "/same")
+	}
+
+	var wg sync.WaitGroup
+	for _, path := range paths {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != http.StatusOK || rec.Body.String() != "body "+path {
+				t.Errorf("%s: expected proxied body, got %d %q", path, rec.Code, rec.Body.String())
+			}
+		}(path)
+	}
+	// Let every request reach the backend before any response returns, so
+	// their cache writes overlap.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if max := store.maxActive.Load(); max > 3 {
+		t.Errorf("Expected at most 3 concurrent cache writes, saw %d", max)
+	}
+	if store.maxPerKey > 1 {
+		t.Errorf("Expected writes of the same key to be collapsed, saw %d at once", store.maxPerKey)
+	}
+	skipped := registry.Counter(metricCacheWritesSkipped).Value()
+	if int(store.writes.Load())+int(skipped) != len(paths) {
+		t.Errorf("Expected every miss to be stored or skipped, got %d stored and %v skipped", store.writes.Load(), skipped)
+	}
+	if skipped == 0 {
+		t.Error("Expected some writes to be skipped under contention")
+	}
+}
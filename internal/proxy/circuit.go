@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"fmt"
+
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/circuit"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+const (
+	metricCircuitTrips = "proxy_circuit_breaker_trips_total"
+	metricCircuitOpen  = "proxy_circuit_breaker_open"
+)
+
+func newCircuitObserver(log *zap.Logger, registry *metrics.Registry, backendURL string) circuit.StateChangeFunc {
+	return func(from, to circuit.State, reason string) {
+		fields := []zap.Field{
+			zap.String("backend", backendURL),
+			zap.String("from", from.String()),
+			zap.String("to", to.String()),
+			zap.String("reason", reason),
+		}
+
+		switch to {
+		case circuit.StateOpen:
+			registry.Counter(metricCircuitTrips, "backend", backendURL).Inc()
+			if from != circuit.StateHalfOpen {
+				registry.Gauge(metricCircuitOpen).Inc()
+			}
+			log.Warn("Circuit breaker opened", fields...)
+		case circuit.StateHalfOpen:
+			log.Info("Circuit breaker half-open", fields...)
+		case circuit.StateClosed:
+			registry.Gauge(metricCircuitOpen).Dec()
+			log.Info("Circuit breaker closed", fields...)
+		}
+	}
+}
+
+// detachBreaker takes backend's breaker off the open-breaker gauge as the
+// backend leaves its pool; the breaker reports no state changes afterwards,
+// so requests still in flight to the backend cannot move the gauge again.
+func detachBreaker(registry *metrics.Registry, backend *balancer.Backend) {
+	breaker := backend.Breaker()
+	if breaker == nil {
+		return
+	}
+	if breaker.Detach() != circuit.StateClosed {
+		registry.Gauge(metricCircuitOpen).Dec()
+	}
+}
+
+func recordBackendOutcome(backend *balancer.Backend, statusCode int, err error) {
+	breaker := backend.Breaker()
+	if breaker == nil {
+		return
+	}
+
+	switch {
+	case err != nil:
+		breaker.RecordFailure(err.Error())
+	case statusCode >= 500:
+		breaker.RecordFailure(fmt.Sprintf("backend returned status %d", statusCode))
+	default:
+		breaker.RecordSuccess()
+	}
+}
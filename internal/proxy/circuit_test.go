@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/circuit"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestCircuitObserver_TripAndRecover(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	registry := metrics.NewRegistry()
+
+	backendURL := "http://localhost:8001"
+	backend := balancer.NewBackend(backendURL, 1)
+	backend.SetBreaker(circuit.NewBreaker(2, 10*time.Millisecond,
+		newCircuitObserver(zap.New(core), registry, backendURL)))
+
+	recordBackendOutcome(backend, 0, errors.New("connection refused"))
+	recordBackendOutcome(backend, 503, nil)
+
+	if backend.IsAvailable() {
+		t.Fatal("Backend should be unavailable while circuit is open")
+	}
+	if v := registry.Counter(metricCircuitTrips, "backend", backendURL).Value(); v != 1 {
+		t.Errorf("Expected 1 trip, got %d", v)
+	}
+	if v := registry.Gauge(metricCircuitOpen).Value(); v != 1 {
+		t.Errorf("Expected 1 open circuit, got %v", v)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if !backend.IsAvailable() || !backend.TryProbe() {
+		t.Fatal("Backend should admit a probe once the open timeout elapses")
+	}
+	recordBackendOutcome(backend, 200, nil)
+
+	if v := registry.Gauge(metricCircuitOpen).Value(); v != 0 {
+		t.Errorf("Expected 0 open circuits after recovery, got %v", v)
+	}
+
+	expected := []string{
+		"Circuit breaker opened",
+		"Circuit breaker half-open",
+		"Circuit breaker closed",
+	}
+	entries := logs.All()
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d log events, got %d", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Message != expected[i] {
+			t.Errorf("Event %d: expected %q, got %q", i, expected[i], entry.Message)
+		}
+		fields := entry.ContextMap()
+		if fields["backend"] != backendURL {
+			t.Errorf("Event %d: expected backend field %q, got %v", i, backendURL, fields["backend"])
+		}
+		if fields["reason"] == "" {
+			t.Errorf("Event %d: missing reason", i)
+		}
+	}
+}
+
+func TestServer_RemovingOpenBackendClearsGauge(t *testing.T) {
+	cfg := testConfig("http://a:8001", "http://b:8002")
+	cfg.CircuitBreaker = config.CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, OpenTimeout: time.Minute}
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	var removed *balancer.Backend
+	for _, backend := range s.balancer.GetBackends() {
+		if backend.URL == "http://b:8002" {
+			removed = backend
+		}
+	}
+	recordBackendOutcome(removed, 0, errors.New("connection refused"))
+	if v := s.metrics.Gauge(metricCircuitOpen).Value(); v != 1 {
+		t.Fatalf("Expected 1 open circuit, got %v", v)
+	}
+
+	next := *cfg
+	next.Backends = []config.BackendConfig{{URL: "http://a:8001", Weight: 1}}
+	s.Reload(&next)
+
+	if v := s.metrics.Gauge(metricCircuitOpen).Value(); v != 0 {
+		t.Errorf("Expected the removed backend's open circuit to be cleared, got %v", v)
+	}
+
+	// A request still in flight to the removed backend must not move it.
+	recordBackendOutcome(removed, 200, nil)
+	if v := s.metrics.Gauge(metricCircuitOpen).Value(); v != 0 {
+		t.Errorf("Expected the gauge to stay at 0, got %v", v)
+	}
+}
+
+func TestHandler_HalfOpenProbeReachesBackend(t *testing.T) {
+	a := namedBackend("a")
+	defer a.Close()
+	b := namedBackend("b")
+	defer b.Close()
+
+	pools := map[string]balancer.Balancer{
+		"srr":     balancer.NewSRR(),
+		"ip_hash": balancer.NewIPHash(),
+	}
+	for name, pool := range pools {
+		pool.AddBackend(balancer.NewBackend(a.URL, 1))
+		recovering := balancer.NewBackend(b.URL, 1)
+		breaker := circuit.NewBreaker(1, 10*time.Millisecond, nil)
+		recovering.SetBreaker(breaker)
+		pool.AddBackend(recovering)
+		handler := NewHandler(pool, nil, cache.NewCache(time.Minute), logger.FromZap(zap.NewNop()), metrics.NewRegistry(),
+			config.CacheConfig{}, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+		breaker.RecordFailure("status 503")
+		time.Sleep(20 * time.Millisecond)
+		// Availability checks, such as the warmer's, must not use up the probe.
+		for i := 0; i < 3; i++ {
+			if !recovering.IsAvailable() {
+				t.Fatalf("%s: expected the backend to be available once the open timeout elapsed", name)
+			}
+		}
+
+		var probed bool
+		for i := 0; i < 20 && !probed; i++ {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0." + strconv.Itoa(i+1) + ":1000"
+			handler.ServeHTTP(rec, req)
+			probed = rec.Body.String() == "b"
+		}
+		if !probed {
+			t.Errorf("%s: expected the half-open probe to reach the recovering backend", name)
+		}
+		if state := breaker.State(); state != circuit.StateClosed {
+			t.Errorf("%s: expected the breaker closed after the probe, got %s", name, state)
+		}
+	}
+}
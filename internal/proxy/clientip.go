@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"proxy-kp/pkg/access"
+)
+
+const clientIPKey contextKey = "clientIP"
+
+func contextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// forwardedClientIP returns the client IP of a request whose direct peer is
+// in trusted: the rightmost X-Forwarded-For entry that is not itself a
+// trusted proxy. Entries left of it were supplied by the client and cannot
+// be trusted. The peer is returned when it is not trusted or the header is
+// absent; an unparsable entry stops the walk at the last trusted hop.
+func forwardedClientIP(r *http.Request, trusted *access.Matcher) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !trusted.Contains(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !trusted.Contains(hop) {
+			break
+		}
+	}
+	return ip
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"proxy-kp/pkg/access"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/ratelimit"
+
+	"go.uber.org/zap"
+)
+
+func TestForwardedClientIP(t *testing.T) {
+	trusted, err := access.NewMatcher([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewMatcher failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		peer   string
+		xff    []string
+		expect string
+	}{
+		{"untrusted peer ignores header", "203.0.113.9:4000", []string{"198.51.100.1"}, "203.0.113.9"},
+		{"trusted peer without header", "10.0.0.1:4000", nil, "10.0.0.1"},
+		{"trusted peer", "10.0.0.1:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"rightmost untrusted wins", "10.0.0.1:4000", []string{"1.2.3.4, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"entries across header lines", "10.0.0.1:4000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"all hops trusted", "10.0.0.1:4000", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"garbage stops the walk", "10.0.0.1:4000", []string{"198.51.100.1, junk, 10.0.0.2"}, "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			for _, value := range tt.xff {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := forwardedClientIP(req, trusted); got != tt.expect {
+				t.Errorf("Expected %s, got %s", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestMiddleware_TrustedProxyRateLimitsByForwardedIP(t *testing.T) {
+	trusted, _ := access.NewMatcher([]string{"10.0.0.1"})
+	m := NewMiddleware(logger.FromZap(zap.NewNop()), ratelimit.NewLimiter(1, 1), nil, false, nil)
+	m.SetTrustedProxies(trusted)
+
+	var forwarded []string
+	h := m.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, getClientIP(r))
+	}))
+	send := func(client string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		req.Header.Set("X-Forwarded-For", client)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send("198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("Expected first client allowed, got %d", code)
+	}
+	if code := send("198.51.100.2"); code != http.StatusOK {
+		t.Errorf("Expected a second client behind the same balancer to get its own bucket, got %d", code)
+	}
+	if code := send("198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the first client to be limited, got %d", code)
+	}
+	if len(forwarded) != 2 || forwarded[0] != "198.51.100.1" || forwarded[1] != "198.51.100.2" {
+		t.Errorf("Expected handlers to see the forwarded client IPs, got %v", forwarded)
+	}
+}
@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"proxy-kp/internal/config"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// encodingWriter is the part of the gzip, flate, brotli and zstd writers the
+// compression middleware relies on; Reset lets writers be pooled.
+type encodingWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoder produces pooled writers for one Content-Encoding.
+type encoder struct {
+	name string
+	pool sync.Pool
+}
+
+func newEncoder(name string, level int) *encoder {
+	e := &encoder{name: name}
+	e.pool.New = func() any {
+		switch name {
+		case config.CompressionDeflate:
+			// Levels are validated at config load, so this cannot fail.
+			w, _ := flate.NewWriter(io.Discard, level)
+			return w
+		case config.CompressionBrotli:
+			if level == flate.DefaultCompression {
+				level = brotli.DefaultCompression
+			}
+			return brotli.NewWriterLevel(io.Discard, level)
+		case config.CompressionZstd:
+			zl := zstd.SpeedDefault
+			if level != flate.DefaultCompression {
+				zl = zstd.EncoderLevelFromZstd(level)
+			}
+			// One encoder per pooled writer; concurrency 1 keeps it from
+			// starting its own goroutines.
+			w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zl), zstd.WithEncoderConcurrency(1))
+			return w
+		default:
+			w, _ := gzip.NewWriterLevel(io.Discard, level)
+			return w
+		}
+	}
+	return e
+}
+
+func (e *encoder) get(w io.Writer) encodingWriter {
+	ew := e.pool.Get().(encodingWriter)
+	ew.Reset(w)
+	return ew
+}
+
+func (e *encoder) put(ew encodingWriter) {
+	ew.Reset(io.Discard)
+	e.pool.Put(ew)
+}
+
+// compressor negotiates a response encoding from the client's
+// Accept-Encoding. Encoders are listed in server preference order, the
+// configured algorithm first, which breaks ties between equal q-values.
+type compressor struct {
+	encoders []*encoder
+}
+
+func newCompressor(cfg config.CompressionConfig) *compressor {
+	preferred := cfg.Algorithm
+	if preferred == "" {
+		preferred = config.CompressionGzip
+	}
+	level := cfg.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	c := &compressor{encoders: []*encoder{newEncoder(preferred, level)}}
+	for _, name := range []string{config.CompressionGzip, config.CompressionDeflate, config.CompressionBrotli, config.CompressionZstd} {
+		if name != preferred {
+			c.encoders = append(c.encoders, newEncoder(name, level))
+		}
+	}
+	return c
+}
+
+// negotiate returns the encoder the client rates highest, or nil when it
+// accepts none of them.
+func (c *compressor) negotiate(acceptEncoding string) *encoder {
+	var best *encoder
+	var bestQ float64
+	for _, e := range c.encoders {
+		if q := encodingQuality(acceptEncoding, e.name); q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+// compressWriter encodes the response on the fly with the negotiated
+// encoding when the response is an uncompressed, compressible type. Cached
+// bodies are always stored as identity, so compression happens here on every
+// serve.
+type compressWriter struct {
+	http.ResponseWriter
+	enc     *encoder
+	ew      encodingWriter
+	decided bool
+}
+
+func (c *compressor) newWriter(w http.ResponseWriter, acceptEncoding string) *compressWriter {
+	return &compressWriter{
+		ResponseWriter: w,
+		enc:            c.negotiate(acceptEncoding),
+	}
+}
+
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if isInformational(statusCode) {
+		cw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if !cw.decided {
+		cw.decide(statusCode)
+	}
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.ew != nil {
+		return cw.ew.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.ew != nil {
+		cw.ew.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) Close() error {
+	if cw.ew == nil {
+		return nil
+	}
+	err := cw.ew.Close()
+	cw.enc.put(cw.ew)
+	cw.ew = nil
+	return err
+}
+
+func (cw *compressWriter) decide(statusCode int) {
+	cw.decided = true
+
+	header := cw.Header()
+	header.Add("Vary", "Accept-Encoding")
+
+	if cw.enc == nil || statusCode < 200 || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		return
+	}
+	if header.Get("Content-Encoding") != "" || !isCompressible(header.Get("Content-Type")) {
+		return
+	}
+
+	header.Set("Content-Encoding", cw.enc.name)
+	header.Del("Content-Length")
+	cw.ew = cw.enc.get(cw.ResponseWriter)
+}
+
+func isCompressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsEncoding(acceptEncoding, encoding string) bool {
+	return encodingQuality(acceptEncoding, encoding) > 0
+}
+
+// encodingQuality returns the q-value acceptEncoding gives encoding, falling
+// back to a "*" entry, or 0 when encoding is not acceptable.
+func encodingQuality(acceptEncoding, encoding string) float64 {
+	wildcard := 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		switch {
+		case strings.EqualFold(name, encoding):
+			return q
+		case name == "*":
+			wildcard = q
+		}
+	}
+	return wildcard
+}
@@ -0,0 +1,294 @@
+package proxy
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+)
+
+func gunzip(t *testing.T, body io.Reader) string {
+	t.Helper()
+
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip body: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Failed to read gzip body: %v", err)
+	}
+	return string(data)
+}
+
+func TestCompression_CachedEntryServedToGzipAndIdentityClients(t *testing.T) {
+	c := cache.NewCache(time.Minute)
+	m := NewMiddleware(logger.FromZap(zap.NewNop()), nil, c, true, nil)
+	m.SetCompression(config.CompressionConfig{Enabled: true})
+	h := m.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Cached request should not reach the handler")
+	}))
+
+	body := strings.Repeat("hello cache ", 50)
+	req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+	c.Set(getCacheKey(req), []byte(body), http.Header{"Content-Type": {"text/plain"}})
+
+	gzipReq := httptest.NewRequest(http.MethodGet, "/doc", nil)
+	gzipReq.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, gzipReq)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip response, got Content-Encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+	if got := gunzip(t, rec.Body); got != body {
+		t.Errorf("Decompressed body mismatch")
+	}
+
+	plainReq := httptest.NewRequest(http.MethodGet, "/doc", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, plainReq)
+
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected identity response, got Content-Encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Body.String() != body {
+		t.Errorf("Identity body mismatch")
+	}
+}
+
+func TestCompression_UpstreamGzipStoredAsIdentity(t *testing.T) {
+	body := strings.Repeat("upstream body ", 50)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write([]byte(body))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(body))
+		gz.Close()
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+	m := NewMiddleware(logger.FromZap(zap.NewNop()), nil, c, true, nil)
+	m.SetCompression(config.CompressionConfig{Enabled: true})
+	h := m.Chain(handler)
+
+	req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := gunzip(t, rec.Body); got != body {
+		t.Errorf("Decompressed body mismatch")
+	}
+
+	cached, headers, found := c.Get(getCacheKey(req))
+	if !found {
+		t.Fatal("Expected response to be cached")
+	}
+	if string(cached) != body || headers.Get("Content-Encoding") != "" {
+		t.Errorf("Expected identity body in cache, got encoding %q", headers.Get("Content-Encoding"))
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	cases := map[string]bool{
+		"gzip":                true,
+		"deflate, gzip;q=0.8": true,
+		"gzip;q=0":            false,
+		"br":                  false,
+		"":                    false,
+	}
+	for header, expected := range cases {
+		if got := acceptsEncoding(header, "gzip"); got != expected {
+			t.Errorf("acceptsEncoding(%q): expected %v, got %v", header, expected, got)
+		}
+	}
+}
+
+// chunkedGzipBackend streams body gzip-encoded in flushed chunks, with no
+// Content-Length, to clients that accept gzip.
+func chunkedGzipBackend(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write([]byte(body))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		for i := 0; i < len(body); i += 256 {
+			gz.Write([]byte(body[i:min(i+256, len(body))]))
+			gz.Flush()
+			w.(http.Flusher).Flush()
+		}
+		gz.Close()
+	}))
+}
+
+func TestHandler_ChunkedGzipBackendWithoutCompression(t *testing.T) {
+	body := strings.Repeat("chunked gzip body ", 200)
+	backend := chunkedGzipBackend(body)
+	defer backend.Close()
+
+	tests := []struct {
+		name      string
+		threshold int64
+	}{
+		{name: "buffered", threshold: 1 << 20},
+		{name: "streamed", threshold: 512},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: tt.threshold})
+			m := NewMiddleware(logger.FromZap(zap.NewNop()), nil, c, true, nil)
+			h := m.Chain(handler)
+
+			gzipReq := httptest.NewRequest(http.MethodGet, "/doc", nil)
+			gzipReq.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, gzipReq)
+
+			if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+				t.Errorf("Expected identity body for gzip client, got encoding %q and %d bytes",
+					rec.Header().Get("Content-Encoding"), rec.Body.Len())
+			}
+
+			plainReq := httptest.NewRequest(http.MethodGet, "/doc", nil)
+			rec = httptest.NewRecorder()
+			h.ServeHTTP(rec, plainReq)
+
+			if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+				t.Errorf("Expected identity body for non-gzip client, got encoding %q and %d bytes",
+					rec.Header().Get("Content-Encoding"), rec.Body.Len())
+			}
+
+			if _, headers, found := c.Get(getCacheKey(plainReq)); found && headers.Get("Content-Encoding") != "" {
+				t.Errorf("Expected cache to hold identity, got encoding %q", headers.Get("Content-Encoding"))
+			}
+		})
+	}
+}
+
+func TestHandler_UncacheableGzipPassesThrough(t *testing.T) {
+	body := strings.Repeat("chunked gzip body ", 200)
+	backend := chunkedGzipBackend(body)
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	req := httptest.NewRequest(http.MethodPost, "/doc", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip to pass through for uncacheable request, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	if got := gunzip(t, rec.Body); got != body {
+		t.Error("Decompressed body mismatch")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/doc", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+		t.Error("Expected identity body for client without Accept-Encoding")
+	}
+}
+
+func TestCompression_AlgorithmRoundTrip(t *testing.T) {
+	body := strings.Repeat("round trip ", 200)
+	decode := map[string]func(io.Reader) (io.Reader, error){
+		config.CompressionGzip: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		config.CompressionDeflate: func(r io.Reader) (io.Reader, error) {
+			return flate.NewReader(r), nil
+		},
+		config.CompressionBrotli: func(r io.Reader) (io.Reader, error) {
+			return brotli.NewReader(r), nil
+		},
+		config.CompressionZstd: func(r io.Reader) (io.Reader, error) {
+			return zstd.NewReader(r)
+		},
+	}
+
+	for algorithm, newReader := range decode {
+		for _, level := range []int{0, 1, 9} {
+			m := NewMiddleware(logger.FromZap(zap.NewNop()), nil, nil, false, nil)
+			m.SetCompression(config.CompressionConfig{Enabled: true, Algorithm: algorithm, Level: level})
+			h := m.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(body))
+			}))
+
+			// Serve twice so the second response reuses a pooled writer.
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("Accept-Encoding", algorithm)
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+
+				if got := rec.Header().Get("Content-Encoding"); got != algorithm {
+					t.Fatalf("%s level %d: expected Content-Encoding %q, got %q", algorithm, level, algorithm, got)
+				}
+				r, err := newReader(rec.Body)
+				if err != nil {
+					t.Fatalf("%s level %d: failed to open body: %v", algorithm, level, err)
+				}
+				data, err := io.ReadAll(r)
+				if err != nil || string(data) != body {
+					t.Errorf("%s level %d: round trip mismatch: %v", algorithm, level, err)
+				}
+			}
+		}
+	}
+}
+
+func TestCompressor_Negotiation(t *testing.T) {
+	cases := []struct {
+		algorithm      string
+		acceptEncoding string
+		want           string
+	}{
+		{config.CompressionGzip, "gzip, deflate", config.CompressionGzip},
+		{config.CompressionDeflate, "gzip, deflate", config.CompressionDeflate},
+		{config.CompressionGzip, "gzip;q=0.5, deflate", config.CompressionDeflate},
+		{config.CompressionDeflate, "deflate;q=0, gzip", config.CompressionGzip},
+		{config.CompressionGzip, "br, zstd", config.CompressionBrotli},
+		{config.CompressionZstd, "br, zstd", config.CompressionZstd},
+		{config.CompressionGzip, "gzip;q=0.5, br;q=0.8, zstd;q=0.9", config.CompressionZstd},
+		{config.CompressionBrotli, "br;q=0, gzip", config.CompressionGzip},
+		{config.CompressionGzip, "compress", ""},
+		{config.CompressionDeflate, "*", config.CompressionDeflate},
+		{config.CompressionGzip, "", ""},
+	}
+
+	for _, tc := range cases {
+		c := newCompressor(config.CompressionConfig{Enabled: true, Algorithm: tc.algorithm})
+		got := ""
+		if e := c.negotiate(tc.acceptEncoding); e != nil {
+			got = e.name
+		}
+		if got != tc.want {
+			t.Errorf("prefer %s, Accept-Encoding %q: expected %q, got %q", tc.algorithm, tc.acceptEncoding, tc.want, got)
+		}
+	}
+}
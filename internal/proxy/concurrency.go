@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"proxy-kp/pkg/metrics"
+)
+
+const (
+	metricBackendInflight    = "proxy_backend_inflight_requests"
+	metricConcurrencyRejects = "proxy_global_concurrency_rejected_total"
+)
+
+// concurrencyLimiter caps in-flight backend requests across all clients and
+// tracks the current in-flight count. A max of zero means unlimited.
+type concurrencyLimiter struct {
+	slots    chan struct{}
+	wait     time.Duration
+	inflight *metrics.Gauge
+	rejected *metrics.Counter
+}
+
+func newConcurrencyLimiter(max int, wait time.Duration, registry *metrics.Registry) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		wait:     wait,
+		inflight: registry.Gauge(metricBackendInflight),
+		rejected: registry.Counter(metricConcurrencyRejects),
+	}
+	if max > 0 {
+		l.slots = make(chan struct{}, max)
+	}
+	return l
+}
+
+// acquire takes a slot, waiting up to the configured wait for one to free up.
+// It reports false if no slot became available or ctx was cancelled first.
+func (l *concurrencyLimiter) acquire(ctx context.Context) bool {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			timer := time.NewTimer(l.wait)
+			defer timer.Stop()
+
+			select {
+			case l.slots <- struct{}{}:
+			case <-timer.C:
+				l.rejected.Inc()
+				return false
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+
+	l.inflight.Inc()
+	return true
+}
+
+func (l *concurrencyLimiter) release() {
+	l.inflight.Dec()
+	if l.slots != nil {
+		<-l.slots
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+)
+
+func TestHandler_GlobalConcurrencyLimit(t *testing.T) {
+	arrived := make(chan struct{}, 4)
+	unblock := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-unblock
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandlerWithCache(backend.URL, config.CacheConfig{}, config.ProxyConfig{
+		StreamThreshold:      1 << 20,
+		MaxGlobalConcurrent:  2,
+		GlobalConcurrentWait: 20 * time.Millisecond,
+	})
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+			codes[i] = rec.Code
+		}(i)
+	}
+	for range codes {
+		select {
+		case <-arrived:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for requests to reach the backend")
+		}
+	}
+
+	if v := handler.metrics.Gauge(metricBackendInflight).Value(); v != 2 {
+		t.Errorf("Expected 2 in-flight requests, got %v", v)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rejected", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when saturated, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After on saturation rejection")
+	}
+	if n := handler.metrics.Counter(metricConcurrencyRejects).Value(); n != 1 {
+		t.Errorf("Expected 1 rejection recorded, got %d", n)
+	}
+
+	close(unblock)
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Request %d: expected 200, got %d", i, code)
+		}
+	}
+	if v := handler.metrics.Gauge(metricBackendInflight).Value(); v != 0 {
+		t.Errorf("Expected in-flight count to return to 0, got %v", v)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/after", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected slots to be released, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsCache remembers backend hostname lookups for a fixed TTL so dials do
+// not re-resolve on every new connection. Once an entry expires the next dial
+// resolves again, picking up a backend whose address changed; an entry whose
+// addresses all fail to connect is dropped early for the same reason.
+type dnsCache struct {
+	ttl    time.Duration
+	lookup func(ctx context.Context, host string) ([]string, error)
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		lookup:  net.DefaultResolver.LookupHost,
+		now:     time.Now,
+		entries: make(map[string]dnsEntry),
+	}
+}
+
+// resolve returns the cached addresses for host, looking them up when
+// missing or expired. Failed lookups are not cached.
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+func (c *dnsCache) forget(host string) {
+	c.mu.Lock()
+	delete(c.entries, host)
+	c.mu.Unlock()
+}
+
+// dialContext wraps dial so hostnames are resolved through the cache and
+// each cached address is tried in turn. Literal IPs are dialed as is.
+func (c *dnsCache) dialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		ips, err := c.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				return nil, lastErr
+			}
+		}
+		c.forget(host)
+		if lastErr == nil {
+			lastErr = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+		return nil, lastErr
+	}
+}
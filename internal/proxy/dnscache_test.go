@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDNSCache_ReusesLookupWithinTTL(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	now := time.Now()
+	lookups := 0
+	addr := "127.0.0.1"
+	c := newDNSCache(time.Minute)
+	c.now = func() time.Time { return now }
+	c.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		return []string{addr}, nil
+	}
+
+	var dialed []string
+	var d net.Dialer
+	dial := c.dialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return d.DialContext(ctx, network, address)
+	})
+
+	for i := 0; i < 3; i++ {
+		conn, err := dial(context.Background(), "tcp", net.JoinHostPort("backend.internal", port))
+		if err != nil {
+			t.Fatalf("Dial %d failed: %v", i, err)
+		}
+		conn.Close()
+	}
+	if lookups != 1 {
+		t.Errorf("Expected dials within the TTL to share one lookup, got %d", lookups)
+	}
+
+	// After the TTL the host is resolved again and its new address used.
+	addr = "127.0.0.2"
+	now = now.Add(2 * time.Minute)
+	dial(context.Background(), "tcp", net.JoinHostPort("backend.internal", port))
+	if lookups != 2 {
+		t.Errorf("Expected a fresh lookup once the TTL passed, got %d", lookups)
+	}
+	if last := dialed[len(dialed)-1]; last != net.JoinHostPort("127.0.0.2", port) {
+		t.Errorf("Expected the re-resolved address to be dialed, got %s", last)
+	}
+}
+
+func TestDNSCache_ForgetsUnreachableAddresses(t *testing.T) {
+	lookups := 0
+	c := newDNSCache(time.Minute)
+	c.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		return []string{"10.0.0.1"}, nil
+	}
+	dial := c.dialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: errRefused{}}
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := dial(context.Background(), "tcp", "backend.internal:80"); err == nil {
+			t.Fatal("Expected dial to fail")
+		}
+	}
+	if lookups != 2 {
+		t.Errorf("Expected a failed dial to drop the cached lookup, got %d lookups", lookups)
+	}
+}
+
+type errRefused struct{}
+
+func (errRefused) Error() string { return "connection refused" }
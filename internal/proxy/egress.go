@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"proxy-kp/internal/config"
+)
+
+// egressProxy returns the transport Proxy function that sends backend
+// requests through proxy.upstream_proxy_url, except for hosts matching
+// proxy.upstream_no_proxy.
+func egressProxy(cfg config.ProxyConfig) (func(*http.Request) (*url.URL, error), error) {
+	proxyURL, err := url.Parse(cfg.UpstreamProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy upstream_proxy_url: %w", err)
+	}
+	bypass, err := newNoProxy(cfg.UpstreamNoProxy)
+	if err != nil {
+		return nil, err
+	}
+	return func(r *http.Request) (*url.URL, error) {
+		if bypass.matches(r.URL.Hostname()) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// noProxy matches hosts that bypass the egress proxy, following NO_PROXY
+// conventions: "example.com" matches the domain and its subdomains,
+// ".example.com" only subdomains, and "*" every host.
+type noProxy struct {
+	all     bool
+	nets    []*net.IPNet
+	ips     []net.IP
+	domains []string
+}
+
+func newNoProxy(entries []string) (*noProxy, error) {
+	n := &noProxy{}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case entry == "*":
+			n.all = true
+		case strings.Contains(entry, "/"):
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy upstream_no_proxy entry %q: %w", entry, err)
+			}
+			n.nets = append(n.nets, ipNet)
+		case net.ParseIP(entry) != nil:
+			n.ips = append(n.ips, net.ParseIP(entry))
+		default:
+			n.domains = append(n.domains, entry)
+		}
+	}
+	return n, nil
+}
+
+func (n *noProxy) matches(host string) bool {
+	if n.all {
+		return true
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, ipNet := range n.nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		for _, other := range n.ips {
+			if ip.Equal(other) {
+				return true
+			}
+		}
+		return false
+	}
+
+	host = strings.ToLower(host)
+	for _, domain := range n.domains {
+		if strings.HasPrefix(domain, ".") {
+			if strings.HasSuffix(host, domain) {
+				return true
+			}
+		} else if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
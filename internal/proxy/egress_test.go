@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"proxy-kp/internal/config"
+)
+
+func TestHandler_RoutesThroughEgressProxy(t *testing.T) {
+	var proxied []string
+	egress := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute backend URL.
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte("via egress"))
+	}))
+	defer egress.Close()
+
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer direct.Close()
+
+	proxyCfg := config.ProxyConfig{StreamThreshold: 1 << 20, UpstreamProxyURL: egress.URL}
+	handler, _ := newTestHandlerWithCache("http://backend.internal.test", config.CacheConfig{}, proxyCfg)
+	setEgressProxy(t, handler, proxyCfg)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items?id=1", nil))
+	if rec.Body.String() != "via egress" {
+		t.Fatalf("Expected the response from the egress proxy, got %d %q", rec.Code, rec.Body.String())
+	}
+	if len(proxied) != 1 || proxied[0] != "http://backend.internal.test/items?id=1" {
+		t.Errorf("Expected the egress proxy to receive the backend URL, got %v", proxied)
+	}
+
+	proxyCfg.UpstreamNoProxy = []string{"127.0.0.0/8"}
+	handler, _ = newTestHandlerWithCache(direct.URL, config.CacheConfig{}, proxyCfg)
+	setEgressProxy(t, handler, proxyCfg)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Body.String() != "direct" || len(proxied) != 1 {
+		t.Errorf("Expected a no_proxy backend to be reached directly, got %q after %d proxied requests", rec.Body.String(), len(proxied))
+	}
+}
+
+func setEgressProxy(t *testing.T, handler *Handler, cfg config.ProxyConfig) {
+	t.Helper()
+	egress, err := egressProxy(cfg)
+	if err != nil {
+		t.Fatalf("egressProxy failed: %v", err)
+	}
+	handler.SetEgressProxy(egress)
+}
+
+func TestNoProxy_Matches(t *testing.T) {
+	n, err := newNoProxy([]string{"example.com", ".internal", "10.0.0.0/8", "192.168.1.5", " Mixed.Case "})
+	if err != nil {
+		t.Fatalf("newNoProxy failed: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"api.example.com", true},
+		{"notexample.com", false},
+		{"internal", false},
+		{"db.internal", true},
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"192.168.1.5", true},
+		{"192.168.1.6", false},
+		{"mixed.case", true},
+	}
+	for _, tt := range tests {
+		if got := n.matches(tt.host); got != tt.want {
+			t.Errorf("matches(%q): expected %v, got %v", tt.host, tt.want, got)
+		}
+	}
+
+	all, err := newNoProxy([]string{"*"})
+	if err != nil {
+		t.Fatalf("newNoProxy failed: %v", err)
+	}
+	if !all.matches("anything.test") {
+		t.Error("Expected * to match every host")
+	}
+
+	if _, err := newNoProxy([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Expected an invalid CIDR to be rejected")
+	}
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"proxy-kp/pkg/balancer"
+)
+
+const metricBackendErrors = "proxy_backend_errors_total"
+
+// Classes of backend failure reported as error_class in logs and as the class
+// label of proxy_backend_errors_total.
+const (
+	errorClassDNS        = "dns"
+	errorClassDial       = "dial"
+	errorClassTimeout    = "timeout"
+	errorClassTLS        = "tls"
+	errorClassReset      = "reset"
+	errorClassBackend5xx = "backend_5xx"
+	errorClassOther      = "other"
+)
+
+// errorClass classifies a failed backend attempt: a transport error by its
+// cause, otherwise a 5xx status. It returns "" for a successful attempt.
+func errorClass(statusCode int, err error) string {
+	if err != nil {
+		return classifyError(err)
+	}
+	if statusCode >= 500 {
+		return errorClassBackend5xx
+	}
+	return ""
+}
+
+// classifyError returns the class of a backend transport error. DNS errors
+// are checked first since lookups can also time out.
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return errorClassDNS
+	}
+
+	var verifyErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	if classifyTLSError(err) != "" || errors.As(err, &verifyErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) {
+		return errorClassTLS
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return errorClassTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errorClassReset
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return errorClassDial
+	}
+	return errorClassOther
+}
+
+// countBackendError counts a failed attempt against backend under class; an
+// empty class is not counted.
+func (h *Handler) countBackendError(backend *balancer.Backend, class string) {
+	if class == "" {
+		return
+	}
+	h.metrics.Counter(metricBackendErrors, "backend", backend.URL, "class", class).Inc()
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// transportErr wraps err the way http.Client.Do reports transport failures.
+func transportErr(err error) error {
+	return &url.Error{Op: "Get", URL: "http://backend/", Err: err}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"dns", transportErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "backend", IsNotFound: true}}), errorClassDNS},
+		{"dns timeout", transportErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "i/o timeout", Name: "backend", IsTimeout: true}}), errorClassDNS},
+		{"dial", transportErr(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), errorClassDial},
+		{"timeout", transportErr(context.DeadlineExceeded), errorClassTimeout},
+		{"tls", transportErr(x509.UnknownAuthorityError{}), errorClassTLS},
+		{"reset", transportErr(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), errorClassReset},
+		{"other", transportErr(fmt.Errorf("malformed HTTP response")), errorClassOther},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("%s: expected class %q, got %q", tt.name, tt.want, got)
+		}
+	}
+
+	if got := errorClass(http.StatusServiceUnavailable, nil); got != errorClassBackend5xx {
+		t.Errorf("Expected a 503 classified as %q, got %q", errorClassBackend5xx, got)
+	}
+	if got := errorClass(http.StatusNotFound, nil); got != "" {
+		t.Errorf("Expected a 404 not to be classified, got %q", got)
+	}
+}
+
+func TestHandler_BackendErrorsClassified(t *testing.T) {
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	for _, tt := range []struct {
+		backend string
+		want    string
+	}{
+		{dead.URL, errorClassDial},
+		{slow.URL, errorClassTimeout},
+	} {
+		core, logs := observer.New(zap.InfoLevel)
+		registry := metrics.NewRegistry()
+		b := balancer.NewSRR()
+		b.AddBackend(balancer.NewBackend(tt.backend, 1))
+		proxyCfg := config.ProxyConfig{StreamThreshold: 1 << 20, ResponseHeaderTimeout: 20 * time.Millisecond}
+		handler := NewHandler(b, nil, cache.NewCache(time.Minute), logger.FromZap(zap.New(core)), registry, config.CacheConfig{}, proxyCfg)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("%s: expected 502, got %d", tt.want, rec.Code)
+		}
+		if v := registry.Counter(metricBackendErrors, "backend", tt.backend, "class", tt.want).Value(); v != 1 {
+			t.Errorf("%s: expected 1 error counted under its class, got %v", tt.want, v)
+		}
+		entries := logs.FilterMessage("Backend request failed").All()
+		if len(entries) != 1 || entries[0].ContextMap()["error_class"] != tt.want {
+			t.Errorf("%s: expected a failure log with error_class %q, got %v", tt.want, tt.want, entries)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"expvar"
+	"net/http"
+	"sync"
+)
+
+// expvarRoot is the /debug/vars key the proxy's counters are published under.
+const expvarRoot = "proxy"
+
+var (
+	expvarVars    = new(expvar.Map)
+	expvarPublish sync.Once
+)
+
+// expvarStats holds the counters published under "proxy" in /debug/vars. A
+// nil *expvarStats records nothing.
+type expvarStats struct {
+	requests    expvar.Int
+	errors      expvar.Int
+	cacheHits   expvar.Int
+	cacheMisses expvar.Int
+}
+
+// newExpvarStats publishes fresh counters, and healthy as healthy_backends,
+// replacing those of any server created earlier in the process; expvar names
+// can only be published once.
+func newExpvarStats(healthy func() int) *expvarStats {
+	expvarPublish.Do(func() {
+		expvar.Publish(expvarRoot, expvarVars)
+	})
+
+	s := &expvarStats{}
+	expvarVars.Set("requests", &s.requests)
+	expvarVars.Set("errors", &s.errors)
+	expvarVars.Set("cache_hits", &s.cacheHits)
+	expvarVars.Set("cache_misses", &s.cacheMisses)
+	expvarVars.Set("healthy_backends", expvar.Func(func() any { return healthy() }))
+	return s
+}
+
+// recordResponse counts a completed request, and an error if it ended in a
+// 5xx status.
+func (s *expvarStats) recordResponse(status int) {
+	if s == nil {
+		return
+	}
+	s.requests.Add(1)
+	if status >= http.StatusInternalServerError {
+		s.errors.Add(1)
+	}
+}
+
+func (s *expvarStats) recordCache(hit bool) {
+	if s == nil {
+		return
+	}
+	if hit {
+		s.cacheHits.Add(1)
+		return
+	}
+	s.cacheMisses.Add(1)
+}
+
+// healthyBackends counts available backends across every pool.
+func (s *Server) healthyBackends() int {
+	healthy := 0
+	for _, pool := range s.pools() {
+		healthy += pool.HealthyCount()
+	}
+	return healthy
+}
+
+// handleDebugVars serves the expvar variables when server.expvar is enabled.
+func (s *Server) handleDebugVars(w http.ResponseWriter, r *http.Request) {
+	if s.expvars == nil {
+		http.NotFound(w, r)
+		return
+	}
+	expvar.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestServer_ExpvarCounters(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL, "http://localhost:8002")
+	cfg.RateLimit.Enabled = false
+	cfg.Cache.Enabled = true
+	cfg.Server.Expvar.Enabled = true
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	s.balancer.SetHealthy("http://localhost:8002", false)
+
+	public := s.publicHandler()
+	for _, path := range []string{"/page", "/page", "/fail"} {
+		public.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	s.adminMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from /debug/vars, got %d", rec.Code)
+	}
+
+	var vars struct {
+		Proxy map[string]int64 `json:"proxy"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&vars); err != nil {
+		t.Fatalf("Failed to decode /debug/vars: %v", err)
+	}
+	want := map[string]int64{
+		"requests":         3,
+		"errors":           1,
+		"cache_hits":       1,
+		"cache_misses":     2,
+		"healthy_backends": 1,
+	}
+	for key, value := range want {
+		got, ok := vars.Proxy[key]
+		if !ok {
+			t.Errorf("Expected proxy.%s in /debug/vars", key)
+			continue
+		}
+		if got != value {
+			t.Errorf("Expected proxy.%s = %d, got %d", key, value, got)
+		}
+	}
+}
+
+func TestServer_ExpvarDisabled(t *testing.T) {
+	s, err := NewServer(testConfig("http://localhost:8001"), logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.adminMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with expvar disabled, got %d", rec.Code)
+	}
+}
@@ -1,49 +1,148 @@
 package proxy
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"proxy-kp/internal/config"
 	"proxy-kp/pkg/balancer"
 	"proxy-kp/pkg/cache"
 	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
 
 	"go.uber.org/zap"
 )
 
 type Handler struct {
-	balancer      *balancer.SRR
-	cache         *cache.Cache
-	logger        *logger.Logger
-	cacheEnabled  bool
-	client        *http.Client
+	balancer    balancer.Balancer
+	upstreams   map[string]balancer.Balancer
+	cache       cache.Store
+	writer      *cacheWriter
+	logger      *logger.Logger
+	cacheConfig config.CacheConfig
+	cacheOn     atomic.Bool
+	config      config.ProxyConfig
+	shadow      *Shadow
+	metrics     *metrics.Registry
+	latency     *latencyAlerter
+	concurrency *concurrencyLimiter
+	prefetch    *prefetcher
+	stripHeader []string
+	retries     *retryBudget
+	rewriter    *bodyRewriter
+	websocket   config.WebSocketConfig
+	affinity    *sessionAffinity
+	idempotency *idempotencyGuard
+	client      *http.Client
 }
 
 func NewHandler(
-	balancer *balancer.SRR,
-	cache *cache.Cache,
+	balancer balancer.Balancer,
+	upstreams map[string]balancer.Balancer,
+	cache cache.Store,
 	logger *logger.Logger,
-	cacheEnabled bool,
+	registry *metrics.Registry,
+	cacheCfg config.CacheConfig,
+	proxyCfg config.ProxyConfig,
 ) *Handler {
-	return &Handler{
-		balancer:     balancer,
-		cache:        cache,
-		logger:       logger,
-		cacheEnabled: cacheEnabled,
+	h := &Handler{
+		balancer:    balancer,
+		upstreams:   upstreams,
+		cache:       cache,
+		writer:      newCacheWriter(cache, cacheCfg.MaxConcurrentWrites, registry),
+		logger:      logger,
+		cacheConfig: cacheCfg,
+		config:      proxyCfg,
+		metrics:     registry,
+		latency:     newLatencyAlerter(proxyCfg.LatencyAlertThreshold, registry, logger),
+		concurrency: newConcurrencyLimiter(proxyCfg.MaxGlobalConcurrent, proxyCfg.GlobalConcurrentWait, registry),
+		retries:     newRetryBudget(proxyCfg.Retry, registry),
+		rewriter:    newBodyRewriter(proxyCfg.BodyRewrite),
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Transport: newTransport(proxyCfg),
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse
 			},
 		},
 	}
+	h.idempotency = newIdempotencyGuard(cache, proxyCfg.IdempotencyTTL, proxyCfg.StreamThreshold, registry, logger)
+	h.cacheOn.Store(cacheCfg.Enabled)
+	// The prefetcher only runs after a response is cached, so it is built
+	// even while caching is off in case a reload enables it.
+	if cacheCfg.Prefetch.Enabled {
+		h.prefetch = newPrefetcher(h, cacheCfg.Prefetch.MaxConcurrent)
+	}
+	return h
+}
+
+// SetCacheEnabled turns response caching on or off for new requests. It is
+// safe to call while serving.
+func (h *Handler) SetCacheEnabled(enabled bool) {
+	h.cacheOn.Store(enabled)
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	backend, err := h.balancer.NextBackend()
+	if key := h.idempotency.key(r); key != "" {
+		h.idempotency.serve(w, r, key, h.proxy)
+		return
+	}
+	h.proxy(w, r)
+}
+
+func (h *Handler) proxy(w http.ResponseWriter, r *http.Request) {
+	if reason := invalidTarget(r.URL); reason != "" {
+		h.logger.Warn("Rejecting malformed request target",
+			zap.String("target", r.RequestURI),
+			zap.String("reason", reason))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if h.config.MaxHops > 0 {
+		if hops := requestHops(r); hops >= h.config.MaxHops {
+			h.logger.Warn("Proxy loop detected",
+				zap.String("path", r.URL.Path),
+				zap.String("client_ip", getClientIP(r)),
+				zap.Int("hops", hops),
+				zap.Int("max_hops", h.config.MaxHops))
+			http.Error(w, "Loop Detected", http.StatusLoopDetected)
+			return
+		}
+	}
+
+	if (h.config.StripGetBody || h.config.RejectGetBody) && unexpectedBody(r) {
+		if h.config.RejectGetBody {
+			h.logger.Warn("Rejecting request body on bodyless method",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("client_ip", getClientIP(r)))
+			http.Error(w, "Bad Request: request body not allowed", http.StatusBadRequest)
+			return
+		}
+		h.logger.Debug("Discarding request body on bodyless method",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path))
+		r.Body.Close()
+		r.Body = http.NoBody
+		r.ContentLength = 0
+	}
+
+	h.retries.observe()
+
+	pool := h.balancerFor(r)
+	backend, err := h.pickBackend(pool, r)
 	if err != nil {
 		h.logger.Error("No healthy backends available",
 			zap.String("path", r.URL.Path),
@@ -51,25 +150,73 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
 		return
 	}
+	// A retry replaces backend, releasing the previous one; this releases
+	// whichever is current once the response is done.
+	defer func() { pool.Release(backend) }()
 
-	targetURL, err := url.Parse(backend.URL)
-	if err != nil {
-		h.logger.Error("Failed to parse backend URL",
-			zap.String("backend", backend.URL),
+	if err := h.retries.bufferForRetry(r, h.config.StreamThreshold); err != nil {
+		if bodyTooLarge(err) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		h.logger.Error("Failed to read request body",
+			zap.String("path", r.URL.Path),
 			zap.Error(err))
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	// Construct full URL with path and query string
-	proxyURL := targetURL.ResolveReference(&url.URL{
-		Path:       r.URL.Path,
-		RawPath:    r.URL.RawPath,
-		RawQuery:   r.URL.RawQuery,
-		Fragment:   r.URL.Fragment,
-	})
+	if h.shadow != nil && h.shadow.ShouldMirror() {
+		body, err := io.ReadAll(r.Body)
+		if bodyTooLarge(err) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to read request body",
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		r.Body = http.NoBody
+		if len(body) > 0 {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		h.shadow.Mirror(r, body)
+	}
+
+	// An expired entry with validators is revalidated instead of fetched
+	// again; the conditional headers go on a copy of the request.
+	stale := h.staleForRevalidation(r)
+	if stale != nil {
+		r = r.Clone(r.Context())
+		addValidators(r.Header, stale)
+	}
 
-	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, proxyURL.String(), r.Body)
+	ctx := httptrace.WithClientTrace(r.Context(), relayInformational(w))
+	timing := timingFromContext(r.Context())
+	if timing != nil {
+		ctx = httptrace.WithClientTrace(ctx, timing.trace())
+	}
+	// WebSocket tunnels outlive any request timeout; their limits are
+	// applied by the tunnel itself.
+	if h.config.RequestTimeout > 0 && !isWebSocketUpgrade(r) {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.config.RequestTimeout)
+		defer cancel()
+	}
+	var reuse connReuse
+	ctx = httptrace.WithClientTrace(ctx, reuse.trace())
+	proxyReq, err := h.newProxyRequest(ctx, r, backend)
+	if errors.Is(err, errInvalidTarget) {
+		h.logger.Warn("Rejecting request target that does not compose a valid backend URL",
+			zap.String("target", r.RequestURI),
+			zap.String("backend", backend.URL),
+			zap.Error(err))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to create proxy request",
 			zap.String("backend", backend.URL),
@@ -78,69 +225,526 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	copyHeader(proxyReq.Header, r.Header)
-
-	h.setProxyHeaders(r, proxyReq, targetURL)
-
 	log := h.logger.WithBackend(backend.URL)
 	log.Info("Proxying request",
 		zap.String("method", r.Method),
 		zap.String("path", r.URL.Path),
 		zap.String("backend", backend.URL))
 
+	// WebSocket tunnels are long-lived, so they neither hold a global
+	// concurrency slot nor go through retries and caching.
+	if isWebSocketUpgrade(r) {
+		h.serveWebSocket(w, r, proxyReq, backend, log)
+		return
+	}
+
+	if !h.concurrency.acquire(r.Context()) {
+		log.Warn("Global backend concurrency limit reached",
+			zap.String("path", r.URL.Path),
+			zap.Int("limit", h.config.MaxGlobalConcurrent))
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.concurrency.release()
+
+	timing.markSent()
 	start := time.Now()
 	resp, err := h.client.Do(proxyReq)
+	// A replayable request that failed on a stale keep-alive connection is
+	// sent once more to the same backend without charging the retry budget.
+	if reuse.staleReset(err) && retryable(r) && r.Context().Err() == nil {
+		if r.GetBody != nil {
+			r.Body, _ = r.GetBody()
+		}
+		if retryReq, buildErr := h.newProxyRequest(ctx, r, backend); buildErr == nil {
+			h.metrics.Counter(metricStaleConnRetries, "backend", backend.URL).Inc()
+			log.Info("Backend reset a reused connection, retrying",
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+			start = time.Now()
+			resp, err = h.client.Do(retryReq)
+		}
+	}
+	// Each retry goes to a backend this request has not tried yet.
+	tried := map[*balancer.Backend]bool{backend: true}
+	for attempt := 1; h.retries.failed(resp, err) && r.Context().Err() == nil && len(tried) < len(pool.GetBackends()) && h.retries.allow(r, attempt); attempt++ {
+		next, nextErr := nextUntried(pool, tried)
+		if nextErr != nil {
+			break
+		}
+		tried[next] = true
+		if r.GetBody != nil {
+			r.Body, _ = r.GetBody()
+		}
+		retryReq, buildErr := h.newProxyRequest(ctx, r, next)
+		if buildErr != nil {
+			pool.Release(next)
+			break
+		}
+		if err != nil {
+			recordBackendOutcome(backend, 0, err)
+			class := classifyError(err)
+			h.countBackendError(backend, class)
+			log.Warn("Backend request failed, retrying",
+				zap.String("path", r.URL.Path),
+				zap.String("next_backend", next.URL),
+				zap.Int("attempt", attempt),
+				zap.String("error_class", class),
+				zap.Error(err))
+		} else {
+			recordBackendOutcome(backend, resp.StatusCode, nil)
+			h.countBackendError(backend, errorClass(resp.StatusCode, nil))
+			log.Warn("Backend returned retryable status, retrying",
+				zap.String("path", r.URL.Path),
+				zap.String("next_backend", next.URL),
+				zap.Int("attempt", attempt),
+				zap.Int("status", resp.StatusCode))
+			resp.Body.Close()
+		}
+
+		pool.Release(backend)
+		backend = next
+		log = h.logger.WithBackend(backend.URL)
+		start = time.Now()
+		resp, err = h.client.Do(retryReq)
+	}
 	if err != nil {
+		if r.Context().Err() != nil {
+			log.Debug("Client cancelled request before backend responded",
+				zap.String("path", r.URL.Path))
+			return
+		}
+		if bodyTooLarge(err) {
+			log.Warn("Request body exceeds limit",
+				zap.String("path", r.URL.Path))
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		recordBackendOutcome(backend, 0, err)
+		class := classifyError(err)
+		h.countBackendError(backend, class)
+		if reason := classifyTLSError(err); reason != "" {
+			h.metrics.Counter(metricBackendTLSErrors, "backend", backend.URL, "reason", reason).Inc()
+			log.Error("Backend TLS certificate verification failed",
+				zap.String("path", r.URL.Path),
+				zap.String("error_class", class),
+				zap.String("tls_error", reason),
+				zap.Error(err))
+			if h.serveStale(w, r, log, "backend TLS certificate "+reason) {
+				return
+			}
+			http.Error(w, "Bad Gateway: backend certificate verification failed", http.StatusBadGateway)
+			return
+		}
 		log.Error("Backend request failed",
 			zap.String("path", r.URL.Path),
+			zap.String("error_class", class),
 			zap.Error(err))
+		if h.serveStale(w, r, log, err.Error()) {
+			return
+		}
 		http.Error(w, "Bad Gateway", http.StatusBadGateway)
 		return
 	}
 	duration := time.Since(start)
 	defer resp.Body.Close()
+	if h.config.ServerTiming {
+		status := cacheStatusMiss
+		if !h.cacheOn.Load() || r.Method != http.MethodGet {
+			status = cacheStatusBypass
+		} else if stale != nil && resp.StatusCode == http.StatusNotModified {
+			status = cacheStatusRevalidated
+		}
+		setServerTiming(w, duration, status)
+	}
+	removeHopHeaders(resp.Header)
+	for _, key := range h.stripHeader {
+		resp.Header.Del(key)
+	}
+	if !h.checkResponseHeader(resp, backend, log, r.URL.Path) {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	recordBackendOutcome(backend, resp.StatusCode, nil)
+	h.latency.observe(backend, duration)
+	if class := errorClass(resp.StatusCode, nil); class != "" {
+		h.countBackendError(backend, class)
+		log.Warn("Backend returned server error",
+			zap.String("path", r.URL.Path),
+			zap.String("error_class", class),
+			zap.Int("status", resp.StatusCode))
+	}
 
 	log.Debug("Backend response received",
 		zap.String("path", r.URL.Path),
 		zap.Int("status", resp.StatusCode),
 		zap.Duration("duration", duration))
 
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
+	if stale != nil && resp.StatusCode == http.StatusNotModified {
+		h.serveRevalidated(w, r, log, stale, resp, backend)
+		timing.markDone()
+		return
 	}
 
-	w.WriteHeader(resp.StatusCode)
+	if resp.StatusCode >= 500 && h.serveStale(w, r, log, fmt.Sprintf("backend returned status %d", resp.StatusCode)) {
+		return
+	}
+
+	// Reads observe client cancellation between chunks, so a disconnect
+	// aborts the upstream transfer and a partial body is never cached.
+	upstream := contextReader{ctx: r.Context(), r: resp.Body}
+
+	ttl, cacheable := h.cacheTTL(resp.StatusCode)
+	cacheable = cacheable && h.cacheOn.Load() && r.Method == http.MethodGet
+	if cacheable {
+		if ttl, cacheable = responseTTL(resp.Header, ttl, time.Now()); !cacheable {
+			log.Debug("Response not cached, backend forbids storing it",
+				zap.String("path", r.URL.Path),
+				zap.Strings("cache_control", resp.Header.Values("Cache-Control")))
+		}
+	}
+	vary, varyOK := parseVary(resp.Header)
+	if cacheable && !varyOK {
+		cacheable = false
+		log.Debug("Response not cached, it varies on every request header",
+			zap.String("path", r.URL.Path))
+	}
+	rewrite := h.rewriter.applies(resp.Header)
+	// Only responses to cache or rewrite are buffered; the rest stream.
+	if !cacheable && !rewrite {
+		h.writeResponseHeader(w, r, resp, backend)
+		h.streamResponse(w, r, log, upstream, nil)
+		timing.markDone()
+		return
+	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, overflow, err := readUpTo(upstream, h.config.StreamThreshold)
 	if err != nil {
+		if r.Context().Err() != nil {
+			log.Debug("Client cancelled request while reading backend response",
+				zap.String("path", r.URL.Path))
+			return
+		}
 		log.Error("Failed to read response body",
 			zap.String("path", r.URL.Path),
 			zap.Error(err))
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	if rewrite && !overflow {
+		body = h.rewriter.rewrite(resp.Header, body)
+	}
+
+	h.writeResponseHeader(w, r, resp, backend)
+
+	if overflow {
+		log.Debug("Response exceeds stream threshold, streaming without caching",
+			zap.String("path", r.URL.Path),
+			zap.Int64("threshold", h.config.StreamThreshold))
+		h.streamResponse(w, r, log, upstream, body)
+		timing.markDone()
 		return
 	}
 
-	if h.cacheEnabled && r.Method == http.MethodGet && resp.StatusCode == http.StatusOK {
+	timing.markDone()
+
+	if cacheable && r.Context().Err() == nil {
 		cacheKey := getCacheKey(r)
-		h.cache.Set(cacheKey, body, resp.Header)
-		log.Debug("Response cached",
-			zap.String("key", cacheKey),
-			zap.Int("size", len(body)))
+		entry := cache.NewEntry(cacheKey, body, resp.Header, ttl)
+		entry.StatusCode = resp.StatusCode
+		entry.Backend = backend.URL
+		if len(vary) > 0 {
+			entry.Key = variantKey(cacheKey, r, vary)
+			entry.Vary = vary
+		}
+		if h.writer.set(entry) {
+			// Written after the variant, so a lookup that finds the
+			// marker also finds the variant.
+			if len(vary) > 0 {
+				h.cache.SetEntry(varyMarker(entry, cacheKey))
+			}
+			log.Debug("Response cached",
+				zap.String("key", entry.Key),
+				zap.Int("status", resp.StatusCode),
+				zap.Duration("ttl", ttl),
+				zap.Int("size", len(body)))
+			if h.prefetch != nil {
+				h.prefetch.maybePrefetch(r, resp.Header)
+			}
+		} else {
+			log.Debug("Cache write skipped, key busy or write limit reached",
+				zap.String("key", entry.Key))
+		}
 	}
 
 	w.Write(body)
 }
 
+// writeResponseHeader copies the backend response headers and status to w.
+func (h *Handler) writeResponseHeader(w http.ResponseWriter, r *http.Request, resp *http.Response, backend *balancer.Backend) {
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	// Set after a retry may have moved the request to another backend.
+	h.affinity.setCookie(w, r, backend)
+
+	w.WriteHeader(resp.StatusCode)
+}
+
+// streamResponse writes the already read prefix followed by the rest of
+// upstream to w, flushing as it goes.
+func (h *Handler) streamResponse(w http.ResponseWriter, r *http.Request, log *logger.Logger, upstream io.Reader, prefix []byte) {
+	_, err := copyFlushing(w, io.MultiReader(bytes.NewReader(prefix), upstream))
+	if err == nil {
+		return
+	}
+	if r.Context().Err() != nil {
+		log.Debug("Client cancelled request while streaming response",
+			zap.String("path", r.URL.Path))
+		return
+	}
+	log.Error("Failed to stream response body",
+		zap.String("path", r.URL.Path),
+		zap.Error(err))
+}
+
+// errInvalidTarget marks a client request target that does not compose a
+// valid backend URL.
+var errInvalidTarget = errors.New("invalid request target")
+
+// newProxyRequest builds the request sent to backend for r: the backend URL
+// joined with the client's path and query, the client's headers, the proxy
+// headers and the backend's configured request headers.
+func (h *Handler) newProxyRequest(ctx context.Context, r *http.Request, backend *balancer.Backend) (*http.Request, error) {
+	targetURL, err := url.Parse(backend.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse backend URL: %w", err)
+	}
+
+	// Construct full URL with path and query string
+	proxyURL := targetURL.ResolveReference(&url.URL{
+		Path:     r.URL.Path,
+		RawPath:  r.URL.RawPath,
+		RawQuery: r.URL.RawQuery,
+		Fragment: r.URL.Fragment,
+	})
+	if _, err := url.Parse(proxyURL.String()); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidTarget, err)
+	}
+
+	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, proxyURL.String(), r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	copyHeader(proxyReq.Header, r.Header)
+	removeHopHeaders(proxyReq.Header)
+	if isWebSocketUpgrade(r) {
+		// The upgrade is the one hop-by-hop exchange the proxy relays.
+		proxyReq.Header.Set("Connection", "Upgrade")
+		proxyReq.Header.Set("Upgrade", r.Header.Get("Upgrade"))
+	} else if strings.Contains(strings.ToLower(r.Header.Get("Te")), "trailers") {
+		// Backends may only send trailers when told the client accepts them.
+		proxyReq.Header.Set("Te", "trailers")
+	}
+	// Cacheable requests leave Accept-Encoding to the transport, which asks
+	// for gzip and decodes it (streaming), so the cache only ever holds
+	// identity bodies that suit every client. Other requests pass the
+	// client's encoding preferences through end to end.
+	if h.cacheOn.Load() && r.Method == http.MethodGet {
+		proxyReq.Header.Del("Accept-Encoding")
+	}
+
+	h.setProxyHeaders(r, proxyReq, targetURL)
+	for key, value := range backend.RequestHeaders() {
+		proxyReq.Header.Set(key, value)
+	}
+	return proxyReq, nil
+}
+
+// serveStale writes a present-but-possibly-expired cache entry in place of a
+// backend error when cache.serve_stale_on_error is enabled. It reports
+// whether a response was written.
+func (h *Handler) serveStale(w http.ResponseWriter, r *http.Request, log *logger.Logger, reason string) bool {
+	if !h.cacheOn.Load() || !h.cacheConfig.ServeStaleOnError || r.Method != http.MethodGet {
+		return false
+	}
+
+	entry, cacheKey, found := lookupCache(r, h.cache.GetStaleEntry)
+	if !found {
+		return false
+	}
+	if staleness := time.Since(entry.ExpiresAt); h.cacheConfig.MaxStaleAge > 0 && staleness > h.cacheConfig.MaxStaleAge {
+		log.Warn("Stale cache entry exceeds max stale age, not serving it",
+			zap.String("key", cacheKey),
+			zap.Duration("staleness", staleness),
+			zap.Duration("max_stale_age", h.cacheConfig.MaxStaleAge))
+		return false
+	}
+
+	log.Warn("Serving stale cache entry on backend error",
+		zap.String("key", cacheKey),
+		zap.String("reason", reason))
+
+	if h.config.ServerTiming {
+		setServerTiming(w, 0, cacheStatusStale)
+	}
+	copyHeader(w.Header(), entry.Header)
+	w.Header().Add("Warning", `110 - "Response is Stale"`)
+	w.WriteHeader(entry.StatusCode)
+	w.Write(entry.Value)
+	return true
+}
+
+// cacheTTL reports whether a response with the given status is cacheable and
+// for how long. An exact status in cache.ttl_by_status wins over its class;
+// 200 is cacheable with the global TTL when not listed.
+func (h *Handler) cacheTTL(statusCode int) (time.Duration, bool) {
+	if ttl, ok := h.cacheConfig.TTLByStatus[strconv.Itoa(statusCode)]; ok {
+		return ttl, true
+	}
+	if ttl, ok := h.cacheConfig.TTLByStatus[fmt.Sprintf("%dxx", statusCode/100)]; ok {
+		return ttl, true
+	}
+	if statusCode == http.StatusOK {
+		return h.cacheConfig.TTL, true
+	}
+	return 0, false
+}
+
+// SetSessionAffinity pins clients to backends with a signed cookie when
+// cfg.Enabled is set.
+func (h *Handler) SetSessionAffinity(cfg config.SessionAffinityConfig) {
+	h.affinity = newSessionAffinity(cfg)
+}
+
+func (h *Handler) SetShadow(shadow *Shadow) {
+	h.shadow = shadow
+}
+
+// SetEgressProxy sends backend requests through proxy, a transport Proxy
+// function such as egressProxy returns.
+func (h *Handler) SetEgressProxy(proxy func(*http.Request) (*url.URL, error)) {
+	h.client.Transport.(*http.Transport).Proxy = proxy
+}
+
+// SetResponseHeaderStrip sets backend response headers that are removed before
+// the response is cached or written to the client.
+func (h *Handler) SetResponseHeaderStrip(names []string) {
+	h.stripHeader = make([]string, 0, len(names))
+	for _, name := range names {
+		h.stripHeader = append(h.stripHeader, http.CanonicalHeaderKey(name))
+	}
+}
+
+// pickBackend returns the backend r's affinity cookie pins it to while that
+// backend is available, otherwise the pool's choice for r, keyed on the
+// client IP when the pool supports it. The chosen backend's circuit is
+// claimed; if another request took its half-open probe in the meantime, an
+// untried backend is picked instead.
+func (h *Handler) pickBackend(pool balancer.Balancer, r *http.Request) (*balancer.Backend, error) {
+	var backend *balancer.Backend
+	var err error
+	if pinned := h.affinity.pinned(r, pool); pinned != nil {
+		pool.Acquire(pinned)
+		backend = pinned
+	} else if keyed, ok := pool.(balancer.KeyedBalancer); ok {
+		backend, err = keyed.NextBackendFor(getClientIP(r))
+	} else {
+		backend, err = pool.NextBackend()
+	}
+	if err != nil || backend.TryProbe() {
+		return backend, err
+	}
+	pool.Release(backend)
+	return nextUntried(pool, map[*balancer.Backend]bool{backend: true})
+}
+
+// balancerFor returns the upstream pool selected by the matched route, falling
+// back to the default backends when no route (or no upstream) applies.
+func (h *Handler) balancerFor(r *http.Request) balancer.Balancer {
+	if route := routeFromContext(r.Context()); route != nil && route.Upstream != "" {
+		if b, ok := h.upstreams[route.Upstream]; ok {
+			return b
+		}
+	}
+	return h.balancer
+}
+
+// newTransport clones the default transport with the configured timeouts and
+// connection pool limits. ExpectContinueTimeout makes requests carrying
+// "Expect: 100-continue" hold their body until the backend answers with 100
+// Continue (or the timeout passes). The per-host idle limit is raised to fit
+// MinIdleConnsPerBackend. Zero values keep the default transport's settings,
+// including its proxy from the environment; SetEgressProxy replaces that.
+// With DNSCacheTTL set, backend hostnames are resolved through a dnsCache.
+func newTransport(cfg config.ProxyConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ExpectContinueTimeout = cfg.ExpectContinueTimeout
+	transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	if cfg.DialTimeout > 0 {
+		dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+	}
+	if cfg.DNSCacheTTL > 0 {
+		transport.DialContext = newDNSCache(cfg.DNSCacheTTL).dialContext(transport.DialContext)
+	}
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	transport.DisableKeepAlives = cfg.DisableKeepAlives
+	if cfg.MinIdleConnsPerBackend > max(transport.MaxIdleConnsPerHost, http.DefaultMaxIdleConnsPerHost) {
+		transport.MaxIdleConnsPerHost = cfg.MinIdleConnsPerBackend
+	}
+	return transport
+}
+
+// relayInformational forwards interim 1xx responses from the backend to the
+// client. Relaying 100 Continue this way also stops the server from sending
+// its own when the transport starts reading the request body.
+func relayInformational(w http.ResponseWriter) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			copyHeader(w.Header(), http.Header(header))
+			w.WriteHeader(code)
+			for key := range header {
+				w.Header().Del(key)
+			}
+			return nil
+		},
+	}
+}
+
+func isInformational(statusCode int) bool {
+	return statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols
+}
+
 func (h *Handler) setProxyHeaders(originalReq *http.Request, proxyReq *http.Request, targetURL *url.URL) {
 	proxyReq.Header.Set("X-Forwarded-For", getClientIP(originalReq))
-	proxyReq.Header.Set("X-Forwarded-Host", originalReq.Host)
 	proxyReq.Header.Set("X-Forwarded-Proto", getScheme(originalReq))
+	proxyReq.Header.Set("X-Forwarded-Port", getPort(originalReq))
 
 	if originalReq.Host != "" {
+		proxyReq.Header.Set("X-Forwarded-Host", originalReq.Host)
 		proxyReq.Header.Set("X-Forwarded-Server", originalReq.Host)
 	}
 
+	if h.config.MaxHops > 0 {
+		proxyReq.Header.Set(hopsHeader, strconv.Itoa(requestHops(originalReq)+1))
+	}
+
 	if originalReq.URL.RawPath != "" {
 		proxyReq.URL.RawPath = originalReq.URL.RawPath
 	}
@@ -153,6 +757,43 @@ func getScheme(r *http.Request) string {
 	return "http"
 }
 
+// getPort returns the port of the listener r arrived on, so HTTP and HTTPS
+// listeners on any port are told apart. Without a local address it falls
+// back to the Host port, then the scheme's default.
+func getPort(r *http.Request) string {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+			return port
+		}
+	}
+	if _, port, err := net.SplitHostPort(r.Host); err == nil && port != "" {
+		return port
+	}
+	if r.TLS != nil {
+		return "443"
+	}
+	return "80"
+}
+
+// invalidTarget returns why the client's request target cannot be proxied, or
+// "" when it is acceptable. Control characters are rejected even when they
+// arrive percent-encoded, since they would reach the backend decoded.
+func invalidTarget(u *url.URL) string {
+	parts := []struct{ name, value string }{
+		{"path", u.Path},
+		{"query", u.RawQuery},
+		{"fragment", u.Fragment},
+	}
+	for _, part := range parts {
+		for i := 0; i < len(part.value); i++ {
+			if c := part.value[i]; c < 0x20 || c == 0x7f {
+				return fmt.Sprintf("control character 0x%02x in %s", c, part.name)
+			}
+		}
+	}
+	return ""
+}
+
 func getCacheKey(r *http.Request) string {
 	return fmt.Sprintf("%s:%s", r.Method, r.URL.String())
 }
@@ -0,0 +1,678 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+func newTestHandler(backendURL string, proxyCfg config.ProxyConfig) (*Handler, *cache.Cache) {
+	return newTestHandlerWithCache(backendURL, config.CacheConfig{Enabled: true, TTL: time.Minute}, proxyCfg)
+}
+
+func newTestHandlerWithCache(backendURL string, cacheCfg config.CacheConfig, proxyCfg config.ProxyConfig) (*Handler, *cache.Cache) {
+	b := balancer.NewSRR()
+	b.AddBackend(balancer.NewBackend(backendURL, 1))
+	c := cache.NewCache(cacheCfg.TTL)
+	return NewHandler(b, nil, c, logger.FromZap(zap.NewNop()), metrics.NewRegistry(), cacheCfg, proxyCfg), c
+}
+
+func TestHandler_SubThresholdResponseCached(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("small body"))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 64})
+
+	req := httptest.NewRequest(http.MethodGet, "/small", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Body.String() != "small body" {
+		t.Errorf("Expected body %q, got %q", "small body", rec.Body.String())
+	}
+	if _, _, found := c.Get(getCacheKey(req)); !found {
+		t.Error("Expected sub-threshold response to be cached")
+	}
+}
+
+func TestHandler_OverThresholdResponseStreamed(t *testing.T) {
+	large := strings.Repeat("x", 1024)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(large))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 64})
+
+	req := httptest.NewRequest(http.MethodGet, "/large", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != large {
+		t.Errorf("Expected full body of %d bytes, got %d", len(large), rec.Body.Len())
+	}
+	if _, _, found := c.Get(getCacheKey(req)); found {
+		t.Error("Expected over-threshold response not to be cached")
+	}
+}
+
+func TestHandler_UncachedResponseStreamedAsProduced(t *testing.T) {
+	upstreamCancelled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// No Content-Length: the response is sent chunked.
+		w.Write([]byte("first chunk\n"))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-r.Context().Done():
+			close(upstreamCancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandlerWithCache(backend.URL, config.CacheConfig{}, config.ProxyConfig{StreamThreshold: 1 << 20})
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/download")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	line := make(chan string, 1)
+	go func() {
+		s, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- s
+	}()
+	select {
+	case got := <-line:
+		if got != "first chunk\n" {
+			t.Errorf("Expected first chunk, got %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the first chunk before the backend finished")
+	}
+
+	resp.Body.Close()
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected upstream request to be cancelled after client disconnect")
+	}
+}
+
+func TestHandler_ServeStaleOnError(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	cacheCfg := config.CacheConfig{Enabled: true, TTL: 10 * time.Millisecond, ServeStaleOnError: true}
+	handler, c := newTestHandlerWithCache(backend.URL, cacheCfg, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	req := httptest.NewRequest(http.MethodGet, "/page", nil)
+	c.Set(getCacheKey(req), []byte("stale copy"), http.Header{"Content-Type": {"text/plain"}})
+	time.Sleep(20 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected stale entry to mask 503, got %d", rec.Code)
+	}
+	if rec.Body.String() != "stale copy" {
+		t.Errorf("Expected stale body, got %q", rec.Body.String())
+	}
+	if !strings.HasPrefix(rec.Header().Get("Warning"), "110") {
+		t.Errorf("Expected Warning: 110 header, got %q", rec.Header().Get("Warning"))
+	}
+}
+
+func TestHandler_ServeStaleOnError_MaxStaleAge(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	cacheCfg := config.CacheConfig{
+		Enabled:           true,
+		TTL:               10 * time.Millisecond,
+		ServeStaleOnError: true,
+		MaxStaleAge:       time.Hour,
+	}
+	handler, c := newTestHandlerWithCache(backend.URL, cacheCfg, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	recent := httptest.NewRequest(http.MethodGet, "/recent", nil)
+	c.Set(getCacheKey(recent), []byte("recent copy"), http.Header{})
+	old := httptest.NewRequest(http.MethodGet, "/old", nil)
+	c.SetEntry(&cache.Entry{
+		Key:        getCacheKey(old),
+		StatusCode: http.StatusOK,
+		Value:      []byte("old copy"),
+		Header:     http.Header{},
+		CreatedAt:  time.Now().Add(-3 * time.Hour),
+		ExpiresAt:  time.Now().Add(-2 * time.Hour),
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, recent)
+	if rec.Code != http.StatusOK || rec.Body.String() != "recent copy" {
+		t.Errorf("Expected entry within max_stale_age served stale, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, old)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected backend 503 for entry past max_stale_age, got %d", rec.Code)
+	}
+	if rec.Header().Get("Warning") != "" {
+		t.Error("Expected no Warning header for entry past max_stale_age")
+	}
+}
+
+func TestHandler_ServeStaleOnError_NoEntry(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	cacheCfg := config.CacheConfig{Enabled: true, TTL: time.Minute, ServeStaleOnError: true}
+	handler, _ := newTestHandlerWithCache(backend.URL, cacheCfg, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected backend 503 without a cached entry, got %d", rec.Code)
+	}
+	if rec.Header().Get("Warning") != "" {
+		t.Error("Expected no Warning header")
+	}
+}
+
+func TestHandler_ServeStaleOnError_BackendDown(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	backendURL := backend.URL
+	backend.Close()
+
+	cacheCfg := config.CacheConfig{Enabled: true, TTL: time.Minute, ServeStaleOnError: true}
+	handler, _ := newTestHandlerWithCache(backendURL, cacheCfg, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 without a cached entry, got %d", rec.Code)
+	}
+}
+
+func TestHandler_ReleasesBackend(t *testing.T) {
+	up := namedBackend("up")
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	for _, backendURL := range []string{up.URL, down.URL} {
+		lc := balancer.NewLeastConn()
+		backend := balancer.NewBackend(backendURL, 1)
+		lc.AddBackend(backend)
+		handler := NewHandler(lc, nil, cache.NewCache(time.Minute), logger.FromZap(zap.NewNop()), metrics.NewRegistry(),
+			config.CacheConfig{}, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if n := backend.ActiveRequests(); n != 0 {
+			t.Errorf("Expected backend released after a %d response, %d still active", rec.Code, n)
+		}
+	}
+}
+
+func TestHandler_IPHashPinsClient(t *testing.T) {
+	a := namedBackend("a")
+	defer a.Close()
+	b := namedBackend("b")
+	defer b.Close()
+
+	pool := balancer.NewIPHash()
+	pool.AddBackend(balancer.NewBackend(a.URL, 1))
+	pool.AddBackend(balancer.NewBackend(b.URL, 1))
+	handler := NewHandler(pool, nil, cache.NewCache(time.Minute), logger.FromZap(zap.NewNop()), metrics.NewRegistry(),
+		config.CacheConfig{}, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	for _, client := range []string{"10.0.0.1:1000", "10.0.0.2:2000", "192.168.5.9:3000"} {
+		var first string
+		for i := 0; i < 5; i++ {
+			// The port changes per connection; only the IP is the key.
+			rec := serveFrom(handler, strings.Replace(client, ":", ":"+strconv.Itoa(i), 1), "/")
+			if i == 0 {
+				first = rec.Body.String()
+			} else if rec.Body.String() != first {
+				t.Errorf("Client %s moved from backend %s to %s", client, first, rec.Body.String())
+			}
+		}
+	}
+}
+
+// fixedBalancer always picks one backend and counts releases.
+type fixedBalancer struct {
+	*balancer.SRR
+	backend  *balancer.Backend
+	released int
+}
+
+func (f *fixedBalancer) NextBackend() (*balancer.Backend, error) {
+	return f.backend, nil
+}
+
+func (f *fixedBalancer) Release(*balancer.Backend) {
+	f.released++
+}
+
+func TestHandler_AcceptsAnyBalancer(t *testing.T) {
+	backend := namedBackend("fixed")
+	defer backend.Close()
+
+	fixed := &fixedBalancer{SRR: balancer.NewSRR(), backend: balancer.NewBackend(backend.URL, 1)}
+	handler := NewHandler(fixed, nil, cache.NewCache(time.Minute), logger.FromZap(zap.NewNop()), metrics.NewRegistry(),
+		config.CacheConfig{}, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Body.String() != "fixed" {
+		t.Errorf("Expected the balancer's backend to serve the request, got %q", rec.Body.String())
+	}
+	if fixed.released != 1 {
+		t.Errorf("Expected 1 release, got %d", fixed.released)
+	}
+}
+
+func TestHandler_RelaysExpectContinue(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Expect") != "100-continue" {
+			t.Errorf("Expected Expect header forwarded to backend, got %q", r.Header.Get("Expect"))
+		}
+		w.Header().Set("X-Continue", "backend")
+		w.WriteHeader(http.StatusContinue)
+		w.Header().Del("X-Continue")
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read upload: %v", err)
+		}
+		w.Write(body)
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20, ExpectContinueTimeout: 5 * time.Second})
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	var continueFrom string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusContinue {
+				continueFrom = header.Get("X-Continue")
+			}
+			return nil
+		},
+	}
+
+	upload := strings.Repeat("u", 4096)
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace),
+		http.MethodPut, proxy.URL+"/upload", strings.NewReader(upload))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Expect", "100-continue")
+
+	// A long client-side timeout: if the interim response were not relayed the
+	// client would sit out the full wait before sending the body.
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected upload to proceed promptly after 100 Continue, took %v", elapsed)
+	}
+	if continueFrom != "backend" {
+		t.Errorf("Expected client to receive the backend's 100 Continue, got header %q", continueFrom)
+	}
+	if string(body) != upload {
+		t.Errorf("Expected upload echoed back (%d bytes), got %d bytes", len(upload), len(body))
+	}
+	if resp.Header.Get("X-Continue") != "" {
+		t.Error("Expected interim response headers not to leak into the final response")
+	}
+}
+
+func TestHandler_StripsConfiguredResponseHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "internal-app/1.2")
+		w.Header().Set("X-Powered-By", "PHP/5.6")
+		w.Header().Set("X-Backend-IP", "10.0.0.7")
+		w.Header().Set("X-Request-Cost", "3")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+	handler.SetResponseHeaderStrip([]string{"server", "X-POWERED-BY", "x-backend-ip"})
+
+	req := httptest.NewRequest(http.MethodGet, "/strip", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	for _, name := range []string{"Server", "X-Powered-By", "X-Backend-IP"} {
+		if v := rec.Header().Get(name); v != "" {
+			t.Errorf("Expected %s to be stripped, got %q", name, v)
+		}
+	}
+	if rec.Header().Get("X-Request-Cost") != "3" {
+		t.Error("Expected unlisted header to pass through")
+	}
+
+	_, cached, found := c.Get(getCacheKey(req))
+	if !found {
+		t.Fatal("Expected response to be cached")
+	}
+	if cached.Get("Server") != "" {
+		t.Error("Expected stripped header to be absent from cached entry")
+	}
+}
+
+func TestHandler_ClientCancellationAbortsUpstream(t *testing.T) {
+	firstChunk := make(chan struct{})
+	upstreamCancelled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial "))
+		w.(http.Flusher).Flush()
+		close(firstChunk)
+
+		select {
+		case <-r.Context().Done():
+			close(upstreamCancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rec, req)
+		close(done)
+	}()
+
+	select {
+	case <-firstChunk:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for backend to start responding")
+	}
+	cancel()
+
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected upstream request to be cancelled after client disconnect")
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected handler to return after client disconnect")
+	}
+
+	if _, _, found := c.Get(getCacheKey(req)); found {
+		t.Error("Expected partial body not to be cached")
+	}
+}
+
+func TestHandler_CacheTTLByStatus(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			w.Header().Set("Location", "/new-home")
+			w.WriteHeader(http.StatusMovedPermanently)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandlerWithCache(backend.URL, config.CacheConfig{
+		Enabled:     true,
+		TTL:         time.Minute,
+		TTLByStatus: map[string]time.Duration{"3xx": time.Hour, "301": 6 * time.Hour},
+	}, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantTTL    time.Duration
+		wantCached bool
+	}{
+		{path: "/moved", wantStatus: http.StatusMovedPermanently, wantTTL: 6 * time.Hour, wantCached: true},
+		{path: "/ok", wantStatus: http.StatusOK, wantTTL: time.Minute, wantCached: true},
+		{path: "/missing", wantCached: false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		entry, found := c.GetEntry(getCacheKey(req))
+		if found != tt.wantCached {
+			t.Errorf("%s: expected cached=%v, got %v", tt.path, tt.wantCached, found)
+			continue
+		}
+		if !found {
+			continue
+		}
+		if entry.StatusCode != tt.wantStatus {
+			t.Errorf("%s: expected cached status %d, got %d", tt.path, tt.wantStatus, entry.StatusCode)
+		}
+		if ttl := entry.ExpiresAt.Sub(entry.CreatedAt); ttl != tt.wantTTL {
+			t.Errorf("%s: expected TTL %v, got %v", tt.path, tt.wantTTL, ttl)
+		}
+	}
+}
+
+func TestHandler_RejectsMalformedRequestTarget(t *testing.T) {
+	var hits int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	for _, target := range []string{"/a%00b", "/a%0d%0aInjected:%20x", "/del%7f"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+	if hits != 0 {
+		t.Errorf("Expected malformed targets never to reach the backend, got %d hits", hits)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/a%20b?q=1", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || hits != 1 {
+		t.Errorf("Expected a well-formed target to be proxied, got %d with %d hits", rec.Code, hits)
+	}
+}
+
+func TestHandler_StripsHopByHopHeaders(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Connection", "X-Backend-Hop")
+		w.Header().Set("X-Backend-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-End-To-End", "1")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Connection", "X-Custom")
+	req.Header.Set("X-Custom", "secret")
+	req.Header.Set("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+	req.Header.Set("X-Kept", "1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	for _, name := range []string{"X-Custom", "Proxy-Authorization"} {
+		if v := got.Get(name); v != "" {
+			t.Errorf("Expected %s to be dropped before the backend, got %q", name, v)
+		}
+	}
+	if got.Get("X-Kept") != "1" {
+		t.Error("Expected end-to-end request headers to reach the backend")
+	}
+	for _, name := range []string{"X-Backend-Hop", "Keep-Alive", "Connection"} {
+		if v := rec.Header().Get(name); v != "" {
+			t.Errorf("Expected %s to be dropped from the response, got %q", name, v)
+		}
+	}
+	if rec.Header().Get("X-End-To-End") != "1" {
+		t.Error("Expected end-to-end response headers to reach the client")
+	}
+}
+
+func TestNewTransport_ConnectionPool(t *testing.T) {
+	transport := newTransport(config.ProxyConfig{
+		MaxIdleConns:        200,
+		MaxIdleConnsPerHost: 64,
+		IdleConnTimeout:     time.Minute,
+		MaxConnsPerHost:     128,
+	})
+	if transport.MaxIdleConns != 200 || transport.MaxIdleConnsPerHost != 64 || transport.IdleConnTimeout != time.Minute || transport.MaxConnsPerHost != 128 {
+		t.Errorf("Expected pool settings 200/64/1m/128, got %d/%d/%s/%d",
+			transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout, transport.MaxConnsPerHost)
+	}
+
+	transport = newTransport(config.ProxyConfig{MaxIdleConnsPerHost: 4, MinIdleConnsPerBackend: 8})
+	if transport.MaxIdleConnsPerHost != 8 {
+		t.Errorf("Expected per-host limit raised to the warm pool size 8, got %d", transport.MaxIdleConnsPerHost)
+	}
+}
+
+func TestHandler_DisableKeepAlives(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		var conns atomic.Int32
+		backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		backend.Config.ConnState = func(c net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				conns.Add(1)
+			}
+		}
+		backend.Start()
+
+		handler, _ := newTestHandlerWithCache(backend.URL, config.CacheConfig{},
+			config.ProxyConfig{StreamThreshold: 1 << 20, DisableKeepAlives: disable})
+		for i := 0; i < 3; i++ {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}
+		backend.Close()
+
+		want := int32(1)
+		if disable {
+			want = 3
+		}
+		if got := conns.Load(); got != want {
+			t.Errorf("disable_keep_alives=%v: expected %d backend connections, got %d", disable, want, got)
+		}
+	}
+}
+
+func TestHandler_ForwardsListenerPort(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Forwarded-Proto") + ":" + r.Header.Get("X-Forwarded-Port")))
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1024})
+
+	tests := []struct {
+		name   string
+		local  int
+		tls    bool
+		host   string
+		expect string
+	}{
+		{"http listener", 8080, false, "example.com", "http:8080"},
+		{"https listener", 8443, true, "example.com", "https:8443"},
+		{"standard https port", 443, true, "example.com:9999", "https:443"},
+		{"no listener address, host port", 0, false, "example.com:8081", "http:8081"},
+		{"no listener address, https default", 0, true, "example.com", "https:443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/port-"+strconv.Itoa(tt.local), nil)
+			req.Host = tt.host
+			if tt.local != 0 {
+				local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: tt.local}
+				req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, local))
+			}
+			if !tt.tls {
+				req.TLS = nil
+			} else if req.TLS == nil {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != tt.expect {
+				t.Errorf("Expected %q, got %q", tt.expect, got)
+			}
+		})
+	}
+}
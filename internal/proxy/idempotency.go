@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	idempotencyKeyPrefix      = "idempotency:"
+
+	metricIdempotentReplays = "proxy_idempotent_replays_total"
+)
+
+// idempotencyGuard replays the stored response to POST and PATCH requests
+// that repeat an Idempotency-Key within ttl, so a client retrying a write
+// does not apply it twice. Records live in the cache store under their own
+// prefix, which makes them shared across replicas with the Redis store. A
+// nil *idempotencyGuard passes every request through.
+type idempotencyGuard struct {
+	store   cache.Store
+	ttl     time.Duration
+	limit   int64
+	logger  *logger.Logger
+	replays *metrics.Counter
+
+	mu       sync.Mutex
+	inflight map[string]struct{}
+}
+
+func newIdempotencyGuard(store cache.Store, ttl time.Duration, limit int64, registry *metrics.Registry, log *logger.Logger) *idempotencyGuard {
+	if ttl <= 0 {
+		return nil
+	}
+	return &idempotencyGuard{
+		store:    store,
+		ttl:      ttl,
+		limit:    limit,
+		logger:   log,
+		replays:  registry.Counter(metricIdempotentReplays),
+		inflight: make(map[string]struct{}),
+	}
+}
+
+// key returns the store key for r, or "" when r is not deduplicated. Keys
+// are scoped to the method and URL so one Idempotency-Key value cannot
+// replay another endpoint's response.
+func (g *idempotencyGuard) key(r *http.Request) string {
+	if g == nil || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+		return ""
+	}
+	value := r.Header.Get(idempotencyKeyHeader)
+	if value == "" {
+		return ""
+	}
+	return idempotencyKeyPrefix + r.Method + ":" + r.URL.String() + ":" + value
+}
+
+// idempotencyUnstoredHeaders are response headers never stored with a
+// record: framing and encoding set by the compression writer, which the
+// identity-encoded recorded body does not match, and per-request values.
+var idempotencyUnstoredHeaders = []string{"Content-Encoding", "Content-Length", "Vary", "X-Request-Id", "Server-Timing"}
+
+// serve replays the stored response for key, or passes r to next and stores
+// its response. Only complete responses under 500 and within the stream
+// threshold are stored, so failed attempts can be retried. A duplicate that
+// arrives while the first request is still in flight gets 409.
+func (g *idempotencyGuard) serve(w http.ResponseWriter, r *http.Request, key string, next http.HandlerFunc) {
+	if entry, found := g.store.GetEntry(key); found {
+		g.replay(w, r, entry)
+		return
+	}
+
+	g.mu.Lock()
+	// Checked again under the lock: a request that finished between the
+	// lookup above and here has stored its response and left inflight.
+	if entry, found := g.store.GetEntry(key); found {
+		g.mu.Unlock()
+		g.replay(w, r, entry)
+		return
+	}
+	if _, busy := g.inflight[key]; busy {
+		g.mu.Unlock()
+		g.logger.Warn("Request with idempotency key already in progress",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path))
+		http.Error(w, "Conflict: request with this Idempotency-Key is in progress", http.StatusConflict)
+		return
+	}
+	g.inflight[key] = struct{}{}
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.inflight, key)
+		g.mu.Unlock()
+	}()
+
+	rec := &idempotencyRecorder{ResponseWriter: w, limit: g.limit}
+	next(rec, r)
+
+	if rec.status == 0 || rec.status >= 500 || rec.overflow || r.Context().Err() != nil {
+		return
+	}
+	entry := cache.NewEntry(key, rec.body.Bytes(), rec.header, g.ttl)
+	entry.StatusCode = rec.status
+	g.store.SetEntry(entry)
+}
+
+// replay writes a stored response, replacing any header already set on w
+// under the same name.
+func (g *idempotencyGuard) replay(w http.ResponseWriter, r *http.Request, entry *cache.Entry) {
+	g.replays.Inc()
+	g.logger.Info("Replaying response for repeated idempotency key",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Int("status", entry.StatusCode))
+	for key, values := range entry.Header {
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	w.Header().Set(idempotencyReplayedHeader, "true")
+	w.WriteHeader(entry.StatusCode)
+	w.Write(entry.Value)
+}
+
+// idempotencyRecorder copies the response it passes through, up to limit
+// body bytes. header is the response header as the handler wrote it,
+// without idempotencyUnstoredHeaders.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func (rec *idempotencyRecorder) WriteHeader(statusCode int) {
+	if rec.status == 0 && !isInformational(statusCode) {
+		rec.record(statusCode)
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.record(http.StatusOK)
+	}
+	if !rec.overflow {
+		if int64(rec.body.Len()+len(b)) > rec.limit {
+			rec.overflow = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// record snapshots the status and header before they reach the underlying
+// writer, which may add its own.
+func (rec *idempotencyRecorder) record(statusCode int) {
+	rec.status = statusCode
+	rec.header = rec.ResponseWriter.Header().Clone()
+	for _, name := range idempotencyUnstoredHeaders {
+		rec.header.Del(name)
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+// streamed responses.
+func (rec *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
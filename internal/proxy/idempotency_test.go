@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func idempotentPost(h http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_IdempotencyKeyReplaysStoredResponse(t *testing.T) {
+	var orders atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := orders.Add(1)
+		w.Header().Set("Location", fmt.Sprintf("/orders/%d", n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "order %d", n)
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20, IdempotencyTTL: time.Minute})
+
+	first := idempotentPost(handler, "/orders", "abc", "item=1")
+	dup := idempotentPost(handler, "/orders", "abc", "item=1")
+
+	if orders.Load() != 1 {
+		t.Errorf("Expected the duplicate not to reach the backend, got %d orders", orders.Load())
+	}
+	if dup.Code != http.StatusCreated || dup.Body.String() != "order 1" || dup.Header().Get("Location") != "/orders/1" {
+		t.Errorf("Expected the stored 201 replayed, got %d %q %v", dup.Code, dup.Body.String(), dup.Header())
+	}
+	if dup.Header().Get(idempotencyReplayedHeader) != "true" || first.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Error("Expected only the replay to be marked Idempotent-Replayed")
+	}
+
+	// Another key, another URL or no key at all is forwarded.
+	idempotentPost(handler, "/orders", "def", "item=1")
+	idempotentPost(handler, "/refunds", "abc", "item=1")
+	idempotentPost(handler, "/orders", "", "item=1")
+	if orders.Load() != 4 {
+		t.Errorf("Expected 4 orders after distinct requests, got %d", orders.Load())
+	}
+	if got := handler.metrics.Counter(metricIdempotentReplays).Value(); got != 1 {
+		t.Errorf("Expected 1 replay counted, got %d", got)
+	}
+}
+
+func TestHandler_IdempotencyKeyNotStoredOnServerError(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20, IdempotencyTTL: time.Minute})
+
+	if rec := idempotentPost(handler, "/pay", "k1", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected the backend's 503, got %d", rec.Code)
+	}
+	rec := idempotentPost(handler, "/pay", "k1", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "done" || calls.Load() != 2 {
+		t.Errorf("Expected the retry after a 5xx forwarded, got %d %q after %d calls", rec.Code, rec.Body.String(), calls.Load())
+	}
+}
+
+func TestHandler_IdempotencyKeyInFlightConflict(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20, IdempotencyTTL: time.Minute})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- idempotentPost(handler, "/slow", "k", "") }()
+	<-started
+
+	if rec := idempotentPost(handler, "/slow", "k", ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate in flight, got %d", rec.Code)
+	}
+	close(release)
+	if rec := <-done; rec.Code != http.StatusOK {
+		t.Errorf("Expected the first request to complete, got %d", rec.Code)
+	}
+}
+
+func TestHandler_IdempotencyDisabledForwardsDuplicates(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+	for i := 0; i < 2; i++ {
+		idempotentPost(handler, "/orders", "abc", "")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected both requests forwarded without idempotency_ttl, got %d", calls.Load())
+	}
+}
+
+func TestIdempotency_ReplayThroughCompressionKeepsIdentityHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strings.Repeat("created ", 64)))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20, IdempotencyTTL: time.Minute})
+	m := NewMiddleware(logger.FromZap(zap.NewNop()), nil, c, true, nil)
+	m.SetCompression(config.CompressionConfig{Enabled: true, Algorithm: config.CompressionGzip})
+	h := m.Chain(handler)
+
+	post := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("item=1"))
+		req.Header.Set(idempotencyKeyHeader, "abc")
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if first := post("gzip"); first.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected the first response compressed, got %v", first.Header())
+	}
+	entry, found := c.GetEntry(idempotencyKeyPrefix + "POST:/orders:abc")
+	if !found {
+		t.Fatal("Expected the response to be stored")
+	}
+	for _, name := range idempotencyUnstoredHeaders {
+		if v := entry.Header.Values(name); len(v) > 0 {
+			t.Errorf("Expected %s not to be stored, got %q", name, v)
+		}
+	}
+
+	dup := post("identity")
+	if dup.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected an identity replay, got Content-Encoding %q", dup.Header().Get("Content-Encoding"))
+	}
+	if ids := dup.Header().Values("X-Request-Id"); len(ids) != 1 {
+		t.Errorf("Expected one X-Request-Id on the replay, got %q", ids)
+	}
+	if dup.Body.String() != strings.Repeat("created ", 64) {
+		t.Errorf("Expected the plain body replayed, got %q", dup.Body.String())
+	}
+}
+
+func TestIdempotency_ConcurrentDuplicatesRunOnce(t *testing.T) {
+	var orders atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orders.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20, IdempotencyTTL: time.Minute})
+
+	var wg sync.WaitGroup
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = idempotentPost(handler, "/orders", "abc", "item=1").Code
+		}(i)
+	}
+	wg.Wait()
+
+	if n := orders.Load(); n != 1 {
+		t.Errorf("Expected one request to reach the backend, got %d", n)
+	}
+	for i, code := range codes {
+		if code != http.StatusCreated && code != http.StatusConflict {
+			t.Errorf("Request %d: expected 201 or 409, got %d", i, code)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+const (
+	metricLatencyP99         = "proxy_backend_latency_p99_seconds"
+	metricLatencyAlert       = "proxy_backend_latency_alert"
+	metricLatencyAlertsTotal = "proxy_backend_latency_alerts_total"
+
+	// minLatencySamples avoids alerting on a p99 computed from a handful of
+	// requests, where it is effectively the maximum.
+	minLatencySamples = 20
+
+	// latencyEvalInterval is how often a backend's p99 is checked against
+	// the threshold. Computing it sorts the sample window, which is too
+	// costly to do on every request.
+	latencyEvalInterval = time.Second
+)
+
+// latencyAlerter records backend latencies and raises an alert whenever a
+// backend's rolling p99 crosses the configured threshold. The p99 is checked
+// at most once per interval per backend.
+type latencyAlerter struct {
+	threshold time.Duration
+	interval  time.Duration
+	metrics   *metrics.Registry
+	logger    *logger.Logger
+	now       func() time.Time
+	mu        sync.Mutex
+	alerting  map[string]bool
+	evaluated map[string]time.Time
+}
+
+func newLatencyAlerter(threshold time.Duration, registry *metrics.Registry, log *logger.Logger) *latencyAlerter {
+	return &latencyAlerter{
+		threshold: threshold,
+		interval:  latencyEvalInterval,
+		metrics:   registry,
+		logger:    log,
+		now:       time.Now,
+		alerting:  make(map[string]bool),
+		evaluated: make(map[string]time.Time),
+	}
+}
+
+func (a *latencyAlerter) observe(backend *balancer.Backend, d time.Duration) {
+	backend.RecordLatency(d)
+	if a.threshold <= 0 {
+		return
+	}
+
+	now := a.now()
+	a.mu.Lock()
+	if last, ok := a.evaluated[backend.URL]; ok && now.Sub(last) < a.interval {
+		a.mu.Unlock()
+		return
+	}
+	a.evaluated[backend.URL] = now
+	a.mu.Unlock()
+
+	p99, samples := backend.LatencyPercentile(0.99)
+	if samples < minLatencySamples {
+		return
+	}
+
+	exceeded := p99 > a.threshold
+
+	a.mu.Lock()
+	changed := a.alerting[backend.URL] != exceeded
+	a.alerting[backend.URL] = exceeded
+	a.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if exceeded {
+		a.metrics.Gauge(metricLatencyAlert, "backend", backend.URL).Set(1)
+		a.metrics.Counter(metricLatencyAlertsTotal, "backend", backend.URL).Inc()
+		a.logger.Warn("Backend p99 latency above threshold",
+			zap.String("backend", backend.URL),
+			zap.Duration("p99", p99),
+			zap.Duration("threshold", a.threshold))
+		return
+	}
+
+	a.metrics.Gauge(metricLatencyAlert, "backend", backend.URL).Set(0)
+	a.logger.Info("Backend p99 latency back below threshold",
+		zap.String("backend", backend.URL),
+		zap.Duration("p99", p99),
+		zap.Duration("threshold", a.threshold))
+}
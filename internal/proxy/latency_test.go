@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLatencyAlerter_FiresAboveThreshold(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	registry := metrics.NewRegistry()
+	alerter := newLatencyAlerter(100*time.Millisecond, registry, logger.FromZap(zap.New(core)))
+	alerter.interval = 0
+
+	backend := balancer.NewBackend("http://localhost:8001", 1)
+
+	for i := 0; i < 100; i++ {
+		alerter.observe(backend, 10*time.Millisecond)
+	}
+	if v := registry.Counter(metricLatencyAlertsTotal, "backend", backend.URL).Value(); v != 0 {
+		t.Fatalf("Expected no alerts for fast backend, got %d", v)
+	}
+
+	for i := 0; i < 5; i++ {
+		alerter.observe(backend, 500*time.Millisecond)
+	}
+
+	if v := registry.Counter(metricLatencyAlertsTotal, "backend", backend.URL).Value(); v != 1 {
+		t.Errorf("Expected exactly 1 alert, got %d", v)
+	}
+	if v := registry.Gauge(metricLatencyAlert, "backend", backend.URL).Value(); v != 1 {
+		t.Errorf("Expected alert gauge 1, got %v", v)
+	}
+	if n := logs.FilterMessage("Backend p99 latency above threshold").Len(); n != 1 {
+		t.Errorf("Expected 1 alert log, got %d", n)
+	}
+
+	for i := 0; i < 512; i++ {
+		alerter.observe(backend, 10*time.Millisecond)
+	}
+	if v := registry.Gauge(metricLatencyAlert, "backend", backend.URL).Value(); v != 0 {
+		t.Errorf("Expected alert to clear, got gauge %v", v)
+	}
+}
+
+func TestLatencyAlerter_MinimumSamples(t *testing.T) {
+	registry := metrics.NewRegistry()
+	alerter := newLatencyAlerter(100*time.Millisecond, registry, logger.FromZap(zap.NewNop()))
+	alerter.interval = 0
+	backend := balancer.NewBackend("http://localhost:8001", 1)
+
+	alerter.observe(backend, time.Second)
+
+	if v := registry.Counter(metricLatencyAlertsTotal, "backend", backend.URL).Value(); v != 0 {
+		t.Errorf("Expected no alert before minimum samples, got %d", v)
+	}
+}
+
+func TestLatencyAlerter_ChecksOncePerInterval(t *testing.T) {
+	registry := metrics.NewRegistry()
+	alerter := newLatencyAlerter(100*time.Millisecond, registry, logger.FromZap(zap.NewNop()))
+	now := time.Unix(0, 0)
+	alerter.now = func() time.Time { return now }
+	backend := balancer.NewBackend("http://localhost:8001", 1)
+
+	// The first observation is checked and falls short of minLatencySamples;
+	// the slow ones after it land within the same interval.
+	for i := 0; i < 50; i++ {
+		alerter.observe(backend, time.Second)
+	}
+	if v := registry.Counter(metricLatencyAlertsTotal, "backend", backend.URL).Value(); v != 0 {
+		t.Fatalf("Expected no check within the interval, got %d alerts", v)
+	}
+
+	now = now.Add(latencyEvalInterval)
+	alerter.observe(backend, time.Second)
+	if v := registry.Counter(metricLatencyAlertsTotal, "backend", backend.URL).Value(); v != 1 {
+		t.Errorf("Expected an alert once the interval passed, got %d", v)
+	}
+}
+
+func TestLatencyAlerter_NoThresholdOnlyRecords(t *testing.T) {
+	registry := metrics.NewRegistry()
+	alerter := newLatencyAlerter(0, registry, logger.FromZap(zap.NewNop()))
+	alerter.interval = 0
+	backend := balancer.NewBackend("http://localhost:8001", 1)
+
+	for i := 0; i < 50; i++ {
+		alerter.observe(backend, time.Second)
+	}
+	if _, n := backend.LatencyPercentile(0.99); n != 50 {
+		t.Errorf("Expected 50 recorded samples, got %d", n)
+	}
+	if len(alerter.evaluated) != 0 {
+		t.Errorf("Expected no p99 checks without a threshold, got %v", alerter.evaluated)
+	}
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"proxy-kp/internal/config"
+)
+
+// localPaths answers server.local_paths without proxying. The first matching
+// entry wins.
+type localPaths struct {
+	entries []config.LocalPathConfig
+}
+
+func newLocalPaths(entries []config.LocalPathConfig) *localPaths {
+	if len(entries) == 0 {
+		return nil
+	}
+	return &localPaths{entries: entries}
+}
+
+func (l *localPaths) match(path string) (config.LocalPathConfig, bool) {
+	if l == nil {
+		return config.LocalPathConfig{}, false
+	}
+	for _, entry := range l.entries {
+		if prefix, ok := strings.CutSuffix(entry.Path, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return entry, true
+			}
+		} else if path == entry.Path {
+			return entry, true
+		}
+	}
+	return config.LocalPathConfig{}, false
+}
+
+func serveLocalPath(w http.ResponseWriter, entry config.LocalPathConfig) {
+	if entry.Body != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(entry.Status)
+	if entry.Body != "" {
+		w.Write([]byte(entry.Body))
+	}
+}
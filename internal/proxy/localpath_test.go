@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestServer_LocalPathsAnsweredLocally(t *testing.T) {
+	backend := namedBackend("backend")
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Server.LocalPaths = []config.LocalPathConfig{
+		{Path: "/favicon.ico", Status: http.StatusNoContent},
+		{Path: "/.well-known/*", Status: http.StatusNotFound, Body: "Not Found"},
+	}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.publicHandler()
+
+	cases := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/favicon.ico", http.StatusNoContent, ""},
+		{"/.well-known/security.txt", http.StatusNotFound, "Not Found"},
+		{"/.well-known/", http.StatusNotFound, "Not Found"},
+		{"/favicon.ico.bak", http.StatusOK, "backend"},
+		{"/.well-known", http.StatusOK, "backend"},
+		{"/page", http.StatusOK, "backend"},
+	}
+	for _, tc := range cases {
+		rec := serveFrom(h, "192.168.1.1:5000", tc.path)
+		if rec.Code != tc.wantStatus || rec.Body.String() != tc.wantBody {
+			t.Errorf("%s: expected %d %q, got %d %q", tc.path, tc.wantStatus, tc.wantBody, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// hopsHeader counts how many times a request has passed through the proxy.
+// It is set on every backend request while loop detection is enabled, so a
+// request a backend sends back through the proxy carries its count along.
+const hopsHeader = "X-Proxy-Hops"
+
+// requestHops returns the hop count r arrived with; missing or malformed
+// values count as 0.
+func requestHops(r *http.Request) int {
+	hops, err := strconv.Atoi(r.Header.Get(hopsHeader))
+	if err != nil || hops < 0 {
+		return 0
+	}
+	return hops
+}
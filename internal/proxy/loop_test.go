@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestServer_BreaksRedirectLoop(t *testing.T) {
+	var proxyURL string
+	var hits atomic.Int32
+	// The backend follows its own redirect back through the proxy, keeping
+	// the incoming headers, so every hop re-enters the proxy.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		req, err := http.NewRequest(http.MethodGet, proxyURL+r.URL.Path, nil)
+		if err != nil {
+			t.Errorf("Failed to build redirect request: %v", err)
+			return
+		}
+		req.Header = r.Header.Clone()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("Redirect request failed: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Cache.Enabled = false
+	cfg.Proxy.MaxHops = 3
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	proxy := httptest.NewServer(s.publicHandler())
+	defer proxy.Close()
+	proxyURL = proxy.URL
+
+	resp, err := http.Get(proxy.URL + "/loop")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusLoopDetected {
+		t.Errorf("Expected 508, got %d", resp.StatusCode)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("Expected the loop to stop after 3 backend hits, got %d", n)
+	}
+}
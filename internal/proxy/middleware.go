@@ -2,31 +2,159 @@ package proxy
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/access"
 	"proxy-kp/pkg/cache"
 	"proxy-kp/pkg/logger"
 	"proxy-kp/pkg/ratelimit"
 
-	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 type Middleware struct {
-	logger     *logger.Logger
-	limiter    *ratelimit.Limiter
-	cache      *cache.Cache
-	cacheEnabled bool
-}
-
-func NewMiddleware(logger *logger.Logger, limiter *ratelimit.Limiter, cache *cache.Cache, cacheEnabled bool) *Middleware {
-	return &Middleware{
-		logger:       logger,
-		limiter:      limiter,
-		cache:        cache,
-		cacheEnabled: cacheEnabled,
+	logger        *logger.Logger
+	limiter       atomic.Pointer[ratelimit.Limiter]
+	cache         cache.Store
+	cacheEnabled  atomic.Bool
+	cacheDebug    bool
+	serverTiming  bool
+	router        *Router
+	compressor    *compressor
+	verboseTiming bool
+	options       *optionsResponder
+	fingerprint   config.FingerprintConfig
+	summary       *summaryStats
+	requestIDs    *requestIDSource
+	bodyLimits    *bodyLimits
+	maxHeader     int
+	defaultHost   string
+	topClients    *topClients
+	trusted       *access.Matcher
+	rateAllowlist *access.Matcher
+	expvars       *expvarStats
+}
+
+func NewMiddleware(logger *logger.Logger, limiter *ratelimit.Limiter, cache cache.Store, cacheEnabled bool, router *Router) *Middleware {
+	m := &Middleware{
+		logger: logger,
+		cache:  cache,
+		router: router,
+	}
+	m.limiter.Store(limiter)
+	m.cacheEnabled.Store(cacheEnabled)
+	return m
+}
+
+// SetLimiter swaps the rate limiter used for new requests; nil disables rate
+// limiting. It is safe to call while serving.
+func (m *Middleware) SetLimiter(limiter *ratelimit.Limiter) {
+	m.limiter.Store(limiter)
+}
+
+// SetCacheDebug adds X-Cache-Backend to cache hits, naming the backend that
+// produced the entry.
+func (m *Middleware) SetCacheDebug(enabled bool) {
+	m.cacheDebug = enabled
+}
+
+// SetServerTiming adds a Server-Timing header to cache hits; the handler
+// adds it to proxied responses.
+func (m *Middleware) SetServerTiming(enabled bool) {
+	m.serverTiming = enabled
+}
+
+// SetCacheEnabled turns cache lookups on or off for new requests. It is safe
+// to call while serving.
+func (m *Middleware) SetCacheEnabled(enabled bool) {
+	m.cacheEnabled.Store(enabled)
+}
+
+func (m *Middleware) SetCompression(cfg config.CompressionConfig) {
+	m.compressor = nil
+	if cfg.Enabled {
+		m.compressor = newCompressor(cfg)
+	}
+}
+
+func (m *Middleware) SetVerboseTiming(enabled bool) {
+	m.verboseTiming = enabled
+}
+
+// SetFingerprint makes the rate limiter key on the client IP plus a request
+// fingerprint rather than the IP alone.
+func (m *Middleware) SetFingerprint(cfg config.FingerprintConfig) {
+	m.fingerprint = cfg
+}
+
+// SetRequestID makes the middleware reuse incoming X-Request-Id values when
+// cfg.Honor is set, uniquifying them as configured.
+func (m *Middleware) SetRequestID(cfg config.RequestIDConfig) {
+	m.requestIDs = nil
+	if cfg.Honor {
+		m.requestIDs = newRequestIDSource(cfg)
+	}
+}
+
+// SetBodyLimits rejects request bodies over server.max_request_body, or over
+// the first matching server.body_limits rule, with 413.
+func (m *Middleware) SetBodyLimits(cfg config.ServerConfig) {
+	m.bodyLimits = newBodyLimits(cfg)
+}
+
+// SetMaxHeaderBytes rejects requests whose headers total more than limit
+// bytes with 431; 0 disables the check.
+func (m *Middleware) SetMaxHeaderBytes(limit int) {
+	m.maxHeader = limit
+}
+
+// SetDefaultHost fills in host for requests without a Host header, which
+// only HTTP/1.0 clients may send. When host is empty they are rejected with
+// 400.
+func (m *Middleware) SetDefaultHost(host string) {
+	m.defaultHost = host
+}
+
+// SetTrustedProxies takes the client IP from X-Forwarded-For for requests
+// whose direct peer is one of trusted, e.g. a load balancer in front of the
+// proxy. nil uses the peer address for every request.
+func (m *Middleware) SetTrustedProxies(trusted *access.Matcher) {
+	m.trusted = trusted
+}
+
+// SetRateLimitAllowlist exempts client IPs in allowlist from rate limiting.
+func (m *Middleware) SetRateLimitAllowlist(allowlist *access.Matcher) {
+	m.rateAllowlist = allowlist
+}
+
+// SetExpvars counts requests, errors and cache lookups into stats.
+func (m *Middleware) SetExpvars(stats *expvarStats) {
+	m.expvars = stats
+}
+
+// SetTopClients counts requests per client IP, including rejected ones, for
+// the admin /top-clients endpoint.
+func (m *Middleware) SetTopClients(t *topClients) {
+	m.topClients = t
+}
+
+// SetSummaryStats records per-pool request and cache counters for
+// /proxy/summary.
+func (m *Middleware) SetSummaryStats(stats *summaryStats) {
+	m.summary = stats
+}
+
+// SetOptionsResponder answers matching OPTIONS requests in the middleware when
+// proxy.handle_options is enabled.
+func (m *Middleware) SetOptionsResponder(cfg config.ProxyConfig) {
+	m.options = nil
+	if cfg.HandleOptions {
+		m.options = newOptionsResponder(cfg.OptionsPaths, cfg.AllowedMethods)
 	}
 }
 
@@ -34,12 +162,21 @@ func (m *Middleware) Chain(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		requestID := uuid.New().String()
+		requestID := m.requestIDs.next(r)
 		r = r.WithContext(contextWithRequestID(r.Context(), requestID))
 		w.Header().Set("X-Request-Id", requestID)
+		if m.trusted != nil {
+			r = r.WithContext(contextWithClientIP(r.Context(), forwardedClientIP(r, m.trusted)))
+		}
 
 		log := m.logger.WithRequestID(requestID)
 
+		var timing *requestTiming
+		if m.verboseTiming {
+			timing = &requestTiming{start: start}
+			r = r.WithContext(contextWithTiming(r.Context(), timing))
+		}
+
 		wrapped := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 
 		defer func() {
@@ -51,7 +188,12 @@ func (m *Middleware) Chain(next http.Handler) http.Handler {
 				wrapped.Write([]byte("Internal Server Error"))
 			}
 
+			m.expvars.recordResponse(wrapped.status)
+
 			duration := time.Since(start)
+			if timing != nil {
+				log = log.With(timing.fields()...)
+			}
 			log.Info("Request completed",
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
@@ -59,11 +201,45 @@ func (m *Middleware) Chain(next http.Handler) http.Handler {
 				zap.Duration("duration", duration))
 		}()
 
-		if m.limiter != nil {
-			ip := getClientIP(r)
-			if !m.limiter.Allow(ip) {
+		m.topClients.record(getClientIP(r))
+
+		if m.maxHeader > 0 {
+			if size := headerBytes(r); size > m.maxHeader {
+				log.Warn("Request headers exceed limit",
+					zap.String("client_ip", getClientIP(r)),
+					zap.String("path", r.URL.Path),
+					zap.Int("header_bytes", size),
+					zap.Int("limit", m.maxHeader))
+				wrapped.WriteHeader(http.StatusRequestHeaderFieldsTooLarge)
+				wrapped.Write([]byte("Request Header Fields Too Large"))
+				return
+			}
+		}
+
+		if r.Host == "" {
+			if m.defaultHost == "" {
+				log.Warn("Rejecting request without a Host header",
+					zap.String("client_ip", getClientIP(r)),
+					zap.String("proto", r.Proto),
+					zap.String("path", r.URL.Path))
+				wrapped.WriteHeader(http.StatusBadRequest)
+				wrapped.Write([]byte("Bad Request: missing Host header"))
+				return
+			}
+			r.Host = m.defaultHost
+		}
+
+		if limiter, ip := m.limiter.Load(), getClientIP(r); limiter != nil && !m.rateAllowlist.Contains(ip) {
+			key := ip
+			if limiter.Global() {
+				key = "global"
+			} else if m.fingerprint.Enabled {
+				key = ratelimit.FingerprintKey(ip, r, m.fingerprint.Headers)
+			}
+			if !limiter.Allow(key) {
 				log.Warn("Rate limit exceeded",
 					zap.String("client_ip", ip),
+					zap.String("limit_key", key),
 					zap.String("path", r.URL.Path))
 				wrapped.WriteHeader(http.StatusTooManyRequests)
 				wrapped.Write([]byte("Rate limit exceeded"))
@@ -71,28 +247,115 @@ func (m *Middleware) Chain(next http.Handler) http.Handler {
 			}
 		}
 
-		if m.cacheEnabled && r.Method == http.MethodGet {
-			cacheKey := getCacheKey(r)
-			if cachedData, headers, found := m.cache.Get(cacheKey); found {
+		if m.options != nil && m.options.matches(r) {
+			log.Debug("Answering OPTIONS request locally",
+				zap.String("path", r.URL.Path))
+			m.options.serve(wrapped)
+			return
+		}
+
+		route := m.router.Match(r)
+		if route == nil {
+			if status, body, reject := m.router.NoMatch(); reject {
+				log.Debug("No route matched",
+					zap.String("path", r.URL.Path),
+					zap.Int("status", status))
+				wrapped.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				wrapped.WriteHeader(status)
+				wrapped.Write([]byte(body))
+				return
+			}
+		}
+
+		if route != nil {
+			r = r.WithContext(contextWithRoute(r.Context(), route))
+			ip := getClientIP(r)
+			if !route.AllowsIP(ip) {
+				log.Warn("Access denied by route policy",
+					zap.String("route", route.Name),
+					zap.String("client_ip", ip),
+					zap.String("path", r.URL.Path))
+				wrapped.WriteHeader(http.StatusForbidden)
+				wrapped.Write([]byte("Forbidden"))
+				return
+			}
+			if !route.Authenticate(r) {
+				log.Warn("Authentication failed for route",
+					zap.String("route", route.Name),
+					zap.String("client_ip", ip),
+					zap.String("path", r.URL.Path))
+				wrapped.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", route.realm))
+				wrapped.WriteHeader(http.StatusUnauthorized)
+				wrapped.Write([]byte("Unauthorized"))
+				return
+			}
+		}
+
+		if limit := m.bodyLimits.limitFor(r); limit > 0 {
+			if r.ContentLength > limit {
+				log.Warn("Request body exceeds limit",
+					zap.String("path", r.URL.Path),
+					zap.Int64("content_length", r.ContentLength),
+					zap.Int64("limit", limit))
+				wrapped.WriteHeader(http.StatusRequestEntityTooLarge)
+				wrapped.Write([]byte("Request Entity Too Large"))
+				return
+			}
+			// Bodies without a Content-Length fail once they pass the
+			// limit; the handler answers 413 for them.
+			r.Body = http.MaxBytesReader(wrapped, r.Body, limit)
+		}
+
+		pool := poolNameFor(route)
+		m.summary.recordRequest(pool)
+
+		var out http.ResponseWriter = wrapped
+		if m.compressor != nil {
+			// Compression is applied after cache retrieval and the upstream
+			// is asked for identity bodies, so cache entries stay
+			// uncompressed and serve every client correctly.
+			cw := m.compressor.newWriter(wrapped, r.Header.Get("Accept-Encoding"))
+			defer cw.Close()
+			out = cw
+			r.Header.Del("Accept-Encoding")
+		}
+
+		if m.cacheEnabled.Load() && r.Method == http.MethodGet && !isWebSocketUpgrade(r) {
+			entry, cacheKey, found := lookupCache(r, m.cache.GetEntry)
+			m.summary.recordCache(pool, found)
+			m.expvars.recordCache(found)
+			if found {
 				log.Debug("Cache hit",
 					zap.String("key", cacheKey),
 					zap.String("path", r.URL.Path))
-				for key, values := range headers {
+				if m.serverTiming {
+					setServerTiming(out, 0, cacheStatusHit)
+				}
+				for key, values := range entry.Header {
 					for _, value := range values {
-						wrapped.Header().Add(key, value)
+						out.Header().Add(key, value)
 					}
 				}
-				wrapped.Write(cachedData)
+				if m.cacheDebug && entry.Backend != "" {
+					out.Header().Set("X-Cache-Backend", entry.Backend)
+				}
+				out.WriteHeader(entry.StatusCode)
+				out.Write(entry.Value)
 				return
 			}
 			log.Debug("Cache miss", zap.String("key", cacheKey))
 		}
 
-		next.ServeHTTP(wrapped, r)
+		next.ServeHTTP(out, r)
 	})
 }
 
+// getClientIP returns the client IP resolved from a trusted proxy's
+// X-Forwarded-For, or else the peer address.
 func getClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		return r.RemoteAddr
@@ -114,10 +377,18 @@ type responseWriter struct {
 }
 
 func (rw *responseWriter) WriteHeader(statusCode int) {
-	rw.status = statusCode
+	if !isInformational(statusCode) {
+		rw.status = statusCode
+	}
 	rw.ResponseWriter.WriteHeader(statusCode)
 }
 
 func (rw *responseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// hijack the connection for a WebSocket tunnel.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,308 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/access"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/ratelimit"
+
+	"go.uber.org/zap"
+)
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+}
+
+func newTestMiddleware(t *testing.T, routes []config.RouteConfig) *Middleware {
+	t.Helper()
+
+	router, err := NewRouter(routes)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	return NewMiddleware(logger.FromZap(zap.NewNop()), nil, nil, false, router)
+}
+
+func serveFrom(h http.Handler, remoteAddr, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware_RouteScopedIPRestriction(t *testing.T) {
+	m := newTestMiddleware(t, []config.RouteConfig{
+		{
+			Name:   "admin",
+			Match:  config.RouteMatchConfig{PathPrefix: "/admin"},
+			Access: &config.AccessConfig{Allow: []string{"10.0.0.0/8"}},
+		},
+	})
+	h := m.Chain(okHandler())
+
+	if rec := serveFrom(h, "192.168.1.1:5000", "/admin/users"); rec.Code != http.StatusForbidden {
+		t.Errorf("External client on /admin: expected 403, got %d", rec.Code)
+	}
+	if rec := serveFrom(h, "10.1.2.3:5000", "/admin/users"); rec.Code != http.StatusOK {
+		t.Errorf("Internal client on /admin: expected 200, got %d", rec.Code)
+	}
+	if rec := serveFrom(h, "192.168.1.1:5000", "/api/items"); rec.Code != http.StatusOK {
+		t.Errorf("External client on /api: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_RouteScopedAuth(t *testing.T) {
+	m := newTestMiddleware(t, []config.RouteConfig{
+		{
+			Match: config.RouteMatchConfig{PathPrefix: "/private"},
+			Auth:  &config.AuthConfig{Users: map[string]string{"alice": "secret"}},
+		},
+	})
+	h := m.Chain(okHandler())
+
+	rec := serveFrom(h, "192.168.1.1:5000", "/private")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", rec.Code)
+	}
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Error("Expected WWW-Authenticate header")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/private", nil)
+	req.SetBasicAuth("alice", "secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with valid credentials, got %d", rec.Code)
+	}
+
+	if rec := serveFrom(h, "192.168.1.1:5000", "/public"); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 on unrestricted route, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_CacheHitReplaysStatus(t *testing.T) {
+	c := cache.NewCache(time.Minute)
+	c.SetWithTTL("GET:/moved", http.StatusMovedPermanently, nil, http.Header{"Location": {"/new-home"}}, time.Hour)
+
+	m := NewMiddleware(logger.FromZap(zap.NewNop()), nil, c, true, nil)
+	rec := serveFrom(m.Chain(okHandler()), "192.168.1.1:5000", "/moved")
+
+	if rec.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected cached 301 to be replayed, got %d", rec.Code)
+	}
+	if rec.Header().Get("Location") != "/new-home" {
+		t.Errorf("Expected cached Location header, got %q", rec.Header().Get("Location"))
+	}
+}
+
+func TestMiddleware_FingerprintRateLimitBuckets(t *testing.T) {
+	newHandler := func(fingerprint bool) http.Handler {
+		m := NewMiddleware(logger.FromZap(zap.NewNop()), ratelimit.NewLimiter(1, 1), nil, false, nil)
+		m.SetFingerprint(config.FingerprintConfig{Enabled: fingerprint, Headers: []string{"Accept-Language"}})
+		return m.Chain(okHandler())
+	}
+	send := func(h http.Handler, userAgent string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.168.1.1:5000"
+		req.Header.Set("User-Agent", userAgent)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	h := newHandler(true)
+	if code := send(h, "bot-a"); code != http.StatusOK {
+		t.Fatalf("Expected first request allowed, got %d", code)
+	}
+	if code := send(h, "bot-b"); code != http.StatusOK {
+		t.Errorf("Expected a distinct fingerprint from the same IP to get its own bucket, got %d", code)
+	}
+	if code := send(h, "bot-a"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected repeated fingerprint to be limited, got %d", code)
+	}
+
+	h = newHandler(false)
+	send(h, "bot-a")
+	if code := send(h, "bot-b"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected IP-only limiting without fingerprint, got %d", code)
+	}
+}
+
+func TestMiddleware_GlobalRateLimitSharedAcrossIPs(t *testing.T) {
+	limiter := ratelimit.NewLimiter(1, 2)
+	limiter.SetGlobal(true)
+	h := NewMiddleware(logger.FromZap(zap.NewNop()), limiter, nil, false, nil).Chain(okHandler())
+
+	for _, addr := range []string{"192.168.1.1:5000", "192.168.1.2:5000"} {
+		if rec := serveFrom(h, addr, "/"); rec.Code != http.StatusOK {
+			t.Fatalf("Expected request from %s within the global burst, got %d", addr, rec.Code)
+		}
+	}
+	if rec := serveFrom(h, "192.168.1.3:5000", "/"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a new IP to be limited once the global burst is spent, got %d", rec.Code)
+	}
+
+	limiter.SetGlobal(false)
+	if rec := serveFrom(h, "192.168.1.3:5000", "/"); rec.Code != http.StatusOK {
+		t.Errorf("Expected per-IP buckets after leaving global scope, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_RateLimitAllowlist(t *testing.T) {
+	allowlist, err := access.NewMatcher([]string{"10.1.2.3", "192.168.10.0/24"})
+	if err != nil {
+		t.Fatalf("NewMatcher failed: %v", err)
+	}
+	m := NewMiddleware(logger.FromZap(zap.NewNop()), ratelimit.NewLimiter(1, 1), nil, false, nil)
+	m.SetRateLimitAllowlist(allowlist)
+	h := m.Chain(okHandler())
+
+	for _, addr := range []string{"10.1.2.3:5000", "192.168.10.77:5000"} {
+		for i := 0; i < 5; i++ {
+			if rec := serveFrom(h, addr, "/"); rec.Code != http.StatusOK {
+				t.Fatalf("Expected allowlisted %s to bypass the limiter, got %d on request %d", addr, rec.Code, i+1)
+			}
+		}
+	}
+
+	for _, addr := range []string{"10.1.2.4:5000", "192.168.11.1:5000"} {
+		serveFrom(h, addr, "/")
+		if rec := serveFrom(h, addr, "/"); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected %s outside the allowlist to be limited, got %d", addr, rec.Code)
+		}
+	}
+}
+
+func TestServer_CacheHitNamesSourceBackend(t *testing.T) {
+	backend := namedBackend("origin")
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Cache.Enabled = true
+	cfg.Cache.DebugHeaders = true
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.publicHandler()
+
+	miss := serveFrom(h, "192.168.1.1:5000", "/doc")
+	if miss.Header().Get("X-Cache-Backend") != "" {
+		t.Error("Expected no X-Cache-Backend on a cache miss")
+	}
+
+	entry, found := s.cache.GetEntry("GET:/doc")
+	if !found {
+		t.Fatal("Expected response to be cached")
+	}
+	if entry.Backend != backend.URL {
+		t.Errorf("Expected entry backend %q, got %q", backend.URL, entry.Backend)
+	}
+
+	hit := serveFrom(h, "192.168.1.1:5000", "/doc")
+	if got := hit.Header().Get("X-Cache-Backend"); got != backend.URL {
+		t.Errorf("Expected X-Cache-Backend %q on a hit, got %q", backend.URL, got)
+	}
+}
+
+// sendHTTP10 writes a raw HTTP/1.0 request for path with the given header
+// lines to conn and reads the response.
+func sendHTTP10(t *testing.T, conn net.Conn, br *bufio.Reader, path string, headers ...string) *http.Response {
+	t.Helper()
+	req := "GET " + path + " HTTP/1.0\r\n" + strings.Join(headers, "") + "\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatalf("Failed to write request: %v", err)
+	}
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestMiddleware_HTTP10WithoutHostRejected(t *testing.T) {
+	cfg := testConfig("http://localhost:8001")
+	cfg.RateLimit.Enabled = false
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	proxy := httptest.NewServer(s.publicHandler())
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	resp := sendHTTP10(t, conn, bufio.NewReader(conn), "/")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a request without Host, got %d", resp.StatusCode)
+	}
+}
+
+func TestMiddleware_HTTP10DefaultHostAndKeepAlive(t *testing.T) {
+	var forwardedHost, connection []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedHost = append(forwardedHost, r.Header.Get("X-Forwarded-Host"))
+		connection = append(connection, r.Header.Get("Connection"))
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Server.DefaultHost = "legacy.example.com"
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	proxy := httptest.NewServer(s.publicHandler())
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	// Both requests must be answered on the same connection.
+	for _, path := range []string{"/first", "/second"} {
+		resp := sendHTTP10(t, conn, br, path, "Connection: keep-alive\r\n")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, resp.StatusCode)
+		}
+		if resp.Close {
+			t.Fatalf("%s: expected the proxy to keep the HTTP/1.0 connection alive", path)
+		}
+	}
+
+	for i, host := range forwardedHost {
+		if host != "legacy.example.com" {
+			t.Errorf("Request %d: expected X-Forwarded-Host from default_host, got %q", i, host)
+		}
+		if connection[i] != "" {
+			t.Errorf("Request %d: expected the client's Connection header not to be forwarded, got %q", i, connection[i])
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// optionsResponder answers OPTIONS requests without a backend roundtrip. It
+// only sets Allow; CORS headers such as Access-Control-Allow-Origin are left
+// to whatever layer owns the CORS policy, so CORS preflights (those carrying
+// Access-Control-Request-Method) are never answered here.
+type optionsResponder struct {
+	paths []string
+	allow string
+}
+
+func newOptionsResponder(paths, methods []string) *optionsResponder {
+	return &optionsResponder{
+		paths: paths,
+		allow: strings.Join(methods, ", "),
+	}
+}
+
+func (o *optionsResponder) matches(r *http.Request) bool {
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") != "" {
+		return false
+	}
+	if r.RequestURI == "*" || len(o.paths) == 0 {
+		return true
+	}
+	for _, prefix := range o.paths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *optionsResponder) serve(w http.ResponseWriter) {
+	w.Header().Set("Allow", o.allow)
+	w.WriteHeader(http.StatusNoContent)
+}
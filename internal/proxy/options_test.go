@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestMiddleware_HandlesConfiguredOptions(t *testing.T) {
+	var forwarded atomic.Int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded.Add(1)
+		w.Write([]byte("from backend"))
+	})
+
+	m := newTestMiddleware(t, nil)
+	m.SetOptionsResponder(config.ProxyConfig{
+		HandleOptions:  true,
+		OptionsPaths:   []string{"/api/"},
+		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+	})
+	h := m.Chain(next)
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/users", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "GET, POST, OPTIONS" {
+		t.Errorf("Expected Allow header from allowed_methods, got %q", allow)
+	}
+	if forwarded.Load() != 0 {
+		t.Error("Expected handled OPTIONS not to reach the backend")
+	}
+
+	req = httptest.NewRequest(http.MethodOptions, "/static/app.js", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Body.String() != "from backend" || forwarded.Load() != 1 {
+		t.Errorf("Expected OPTIONS outside options_paths to be forwarded, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMiddleware_ForwardsCORSPreflight(t *testing.T) {
+	var forwarded atomic.Int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded.Add(1)
+		w.Header().Set("Access-Control-Allow-Origin", "https://app.example")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	m := newTestMiddleware(t, nil)
+	m.SetOptionsResponder(config.ProxyConfig{
+		HandleOptions:  true,
+		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+	})
+	h := m.Chain(next)
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/users", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if forwarded.Load() != 1 {
+		t.Fatal("Expected the CORS preflight to reach the backend")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("Expected the backend's CORS headers, got Access-Control-Allow-Origin %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/api/users", nil))
+	if forwarded.Load() != 1 || rec.Header().Get("Allow") != "GET, POST, OPTIONS" {
+		t.Errorf("Expected a plain OPTIONS request to be answered locally, got Allow %q", rec.Header().Get("Allow"))
+	}
+}
+
+func TestServer_HandlesOptionsAsterisk(t *testing.T) {
+	backend := namedBackend("backend")
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Proxy.HandleOptions = true
+	cfg.Proxy.AllowedMethods = []string{"GET", "HEAD"}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(s.publicHandler())
+	srv.Config.DisableGeneralOptionsHandler = true
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "OPTIONS * HTTP/1.1\r\nHost: %s\r\n\r\n", srv.Listener.Addr())
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 for OPTIONS *, got %d", resp.StatusCode)
+	}
+	if allow := resp.Header.Get("Allow"); !strings.Contains(allow, "HEAD") {
+		t.Errorf("Expected Allow header, got %q", allow)
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import "net/http"
+
+type pingResponse struct {
+	Status  string `json:"status"`
+	Version string `json:"version,omitempty"`
+}
+
+// SetVersion sets the version reported on server.ping_path.
+func (s *Server) SetVersion(version string) {
+	s.version = version
+}
+
+// handlePing answers server.ping_path from the proxy itself so monitoring can
+// tell the proxy apart from the backends behind it.
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, pingResponse{Status: "ok", Version: s.version})
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestServer_PingPathAnsweredLocally(t *testing.T) {
+	backend := namedBackend("backend")
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Server.PingPath = "/__ping"
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	s.SetVersion("1.2.3")
+	h := s.publicHandler()
+
+	rec := serveFrom(h, "192.168.1.1:5000", "/__ping")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from ping path, got %d", rec.Code)
+	}
+	var ping pingResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &ping); err != nil {
+		t.Fatalf("Invalid ping JSON %q: %v", rec.Body.String(), err)
+	}
+	if ping.Status != "ok" || ping.Version != "1.2.3" {
+		t.Errorf("Unexpected ping response: %+v", ping)
+	}
+
+	for _, path := range []string{"/", "/__ping/extra"} {
+		if rec := serveFrom(h, "192.168.1.1:5000", path); rec.Body.String() != "backend" {
+			t.Errorf("%s: expected request to be proxied, got %q", path, rec.Body.String())
+		}
+	}
+}
+
+func TestServer_PingPathUnsetProxiesEverything(t *testing.T) {
+	backend := namedBackend("backend")
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	if rec := serveFrom(s.publicHandler(), "192.168.1.1:5000", "/__ping"); rec.Body.String() != "backend" {
+		t.Errorf("Expected /__ping to be proxied when ping_path is unset, got %q", rec.Body.String())
+	}
+}
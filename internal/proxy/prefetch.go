@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+type prefetchKey struct{}
+
+// prefetcher fetches resources advertised by "Link: <...>; rel=prefetch" on
+// cached responses, so a following request for them is a cache hit. Fetches
+// go back through the handler, are limited to the origin request's host, and
+// are dropped rather than queued once maxConcurrent are in flight. They skip
+// the middleware, so they carry the origin request's route and client IP,
+// and a link outside that route is not fetched: it would otherwise be sent
+// to the default pool and cached under a path another upstream serves.
+type prefetcher struct {
+	handler *Handler
+	slots   chan struct{}
+}
+
+func newPrefetcher(h *Handler, maxConcurrent int) *prefetcher {
+	return &prefetcher{
+		handler: h,
+		slots:   make(chan struct{}, maxConcurrent),
+	}
+}
+
+func (p *prefetcher) maybePrefetch(r *http.Request, header http.Header) {
+	// Never chain prefetches off a prefetched response.
+	if r.Context().Value(prefetchKey{}) != nil {
+		return
+	}
+
+	for _, target := range prefetchLinks(header) {
+		ref, err := url.Parse(target)
+		if err != nil {
+			continue
+		}
+		if ref.IsAbs() || ref.Host != "" {
+			if !strings.EqualFold(ref.Host, r.Host) {
+				continue
+			}
+		}
+
+		resolved := r.URL.ResolveReference(ref)
+		req, err := http.NewRequestWithContext(p.context(r),
+			http.MethodGet, (&url.URL{Path: resolved.Path, RawPath: resolved.RawPath, RawQuery: resolved.RawQuery}).String(), nil)
+		if err != nil {
+			continue
+		}
+		req.Host = r.Host
+		req.RemoteAddr = r.RemoteAddr
+
+		if route := routeFromContext(req.Context()); route != nil && !route.matches(req) {
+			p.handler.logger.Debug("Prefetch skipped, link is outside the route",
+				zap.String("route", route.Name),
+				zap.String("path", req.URL.Path))
+			continue
+		}
+
+		if _, _, found := lookupCache(req, p.handler.cache.GetEntry); found {
+			continue
+		}
+
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			p.handler.logger.Debug("Prefetch skipped, too many in flight",
+				zap.String("path", req.URL.Path))
+			continue
+		}
+
+		go func() {
+			defer func() { <-p.slots }()
+			p.handler.ServeHTTP(newDiscardWriter(), req)
+			p.handler.logger.Debug("Prefetched linked resource",
+				zap.String("path", req.URL.Path))
+		}()
+	}
+}
+
+// context builds a prefetch context detached from the origin request's
+// lifetime but keeping the values the handler routes on.
+func (p *prefetcher) context(r *http.Request) context.Context {
+	ctx := context.WithValue(context.Background(), prefetchKey{}, true)
+	if route := routeFromContext(r.Context()); route != nil {
+		ctx = contextWithRoute(ctx, route)
+	}
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		ctx = contextWithClientIP(ctx, ip)
+	}
+	return ctx
+}
+
+// prefetchLinks returns the targets of Link header entries whose rel includes
+// "prefetch".
+func prefetchLinks(header http.Header) []string {
+	var links []string
+	for _, value := range header.Values("Link") {
+		for _, entry := range strings.Split(value, ",") {
+			parts := strings.Split(entry, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				name, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+					continue
+				}
+				rels := strings.Fields(strings.Trim(strings.TrimSpace(val), `"`))
+				for _, rel := range rels {
+					if strings.EqualFold(rel, "prefetch") {
+						links = append(links, target[1:len(target)-1])
+						break
+					}
+				}
+			}
+		}
+	}
+	return links
+}
+
+type discardWriter struct {
+	header http.Header
+}
+
+func newDiscardWriter() *discardWriter {
+	return &discardWriter{header: make(http.Header)}
+}
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
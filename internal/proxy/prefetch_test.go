@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+func TestHandler_PrefetchesLinkedResource(t *testing.T) {
+	var foreignHits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page/1":
+			w.Header().Add("Link", `</page/2>; rel=prefetch`)
+			w.Header().Add("Link", `<http://elsewhere.test/page/3>; rel=prefetch`)
+			w.Write([]byte("page 1"))
+		case "/page/2":
+			w.Header().Set("Link", `</page/3>; rel=prefetch`)
+			w.Write([]byte("page 2"))
+		default:
+			foreignHits.Add(1)
+			w.Write([]byte("other"))
+		}
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandlerWithCache(backend.URL, config.CacheConfig{
+		Enabled:  true,
+		TTL:      time.Minute,
+		Prefetch: config.PrefetchConfig{Enabled: true, MaxConcurrent: 2},
+	}, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/page/1", nil))
+	if rec.Body.String() != "page 1" {
+		t.Fatalf("Expected page 1, got %q", rec.Body.String())
+	}
+
+	key := getCacheKey(httptest.NewRequest(http.MethodGet, "/page/2", nil))
+	deadline := time.Now().Add(2 * time.Second)
+	var body []byte
+	found := false
+	for !found && time.Now().Before(deadline) {
+		body, _, found = c.Get(key)
+		if !found {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if !found {
+		t.Fatal("Expected linked resource to be prefetched into cache")
+	}
+	if string(body) != "page 2" {
+		t.Errorf("Expected prefetched body %q, got %q", "page 2", body)
+	}
+
+	// Give any stray fetches a moment to land before asserting none happened.
+	time.Sleep(50 * time.Millisecond)
+	if n := foreignHits.Load(); n != 0 {
+		t.Errorf("Expected no cross-host or chained prefetches, got %d", n)
+	}
+}
+
+func TestHandler_PrefetchUsesOriginRoute(t *testing.T) {
+	defaultBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("default " + r.URL.Path))
+	}))
+	defer defaultBackend.Close()
+	var outsideHits atomic.Int32
+	apiBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/1":
+			w.Header().Add("Link", `</api/2>; rel=prefetch`)
+			w.Header().Add("Link", `</other>; rel=prefetch`)
+		case "/other":
+			outsideHits.Add(1)
+		}
+		w.Write([]byte("api " + r.URL.Path))
+	}))
+	defer apiBackend.Close()
+
+	pool := balancer.NewSRR()
+	pool.AddBackend(balancer.NewBackend(defaultBackend.URL, 1))
+	api := balancer.NewSRR()
+	api.AddBackend(balancer.NewBackend(apiBackend.URL, 1))
+	cacheCfg := config.CacheConfig{
+		Enabled:  true,
+		TTL:      time.Minute,
+		Prefetch: config.PrefetchConfig{Enabled: true, MaxConcurrent: 2},
+	}
+	c := cache.NewCache(cacheCfg.TTL)
+	handler := NewHandler(pool, map[string]balancer.Balancer{"api": api}, c,
+		logger.FromZap(zap.NewNop()), metrics.NewRegistry(), cacheCfg, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	router, err := NewRouter([]config.RouteConfig{
+		{Name: "api", Upstream: "api", Match: config.RouteMatchConfig{PathPrefix: "/api/"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/1", nil)
+	req = req.WithContext(contextWithRoute(req.Context(), router.Match(req)))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	key := getCacheKey(httptest.NewRequest(http.MethodGet, "/api/2", nil))
+	deadline := time.Now().Add(2 * time.Second)
+	var body []byte
+	found := false
+	for !found && time.Now().Before(deadline) {
+		body, _, found = c.Get(key)
+		if !found {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if !found {
+		t.Fatal("Expected routed link to be prefetched into cache")
+	}
+	if string(body) != "api /api/2" {
+		t.Errorf("Expected prefetch from the route's upstream, got %q", body)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := outsideHits.Load(); n != 0 {
+		t.Errorf("Expected no prefetch outside the route, got %d", n)
+	}
+	if _, _, found := c.Get(getCacheKey(httptest.NewRequest(http.MethodGet, "/other", nil))); found {
+		t.Error("Expected link outside the route not to be cached")
+	}
+}
+
+func TestPrefetchLinks(t *testing.T) {
+	header := http.Header{}
+	header.Add("Link", `</a.css>; rel=preload; as=style, </next>; rel="prefetch"`)
+	header.Add("Link", `</b>; rel="next prefetch", </c>`)
+
+	got := prefetchLinks(header)
+	want := []string{"/next", "/b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type rateLimitStatsResponse struct {
+	IP       string    `json:"ip"`
+	Tokens   float64   `json:"tokens"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// handleRateLimitInspect serves GET /ratelimit/inspect?ip=, reporting the
+// requests the client's bucket currently allows. With fingerprinting on, ip
+// must be the full limiter key.
+func (s *Server) handleRateLimitInspect(w http.ResponseWriter, r *http.Request) {
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		http.Error(w, "ip is required", http.StatusBadRequest)
+		return
+	}
+
+	tokens, lastSeen, ok := s.limiter.Stats(ip)
+	if !ok {
+		http.Error(w, "no rate limiter state for "+ip, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, rateLimitStatsResponse{IP: ip, Tokens: tokens, LastSeen: lastSeen})
+}
+
+// handleRateLimitReset serves POST /ratelimit/reset?ip=, giving a client
+// stuck at its limit a fresh allowance.
+func (s *Server) handleRateLimitReset(w http.ResponseWriter, r *http.Request) {
+	ip := r.URL.Query().Get("ip")
+	params := map[string]string{"ip": ip}
+	if ip == "" {
+		s.adminError(w, r, "ratelimit.reset", params, http.StatusBadRequest, errors.New("ip is required"))
+		return
+	}
+	if !s.limiter.Reset(ip) {
+		s.adminError(w, r, "ratelimit.reset", params, http.StatusNotFound, errors.New("no rate limiter state for "+ip))
+		return
+	}
+
+	s.logger.Info("Rate limiter reset for client", zap.String("client_ip", ip))
+	writeJSON(w, http.StatusOK, map[string]string{"reset": ip})
+	s.recordAudit(r, "ratelimit.reset", params, http.StatusOK, nil)
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestAdmin_RateLimitInspectAndReset(t *testing.T) {
+	cfg := testConfig("http://localhost:8001")
+	cfg.RateLimit.RequestsPerMinute = 1
+	cfg.RateLimit.Burst = 2
+	cfg.Admin.Token = "secret"
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	mux := s.adminMux()
+	admin := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := admin(http.MethodGet, "/ratelimit/inspect?ip=192.168.1.1"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unseen client, got %d", rec.Code)
+	}
+
+	s.limiter.Allow("192.168.1.1")
+	s.limiter.Allow("192.168.1.1")
+	if s.limiter.Allow("192.168.1.1") {
+		t.Fatal("Expected the client to be at its limit")
+	}
+
+	rec := admin(http.MethodGet, "/ratelimit/inspect?ip=192.168.1.1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var stats rateLimitStatsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if stats.Tokens >= 1 || stats.LastSeen.IsZero() {
+		t.Errorf("Expected an exhausted bucket with a last seen time, got %+v", stats)
+	}
+
+	if rec := admin(http.MethodPost, "/ratelimit/reset?ip=192.168.1.1"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on reset, got %d", rec.Code)
+	}
+	if !s.limiter.Allow("192.168.1.1") {
+		t.Error("Expected the client to be allowed again after reset")
+	}
+
+	if rec := admin(http.MethodPost, "/ratelimit/reset?ip=10.0.0.1"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 resetting an unseen client, got %d", rec.Code)
+	}
+	if rec := admin(http.MethodPost, "/ratelimit/reset"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without ip, got %d", rec.Code)
+	}
+}
+
+func TestAdmin_RateLimitResetRequiresToken(t *testing.T) {
+	cfg := testConfig("http://localhost:8001")
+	cfg.RateLimit.RequestsPerMinute = 1
+	cfg.RateLimit.Burst = 1
+	cfg.Admin.Token = "secret"
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	s.limiter.Allow("192.168.1.1")
+
+	for _, token := range []string{"", "wrong"} {
+		req := httptest.NewRequest(http.MethodPost, "/ratelimit/reset?ip=192.168.1.1", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.adminMux().ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Token %q: expected 401, got %d", token, rec.Code)
+		}
+	}
+	if s.limiter.Allow("192.168.1.1") {
+		t.Error("Expected the client to stay at its limit after unauthorized resets")
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// readinessCheck is one condition /readyz depends on. Reason says why a
+// failing check blocks readiness.
+type readinessCheck struct {
+	Name   string `json:"name"`
+	Ready  bool   `json:"ready"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type readinessResponse struct {
+	Ready  bool             `json:"ready"`
+	Checks []readinessCheck `json:"checks"`
+}
+
+// readinessChecks evaluates every readiness condition in order: shutdown,
+// healthy backends, min_healthy (when it gates readiness) and the initial
+// connection warm-up (when warming is on).
+func (s *Server) readinessChecks() []readinessCheck {
+	checks := []readinessCheck{{Name: "shutdown", Ready: !s.draining.Load()}}
+	if !checks[0].Ready {
+		checks[0].Reason = "draining"
+	}
+
+	healthy := s.balancer.HealthyCount()
+	backends := readinessCheck{Name: "backends", Ready: healthy > 0}
+	if !backends.Ready {
+		backends.Reason = "0 healthy backends"
+	}
+	checks = append(checks, backends)
+
+	if s.config.HealthCheck.MinHealthyReadiness {
+		minHealthy := readinessCheck{Name: "min_healthy", Ready: !s.monitor.Degraded()}
+		if !minHealthy.Ready {
+			minHealthy.Reason = fmt.Sprintf("%d healthy backends, below min_healthy %d", healthy, s.config.HealthCheck.MinHealthy)
+		}
+		checks = append(checks, minHealthy)
+	}
+
+	if s.warmer != nil {
+		warm := readinessCheck{Name: "warm_up", Ready: s.warmer.Warmed()}
+		if !warm.Ready {
+			warm.Reason = "warming up"
+		}
+		checks = append(checks, warm)
+	}
+	return checks
+}
+
+// handleReady answers 200 "ready" or 503 with the first blocking reason.
+// With ?verbose=true it returns every check as JSON instead.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	checks := s.readinessChecks()
+	var blocking *readinessCheck
+	for i := range checks {
+		if !checks[i].Ready {
+			blocking = &checks[i]
+			break
+		}
+	}
+
+	if r.URL.Query().Get("verbose") == "true" {
+		status := http.StatusOK
+		if blocking != nil {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, readinessResponse{Ready: blocking == nil, Checks: checks})
+		return
+	}
+
+	if blocking != nil {
+		http.Error(w, blocking.Reason, http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ready"))
+}
@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"slices"
+	"strings"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+
+	"go.uber.org/zap"
+)
+
+// Reload logs every difference between cfg and the running configuration,
+// then applies those that take effect without a restart: backend membership,
+// weights and priorities in existing pools, the rate limit, and whether rate
+// limiting and caching are enabled. Other changes are logged as requiring a
+// restart. When nothing changed, Reload does nothing. It returns the changes
+// found.
+func (s *Server) Reload(cfg *config.Config) []config.Change {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	changes := config.Diff(s.config, cfg)
+	if len(changes) == 0 {
+		s.logger.Info("Config unchanged, skipping reload")
+		return nil
+	}
+
+	for _, change := range changes {
+		s.logger.Info("Config change",
+			zap.String("path", change.Path),
+			zap.String("old", change.Old),
+			zap.String("new", change.New))
+	}
+
+	pools := make(map[string]bool)
+	rateLimit, cacheToggle := false, false
+	for _, change := range changes {
+		if name, ok := livePool(change.Path); ok && s.poolNamed(name) != nil {
+			pools[name] = true
+			continue
+		}
+		switch change.Path {
+		case "rate_limit.enabled", "rate_limit.requests_per_minute", "rate_limit.burst", "rate_limit.scope":
+			rateLimit = true
+			continue
+		case "cache.enabled":
+			cacheToggle = true
+			continue
+		}
+		s.logger.Warn("Config change requires a restart to take effect",
+			zap.String("path", change.Path))
+	}
+
+	applied := *s.config
+	applied.Upstreams = slices.Clone(s.config.Upstreams)
+	for name := range pools {
+		if name == "" {
+			s.syncPool(s.balancer, cfg, cfg.Backends)
+			applied.Backends = appliedBackends(s.config.Backends, cfg.Backends)
+			continue
+		}
+		i := slices.IndexFunc(applied.Upstreams, func(u config.UpstreamConfig) bool { return u.Name == name })
+		j := slices.IndexFunc(cfg.Upstreams, func(u config.UpstreamConfig) bool { return u.Name == name })
+		s.syncPool(s.upstreams[name], cfg, cfg.Upstreams[j].Backends)
+		applied.Upstreams[i].Backends = appliedBackends(applied.Upstreams[i].Backends, cfg.Upstreams[j].Backends)
+	}
+	if rateLimit {
+		s.limiter.SetLimit(cfg.RateLimit.RequestsPerMinute, cfg.RateLimit.Burst)
+		s.limiter.SetGlobal(cfg.RateLimit.Scope == "global")
+		if cfg.RateLimit.Enabled {
+			s.middleware.SetLimiter(s.limiter)
+		} else {
+			s.middleware.SetLimiter(nil)
+		}
+		applied.RateLimit.Enabled = cfg.RateLimit.Enabled
+		applied.RateLimit.RequestsPerMinute = cfg.RateLimit.RequestsPerMinute
+		applied.RateLimit.Burst = cfg.RateLimit.Burst
+		applied.RateLimit.Scope = cfg.RateLimit.Scope
+	}
+	if cacheToggle {
+		s.handler.SetCacheEnabled(cfg.Cache.Enabled)
+		s.middleware.SetCacheEnabled(cfg.Cache.Enabled)
+		applied.Cache.Enabled = cfg.Cache.Enabled
+	}
+	s.config = &applied
+
+	return changes
+}
+
+// livePool returns the pool a backend membership, weight or priority change
+// at path belongs to, "" for the default pool.
+func livePool(path string) (string, bool) {
+	if path == "backends" || (strings.HasPrefix(path, "backends[") && liveBackendField(path)) {
+		return "", true
+	}
+	rest, ok := strings.CutPrefix(path, "upstreams.")
+	if !ok {
+		return "", false
+	}
+	name, tail, ok := strings.Cut(rest, ".backends")
+	if !ok || (tail != "" && !(strings.HasPrefix(tail, "[") && liveBackendField(tail))) {
+		return "", false
+	}
+	return name, true
+}
+
+// liveBackendField reports whether path names a backend setting syncPool
+// applies in place.
+func liveBackendField(path string) bool {
+	return strings.HasSuffix(path, ".weight") || strings.HasSuffix(path, ".priority")
+}
+
+// appliedBackends is the backend list syncPool leaves running when a pool
+// configured as running is synced to next: backends that stay keep their
+// running settings apart from weight and priority, and added backends take
+// theirs from next.
+func appliedBackends(running, next []config.BackendConfig) []config.BackendConfig {
+	byURL := make(map[string]config.BackendConfig, len(running))
+	for _, backend := range running {
+		byURL[backend.URL] = backend
+	}
+	applied := make([]config.BackendConfig, 0, len(next))
+	for _, backend := range next {
+		if current, ok := byURL[backend.URL]; ok {
+			current.Weight = backend.Weight
+			current.Priority = backend.Priority
+			backend = current
+		}
+		applied = append(applied, backend)
+	}
+	return applied
+}
+
+func (s *Server) poolNamed(name string) balancer.Balancer {
+	if name == "" {
+		return s.balancer
+	}
+	return s.upstreams[name]
+}
+
+// syncPool makes pool hold exactly backends. Backends that stay keep their
+// health and balancing state and only have their weight and priority
+// updated.
+func (s *Server) syncPool(pool balancer.Balancer, cfg *config.Config, backends []config.BackendConfig) {
+	configured := make([]float64, len(backends))
+	for i, backendCfg := range backends {
+		configured[i] = backendCfg.Weight
+	}
+	weights := balancer.NormalizeWeights(configured)
+
+	current := make(map[string]*balancer.Backend)
+	for _, backend := range pool.GetBackends() {
+		current[backend.URL] = backend
+	}
+
+	wanted := make(map[string]bool, len(backends))
+	for i, backendCfg := range backends {
+		wanted[backendCfg.URL] = true
+		if pool.SetWeight(backendCfg.URL, weights[i]) {
+			if backend, ok := current[backendCfg.URL]; ok {
+				backend.SetPriority(backendCfg.Priority)
+			}
+			continue
+		}
+		pool.AddBackend(newPoolBackend(cfg, backendCfg, weights[i], s.metrics, s.logger))
+		s.logger.Info("Backend added",
+			zap.String("url", backendCfg.URL),
+			zap.Float64("weight", backendCfg.Weight),
+			zap.Int("effective_weight", weights[i]))
+	}
+	for _, backend := range pool.GetBackends() {
+		if !wanted[backend.URL] && pool.RemoveBackend(backend.URL) {
+			detachBreaker(s.metrics, backend)
+			s.logger.Info("Backend removed", zap.String("url", backend.URL))
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestServer_ReloadLogsDiffAndApplies(t *testing.T) {
+	cfg := testConfig("http://a:8001", "http://b:8002")
+	core, logs := observer.New(zap.InfoLevel)
+	s, err := NewServer(cfg, logger.FromZap(zap.New(core)))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	next := *cfg
+	next.Backends = []config.BackendConfig{
+		{URL: "http://a:8001", Weight: 1},
+		{URL: "http://c:8003", Weight: 1},
+	}
+	next.RateLimit.RequestsPerMinute = cfg.RateLimit.RequestsPerMinute * 2
+
+	changes := s.Reload(&next)
+
+	want := map[string]bool{
+		"backends: added http://c:8003":   false,
+		"backends: removed http://b:8002": false,
+	}
+	rateLimitChanged := false
+	for _, change := range changes {
+		if _, ok := want[change.String()]; ok {
+			want[change.String()] = true
+		}
+		if change.Path == "rate_limit.requests_per_minute" {
+			rateLimitChanged = true
+		}
+	}
+	for change, found := range want {
+		if !found {
+			t.Errorf("Expected diff to contain %q, got %v", change, changes)
+		}
+	}
+	if !rateLimitChanged {
+		t.Errorf("Expected diff to report the rate limit change, got %v", changes)
+	}
+	if n := logs.FilterMessage("Config change").Len(); n != len(changes) {
+		t.Errorf("Expected %d logged changes, got %d", len(changes), n)
+	}
+
+	var urls []string
+	for _, backend := range s.balancer.GetBackends() {
+		urls = append(urls, backend.URL)
+	}
+	if len(urls) != 2 || urls[0] != "http://a:8001" || urls[1] != "http://c:8003" {
+		t.Errorf("Expected pool [a c] after reload, got %v", urls)
+	}
+	if s.config.RateLimit.RequestsPerMinute != next.RateLimit.RequestsPerMinute {
+		t.Errorf("Expected applied rate limit %d, got %d", next.RateLimit.RequestsPerMinute, s.config.RateLimit.RequestsPerMinute)
+	}
+
+	if changes := s.Reload(&next); changes != nil {
+		t.Errorf("Expected a repeated reload to find no changes, got %v", changes)
+	}
+	if logs.FilterMessage("Config unchanged, skipping reload").Len() != 1 {
+		t.Error("Expected the no-op reload to be logged as skipped")
+	}
+}
+
+func TestServer_ReloadFlagsRestartOnlyChanges(t *testing.T) {
+	cfg := testConfig("http://a:8001")
+	core, logs := observer.New(zap.InfoLevel)
+	s, err := NewServer(cfg, logger.FromZap(zap.New(core)))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	next := *cfg
+	next.Compression.Enabled = !cfg.Compression.Enabled
+	s.Reload(&next)
+
+	entries := logs.FilterMessage("Config change requires a restart to take effect").All()
+	if len(entries) != 1 || entries[0].ContextMap()["path"] != "compression.enabled" {
+		t.Errorf("Expected compression.enabled to require a restart, got %v", entries)
+	}
+	if s.config.Compression.Enabled != cfg.Compression.Enabled {
+		t.Error("Expected restart-only change not to be recorded as applied")
+	}
+}
+
+func TestServer_ReloadAppliesBackendPriority(t *testing.T) {
+	cfg := testConfig("http://a:8001", "http://b:8002")
+	core, logs := observer.New(zap.InfoLevel)
+	s, err := NewServer(cfg, logger.FromZap(zap.New(core)))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	next := *cfg
+	next.Backends = []config.BackendConfig{
+		{URL: "http://a:8001", Weight: 1},
+		{URL: "http://b:8002", Weight: 1, Priority: 1},
+	}
+	s.Reload(&next)
+
+	if n := logs.FilterMessage("Config change requires a restart to take effect").Len(); n != 0 {
+		t.Errorf("Expected a priority change to apply live, got %d restart warnings", n)
+	}
+	for _, backend := range s.balancer.GetBackends() {
+		want := 0
+		if backend.URL == "http://b:8002" {
+			want = 1
+		}
+		if backend.Priority() != want {
+			t.Errorf("%s: expected priority %d, got %d", backend.URL, want, backend.Priority())
+		}
+	}
+	if s.config.Backends[1].Priority != 1 {
+		t.Error("Expected the applied config to record the new priority")
+	}
+}
+
+func TestServer_ReloadKeepsRestartOnlyBackendSettings(t *testing.T) {
+	cfg := testConfig("http://a:8001", "http://b:8002")
+	cfg.Backends[0].RequestHeaders = map[string]string{"Authorization": "Bearer old"}
+	cfg.Upstreams = []config.UpstreamConfig{{Name: "images", Backends: []config.BackendConfig{
+		{URL: "http://i:8001", Weight: 1, RequestHeaders: map[string]string{"Authorization": "Bearer old"}},
+	}}}
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	next := *cfg
+	next.Backends = []config.BackendConfig{
+		{URL: "http://a:8001", Weight: 2, RequestHeaders: map[string]string{"Authorization": "Bearer new"}},
+		{URL: "http://c:8003", Weight: 1, RequestHeaders: map[string]string{"Authorization": "Bearer c"}},
+	}
+	next.Upstreams = []config.UpstreamConfig{{Name: "images", Backends: []config.BackendConfig{
+		{URL: "http://i:8001", Weight: 1, Priority: 1, RequestHeaders: map[string]string{"Authorization": "Bearer new"}},
+	}}}
+	s.Reload(&next)
+
+	applied := s.config.Backends
+	if len(applied) != 2 || applied[0].Weight != 2 || applied[0].RequestHeaders["Authorization"] != "Bearer old" {
+		t.Errorf("Expected a's new weight with its running headers, got %+v", applied)
+	}
+	if len(applied) == 2 && applied[1].RequestHeaders["Authorization"] != "Bearer c" {
+		t.Errorf("Expected the added backend's headers to be recorded, got %+v", applied[1])
+	}
+	upstream := s.config.Upstreams[0].Backends[0]
+	if upstream.Priority != 1 || upstream.RequestHeaders["Authorization"] != "Bearer old" {
+		t.Errorf("Expected the upstream backend's new priority with its running headers, got %+v", upstream)
+	}
+
+	// The header change was not applied, so it is still reported next time.
+	var pending int
+	for _, change := range config.Diff(s.config, &next) {
+		if strings.Contains(change.Path, ".request_headers[") {
+			pending++
+		}
+	}
+	if pending != 2 {
+		t.Errorf("Expected both header changes still pending, got %d", pending)
+	}
+}
+
+func TestServer_ReloadFlagsUpstreamHealthCheckForRestart(t *testing.T) {
+	cfg := testConfig("http://a:8001")
+	cfg.Upstreams = []config.UpstreamConfig{{
+		Name:     "images",
+		Backends: []config.BackendConfig{{URL: "http://i:8001", Weight: 1}},
+	}}
+	core, logs := observer.New(zap.InfoLevel)
+	s, err := NewServer(cfg, logger.FromZap(zap.New(core)))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	next := *cfg
+	next.Upstreams = []config.UpstreamConfig{{
+		Name:        "images",
+		Backends:    cfg.Upstreams[0].Backends,
+		HealthCheck: config.HealthCheckOverride{Endpoint: "/images-health"},
+	}}
+	s.Reload(&next)
+
+	entries := logs.FilterMessage("Config change requires a restart to take effect").All()
+	if len(entries) != 1 || entries[0].ContextMap()["path"] != "upstreams.images.health_check.endpoint" {
+		t.Errorf("Expected the upstream health_check override to require a restart, got %v", entries)
+	}
+}
+
+func TestServer_ReloadTogglesCache(t *testing.T) {
+	var hits atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Cache.Enabled = false
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.publicHandler()
+
+	fetchTwice := func(path string) int64 {
+		before := hits.Load()
+		serveFrom(h, "192.168.1.1:5000", path)
+		serveFrom(h, "192.168.1.1:5000", path)
+		return hits.Load() - before
+	}
+
+	if n := fetchTwice("/off"); n != 2 {
+		t.Errorf("Expected both requests to reach the backend with cache off, got %d", n)
+	}
+
+	enabled := *cfg
+	enabled.Cache.Enabled = true
+	s.Reload(&enabled)
+	if n := fetchTwice("/on"); n != 1 {
+		t.Errorf("Expected the second request to be a cache hit after enabling, got %d backend hits", n)
+	}
+
+	disabled := enabled
+	disabled.Cache.Enabled = false
+	s.Reload(&disabled)
+	if n := fetchTwice("/on"); n != 2 {
+		t.Errorf("Expected cached entries to be bypassed after disabling, got %d backend hits", n)
+	}
+}
+
+func TestServer_ReloadTogglesRateLimit(t *testing.T) {
+	backend := namedBackend("ok")
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit = config.RateLimitConfig{Enabled: false, RequestsPerMinute: 1, Burst: 1}
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.publicHandler()
+
+	statuses := func(ip string) (int, int) {
+		return serveFrom(h, ip+":5000", "/").Code, serveFrom(h, ip+":5000", "/").Code
+	}
+
+	if first, second := statuses("192.168.1.1"); first != http.StatusOK || second != http.StatusOK {
+		t.Errorf("Expected no rate limiting while disabled, got %d and %d", first, second)
+	}
+
+	enabled := *cfg
+	enabled.RateLimit.Enabled = true
+	s.Reload(&enabled)
+	if first, second := statuses("192.168.1.2"); first != http.StatusOK || second != http.StatusTooManyRequests {
+		t.Errorf("Expected the second request to be limited after enabling, got %d and %d", first, second)
+	}
+
+	disabled := enabled
+	disabled.RateLimit.Enabled = false
+	s.Reload(&disabled)
+	if first, second := statuses("192.168.1.2"); first != http.StatusOK || second != http.StatusOK {
+		t.Errorf("Expected no rate limiting after disabling, got %d and %d", first, second)
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"proxy-kp/internal/config"
+
+	"github.com/google/uuid"
+)
+
+// maxRequestIDLength bounds the incoming X-Request-Id the proxy will honor;
+// longer or non-printable values are replaced with a generated ID.
+const maxRequestIDLength = 128
+
+// requestIDSource assigns request IDs, optionally reusing the client's
+// X-Request-Id. A nil *requestIDSource always generates a fresh UUID.
+type requestIDSource struct {
+	uniquify string
+	window   time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newRequestIDSource(cfg config.RequestIDConfig) *requestIDSource {
+	return &requestIDSource{
+		uniquify: cfg.Uniquify,
+		window:   cfg.CollisionWindow,
+		seen:     make(map[string]time.Time),
+	}
+}
+
+func (s *requestIDSource) next(r *http.Request) string {
+	if s == nil {
+		return uuid.New().String()
+	}
+
+	incoming := r.Header.Get("X-Request-Id")
+	if !validRequestID(incoming) {
+		return uuid.New().String()
+	}
+
+	switch s.uniquify {
+	case config.RequestIDUniquifyAlways:
+		return withSuffix(incoming)
+	case config.RequestIDUniquifyOnCollision:
+		if s.collides(incoming, time.Now()) {
+			return withSuffix(incoming)
+		}
+	}
+	return incoming
+}
+
+// collides records id and reports whether it was already seen within the
+// collision window.
+func (s *requestIDSource) collides(id string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastPrune) > s.window {
+		for seenID, at := range s.seen {
+			if now.Sub(at) > s.window {
+				delete(s.seen, seenID)
+			}
+		}
+		s.lastPrune = now
+	}
+
+	at, ok := s.seen[id]
+	s.seen[id] = now
+	return ok && now.Sub(at) <= s.window
+}
+
+// withSuffix keeps the client-provided prefix and appends a short random
+// suffix so the resulting ID is unique.
+func withSuffix(id string) string {
+	return id + "-" + uuid.New().String()[:8]
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
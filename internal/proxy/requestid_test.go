@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMiddleware_DuplicateRequestIDsAreDisambiguated(t *testing.T) {
+	cases := []struct {
+		uniquify string
+		// first reports whether the first request keeps the ID verbatim.
+		first bool
+	}{
+		{config.RequestIDUniquifyOnCollision, true},
+		{config.RequestIDUniquifyAlways, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.uniquify, func(t *testing.T) {
+			core, logs := observer.New(zap.InfoLevel)
+			m := NewMiddleware(logger.FromZap(zap.New(core)), nil, nil, false, nil)
+			m.SetRequestID(config.RequestIDConfig{Honor: true, Uniquify: tc.uniquify, CollisionWindow: time.Minute})
+			h := m.Chain(okHandler())
+
+			headers := make([]string, 0, 2)
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("X-Request-Id", "client-abc")
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				headers = append(headers, rec.Header().Get("X-Request-Id"))
+			}
+
+			entries := logs.FilterMessage("Request completed").All()
+			if len(entries) != 2 {
+				t.Fatalf("Expected 2 completion logs, got %d", len(entries))
+			}
+			logged := make([]string, 0, 2)
+			for i, entry := range entries {
+				id, _ := entry.ContextMap()["request_id"].(string)
+				if id != headers[i] {
+					t.Errorf("Expected logged ID %q to match response header %q", id, headers[i])
+				}
+				if !strings.HasPrefix(id, "client-abc") {
+					t.Errorf("Expected client prefix to be preserved, got %q", id)
+				}
+				logged = append(logged, id)
+			}
+
+			if logged[0] == logged[1] {
+				t.Errorf("Expected duplicate incoming IDs to be disambiguated, both logged as %q", logged[0])
+			}
+			if got := logged[0] == "client-abc"; got != tc.first {
+				t.Errorf("Expected verbatim first ID %v, got %q", tc.first, logged[0])
+			}
+		})
+	}
+}
+
+func TestMiddleware_RequestIDNotHonoredByDefault(t *testing.T) {
+	m := NewMiddleware(logger.FromZap(zap.NewNop()), nil, nil, false, nil)
+	h := m.Chain(okHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-Id", "client-abc")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if id := rec.Header().Get("X-Request-Id"); id == "" || strings.HasPrefix(id, "client-abc") {
+		t.Errorf("Expected a generated request ID, got %q", id)
+	}
+}
+
+func TestRequestIDSource_RejectsInvalidIncoming(t *testing.T) {
+	s := newRequestIDSource(config.RequestIDConfig{Uniquify: config.RequestIDUniquifyNone})
+
+	for _, incoming := range []string{"has space", strings.Repeat("a", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Request-Id", incoming)
+		if id := s.next(req); id == incoming {
+			t.Errorf("Expected invalid ID %q to be replaced", incoming)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"cmp"
+	"maps"
+	"net/http"
+	"slices"
+
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const metricOversizedResponseHeaders = "proxy_oversized_response_headers_total"
+
+// framingHeaders are never stripped from an oversized response: without
+// them the body could not be read correctly.
+var framingHeaders = map[string]bool{
+	"Content-Length":   true,
+	"Content-Type":     true,
+	"Content-Encoding": true,
+}
+
+// checkResponseHeader enforces proxy.max_response_header_bytes on resp. In
+// strip mode the largest headers are dropped until the rest fit. It reports
+// false when resp must be answered with 502 instead.
+func (h *Handler) checkResponseHeader(resp *http.Response, backend *balancer.Backend, log *logger.Logger, path string) bool {
+	limit := h.config.MaxResponseHeaderBytes
+	if limit <= 0 {
+		return true
+	}
+	size := fieldBytes(resp.Header)
+	if size <= limit {
+		return true
+	}
+
+	if h.config.OversizedResponseHeaders != "strip" {
+		h.metrics.Counter(metricOversizedResponseHeaders, "backend", backend.URL, "action", "reject").Inc()
+		log.Warn("Backend response headers exceed limit, rejecting response",
+			zap.String("path", path),
+			zap.Int("header_bytes", size),
+			zap.Int("limit", limit))
+		return false
+	}
+
+	names := slices.Collect(maps.Keys(resp.Header))
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Compare(fieldBytes(http.Header{b: resp.Header[b]}), fieldBytes(http.Header{a: resp.Header[a]}))
+	})
+	var stripped []string
+	for _, name := range names {
+		if size <= limit {
+			break
+		}
+		if framingHeaders[name] {
+			continue
+		}
+		size -= fieldBytes(http.Header{name: resp.Header[name]})
+		resp.Header.Del(name)
+		stripped = append(stripped, name)
+	}
+
+	if size > limit {
+		h.metrics.Counter(metricOversizedResponseHeaders, "backend", backend.URL, "action", "reject").Inc()
+		log.Warn("Backend response headers exceed limit even after stripping, rejecting response",
+			zap.String("path", path),
+			zap.Strings("stripped", stripped),
+			zap.Int("header_bytes", size),
+			zap.Int("limit", limit))
+		return false
+	}
+	h.metrics.Counter(metricOversizedResponseHeaders, "backend", backend.URL, "action", "strip").Inc()
+	log.Warn("Backend response headers exceed limit, stripped largest headers",
+		zap.String("path", path),
+		zap.Strings("stripped", stripped),
+		zap.Int("limit", limit))
+	return true
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"proxy-kp/internal/config"
+)
+
+func oversizedHeaderBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Add("Set-Cookie", "session="+strings.Repeat("a", 2048))
+		w.Header().Set("X-Debug-Trace", strings.Repeat("b", 1024))
+		w.Header().Set("X-Small", "kept")
+		w.Write([]byte("ok"))
+	}))
+}
+
+func TestHandler_OversizedResponseHeadersRejected(t *testing.T) {
+	backend := oversizedHeaderBackend()
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{
+		StreamThreshold:          1 << 20,
+		MaxResponseHeaderBytes:   1024,
+		OversizedResponseHeaders: "reject",
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502, got %d", rec.Code)
+	}
+	if got := handler.metrics.Counter(metricOversizedResponseHeaders, "backend", backend.URL, "action", "reject").Value(); got != 1 {
+		t.Errorf("Expected 1 rejected response counted, got %d", got)
+	}
+}
+
+func TestHandler_OversizedResponseHeadersStripped(t *testing.T) {
+	backend := oversizedHeaderBackend()
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{
+		StreamThreshold:          1 << 20,
+		MaxResponseHeaderBytes:   1500,
+		OversizedResponseHeaders: "strip",
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Fatalf("Expected 200 ok, got %d %q", rec.Code, rec.Body.String())
+	}
+	// Dropping the 2KB cookie is enough; the smaller headers stay.
+	if rec.Header().Get("Set-Cookie") != "" {
+		t.Error("Expected the largest header to be stripped")
+	}
+	if rec.Header().Get("X-Debug-Trace") == "" || rec.Header().Get("X-Small") != "kept" || rec.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected the remaining headers kept, got %v", rec.Header())
+	}
+}
+
+func TestHandler_ResponseHeadersStripFallsBackToReject(t *testing.T) {
+	backend := oversizedHeaderBackend()
+	defer backend.Close()
+
+	// Even the headers that are never stripped exceed this limit.
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{
+		StreamThreshold:          1 << 20,
+		MaxResponseHeaderBytes:   10,
+		OversizedResponseHeaders: "strip",
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 when stripping cannot fit the limit, got %d", rec.Code)
+	}
+}
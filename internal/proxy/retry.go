@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/metrics"
+)
+
+const (
+	metricRetries           = "proxy_retries_total"
+	metricRetriesSuppressed = "proxy_retries_suppressed_total"
+	metricRetryBudgetUsage  = "proxy_retry_budget_usage"
+	metricStaleConnRetries  = "proxy_stale_conn_retries_total"
+)
+
+// retryBudget decides whether a failed backend request may be retried. Each
+// request gets at most attempts retries, and retries across all requests are
+// capped to ratio of the requests seen over the last minute (never fewer than
+// minRetries), so retries are throttled once many requests are already
+// retrying. A nil *retryBudget never allows a retry.
+type retryBudget struct {
+	attempts   int
+	ratio      float64
+	minRetries int
+	onStatus   map[int]bool
+
+	requests rateWindow
+	retries  rateWindow
+
+	retried    *metrics.Counter
+	suppressed *metrics.Counter
+	usage      *metrics.Gauge
+}
+
+func newRetryBudget(cfg config.RetryConfig, registry *metrics.Registry) *retryBudget {
+	if cfg.Attempts <= 0 {
+		return nil
+	}
+	onStatus := make(map[int]bool, len(cfg.OnStatus))
+	for _, status := range cfg.OnStatus {
+		onStatus[status] = true
+	}
+	return &retryBudget{
+		attempts:   cfg.Attempts,
+		ratio:      cfg.BudgetRatio,
+		minRetries: cfg.MinRetries,
+		onStatus:   onStatus,
+		retried:    registry.Counter(metricRetries),
+		suppressed: registry.Counter(metricRetriesSuppressed),
+		usage:      registry.Gauge(metricRetryBudgetUsage),
+	}
+}
+
+// observe counts a proxied request towards the budget.
+func (b *retryBudget) observe() {
+	if b == nil {
+		return
+	}
+	b.requests.add(time.Now())
+}
+
+// failed reports whether a backend attempt ended in a way worth retrying: a
+// connection-level error or a status listed in on_status.
+func (b *retryBudget) failed(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return b != nil && b.onStatus[resp.StatusCode]
+}
+
+// allow reports whether r may make its attempt-th retry, and charges it to the
+// budget if so.
+func (b *retryBudget) allow(r *http.Request, attempt int) bool {
+	if b == nil || attempt > b.attempts || !retryable(r) {
+		return false
+	}
+
+	now := time.Now()
+	budget := int64(b.ratio * float64(b.requests.count(now)))
+	if budget < int64(b.minRetries) {
+		budget = int64(b.minRetries)
+	}
+	used := b.retries.count(now)
+	if used >= budget {
+		b.suppressed.Inc()
+		b.usage.Set(1)
+		return false
+	}
+
+	b.retries.add(now)
+	b.retried.Inc()
+	b.usage.Set(float64(used+1) / float64(budget))
+	return true
+}
+
+// retryable reports whether r can be sent again: its method is idempotent and
+// it has no body, or a body buffered by bufferForRetry that can be replayed.
+func retryable(r *http.Request) bool {
+	if !idempotent(r.Method) {
+		return false
+	}
+	return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// bufferForRetry reads the body of an idempotent request into memory and sets
+// r.GetBody so a retry can replay it. Bodies over limit are left streaming
+// and the request is not retried.
+func (b *retryBudget) bufferForRetry(r *http.Request, limit int64) error {
+	if b == nil || !idempotent(r.Method) || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	body, overflow, err := readUpTo(r.Body, limit)
+	if err != nil {
+		return err
+	}
+	if overflow {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil
+	}
+
+	r.Body.Close()
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.Body, _ = r.GetBody()
+	return nil
+}
+
+// nextUntried picks the next backend from pool that this request has not
+// tried yet and whose circuit it can claim, giving up after one pass over
+// the pool.
+func nextUntried(pool balancer.Balancer, tried map[*balancer.Backend]bool) (*balancer.Backend, error) {
+	for range len(pool.GetBackends()) {
+		next, err := pool.NextBackend()
+		if err != nil {
+			return nil, err
+		}
+		if !tried[next] && next.TryProbe() {
+			return next, nil
+		}
+		pool.Release(next)
+	}
+	return nil, balancer.ErrNoHealthyBackends
+}
+
+// connReuse records whether a backend attempt went out on a reused
+// keep-alive connection.
+type connReuse struct {
+	reused atomic.Bool
+}
+
+func (c *connReuse) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.reused.Store(info.Reused)
+		},
+	}
+}
+
+// staleReset reports whether err is a reset of a reused keep-alive
+// connection, most likely one a NAT or load balancer between the proxy and
+// the backend dropped while it sat idle. Such a failure says nothing about
+// the backend, so the request is worth one more try on a fresh connection.
+func (c *connReuse) staleReset(err error) bool {
+	return err != nil && c.reused.Load() && classifyError(err) == errorClassReset
+}
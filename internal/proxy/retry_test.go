@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+func TestHandler_RetriesSuppressedOnceBudgetExhausted(t *testing.T) {
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+	live := namedBackend("live")
+	defer live.Close()
+
+	b := balancer.NewSRR()
+	b.AddBackend(balancer.NewBackend(dead.URL, 1))
+	b.AddBackend(balancer.NewBackend(live.URL, 1))
+	registry := metrics.NewRegistry()
+	proxyCfg := config.ProxyConfig{
+		StreamThreshold: 1 << 20,
+		Retry:           config.RetryConfig{Attempts: 1, MinRetries: 2},
+	}
+	handler := NewHandler(b, nil, cache.NewCache(time.Minute), logger.FromZap(zap.NewNop()), registry, config.CacheConfig{}, proxyCfg)
+
+	// Smooth round-robin alternates dead, live, dead, live...; each request
+	// that lands on the dead backend needs a retry to reach the live one.
+	var codes []int
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes = append(codes, rec.Code)
+	}
+
+	want := []int{http.StatusOK, http.StatusOK, http.StatusBadGateway}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Errorf("Request %d: expected %d, got %d", i, want[i], codes[i])
+		}
+	}
+	if v := registry.Counter(metricRetries).Value(); v != 2 {
+		t.Errorf("Expected 2 retries, got %v", v)
+	}
+	if v := registry.Counter(metricRetriesSuppressed).Value(); v != 1 {
+		t.Errorf("Expected 1 suppressed retry, got %v", v)
+	}
+	if v := registry.Gauge(metricRetryBudgetUsage).Value(); v != 1 {
+		t.Errorf("Expected budget usage 1, got %v", v)
+	}
+}
+
+func TestHandler_NoRetryForNonIdempotentRequests(t *testing.T) {
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+	live := namedBackend("live")
+	defer live.Close()
+
+	b := balancer.NewSRR()
+	b.AddBackend(balancer.NewBackend(dead.URL, 1))
+	b.AddBackend(balancer.NewBackend(live.URL, 1))
+	registry := metrics.NewRegistry()
+	proxyCfg := config.ProxyConfig{
+		StreamThreshold: 1 << 20,
+		Retry:           config.RetryConfig{Attempts: 1, MinRetries: 10},
+	}
+	handler := NewHandler(b, nil, cache.NewCache(time.Minute), logger.FromZap(zap.NewNop()), registry, config.CacheConfig{}, proxyCfg)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload")))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected POST not to be retried, got %d", rec.Code)
+	}
+	if v := registry.Counter(metricRetries).Value(); v != 0 {
+		t.Errorf("Expected no retries, got %v", v)
+	}
+}
+
+func TestHandler_RetryReplaysBufferedBody(t *testing.T) {
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+	var got string
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer live.Close()
+
+	b := balancer.NewSRR()
+	b.AddBackend(balancer.NewBackend(dead.URL, 1))
+	b.AddBackend(balancer.NewBackend(live.URL, 1))
+	proxyCfg := config.ProxyConfig{
+		StreamThreshold: 1 << 20,
+		Retry:           config.RetryConfig{Attempts: 1, MinRetries: 10},
+	}
+	handler := NewHandler(b, nil, cache.NewCache(time.Minute), logger.FromZap(zap.NewNop()), metrics.NewRegistry(), config.CacheConfig{}, proxyCfg)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/item", strings.NewReader("payload")))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected PUT to be retried on the live backend, got %d", rec.Code)
+	}
+	if got != "payload" {
+		t.Errorf("Expected replayed body %q, got %q", "payload", got)
+	}
+}
+
+func TestHandler_RetrySkipsTriedBackends(t *testing.T) {
+	b := balancer.NewSRR()
+	for i := 0; i < 2; i++ {
+		dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		dead.Close()
+		b.AddBackend(balancer.NewBackend(dead.URL, 1))
+	}
+	registry := metrics.NewRegistry()
+	proxyCfg := config.ProxyConfig{
+		StreamThreshold: 1 << 20,
+		Retry:           config.RetryConfig{Attempts: 5, MinRetries: 10},
+	}
+	handler := NewHandler(b, nil, cache.NewCache(time.Minute), logger.FromZap(zap.NewNop()), registry, config.CacheConfig{}, proxyCfg)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 once every backend failed, got %d", rec.Code)
+	}
+	if v := registry.Counter(metricRetries).Value(); v != 1 {
+		t.Errorf("Expected one retry per untried backend, got %v", v)
+	}
+	for _, backend := range b.GetBackends() {
+		if n := backend.ActiveRequests(); n != 0 {
+			t.Errorf("Expected %s released, %d requests still active", backend.URL, n)
+		}
+	}
+}
+
+func TestHandler_RetryOnStatus(t *testing.T) {
+	var flakyHits int
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flakyHits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer flaky.Close()
+	live := namedBackend("live")
+	defer live.Close()
+
+	b := balancer.NewSRR()
+	b.AddBackend(balancer.NewBackend(flaky.URL, 1))
+	b.AddBackend(balancer.NewBackend(live.URL, 1))
+	registry := metrics.NewRegistry()
+	proxyCfg := config.ProxyConfig{
+		StreamThreshold: 1 << 20,
+		Retry:           config.RetryConfig{Attempts: 1, MinRetries: 10, OnStatus: []int{http.StatusServiceUnavailable}},
+	}
+	handler := NewHandler(b, nil, cache.NewCache(time.Minute), logger.FromZap(zap.NewNop()), registry, config.CacheConfig{}, proxyCfg)
+
+	// Smooth round-robin sends the first request to the flaky backend.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "live" {
+		t.Fatalf("Expected the 503 to be retried on the live backend, got %d %q", rec.Code, rec.Body.String())
+	}
+	if flakyHits != 1 {
+		t.Errorf("Expected the flaky backend to be tried once, got %d", flakyHits)
+	}
+
+	// Of two consecutive POSTs, one reaches the flaky backend; its 503 must
+	// be passed through rather than retried.
+	for i := 0; i < 2; i++ {
+		before := flakyHits
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload")))
+		if flakyHits > before && rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected the POST's 503 to be passed through, got %d", rec.Code)
+		}
+	}
+	if flakyHits != 2 {
+		t.Fatalf("Expected one POST to reach the flaky backend, got %d hits", flakyHits-1)
+	}
+	if v := registry.Counter(metricRetries).Value(); v != 1 {
+		t.Errorf("Expected only the GET to be retried, got %v retries", v)
+	}
+}
+
+// resettingBackend resets each connection on its second request, like a NAT
+// that dropped the connection while it sat idle in the proxy's pool. conns
+// reports how many connections it has seen.
+func resettingBackend() (backend *httptest.Server, conns func() int) {
+	var mu sync.Mutex
+	perConn := make(map[string]int)
+	backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		perConn[r.RemoteAddr]++
+		n := perConn[r.RemoteAddr]
+		mu.Unlock()
+		if n == 2 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return backend, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(perConn)
+	}
+}
+
+func TestHandler_RetriesStaleConnectionReset(t *testing.T) {
+	backend, conns := resettingBackend()
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	// DELETE is idempotent to the proxy but not replayed by net/http itself.
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/item", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+			t.Fatalf("Request %d: expected 200 ok, got %d %q", i+1, rec.Code, rec.Body.String())
+		}
+	}
+
+	if got := handler.metrics.Counter(metricStaleConnRetries, "backend", backend.URL).Value(); got != 1 {
+		t.Errorf("Expected 1 stale connection retry, got %d", got)
+	}
+	if got := conns(); got != 2 {
+		t.Errorf("Expected the retry on a new connection, got %d connections", got)
+	}
+}
+
+func TestHandler_NoStaleRetryForNonIdempotentRequests(t *testing.T) {
+	backend, _ := resettingBackend()
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/item", nil))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/item", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 for a POST on a reset connection, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const metricCacheRevalidated = "proxy_cache_revalidated_total"
+
+// staleForRevalidation returns the expired cache entry for r when it carries
+// an ETag or Last-Modified validator the backend can be asked about. Requests
+// with their own conditional headers are left to the backend as they are.
+func (h *Handler) staleForRevalidation(r *http.Request) *cache.Entry {
+	if !h.cacheOn.Load() || r.Method != http.MethodGet {
+		return nil
+	}
+	if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		return nil
+	}
+
+	entry, _, found := lookupCache(r, h.cache.GetStaleEntry)
+	if !found || !entry.IsExpired() {
+		return nil
+	}
+	if entry.Header.Get("ETag") == "" && entry.Header.Get("Last-Modified") == "" {
+		return nil
+	}
+	return entry
+}
+
+// addValidators makes a request conditional on entry still being current.
+func addValidators(h http.Header, entry *cache.Entry) {
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		h.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		h.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// serveRevalidated answers r from stale after the backend confirmed it with
+// 304 Not Modified. The entry takes the headers sent with the 304 and is
+// stored again with a fresh expiry.
+func (h *Handler) serveRevalidated(w http.ResponseWriter, r *http.Request, log *logger.Logger, stale *cache.Entry, resp *http.Response, backend *balancer.Backend) {
+	header := stale.Header.Clone()
+	for key, values := range resp.Header {
+		// A 304 describes the stored body, it does not frame one.
+		if key == "Content-Length" || key == "Transfer-Encoding" {
+			continue
+		}
+		header[key] = values
+	}
+
+	refreshed := *stale
+	refreshed.Header = header
+	refreshed.CreatedAt = time.Now()
+	refreshed.Backend = backend.URL
+
+	ttl, cacheable := h.cacheTTL(stale.StatusCode)
+	if cacheable {
+		ttl, cacheable = responseTTL(header, ttl, refreshed.CreatedAt)
+	}
+	if cacheable {
+		refreshed.ExpiresAt = refreshed.CreatedAt.Add(ttl)
+		if h.writer.set(&refreshed) && len(refreshed.Vary) > 0 {
+			h.cache.SetEntry(varyMarker(&refreshed, getCacheKey(r)))
+		}
+	}
+	h.metrics.Counter(metricCacheRevalidated).Inc()
+	log.Debug("Cache entry revalidated by backend",
+		zap.String("key", refreshed.Key),
+		zap.Bool("refreshed", cacheable),
+		zap.Duration("ttl", ttl))
+
+	copyHeader(w.Header(), header)
+	h.affinity.setCookie(w, r, backend)
+	w.WriteHeader(stale.StatusCode)
+	w.Write(stale.Value)
+}
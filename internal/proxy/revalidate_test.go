@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/cache"
+)
+
+// expire moves the cached entry for path into the past.
+func expire(t *testing.T, c *cache.Cache, path string) {
+	t.Helper()
+	key := getCacheKey(httptest.NewRequest(http.MethodGet, path, nil))
+	entry, found := c.GetEntry(key)
+	if !found {
+		t.Fatalf("Expected %s to be cached", path)
+	}
+	expired := *entry
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	c.SetEntry(&expired)
+}
+
+func TestHandler_RevalidatesStaleEntryWithETag(t *testing.T) {
+	var full, notModified atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.Header().Set("X-Checked", "yes")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Write([]byte("large asset"))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/asset", nil))
+	expire(t, c, "/asset")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/asset", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "large asset" {
+		t.Errorf("Expected the cached body with 200, got %d %q", rec.Code, rec.Body.String())
+	}
+	if full.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("Expected 1 full response and 1 revalidation, got %d and %d", full.Load(), notModified.Load())
+	}
+
+	entry, found := c.GetEntry(getCacheKey(httptest.NewRequest(http.MethodGet, "/asset", nil)))
+	if !found {
+		t.Fatal("Expected the revalidated entry to be fresh again")
+	}
+	if entry.Header.Get("X-Checked") != "yes" || string(entry.Value) != "large asset" {
+		t.Errorf("Expected headers from the 304 merged into the entry, got %v", entry.Header)
+	}
+	if rec.Header().Get("X-Checked") != "yes" {
+		t.Error("Expected the client response to carry headers from the 304")
+	}
+}
+
+func TestHandler_RevalidatesWithLastModified(t *testing.T) {
+	lastModified := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	var conditional atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional.Store(r.Header.Get("If-Modified-Since"))
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("doc"))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/doc", nil))
+	expire(t, c, "/doc")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/doc", nil))
+	if got := conditional.Load(); got != lastModified {
+		t.Errorf("Expected If-Modified-Since %q, got %q", lastModified, got)
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != "doc" {
+		t.Errorf("Expected the cached body with 200, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandler_RevalidationReplacesChangedEntry(t *testing.T) {
+	var version atomic.Int32
+	version.Store(1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(etag))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/x", nil))
+	expire(t, c, "/x")
+	version.Store(2)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != `"v2"` {
+		t.Errorf("Expected the new version, got %d %q", rec.Code, rec.Body.String())
+	}
+	body, _, found := c.Get(getCacheKey(httptest.NewRequest(http.MethodGet, "/x", nil)))
+	if !found || string(body) != `"v2"` {
+		t.Errorf("Expected the new version cached, got %q", body)
+	}
+}
+
+func TestHandler_ClientConditionalPassesThrough(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("body"))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/y", nil))
+	expire(t, c, "/y")
+
+	req := httptest.NewRequest(http.MethodGet, "/y", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("Expected the client's own 304 passed through, got %d %q", rec.Code, rec.Body.String())
+	}
+}
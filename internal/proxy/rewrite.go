@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"proxy-kp/internal/config"
+)
+
+// bodyRewriter applies proxy.body_rewrite rules to response bodies. A nil
+// *bodyRewriter rewrites nothing.
+type bodyRewriter struct {
+	rules []config.BodyRewriteConfig
+}
+
+func newBodyRewriter(rules []config.BodyRewriteConfig) *bodyRewriter {
+	if len(rules) == 0 {
+		return nil
+	}
+	return &bodyRewriter{rules: rules}
+}
+
+// applies reports whether any rule covers a response with header h. Bodies
+// with a Content-Encoding are binary to the proxy and never rewritten.
+func (rw *bodyRewriter) applies(h http.Header) bool {
+	if rw == nil {
+		return false
+	}
+	if enc := h.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	for _, rule := range rw.rules {
+		if rw.matches(rule, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rw *bodyRewriter) matches(rule config.BodyRewriteConfig, mediaType string) bool {
+	for _, pattern := range rule.ContentTypes {
+		if matchesMediaType(pattern, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewrite returns body with the matching rules applied, updating
+// Content-Length in h when the size changes.
+func (rw *bodyRewriter) rewrite(h http.Header, body []byte) []byte {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	out := body
+	for _, rule := range rw.rules {
+		if rw.matches(rule, mediaType) {
+			out = bytes.ReplaceAll(out, []byte(rule.From), []byte(rule.To))
+		}
+	}
+	if len(out) != len(body) {
+		h.Set("Content-Length", strconv.Itoa(len(out)))
+	}
+	return out
+}
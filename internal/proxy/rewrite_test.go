@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"proxy-kp/internal/config"
+)
+
+func TestHandler_BodyRewriteHTML(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<a href="http://internal:8080/docs">docs</a>`))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{
+		StreamThreshold: 1 << 20,
+		BodyRewrite: []config.BodyRewriteConfig{{
+			ContentTypes: []string{"text/html"},
+			From:         "http://internal:8080",
+			To:           "https://www.example.com",
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/page", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	want := `<a href="https://www.example.com/docs">docs</a>`
+	if rec.Body.String() != want {
+		t.Errorf("Expected rewritten body %q, got %q", want, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(want)) {
+		t.Errorf("Expected Content-Length %d, got %q", len(want), got)
+	}
+
+	cached, header, found := c.Get(getCacheKey(req))
+	if !found {
+		t.Fatal("Expected rewritten response to be cached")
+	}
+	if string(cached) != want {
+		t.Errorf("Expected cache to hold the rewritten body, got %q", cached)
+	}
+	if got := header.Get("Content-Length"); got != strconv.Itoa(len(want)) {
+		t.Errorf("Expected cached Content-Length %d, got %q", len(want), got)
+	}
+}
+
+func TestHandler_BodyRewriteSkipsBinary(t *testing.T) {
+	payload := []byte("\x89PNG\r\n\x1a\nhttp://internal:8080\x00\x01")
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(payload)
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandlerWithCache(backend.URL, config.CacheConfig{}, config.ProxyConfig{
+		StreamThreshold: 1 << 20,
+		BodyRewrite: []config.BodyRewriteConfig{{
+			ContentTypes: []string{"text/*"},
+			From:         "http://internal:8080",
+			To:           "https://www.example.com",
+		}},
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/logo.png", nil))
+
+	if rec.Body.String() != string(payload) {
+		t.Errorf("Expected binary body to pass through unchanged, got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/access"
+)
+
+type Route struct {
+	Name       string
+	Upstream   string
+	pathPrefix string
+	pathRegex  *regexp.Regexp
+	clientIPs  *access.Matcher
+	access     *access.Policy
+	realm      string
+	users      map[string]string
+}
+
+type Router struct {
+	routes        []*Route
+	fallback      *Route
+	noMatch       string
+	noMatchStatus int
+	noMatchBody   string
+}
+
+func NewRouter(cfgs []config.RouteConfig) (*Router, error) {
+	r := &Router{routes: make([]*Route, 0, len(cfgs))}
+
+	for i, cfg := range cfgs {
+		route := &Route{
+			Name:       cfg.Name,
+			Upstream:   cfg.Upstream,
+			pathPrefix: cfg.Match.PathPrefix,
+		}
+		if route.Name == "" {
+			route.Name = fmt.Sprintf("route-%d", i)
+		}
+
+		if cfg.Match.PathRegex != "" {
+			re, err := regexp.Compile(cfg.Match.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: invalid path_regex %q: %w", route.Name, cfg.Match.PathRegex, err)
+			}
+			route.pathRegex = re
+		}
+
+		if len(cfg.Match.ClientCIDRs) > 0 {
+			matcher, err := access.NewMatcher(cfg.Match.ClientCIDRs)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: client_cidrs: %w", route.Name, err)
+			}
+			route.clientIPs = matcher
+		}
+
+		if cfg.Access != nil {
+			policy, err := access.NewPolicy(cfg.Access.Allow, cfg.Access.Deny)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %w", route.Name, err)
+			}
+			route.access = policy
+		}
+
+		if cfg.Auth != nil {
+			route.users = cfg.Auth.Users
+			route.realm = cfg.Auth.Realm
+			if route.realm == "" {
+				route.realm = "proxy-kp"
+			}
+		}
+
+		r.routes = append(r.routes, route)
+	}
+
+	return r, nil
+}
+
+// SetNoMatch configures how requests matching no route are handled. With the
+// default_upstream action and a named upstream, Match falls back to a
+// synthetic "default" route for that upstream.
+func (r *Router) SetNoMatch(cfg config.RoutingConfig) {
+	r.noMatch = cfg.NoMatch
+	r.noMatchStatus = cfg.NoMatchStatus
+	r.noMatchBody = cfg.NoMatchBody
+	r.fallback = nil
+	if cfg.NoMatch == config.NoMatchDefaultUpstream && cfg.DefaultUpstream != "" {
+		r.fallback = &Route{Name: "default", Upstream: cfg.DefaultUpstream}
+	}
+}
+
+// Match returns the first route, in config order, whose conditions all match
+// the request, then the fallback route if one is configured, or nil.
+func (r *Router) Match(req *http.Request) *Route {
+	if r == nil {
+		return nil
+	}
+
+	for _, route := range r.routes {
+		if route.matches(req) {
+			return route
+		}
+	}
+	return r.fallback
+}
+
+// NoMatch reports whether an unmatched request should be rejected, and with
+// what status and body.
+func (r *Router) NoMatch() (status int, body string, reject bool) {
+	if r == nil || (r.noMatch != config.NoMatchNotFound && r.noMatch != config.NoMatchCustom) {
+		return 0, "", false
+	}
+	return r.noMatchStatus, r.noMatchBody, true
+}
+
+func (rt *Route) matches(req *http.Request) bool {
+	if rt.pathPrefix != "" && !strings.HasPrefix(req.URL.Path, rt.pathPrefix) {
+		return false
+	}
+	if rt.pathRegex != nil && !rt.pathRegex.MatchString(req.URL.Path) {
+		return false
+	}
+	if rt.clientIPs != nil && !rt.clientIPs.Contains(getClientIP(req)) {
+		return false
+	}
+	return true
+}
+
+func (rt *Route) AllowsIP(ip string) bool {
+	return rt.access == nil || rt.access.Allowed(ip)
+}
+
+func (rt *Route) Authenticate(req *http.Request) bool {
+	if rt.users == nil {
+		return true
+	}
+
+	user, pass, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	expected, exists := rt.users[user]
+	if !exists {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(pass), []byte(expected)) == 1
+}
+
+const routeKey contextKey = "route"
+
+func contextWithRoute(ctx context.Context, route *Route) context.Context {
+	return context.WithValue(ctx, routeKey, route)
+}
+
+func routeFromContext(ctx context.Context) *Route {
+	route, _ := ctx.Value(routeKey).(*Route)
+	return route
+}
@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func namedBackend(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	}))
+}
+
+func TestRouter_RegexRouteToUpstream(t *testing.T) {
+	defaultBackend := namedBackend("default")
+	defer defaultBackend.Close()
+	imagesBackend := namedBackend("images")
+	defer imagesBackend.Close()
+
+	cfg := testConfig(defaultBackend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Upstreams = []config.UpstreamConfig{
+		{Name: "images", Backends: []config.BackendConfig{{URL: imagesBackend.URL, Weight: 1}}},
+	}
+	cfg.Routes = []config.RouteConfig{
+		{Name: "images", Match: config.RouteMatchConfig{PathRegex: `^/images/.*\.(png|jpg)$`}, Upstream: "images"},
+	}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.middleware.Chain(s.handler)
+
+	cases := map[string]string{
+		"/images/cat.png":   "images",
+		"/images/cat.gif":   "default",
+		"/api/images/a.png": "default",
+	}
+	for path, expected := range cases {
+		rec := serveFrom(h, "192.168.1.1:5000", path)
+		if rec.Body.String() != expected {
+			t.Errorf("%s: expected upstream %q, got %q", path, expected, rec.Body.String())
+		}
+	}
+}
+
+func TestRouter_ClientCIDRRouteToUpstream(t *testing.T) {
+	production := namedBackend("production")
+	defer production.Close()
+	staging := namedBackend("staging")
+	defer staging.Close()
+
+	cfg := testConfig(production.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Upstreams = []config.UpstreamConfig{
+		{Name: "staging", Backends: []config.BackendConfig{{URL: staging.URL, Weight: 1}}},
+	}
+	cfg.Routes = []config.RouteConfig{
+		{Name: "internal-api", Match: config.RouteMatchConfig{PathPrefix: "/api", ClientCIDRs: []string{"10.0.0.0/8"}}, Upstream: "staging"},
+	}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.middleware.Chain(s.handler)
+
+	cases := []struct {
+		remoteAddr string
+		path       string
+		expected   string
+	}{
+		{"10.1.2.3:5000", "/api/users", "staging"},
+		{"203.0.113.9:5000", "/api/users", "production"},
+		// Both conditions must match.
+		{"10.1.2.3:5000", "/home", "production"},
+	}
+	for _, tc := range cases {
+		rec := serveFrom(h, tc.remoteAddr, tc.path)
+		if rec.Body.String() != tc.expected {
+			t.Errorf("%s %s: expected upstream %q, got %q", tc.remoteAddr, tc.path, tc.expected, rec.Body.String())
+		}
+	}
+}
+
+func TestRouter_FirstMatchWins(t *testing.T) {
+	router, err := NewRouter([]config.RouteConfig{
+		{Name: "first", Match: config.RouteMatchConfig{PathRegex: "^/a"}},
+		{Name: "second", Match: config.RouteMatchConfig{PathPrefix: "/a/b"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+
+	route := router.Match(httptest.NewRequest(http.MethodGet, "/a/b/c", nil))
+	if route == nil || route.Name != "first" {
+		t.Errorf("Expected first route to win, got %v", route)
+	}
+
+	if route := router.Match(httptest.NewRequest(http.MethodGet, "/z", nil)); route != nil {
+		t.Errorf("Expected no match, got %s", route.Name)
+	}
+}
+
+func newNoMatchServer(t *testing.T, routing config.RoutingConfig, defaultURL, imagesURL, fallbackURL string) http.Handler {
+	t.Helper()
+
+	cfg := testConfig(defaultURL)
+	cfg.RateLimit.Enabled = false
+	cfg.Upstreams = []config.UpstreamConfig{
+		{Name: "images", Backends: []config.BackendConfig{{URL: imagesURL, Weight: 1}}},
+		{Name: "fallback", Backends: []config.BackendConfig{{URL: fallbackURL, Weight: 1}}},
+	}
+	cfg.Routes = []config.RouteConfig{
+		{Name: "images", Match: config.RouteMatchConfig{PathPrefix: "/images/"}, Upstream: "images"},
+	}
+	cfg.Routing = routing
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	return s.middleware.Chain(s.handler)
+}
+
+func TestRouter_NoMatch(t *testing.T) {
+	defaultBackend := namedBackend("default")
+	defer defaultBackend.Close()
+	imagesBackend := namedBackend("images")
+	defer imagesBackend.Close()
+	fallbackBackend := namedBackend("fallback")
+	defer fallbackBackend.Close()
+
+	tests := []struct {
+		name       string
+		routing    config.RoutingConfig
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "matched route",
+			routing:    config.RoutingConfig{NoMatch: config.NoMatchNotFound, NoMatchStatus: 404, NoMatchBody: "Not Found"},
+			path:       "/images/cat.png",
+			wantStatus: http.StatusOK,
+			wantBody:   "images",
+		},
+		{
+			name:       "default backends fallthrough",
+			routing:    config.RoutingConfig{NoMatch: config.NoMatchDefaultUpstream},
+			path:       "/api/users",
+			wantStatus: http.StatusOK,
+			wantBody:   "default",
+		},
+		{
+			name:       "default upstream fallthrough",
+			routing:    config.RoutingConfig{NoMatch: config.NoMatchDefaultUpstream, DefaultUpstream: "fallback"},
+			path:       "/api/users",
+			wantStatus: http.StatusOK,
+			wantBody:   "fallback",
+		},
+		{
+			name:       "404 no match",
+			routing:    config.RoutingConfig{NoMatch: config.NoMatchNotFound, NoMatchStatus: 404, NoMatchBody: "no such route"},
+			path:       "/api/users",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "no such route",
+		},
+		{
+			name:       "custom no match",
+			routing:    config.RoutingConfig{NoMatch: config.NoMatchCustom, NoMatchStatus: 410, NoMatchBody: "gone"},
+			path:       "/api/users",
+			wantStatus: http.StatusGone,
+			wantBody:   "gone",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newNoMatchServer(t, tt.routing, defaultBackend.URL, imagesBackend.URL, fallbackBackend.URL)
+			rec := serveFrom(h, "192.168.1.1:5000", tt.path)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -3,16 +3,24 @@ package proxy
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"proxy-kp/internal/config"
+	"proxy-kp/pkg/access"
 	"proxy-kp/pkg/balancer"
 	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/circuit"
 	"proxy-kp/pkg/health"
 	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
 	"proxy-kp/pkg/ratelimit"
 	tlsconfig "proxy-kp/pkg/tls"
 
@@ -20,123 +28,457 @@ import (
 )
 
 type Server struct {
-	config         *config.Config
-	logger         *logger.Logger
-	server         *http.Server
-	tlsServer      *http.Server
-	balancer       *balancer.SRR
-	healthChecker  *health.Checker
-	limiter        *ratelimit.Limiter
-	cache          *cache.Cache
-	cleanupManager *ratelimit.CleanupManager
-	middleware     *Middleware
-	handler        *Handler
+	config           *config.Config
+	logger           *logger.Logger
+	servers          []*http.Server
+	tlsServers       []*http.Server
+	adminServer      *http.Server
+	balancer         balancer.Balancer
+	upstreams        map[string]balancer.Balancer
+	healthChecker    *health.Checker
+	monitor          *health.Monitor
+	webhook          *health.Webhook
+	upstreamCheckers map[string]*health.Checker
+	limiter          *ratelimit.Limiter
+	cache            cache.Store
+	cleanupManager   *ratelimit.CleanupManager
+	ticketRotator    *tlsconfig.TicketRotator
+	tlsMinVersion    uint16
+	tlsMinByPort     map[int]uint16
+	warmer           *connWarmer
+	summaryStats     *summaryStats
+	topClients       *topClients
+	expvars          *expvarStats
+	summaryAccess    *access.Policy
+	middleware       *Middleware
+	handler          *Handler
+	metrics          *metrics.Registry
+	version          string
+	audit            *logger.Logger
+	reloadMu         sync.Mutex
+	draining         atomic.Bool
 }
 
 func NewServer(cfg *config.Config, log *logger.Logger) (*Server, error) {
-	b := balancer.NewSRR()
+	registry := metrics.NewRegistry()
+	b := newPool(cfg, cfg.Backends, registry, log)
 
-	for _, backendCfg := range cfg.Backends {
-		backend := balancer.NewBackend(backendCfg.URL, backendCfg.Weight)
-		b.AddBackend(backend)
-		log.Info("Backend added",
-			zap.String("url", backendCfg.URL),
-			zap.Int("weight", backendCfg.Weight))
+	// Backend requests and health checks use the egress proxy when one is
+	// configured, and the environment's proxy settings otherwise.
+	var egress func(*http.Request) (*url.URL, error)
+	if cfg.Proxy.UpstreamProxyURL != "" {
+		var err error
+		if egress, err = egressProxy(cfg.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	upstreams := make(map[string]balancer.Balancer, len(cfg.Upstreams))
+	upstreamCheckers := make(map[string]*health.Checker, len(cfg.Upstreams))
+	for _, upstreamCfg := range cfg.Upstreams {
+		pool := newPool(cfg, upstreamCfg.Backends, registry, log)
+		upstreams[upstreamCfg.Name] = pool
+		checker, err := newHealthChecker(cfg.UpstreamHealthCheck(upstreamCfg), egress, pool, log)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s: %w", upstreamCfg.Name, err)
+		}
+		upstreamCheckers[upstreamCfg.Name] = checker
+		log.Info("Upstream added",
+			zap.String("name", upstreamCfg.Name),
+			zap.Int("backends", len(upstreamCfg.Backends)))
 	}
 
-	c := cache.NewCache(cfg.Cache.TTL)
+	c := newCacheStore(cfg.Cache, registry, log)
 
-	var limiter *ratelimit.Limiter
+	// The limiter exists even while rate limiting is off so a reload can
+	// switch it on; the middleware only sees it when enabled.
+	limiter := ratelimit.NewLimiter(cfg.RateLimit.RequestsPerMinute, cfg.RateLimit.Burst)
+	if cfg.RateLimit.Algorithm == config.RateLimitSlidingWindow {
+		limiter = ratelimit.NewSlidingWindowLimiter(cfg.RateLimit.RequestsPerMinute)
+	}
+	if cfg.RateLimit.MaxClients > 0 {
+		limiter.SetMaxClients(cfg.RateLimit.MaxClients, cfg.RateLimit.OverflowRequestsPerMinute, cfg.RateLimit.OverflowBurst,
+			func(degraded bool, clients int) {
+				if degraded {
+					log.Warn("Rate limiter client limit reached, new clients share an overflow bucket",
+						zap.Int("clients", clients))
+					return
+				}
+				log.Info("Rate limiter back to per-client buckets",
+					zap.Int("clients", clients))
+			})
+	}
+	limiter.SetGlobal(cfg.RateLimit.Scope == "global")
+	var activeLimiter *ratelimit.Limiter
 	if cfg.RateLimit.Enabled {
-		limiter = ratelimit.NewLimiter(cfg.RateLimit.RequestsPerMinute, cfg.RateLimit.Burst)
+		activeLimiter = limiter
 	}
 
 	h := &health.Checker{}
 	if cfg.HealthCheck.Interval > 0 {
-		h = health.NewChecker(
-			b,
-			cfg.HealthCheck.Interval,
-			cfg.HealthCheck.Timeout,
-			cfg.HealthCheck.Endpoint,
-			cfg.HealthCheck.FailureThreshold,
-			cfg.HealthCheck.RecoveryInterval,
+		checker, err := newHealthChecker(cfg.HealthCheck, egress, b, log)
+		if err != nil {
+			return nil, err
+		}
+		h = checker
+	}
+
+	monitor := health.NewMonitor(h)
+
+	router, err := NewRouter(cfg.Routes)
+	if err != nil {
+		return nil, err
+	}
+	router.SetNoMatch(cfg.Routing)
+
+	handler := NewHandler(b, upstreams, c, log, registry, cfg.Cache, cfg.Proxy)
+	handler.SetResponseHeaderStrip(cfg.Headers.Response.Strip)
+	handler.SetWebSocket(cfg.WebSocket)
+	handler.SetSessionAffinity(cfg.Server.SessionAffinity)
+	if egress != nil {
+		handler.SetEgressProxy(egress)
+	}
+	middleware := NewMiddleware(log, activeLimiter, c, cfg.Cache.Enabled, router)
+	middleware.SetCompression(cfg.Compression)
+	middleware.SetVerboseTiming(cfg.Logging.VerboseTiming)
+	middleware.SetOptionsResponder(cfg.Proxy)
+	middleware.SetFingerprint(cfg.RateLimit.Fingerprint)
+	if len(cfg.RateLimit.Allowlist) > 0 {
+		allowlist, err := access.NewMatcher(cfg.RateLimit.Allowlist)
+		if err != nil {
+			return nil, fmt.Errorf("rate_limit allowlist: %w", err)
+		}
+		middleware.SetRateLimitAllowlist(allowlist)
+	}
+	middleware.SetRequestID(cfg.Logging.RequestID)
+	middleware.SetBodyLimits(cfg.Server)
+	middleware.SetMaxHeaderBytes(cfg.Server.MaxHeaderBytes)
+	middleware.SetDefaultHost(cfg.Server.DefaultHost)
+	if len(cfg.Server.TrustedProxies) > 0 {
+		trusted, err := access.NewMatcher(cfg.Server.TrustedProxies)
+		if err != nil {
+			return nil, fmt.Errorf("server trusted_proxies: %w", err)
+		}
+		middleware.SetTrustedProxies(trusted)
+	}
+	middleware.SetCacheDebug(cfg.Cache.DebugHeaders)
+	middleware.SetServerTiming(cfg.Proxy.ServerTiming)
+
+	if cfg.Shadow.Enabled {
+		shadow, err := NewShadow(cfg.Shadow, log, registry)
+		if err != nil {
+			return nil, err
+		}
+		handler.SetShadow(shadow)
+	}
+
+	var tlsMinVersion uint16
+	if cfg.TLS.MinVersion != "" {
+		version, err := tlsconfig.ParseVersion(cfg.TLS.MinVersion)
+		if err != nil {
+			return nil, fmt.Errorf("tls min_version: %w", err)
+		}
+		tlsMinVersion = version
+	}
+	tlsMinByPort := make(map[int]uint16, len(cfg.TLS.MinVersionByPort))
+	for port, name := range cfg.TLS.MinVersionByPort {
+		version, err := tlsconfig.ParseVersion(name)
+		if err != nil {
+			return nil, fmt.Errorf("tls min_version_by_port %d: %w", port, err)
+		}
+		tlsMinByPort[port] = version
+	}
+
+	s := &Server{
+		config:           cfg,
+		logger:           log,
+		balancer:         b,
+		upstreams:        upstreams,
+		healthChecker:    h,
+		monitor:          monitor,
+		upstreamCheckers: upstreamCheckers,
+		limiter:          limiter,
+		cache:            c,
+		handler:          handler,
+		middleware:       middleware,
+		metrics:          registry,
+		audit:            log,
+		tlsMinVersion:    tlsMinVersion,
+		tlsMinByPort:     tlsMinByPort,
+	}
+
+	if cfg.Admin.Enabled && cfg.Admin.AuditLog != "" {
+		audit, err := logger.NewAudit(cfg.Admin.AuditLog)
+		if err != nil {
+			return nil, err
+		}
+		s.audit = audit
+	}
+
+	if cfg.HealthCheck.WebhookURL != "" {
+		s.webhook = health.NewWebhook(
+			cfg.HealthCheck.WebhookURL,
+			cfg.HealthCheck.WebhookTimeout,
+			cfg.HealthCheck.WebhookRetries,
 			log.Zap(),
 		)
+		h.OnStateChange(s.webhook.Notify)
+		for _, checker := range upstreamCheckers {
+			checker.OnStateChange(s.webhook.Notify)
+		}
 	}
 
-	handler := NewHandler(b, c, log, cfg.Cache.Enabled)
-	middleware := NewMiddleware(log, limiter, c, cfg.Cache.Enabled)
+	if cfg.HealthCheck.MinHealthy > 0 {
+		monitor.OnDegradedChange(s.recordDegraded)
+		monitor.SetMinHealthy(cfg.HealthCheck.MinHealthy, log.Zap())
+	}
 
-	s := &Server{
-		config:        cfg,
-		logger:        log,
-		balancer:      b,
-		healthChecker: h,
-		limiter:       limiter,
-		cache:         c,
-		handler:       handler,
-		middleware:    middleware,
+	if cfg.Summary.Enabled {
+		policy, err := access.NewPolicy(cfg.Summary.Access.Allow, cfg.Summary.Access.Deny)
+		if err != nil {
+			return nil, fmt.Errorf("summary: %w", err)
+		}
+		s.summaryAccess = policy
+		s.summaryStats = newSummaryStats()
+		middleware.SetSummaryStats(s.summaryStats)
+	}
+
+	if cfg.Server.Expvar.Enabled {
+		s.expvars = newExpvarStats(s.healthyBackends)
+		middleware.SetExpvars(s.expvars)
+	}
+
+	if cfg.Admin.TopClients.Enabled {
+		s.topClients = newTopClients(cfg.Admin.TopClients.Capacity)
+		middleware.SetTopClients(s.topClients)
 	}
 
-	if limiter != nil {
-		s.cleanupManager = ratelimit.NewCleanupManager(limiter, 5*time.Minute, 5*time.Minute)
+	if cfg.Proxy.MinIdleConnsPerBackend > 0 {
+		s.warmer = newConnWarmer(handler, cfg.Proxy.MinIdleConnsPerBackend, cfg.HealthCheck.Endpoint, log)
 	}
 
+	s.cleanupManager = ratelimit.NewCleanupManager(limiter, 5*time.Minute, 5*time.Minute)
+
 	return s, nil
 }
 
+const (
+	metricBelowMinHealthy      = "proxy_backends_below_min_healthy"
+	metricBelowMinHealthyTotal = "proxy_backends_below_min_healthy_total"
+	metricConnLimitRejected    = "proxy_conn_limit_rejected_total"
+	metricCacheEvictions       = "proxy_cache_evictions_total"
+)
+
+func (s *Server) recordDegraded(degraded bool, healthy int) {
+	if degraded {
+		s.metrics.Gauge(metricBelowMinHealthy).Set(1)
+		s.metrics.Counter(metricBelowMinHealthyTotal).Inc()
+		return
+	}
+	s.metrics.Gauge(metricBelowMinHealthy).Set(0)
+}
+
+func newPool(cfg *config.Config, backends []config.BackendConfig, registry *metrics.Registry, log *logger.Logger) balancer.Balancer {
+	var pool balancer.Balancer
+	switch cfg.Balancer {
+	case config.BalancerLeastConn:
+		pool = balancer.NewLeastConn()
+	case config.BalancerIPHash:
+		pool = balancer.NewIPHash()
+	default:
+		srr := balancer.NewSRR()
+		srr.SetSlowPenalty(cfg.SlowBackendPenalty)
+		pool = srr
+	}
+
+	configured := make([]float64, len(backends))
+	for i, backendCfg := range backends {
+		configured[i] = backendCfg.Weight
+	}
+	weights := balancer.NormalizeWeights(configured)
+
+	for i, backendCfg := range backends {
+		pool.AddBackend(newPoolBackend(cfg, backendCfg, weights[i], registry, log))
+		log.Info("Backend added",
+			zap.String("url", backendCfg.URL),
+			zap.Float64("weight", backendCfg.Weight),
+			zap.Int("effective_weight", weights[i]))
+	}
+
+	return pool
+}
+
+func newPoolBackend(cfg *config.Config, backendCfg config.BackendConfig, weight int, registry *metrics.Registry, log *logger.Logger) *balancer.Backend {
+	backend := balancer.NewBackend(backendCfg.URL, weight)
+	if len(backendCfg.RequestHeaders) > 0 {
+		backend.SetRequestHeaders(backendCfg.RequestHeaders)
+	}
+	backend.SetPriority(backendCfg.Priority)
+	if cfg.CircuitBreaker.Enabled {
+		backend.SetBreaker(circuit.NewBreaker(
+			cfg.CircuitBreaker.FailureThreshold,
+			cfg.CircuitBreaker.OpenTimeout,
+			newCircuitObserver(log.Zap(), registry, backendCfg.URL),
+		))
+	}
+	return backend
+}
+
+func newCacheStore(cfg config.CacheConfig, registry *metrics.Registry, log *logger.Logger) cache.Store {
+	if cfg.Backend != "redis" {
+		c := cache.NewCache(cfg.TTL)
+		if cfg.MaxEntries > 0 || cfg.MaxBytes > 0 {
+			evictions := registry.Counter(metricCacheEvictions)
+			c.SetLimits(cfg.MaxEntries, cfg.MaxBytes, evictions.Inc)
+		}
+		return c
+	}
+
+	log.Info("Using Redis cache",
+		zap.String("addr", cfg.Redis.Addr),
+		zap.Int("db", cfg.Redis.DB))
+	return cache.NewRedisStore(cache.RedisOptions{
+		Addr:      cfg.Redis.Addr,
+		Password:  cfg.Redis.Password,
+		DB:        cfg.Redis.DB,
+		KeyPrefix: cfg.Redis.KeyPrefix,
+		Timeout:   cfg.Redis.Timeout,
+		TTL:       cfg.TTL,
+		OnError: func(op string, err error) {
+			log.Warn("Redis cache command failed",
+				zap.String("op", op),
+				zap.Error(err))
+		},
+	})
+}
+
+// newHealthChecker builds a checker for pool; egress, when set, is the proxy
+// probes go through.
+func newHealthChecker(hc config.HealthCheckConfig, egress func(*http.Request) (*url.URL, error), pool balancer.Balancer, log *logger.Logger) (*health.Checker, error) {
+	checker := health.NewChecker(
+		pool,
+		hc.Interval,
+		hc.Timeout,
+		hc.Endpoint,
+		hc.FailureThreshold,
+		hc.RecoveryInterval,
+		log.Zap(),
+	)
+	if len(hc.TierIntervals) > 0 {
+		checker.SetTierIntervals(hc.TierIntervals)
+	}
+	if len(hc.JSONChecks) > 0 {
+		matcher, err := health.NewJSONMatcher(hc.JSONChecks)
+		if err != nil {
+			return nil, fmt.Errorf("health_check json_checks: %w", err)
+		}
+		checker.SetJSONChecks(matcher)
+	}
+	if egress != nil {
+		checker.SetProxy(egress)
+	}
+	return checker, nil
+}
+
 func (s *Server) Start(ctx context.Context) error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.middleware.Chain(s.handler).ServeHTTP)
+	handler := s.publicHandler()
 
 	var tlsConfig *tls.Config
 	if s.config.TLS.Enabled {
-		cfg, err := tlsconfig.NewConfig(s.config.TLS.CertFile, s.config.TLS.KeyFile).Load()
+		termination := tlsconfig.NewConfig(s.config.TLS.CertFile, s.config.TLS.KeyFile)
+		if len(s.config.TLS.ALPNProtocols) > 0 {
+			termination.SetNextProtos(s.config.TLS.ALPNProtocols)
+		}
+		if s.tlsMinVersion != 0 {
+			termination.SetMinVersion(s.tlsMinVersion)
+		}
+		cfg, err := termination.Load()
 		if err != nil {
 			return err
 		}
 		tlsConfig = cfg
+
+		if s.config.TLS.DisableSessionTickets {
+			tlsConfig.SessionTicketsDisabled = true
+		} else if s.config.TLS.SessionTicketRotation > 0 {
+			rotator, err := tlsconfig.NewTicketRotator(tlsConfig, s.config.TLS.SessionTicketRotation)
+			if err != nil {
+				return err
+			}
+			s.ticketRotator = rotator
+			s.ticketRotator.Start()
+		}
 	}
 
-	s.server = &http.Server{
-		Addr:         fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.HTTPPort),
-		Handler:      mux,
-		ReadTimeout:  s.config.Server.ReadTimeout,
-		WriteTimeout: s.config.Server.WriteTimeout,
+	for _, port := range s.config.Server.ListenHTTPPorts() {
+		s.servers = append(s.servers, s.newPublicServer(port, handler, nil))
 	}
 
 	if s.config.TLS.Enabled {
-		s.tlsServer = &http.Server{
-			Addr:         fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.HTTPSPort),
-			Handler:      mux,
-			TLSConfig:    tlsConfig,
+		for _, port := range s.config.Server.ListenHTTPSPorts() {
+			s.tlsServers = append(s.tlsServers, s.newPublicServer(port, handler, s.listenerTLSConfig(port, tlsConfig)))
+		}
+	}
+
+	if s.config.Admin.Enabled {
+		s.adminServer = &http.Server{
+			Addr:         fmt.Sprintf("%s:%d", s.config.Admin.Host, s.config.Admin.Port),
+			Handler:      s.adminMux(),
 			ReadTimeout:  s.config.Server.ReadTimeout,
 			WriteTimeout: s.config.Server.WriteTimeout,
 		}
 	}
 
+	s.logStartupReport()
+
+	if s.webhook != nil {
+		s.webhook.Start()
+	}
 	s.healthChecker.Start(ctx)
+	for _, checker := range s.upstreamCheckers {
+		checker.Start(ctx)
+	}
 	if s.cleanupManager != nil {
 		s.cleanupManager.Start()
 	}
+	// Idempotency records live in the cache store too, so the memory cache
+	// is cleaned up even while response caching is off.
+	if store, ok := s.cache.(*cache.Cache); ok && s.config.Cache.CleanupInterval > 0 {
+		store.StartCleanup(s.config.Cache.CleanupInterval, s.config.Cache.ExpiredRetention)
+	}
+	if s.warmer != nil {
+		s.warmer.Start()
+	}
 
-	errCh := make(chan error, 2)
+	errCh := make(chan error, len(s.servers)+len(s.tlsServers)+1)
 
-	go func() {
-		s.logger.Info("Starting HTTP server",
-			zap.String("address", s.server.Addr))
-		if err := s.server.ListenAndServe(); err != nil {
-			errCh <- fmt.Errorf("HTTP server error: %w", err)
-		}
-	}()
+	for _, srv := range s.servers {
+		go func(srv *http.Server) {
+			s.logger.Info("Starting HTTP server",
+				zap.String("address", srv.Addr))
+			if err := s.serve(srv, false); err != nil {
+				errCh <- fmt.Errorf("HTTP server error: %w", err)
+			}
+		}(srv)
+	}
 
-	if s.config.TLS.Enabled {
-		go func() {
+	for _, srv := range s.tlsServers {
+		go func(srv *http.Server) {
 			s.logger.Info("Starting HTTPS server",
-				zap.String("address", s.tlsServer.Addr))
-			if err := s.tlsServer.ListenAndServeTLS("", ""); err != nil {
+				zap.String("address", srv.Addr))
+			if err := s.serve(srv, true); err != nil {
 				errCh <- fmt.Errorf("HTTPS server error: %w", err)
 			}
+		}(srv)
+	}
+
+	if s.adminServer != nil {
+		go func() {
+			s.logger.Info("Starting admin server",
+				zap.String("address", s.adminServer.Addr))
+			if err := s.adminServer.ListenAndServe(); err != nil {
+				errCh <- fmt.Errorf("admin server error: %w", err)
+			}
 		}()
 	}
 
@@ -149,44 +491,209 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 }
 
+// listenerTLSConfig returns tlsConfig, or a clone of it when the port has
+// its own minimum TLS version. Clones share the rotated ticket keys.
+func (s *Server) listenerTLSConfig(port int, tlsConfig *tls.Config) *tls.Config {
+	version, ok := s.tlsMinByPort[port]
+	if !ok {
+		return tlsConfig
+	}
+	cfg := tlsConfig.Clone()
+	cfg.MinVersion = version
+	if s.ticketRotator != nil {
+		s.ticketRotator.AddConfig(cfg)
+	}
+	return cfg
+}
+
+// newPublicServer builds a listener for one HTTP or HTTPS port; tlsConfig is
+// nil for plain HTTP.
+func (s *Server) newPublicServer(port int, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", s.config.Server.Host, port),
+		Handler:      handler,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  s.config.Server.ReadTimeout,
+		WriteTimeout: s.config.Server.WriteTimeout,
+
+		DisableGeneralOptionsHandler: s.config.Proxy.HandleOptions,
+	}
+	// net/http adds "h2" to NextProtos unless TLSNextProto is non-nil, so an
+	// empty map keeps HTTP/2 off when it was not configured.
+	if tlsConfig != nil && !slices.Contains(tlsConfig.NextProtos, "h2") {
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return srv
+}
+
+func (s *Server) listenAddresses() []string {
+	var addrs []string
+	for _, port := range s.config.Server.ListenHTTPPorts() {
+		addrs = append(addrs, fmt.Sprintf("http://%s:%d", s.config.Server.Host, port))
+	}
+	if s.config.TLS.Enabled {
+		for _, port := range s.config.Server.ListenHTTPSPorts() {
+			addrs = append(addrs, fmt.Sprintf("https://%s:%d", s.config.Server.Host, port))
+		}
+	}
+	if s.config.Admin.Enabled {
+		addrs = append(addrs, fmt.Sprintf("admin://%s:%d", s.config.Admin.Host, s.config.Admin.Port))
+	}
+	return addrs
+}
+
+// logStartupReport logs a one-time summary of the effective configuration.
+func (s *Server) logStartupReport() {
+	backends := s.balancer.GetBackends()
+	weights := make([]string, 0, len(backends))
+	for _, b := range backends {
+		weights = append(weights, fmt.Sprintf("%s=%d", b.URL, b.Weight))
+	}
+
+	s.logger.Info("Startup report",
+		zap.Strings("listen", s.listenAddresses()),
+		zap.Int("backends", len(backends)),
+		zap.Strings("weights", weights),
+		zap.Bool("tls", s.config.TLS.Enabled),
+		zap.Bool("cache", s.config.Cache.Enabled),
+		zap.Bool("rate_limit", s.config.RateLimit.Enabled),
+		zap.Bool("circuit_breaker", s.config.CircuitBreaker.Enabled),
+		zap.Duration("read_timeout", s.config.Server.ReadTimeout),
+		zap.Duration("write_timeout", s.config.Server.WriteTimeout),
+		zap.Duration("health_check_interval", s.config.HealthCheck.Interval),
+		zap.Duration("health_check_timeout", s.config.HealthCheck.Timeout))
+}
+
+// publicHandler returns the handler for the HTTP and HTTPS listeners.
+// "OPTIONS *" has no path for the mux to route, so it goes straight to the
+// middleware chain; it only arrives here when proxy.handle_options disables
+// net/http's built-in reply.
+func (s *Server) publicHandler() http.Handler {
+	chain := s.middleware.Chain(s.handler)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", chain.ServeHTTP)
+	if s.summaryAccess != nil {
+		mux.HandleFunc(summaryPath, s.summaryHandler(s.summaryAccess))
+	}
+
+	pingPath := s.config.Server.PingPath
+	local := newLocalPaths(s.config.Server.LocalPaths)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI == "*" {
+			chain.ServeHTTP(w, r)
+			return
+		}
+		if pingPath != "" && r.URL.Path == pingPath {
+			s.handlePing(w, r)
+			return
+		}
+		// Local paths bypass the middleware as well, so these probes stay
+		// out of the request log.
+		if entry, ok := local.match(r.URL.Path); ok {
+			serveLocalPath(w, entry)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// serve runs srv on its address, wrapping the listener with the per-IP
+// connection limit when server.max_conns_per_ip is set.
+func (s *Server) serve(srv *http.Server, useTLS bool) error {
+	if s.config.Server.MaxConnsPerIP <= 0 {
+		if useTLS {
+			return srv.ListenAndServeTLS("", "")
+		}
+		return srv.ListenAndServe()
+	}
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	rejected := s.metrics.Counter(metricConnLimitRejected)
+	limited := ratelimit.NewConnLimitListener(ln, s.config.Server.MaxConnsPerIP, func(ip string) {
+		rejected.Inc()
+		s.logger.Debug("Connection refused, per-IP limit reached",
+			zap.String("client_ip", ip),
+			zap.Int("limit", s.config.Server.MaxConnsPerIP))
+	})
+
+	if useTLS {
+		return srv.ServeTLS(limited, "", "")
+	}
+	return srv.Serve(limited)
+}
+
+// Shutdown stops the server in a fixed order so that no in-flight request
+// observes a partially torn-down server:
+//
+//  1. all listeners stop accepting connections and drain in-flight requests;
+//  2. the health checker is stopped, then its webhook notifier;
+//  3. the session ticket rotator and the rate limiter cleanup are stopped.
+//
+// The limiter and cache themselves are never torn down, so requests that are
+// still draining in step 1 keep working against them.
 func (s *Server) Shutdown() error {
+	s.draining.Store(true)
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	var wg sync.WaitGroup
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
 
-	if s.healthChecker != nil {
+	listeners := append(append([]*http.Server{}, s.servers...), s.tlsServers...)
+	for _, srv := range append(listeners, s.adminServer) {
+		if srv == nil {
+			continue
+		}
 		wg.Add(1)
-		go func() {
+		go func(srv *http.Server) {
 			defer wg.Done()
-			s.healthChecker.Stop()
-		}()
+			if err := srv.Shutdown(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("shutdown %s: %w", srv.Addr, err))
+				mu.Unlock()
+			}
+		}(srv)
 	}
 
-	if s.cleanupManager != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			s.cleanupManager.Stop()
-		}()
+	wg.Wait()
+	s.logger.Info("Listeners stopped")
+
+	if s.healthChecker != nil {
+		s.healthChecker.Stop()
+		for _, checker := range s.upstreamCheckers {
+			checker.Stop()
+		}
+		s.logger.Info("Health checker stopped")
 	}
 
-	if s.server != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			s.server.Shutdown(ctx)
-		}()
+	if s.webhook != nil {
+		s.webhook.Stop()
 	}
 
-	if s.tlsServer != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			s.tlsServer.Shutdown(ctx)
-		}()
+	if s.ticketRotator != nil {
+		s.ticketRotator.Stop()
 	}
 
-	wg.Wait()
-	return nil
+	if s.warmer != nil {
+		s.warmer.Stop()
+	}
+
+	if s.cleanupManager != nil {
+		s.cleanupManager.Stop()
+		s.logger.Info("Rate limit cleanup stopped")
+	}
+
+	if store, ok := s.cache.(*cache.Cache); ok {
+		store.StopCleanup()
+	}
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,414 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func testConfig(backendURLs ...string) *config.Config {
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			Host:         "127.0.0.1",
+			HTTPPort:     8080,
+			HTTPSPort:    8443,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 5 * time.Second,
+		},
+		HealthCheck: config.HealthCheckConfig{
+			Interval:         time.Hour,
+			Timeout:          time.Second,
+			Endpoint:         "/healthz",
+			FailureThreshold: 3,
+			RecoveryInterval: time.Second,
+		},
+		Cache: config.CacheConfig{TTL: time.Minute},
+		RateLimit: config.RateLimitConfig{
+			Enabled:           true,
+			RequestsPerMinute: 600,
+			Burst:             100,
+		},
+		Proxy: config.ProxyConfig{StreamThreshold: 1 << 20},
+	}
+
+	for _, u := range backendURLs {
+		cfg.Backends = append(cfg.Backends, config.BackendConfig{URL: u, Weight: 1})
+	}
+	return cfg
+}
+
+func TestServer_ShutdownDrainsBeforeStoppingSubsystems(t *testing.T) {
+	started := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer backend.Close()
+
+	core, logs := observer.New(zap.InfoLevel)
+	s, err := NewServer(testConfig(backend.URL), logger.FromZap(zap.New(core)))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s.servers = []*http.Server{{Handler: s.middleware.Chain(s.handler)}}
+	go s.servers[0].Serve(ln)
+	s.healthChecker.Start(context.Background())
+	s.cleanupManager.Start()
+
+	type result struct {
+		status int
+		err    error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		resp.Body.Close()
+		resultCh <- result{status: resp.StatusCode}
+	}()
+
+	<-started
+	shutdownStart := time.Now()
+	if err := s.Shutdown(); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if elapsed := time.Since(shutdownStart); elapsed < 100*time.Millisecond {
+		t.Errorf("Shutdown returned after %v, before in-flight request drained", elapsed)
+	}
+
+	select {
+	case res := <-resultCh:
+		if res.err != nil {
+			t.Fatalf("In-flight request failed: %v", res.err)
+		}
+		if res.status != http.StatusOK {
+			t.Errorf("Expected in-flight request to complete with 200, got %d", res.status)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("In-flight request did not complete")
+	}
+
+	expected := []string{"Listeners stopped", "Health checker stopped", "Rate limit cleanup stopped"}
+	var got []string
+	for _, entry := range logs.All() {
+		for _, msg := range expected {
+			if entry.Message == msg {
+				got = append(got, msg)
+			}
+		}
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected shutdown stages %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Stage %d: expected %q, got %q", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestServer_LogStartupReport(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	cfg := testConfig("http://localhost:8001", "http://localhost:8002")
+	cfg.Cache.Enabled = true
+
+	s, err := NewServer(cfg, logger.FromZap(zap.New(core)))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	s.logStartupReport()
+
+	entries := logs.FilterMessage("Startup report").All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected one startup report, got %d", len(entries))
+	}
+	if entries[0].Level != zap.InfoLevel {
+		t.Errorf("Expected info level, got %s", entries[0].Level)
+	}
+
+	fields := entries[0].ContextMap()
+	for _, key := range []string{"listen", "backends", "weights", "tls", "cache", "rate_limit", "read_timeout", "write_timeout"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("Expected field %q in startup report", key)
+		}
+	}
+	if fields["backends"] != int64(2) {
+		t.Errorf("Expected 2 backends, got %v", fields["backends"])
+	}
+	if fields["cache"] != true {
+		t.Errorf("Expected cache=true, got %v", fields["cache"])
+	}
+	if fields["tls"] != false {
+		t.Errorf("Expected tls=false, got %v", fields["tls"])
+	}
+}
+
+func TestServer_BackendRequestHeaders(t *testing.T) {
+	echoToken := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + ":" + r.Header.Get("X-Upstream-Token")))
+		}))
+	}
+	plain := echoToken("plain")
+	defer plain.Close()
+	tagged := echoToken("tagged")
+	defer tagged.Close()
+
+	cfg := testConfig(plain.URL, tagged.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Backends[1].RequestHeaders = map[string]string{"X-Upstream-Token": "secret"}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.middleware.Chain(s.handler)
+
+	seen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/token", nil)
+		req.Header.Set("X-Upstream-Token", "spoofed")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		seen[rec.Body.String()]++
+	}
+
+	if seen["tagged:secret"] != 2 {
+		t.Errorf("Expected tagged backend to receive the configured header, got %v", seen)
+	}
+	if seen["plain:spoofed"] != 2 {
+		t.Errorf("Expected untagged backend to see only the client header, got %v", seen)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestServer_ListensOnEveryHTTPPort(t *testing.T) {
+	backend := namedBackend("backend")
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Server.HTTPPort = freePort(t)
+	cfg.Server.HTTPPorts = []int{freePort(t)}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ctx) }()
+
+	for _, port := range []int{cfg.Server.HTTPPort, cfg.Server.HTTPPorts[0]} {
+		url := fmt.Sprintf("http://127.0.0.1:%d/", port)
+		var body string
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			resp, err := http.Get(url)
+			if err == nil {
+				b, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				body = string(b)
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if body != "backend" {
+			t.Errorf("Port %d: expected proxied response, got %q", port, body)
+		}
+	}
+
+	if len(s.servers) != 2 {
+		t.Errorf("Expected 2 HTTP listeners tracked, got %d", len(s.servers))
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start returned error on shutdown: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and returns
+// the certificate and key paths.
+func writeTestCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestServer_MinTLSVersionPerListener(t *testing.T) {
+	backend := namedBackend("backend")
+	defer backend.Close()
+
+	certFile, keyFile := writeTestCert(t)
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Server.HTTPPort = freePort(t)
+	cfg.Server.HTTPSPort = freePort(t)
+	cfg.Server.HTTPSPorts = []int{freePort(t)}
+	cfg.TLS = config.TLSConfig{
+		Enabled:          true,
+		CertFile:         certFile,
+		KeyFile:          keyFile,
+		MinVersion:       "1.2",
+		MinVersionByPort: map[int]string{cfg.Server.HTTPSPorts[0]: "TLS1.3"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ctx) }()
+
+	handshake := func(port int, maxVersion uint16) error {
+		addr := fmt.Sprintf("127.0.0.1:%d", port)
+		var err error
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			var conn *tls.Conn
+			conn, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MaxVersion: maxVersion})
+			if err == nil {
+				conn.Close()
+				return nil
+			}
+			var opErr *net.OpError
+			if !errors.As(err, &opErr) || opErr.Op != "dial" {
+				return err
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return err
+	}
+
+	if err := handshake(cfg.Server.HTTPSPort, tls.VersionTLS12); err != nil {
+		t.Errorf("Expected TLS 1.2 to be accepted on port %d, got %v", cfg.Server.HTTPSPort, err)
+	}
+	if err := handshake(cfg.Server.HTTPSPorts[0], tls.VersionTLS12); err == nil {
+		t.Errorf("Expected TLS 1.2 to be rejected on port %d", cfg.Server.HTTPSPorts[0])
+	}
+	if err := handshake(cfg.Server.HTTPSPorts[0], tls.VersionTLS13); err != nil {
+		t.Errorf("Expected TLS 1.3 to be accepted on port %d, got %v", cfg.Server.HTTPSPorts[0], err)
+	}
+	if err := handshake(cfg.Server.HTTPSPort, tls.VersionTLS11); err == nil {
+		t.Errorf("Expected TLS 1.1 to be rejected on port %d", cfg.Server.HTTPSPort)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start returned error on shutdown: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+}
+
+func TestNewServer_RejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*config.Config)
+	}{
+		{"trusted proxy", func(c *config.Config) { c.Server.TrustedProxies = []string{"10.0.0.0/33"} }},
+		{"rate limit allowlist", func(c *config.Config) { c.RateLimit.Allowlist = []string{"not-an-ip"} }},
+		{"no proxy", func(c *config.Config) {
+			c.Proxy.UpstreamProxyURL = "http://egress:3128"
+			c.Proxy.UpstreamNoProxy = []string{"10.0.0.0/33"}
+		}},
+		{"upstream proxy URL", func(c *config.Config) { c.Proxy.UpstreamProxyURL = "http://egress:port" }},
+		{"json check", func(c *config.Config) { c.HealthCheck.JSONChecks = map[string]string{"status..ok": "true"} }},
+		{"tls min version", func(c *config.Config) { c.TLS.MinVersion = "1.9" }},
+		{"tls min version by port", func(c *config.Config) { c.TLS.MinVersionByPort = map[int]string{9443: "ssl3"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig("http://localhost:8001")
+			tt.modify(cfg)
+			if _, err := NewServer(cfg, logger.FromZap(zap.NewNop())); err == nil {
+				t.Error("Expected NewServer to return an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Cache statuses reported in the Server-Timing header.
+const (
+	cacheStatusHit         = "HIT"
+	cacheStatusMiss        = "MISS"
+	cacheStatusBypass      = "BYPASS"
+	cacheStatusStale       = "STALE"
+	cacheStatusRevalidated = "REVALIDATED"
+)
+
+// serverTiming formats a Server-Timing value with the backend duration in
+// milliseconds, when the backend was asked, and the cache status, e.g.
+// "backend;dur=12.3, cache;desc=MISS".
+func serverTiming(backend time.Duration, status string) string {
+	if backend <= 0 {
+		return "cache;desc=" + status
+	}
+	return fmt.Sprintf("backend;dur=%.1f, cache;desc=%s", float64(backend)/float64(time.Millisecond), status)
+}
+
+// setServerTiming sets the proxy's Server-Timing value on w. A Server-Timing
+// header from the backend is added after it rather than replaced.
+func setServerTiming(w http.ResponseWriter, backend time.Duration, status string) {
+	w.Header().Set("Server-Timing", serverTiming(backend, status))
+}
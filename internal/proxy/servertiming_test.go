@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestServerTiming_MissAndHit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body"))
+	}))
+	defer backend.Close()
+
+	handler, c := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1024, ServerTiming: true})
+	m := NewMiddleware(logger.FromZap(zap.NewNop()), nil, c, true, nil)
+	m.SetServerTiming(true)
+	h := m.Chain(handler)
+
+	rec := serveFrom(h, "192.168.1.1:5000", "/page")
+	miss := regexp.MustCompile(`^backend;dur=\d+\.\d, cache;desc=MISS$`)
+	if got := rec.Header().Get("Server-Timing"); !miss.MatchString(got) {
+		t.Errorf("Expected backend duration and MISS on first request, got %q", got)
+	}
+
+	rec = serveFrom(h, "192.168.1.1:5000", "/page")
+	if got := rec.Header().Values("Server-Timing"); len(got) != 1 || got[0] != "cache;desc=HIT" {
+		t.Errorf("Expected only cache;desc=HIT on a cache hit, got %q", got)
+	}
+}
+
+func TestServerTiming_Disabled(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body"))
+	}))
+	defer backend.Close()
+
+	handler, _ := newTestHandler(backend.URL, config.ProxyConfig{StreamThreshold: 1024})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/page", nil))
+	if got := rec.Header().Get("Server-Timing"); got != "" {
+		t.Errorf("Expected no Server-Timing header when disabled, got %q", got)
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+const metricShadowDropped = "proxy_shadow_dropped_total"
+
+// Shadow mirrors a sampled fraction of requests to a secondary upstream.
+// Mirrored responses are discarded and never affect the client response. At
+// most cfg.MaxInFlight mirrored requests run at once; a slow shadow upstream
+// makes further ones drop rather than pile up.
+type Shadow struct {
+	target     *url.URL
+	sampleRate float64
+	client     *http.Client
+	logger     *logger.Logger
+	metrics    *metrics.Registry
+	slots      chan struct{}
+	draw       func() float64
+}
+
+func NewShadow(cfg config.ShadowConfig, log *logger.Logger, registry *metrics.Registry) (*Shadow, error) {
+	target, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shadow URL: %w", err)
+	}
+
+	return &Shadow{
+		target:     target,
+		sampleRate: cfg.SampleRate,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger:  log,
+		metrics: registry,
+		slots:   make(chan struct{}, cfg.MaxInFlight),
+		draw:    rand.Float64,
+	}, nil
+}
+
+func (s *Shadow) ShouldMirror() bool {
+	return s.draw() < s.sampleRate
+}
+
+// Mirror sends a copy of r with the given body to the shadow upstream in the
+// background, or drops it when MaxInFlight mirrored requests are pending.
+func (s *Shadow) Mirror(r *http.Request, body []byte) {
+	shadowURL := s.target.ResolveReference(&url.URL{
+		Path:     r.URL.Path,
+		RawPath:  r.URL.RawPath,
+		RawQuery: r.URL.RawQuery,
+	})
+
+	req, err := http.NewRequestWithContext(context.Background(), r.Method, shadowURL.String(), bytes.NewReader(body))
+	if err != nil {
+		s.logger.Warn("Failed to create shadow request",
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		return
+	}
+	copyHeader(req.Header, r.Header)
+	removeHopHeaders(req.Header)
+
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		s.metrics.Counter(metricShadowDropped).Inc()
+		s.logger.Debug("Shadow request dropped, too many in flight",
+			zap.String("path", r.URL.Path))
+		return
+	}
+
+	go func() {
+		defer func() { <-s.slots }()
+		resp, err := s.client.Do(req)
+		if err != nil {
+			s.logger.Debug("Shadow request failed",
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
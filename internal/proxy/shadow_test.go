@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+func TestShadow_SampleRate(t *testing.T) {
+	shadow, err := NewShadow(config.ShadowConfig{URL: "http://localhost:9000", SampleRate: 0.25, MaxInFlight: 1}, logger.FromZap(zap.NewNop()), metrics.NewRegistry())
+	if err != nil {
+		t.Fatalf("NewShadow failed: %v", err)
+	}
+	shadow.draw = rand.New(rand.NewPCG(1, 2)).Float64
+
+	iterations := 10000
+	mirrored := 0
+	for i := 0; i < iterations; i++ {
+		if shadow.ShouldMirror() {
+			mirrored++
+		}
+	}
+
+	observed := float64(mirrored) / float64(iterations)
+	if math.Abs(observed-0.25) > 0.02 {
+		t.Errorf("Expected mirror rate near 0.25, got %.3f", observed)
+	}
+}
+
+func TestHandler_MirrorsSampledRequests(t *testing.T) {
+	var mirrored atomic.Int32
+	shadowBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored.Add(1)
+	}))
+	defer shadowBackend.Close()
+
+	primary := namedBackend("primary")
+	defer primary.Close()
+
+	handler, _ := newTestHandler(primary.URL, config.ProxyConfig{StreamThreshold: 1 << 20})
+	shadow, err := NewShadow(config.ShadowConfig{URL: shadowBackend.URL, SampleRate: 0.5, Timeout: time.Second, MaxInFlight: 400}, logger.FromZap(zap.NewNop()), metrics.NewRegistry())
+	if err != nil {
+		t.Fatalf("NewShadow failed: %v", err)
+	}
+	shadow.draw = rand.New(rand.NewPCG(3, 4)).Float64
+	handler.SetShadow(shadow)
+
+	requests := 400
+	for i := 0; i < requests; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/item", nil))
+		if rec.Body.String() != "primary" {
+			t.Fatalf("Expected primary response, got %q", rec.Body.String())
+		}
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	observed := float64(mirrored.Load()) / float64(requests)
+	if math.Abs(observed-0.5) > 0.1 {
+		t.Errorf("Expected roughly half of requests mirrored, got %.3f", observed)
+	}
+}
+
+func TestShadow_DropsPastMaxInFlight(t *testing.T) {
+	release := make(chan struct{})
+	var mirrored atomic.Int32
+	shadowBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored.Add(1)
+		<-release
+	}))
+	defer shadowBackend.Close()
+	defer close(release)
+
+	registry := metrics.NewRegistry()
+	shadow, err := NewShadow(config.ShadowConfig{URL: shadowBackend.URL, SampleRate: 1, Timeout: 5 * time.Second, MaxInFlight: 2},
+		logger.FromZap(zap.NewNop()), registry)
+	if err != nil {
+		t.Fatalf("NewShadow failed: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		shadow.Mirror(httptest.NewRequest(http.MethodGet, "/item", nil), nil)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mirrored.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := mirrored.Load(); got != 2 {
+		t.Errorf("Expected 2 mirrored requests in flight, got %d", got)
+	}
+	if got := registry.Counter(metricShadowDropped).Value(); got != 3 {
+		t.Errorf("Expected 3 dropped requests counted, got %d", got)
+	}
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// readUpTo buffers at most limit bytes from r. When the body is larger than
+// limit, overflow is true and the returned prefix must be written before the
+// remainder of r is streamed.
+func readUpTo(r io.Reader, limit int64) (prefix []byte, overflow bool, err error) {
+	prefix, err = io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(prefix)) > limit {
+		return prefix, true, nil
+	}
+	return prefix, false, nil
+}
+
+// contextReader fails reads once ctx is done, even if the underlying reader
+// would still return buffered data.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// copyFlushing copies src to w, flushing after every chunk so the client
+// receives bytes as the backend produces them, including chunked responses
+// with no Content-Length.
+func copyFlushing(w http.ResponseWriter, src io.Reader) (int64, error) {
+	rc := http.NewResponseController(w)
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			m, err := w.Write(buf[:n])
+			written += int64(m)
+			if err != nil {
+				return written, err
+			}
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return written, err
+			}
+		}
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"proxy-kp/pkg/access"
+
+	"go.uber.org/zap"
+)
+
+const (
+	summaryPath = "/proxy/summary"
+
+	// rateWindowSeconds is the span over which per-pool RPS is averaged.
+	rateWindowSeconds = 60
+)
+
+// rateWindow counts events in per-second buckets covering the last minute.
+type rateWindow struct {
+	mu      sync.Mutex
+	counts  [rateWindowSeconds]int64
+	seconds [rateWindowSeconds]int64
+}
+
+func (w *rateWindow) add(now time.Time) {
+	sec := now.Unix()
+	idx := sec % rateWindowSeconds
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seconds[idx] != sec {
+		w.seconds[idx] = sec
+		w.counts[idx] = 0
+	}
+	w.counts[idx]++
+}
+
+// count returns the number of events in the window ending at now.
+func (w *rateWindow) count(now time.Time) int64 {
+	oldest := now.Unix() - rateWindowSeconds
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var total int64
+	for i, sec := range w.seconds {
+		if sec > oldest {
+			total += w.counts[i]
+		}
+	}
+	return total
+}
+
+// rate returns events per second averaged over the window ending at now.
+func (w *rateWindow) rate(now time.Time) float64 {
+	return float64(w.count(now)) / rateWindowSeconds
+}
+
+type poolStats struct {
+	requests    rateWindow
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+}
+
+func (p *poolStats) hitRatio() float64 {
+	hits, misses := p.cacheHits.Load(), p.cacheMisses.Load()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// summaryStats collects the per-pool request and cache counters that the
+// balancer and cache do not track themselves. A nil *summaryStats ignores
+// every call, so the middleware can record unconditionally.
+type summaryStats struct {
+	mu    sync.Mutex
+	pools map[string]*poolStats
+}
+
+func newSummaryStats() *summaryStats {
+	return &summaryStats{pools: make(map[string]*poolStats)}
+}
+
+func (s *summaryStats) pool(name string) *poolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pools[name]
+	if !ok {
+		p = &poolStats{}
+		s.pools[name] = p
+	}
+	return p
+}
+
+func (s *summaryStats) recordRequest(pool string) {
+	if s == nil {
+		return
+	}
+	s.pool(pool).requests.add(time.Now())
+}
+
+func (s *summaryStats) recordCache(pool string, hit bool) {
+	if s == nil {
+		return
+	}
+	if hit {
+		s.pool(pool).cacheHits.Add(1)
+		return
+	}
+	s.pool(pool).cacheMisses.Add(1)
+}
+
+// poolNameFor returns the pool a request is served from: the route's upstream,
+// or "default" for the top-level backends.
+func poolNameFor(route *Route) string {
+	if route != nil && route.Upstream != "" {
+		return route.Upstream
+	}
+	return "default"
+}
+
+type poolSummary struct {
+	Name          string  `json:"name"`
+	Backends      int     `json:"backends"`
+	Healthy       int     `json:"healthy"`
+	RPS           float64 `json:"rps"`
+	AvgLatencyMs  float64 `json:"avg_latency_ms"`
+	CacheHitRatio float64 `json:"cache_hit_ratio"`
+}
+
+type summaryResponse struct {
+	Pools        []poolSummary `json:"pools"`
+	Degraded     bool          `json:"degraded"`
+	CacheEntries int           `json:"cache_entries"`
+}
+
+func (s *Server) summary() summaryResponse {
+	now := time.Now()
+	resp := summaryResponse{
+		Degraded:     s.monitor.Degraded(),
+		CacheEntries: s.cache.Size(),
+	}
+
+	for name, pool := range s.pools() {
+		backends := pool.GetBackends()
+		entry := poolSummary{
+			Name:     name,
+			Backends: len(backends),
+			Healthy:  pool.HealthyCount(),
+		}
+
+		var total time.Duration
+		var samples int
+		for _, b := range backends {
+			mean, n := b.LatencyMean()
+			total += mean * time.Duration(n)
+			samples += n
+		}
+		if samples > 0 {
+			entry.AvgLatencyMs = float64(total/time.Duration(samples)) / float64(time.Millisecond)
+		}
+
+		stats := s.summaryStats.pool(name)
+		entry.RPS = stats.requests.rate(now)
+		entry.CacheHitRatio = stats.hitRatio()
+
+		resp.Pools = append(resp.Pools, entry)
+	}
+
+	sort.Slice(resp.Pools, func(i, j int) bool { return resp.Pools[i].Name < resp.Pools[j].Name })
+	return resp
+}
+
+// summaryHandler serves the aggregated pool summary to clients admitted by
+// policy and answers everyone else with 403. It is registered for every method
+// so that no request to the summary path reaches a backend.
+func (s *Server) summaryHandler(policy *access.Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip := getClientIP(r)
+		if !policy.Allowed(ip) {
+			s.logger.Warn("Summary request denied",
+				zap.String("client_ip", ip))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.summary())
+	}
+}
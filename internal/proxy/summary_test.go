@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestServer_SummaryAggregatesSubsystems(t *testing.T) {
+	first := namedBackend("first")
+	defer first.Close()
+	second := namedBackend("second")
+	defer second.Close()
+	images := namedBackend("images")
+	defer images.Close()
+
+	cfg := testConfig(first.URL, second.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Cache.Enabled = true
+	cfg.HealthCheck.MinHealthy = 2
+	cfg.Upstreams = []config.UpstreamConfig{
+		{Name: "images", Backends: []config.BackendConfig{{URL: images.URL, Weight: 1}}},
+	}
+	cfg.Routes = []config.RouteConfig{
+		{Name: "images", Match: config.RouteMatchConfig{PathPrefix: "/images/"}, Upstream: "images"},
+	}
+	cfg.Summary = config.SummaryConfig{
+		Enabled: true,
+		Access:  config.AccessConfig{Allow: []string{"127.0.0.1"}},
+	}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.publicHandler()
+
+	// One miss followed by two hits on the default pool.
+	for i := 0; i < 3; i++ {
+		serveFrom(h, "192.168.1.1:5000", "/page")
+	}
+
+	imagesBackend := s.upstreams["images"].GetBackends()[0]
+	imagesBackend.RecordLatency(10 * time.Millisecond)
+	imagesBackend.RecordLatency(30 * time.Millisecond)
+
+	s.balancer.SetHealthy(second.URL, false)
+	s.monitor.Evaluate()
+
+	rec := serveFrom(h, "127.0.0.1:5000", summaryPath)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var summary summaryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("Invalid summary JSON: %v", err)
+	}
+
+	if !summary.Degraded {
+		t.Error("Expected degraded with one healthy backend below min_healthy 2")
+	}
+	if summary.CacheEntries != 1 {
+		t.Errorf("Expected 1 cache entry, got %d", summary.CacheEntries)
+	}
+	if len(summary.Pools) != 2 {
+		t.Fatalf("Expected 2 pools, got %+v", summary.Pools)
+	}
+
+	def, img := summary.Pools[0], summary.Pools[1]
+	if def.Name != "default" || img.Name != "images" {
+		t.Fatalf("Expected pools sorted by name, got %q and %q", def.Name, img.Name)
+	}
+	if def.Backends != 2 || def.Healthy != 1 {
+		t.Errorf("Expected default pool 1/2 healthy, got %d/%d", def.Healthy, def.Backends)
+	}
+	if want := 3.0 / rateWindowSeconds; math.Abs(def.RPS-want) > 1e-9 {
+		t.Errorf("Expected default RPS %v, got %v", want, def.RPS)
+	}
+	if want := 2.0 / 3.0; math.Abs(def.CacheHitRatio-want) > 1e-9 {
+		t.Errorf("Expected default cache hit ratio %v, got %v", want, def.CacheHitRatio)
+	}
+	if def.AvgLatencyMs <= 0 {
+		t.Errorf("Expected default pool latency from the proxied miss, got %v", def.AvgLatencyMs)
+	}
+	if img.Backends != 1 || img.Healthy != 1 || img.RPS != 0 || img.CacheHitRatio != 0 {
+		t.Errorf("Unexpected images pool summary: %+v", img)
+	}
+	if img.AvgLatencyMs != 20 {
+		t.Errorf("Expected images avg latency 20ms, got %v", img.AvgLatencyMs)
+	}
+}
+
+func TestServer_SummaryIsGuardedAndNotProxied(t *testing.T) {
+	var proxied bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+	}))
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Summary = config.SummaryConfig{
+		Enabled: true,
+		Access:  config.AccessConfig{Allow: []string{"127.0.0.1"}},
+	}
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	h := s.publicHandler()
+
+	if rec := serveFrom(h, "192.168.1.1:5000", summaryPath); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a client outside the allow list, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, summaryPath, nil)
+	req.RemoteAddr = "127.0.0.1:5000"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rec.Code)
+	}
+
+	if proxied {
+		t.Error("Expected summary requests never to reach the backend")
+	}
+}
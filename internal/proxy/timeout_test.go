@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// unacceptingAddr returns the address of a socket that listens with a
+// minimal backlog and never accepts. Once the backlog is full, new
+// connection attempts hang instead of completing or being refused.
+func unacceptingAddr(t *testing.T) string {
+	t.Helper()
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("Socket failed: %v", err)
+	}
+	t.Cleanup(func() { syscall.Close(fd) })
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatalf("Getsockname failed: %v", err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(sa.(*syscall.SockaddrInet4).Port))
+
+	for i := 0; i < 8; i++ {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err != nil {
+			return addr
+		}
+		t.Cleanup(func() { conn.Close() })
+	}
+	t.Skip("Kernel keeps completing connections to a full backlog")
+	return ""
+}
+
+// proxyOnce sends one request through a handler for backendURL and returns
+// the status, the logged backend error and how long the request took.
+func proxyOnce(t *testing.T, backendURL string, proxyCfg config.ProxyConfig) (int, string, time.Duration) {
+	t.Helper()
+
+	core, logs := observer.New(zap.ErrorLevel)
+	b := balancer.NewSRR()
+	b.AddBackend(balancer.NewBackend(backendURL, 1))
+	h := NewHandler(b, nil, cache.NewCache(time.Minute), logger.FromZap(zap.New(core)), metrics.NewRegistry(), config.CacheConfig{}, proxyCfg)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	elapsed := time.Since(start)
+
+	entries := logs.FilterMessage("Backend request failed").All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected one backend failure log, got %d", len(entries))
+	}
+	errText, _ := entries[0].ContextMap()["error"].(string)
+	return rec.Code, errText, elapsed
+}
+
+func TestHandler_DialTimeout(t *testing.T) {
+	addr := unacceptingAddr(t)
+
+	code, errText, elapsed := proxyOnce(t, "http://"+addr, config.ProxyConfig{
+		DialTimeout:           100 * time.Millisecond,
+		ResponseHeaderTimeout: 5 * time.Second,
+		RequestTimeout:        5 * time.Second,
+	})
+
+	if code != http.StatusBadGateway {
+		t.Errorf("Expected 502, got %d", code)
+	}
+	if !strings.Contains(errText, "dial") || !strings.Contains(errText, "timeout") {
+		t.Errorf("Expected a dial timeout, got %q", errText)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("Expected the dial timeout to fail fast, took %v", elapsed)
+	}
+}
+
+func TestHandler_ResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	code, errText, elapsed := proxyOnce(t, backend.URL, config.ProxyConfig{
+		DialTimeout:           5 * time.Second,
+		ResponseHeaderTimeout: 100 * time.Millisecond,
+		RequestTimeout:        5 * time.Second,
+	})
+
+	if code != http.StatusBadGateway {
+		t.Errorf("Expected 502, got %d", code)
+	}
+	if !strings.Contains(errText, "timeout awaiting response headers") {
+		t.Errorf("Expected a response header timeout, got %q", errText)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("Expected the header timeout to apply, took %v", elapsed)
+	}
+}
+
+func TestHandler_RequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	_, errText, elapsed := proxyOnce(t, backend.URL, config.ProxyConfig{
+		DialTimeout:    5 * time.Second,
+		RequestTimeout: 100 * time.Millisecond,
+	})
+
+	if !strings.Contains(errText, "context deadline exceeded") {
+		t.Errorf("Expected the request deadline to be exceeded, got %q", errText)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("Expected the request timeout to apply, took %v", elapsed)
+	}
+}
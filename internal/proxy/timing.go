@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const timingKey contextKey = "timing"
+
+// requestTiming breaks a proxied request down into queue wait (arrival until
+// the backend request is sent), connect, time to first byte and body
+// transfer. The middleware creates it when logging.verbose_timing is set and
+// logs it on completion; the handler fills it in.
+type requestTiming struct {
+	mu           sync.Mutex
+	start        time.Time
+	sent         time.Time
+	connectStart time.Time
+	connect      time.Duration
+	firstByte    time.Time
+	done         time.Time
+}
+
+func contextWithTiming(ctx context.Context, timing *requestTiming) context.Context {
+	return context.WithValue(ctx, timingKey, timing)
+}
+
+func timingFromContext(ctx context.Context) *requestTiming {
+	timing, _ := ctx.Value(timingKey).(*requestTiming)
+	return timing
+}
+
+func (t *requestTiming) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			if !t.connectStart.IsZero() {
+				t.connect = time.Since(t.connectStart)
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mu.Lock()
+			if t.connect == 0 && !t.connectStart.IsZero() {
+				t.connect = time.Since(t.connectStart)
+			}
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.firstByte = time.Now()
+			t.mu.Unlock()
+		},
+	}
+}
+
+func (t *requestTiming) markSent() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.sent = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *requestTiming) markDone() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.done = time.Now()
+	t.mu.Unlock()
+}
+
+// fields returns the phases that were reached; a request answered from cache
+// or rejected before reaching a backend has none.
+func (t *requestTiming) fields() []zap.Field {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sent.IsZero() {
+		return nil
+	}
+
+	fields := []zap.Field{
+		zap.Duration("queue_wait", t.sent.Sub(t.start)),
+		zap.Duration("backend_connect", t.connect),
+	}
+	if !t.firstByte.IsZero() {
+		fields = append(fields, zap.Duration("ttfb", t.firstByte.Sub(t.sent)))
+		if !t.done.IsZero() {
+			fields = append(fields, zap.Duration("body_transfer", t.done.Sub(t.firstByte)))
+		}
+	}
+	return fields
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var timingFields = []string{"queue_wait", "backend_connect", "ttfb", "body_transfer"}
+
+func completionFields(t *testing.T, verbose bool) map[string]interface{} {
+	t.Helper()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	core, logs := observer.New(zap.InfoLevel)
+	handler, _ := newTestHandlerWithCache(backend.URL, config.CacheConfig{}, config.ProxyConfig{StreamThreshold: 1 << 20})
+	m := NewMiddleware(logger.FromZap(zap.New(core)), nil, nil, false, nil)
+	m.SetVerboseTiming(verbose)
+
+	serveFrom(m.Chain(handler), "192.168.1.1:5000", "/timed")
+
+	entries := logs.FilterMessage("Request completed").All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 completion log, got %d", len(entries))
+	}
+	return entries[0].ContextMap()
+}
+
+func TestMiddleware_VerboseTimingFields(t *testing.T) {
+	fields := completionFields(t, true)
+
+	for _, name := range timingFields {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("Expected %s in completion log, got %v", name, fields)
+		}
+	}
+	if ttfb, _ := fields["ttfb"].(time.Duration); ttfb < 5*time.Millisecond {
+		t.Errorf("Expected ttfb to include backend processing time, got %v", fields["ttfb"])
+	}
+}
+
+func TestMiddleware_TimingFieldsOffByDefault(t *testing.T) {
+	fields := completionFields(t, false)
+
+	for _, name := range timingFields {
+		if _, ok := fields[name]; ok {
+			t.Errorf("Expected no %s without verbose_timing", name)
+		}
+	}
+}
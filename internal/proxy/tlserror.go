@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"errors"
+	"time"
+)
+
+const metricBackendTLSErrors = "proxy_backend_tls_errors_total"
+
+const (
+	tlsErrorExpired          = "expired"
+	tlsErrorNotYetValid      = "not_yet_valid"
+	tlsErrorHostnameMismatch = "hostname_mismatch"
+	tlsErrorUnknownAuthority = "unknown_authority"
+	tlsErrorInvalid          = "invalid_certificate"
+)
+
+// classifyTLSError returns why a backend's certificate failed verification,
+// or "" when err is not a certificate verification error.
+func classifyTLSError(err error) string {
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		return tlsErrorHostnameMismatch
+	}
+	var authorityErr x509.UnknownAuthorityError
+	if errors.As(err, &authorityErr) {
+		return tlsErrorUnknownAuthority
+	}
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &invalidErr) {
+		if invalidErr.Reason == x509.Expired {
+			// Expired covers both sides of the validity window; tell them
+			// apart so a clock-skewed backend is not reported as expired.
+			if invalidErr.Cert != nil && invalidErr.Cert.NotBefore.After(time.Now()) {
+				return tlsErrorNotYetValid
+			}
+			return tlsErrorExpired
+		}
+		return tlsErrorInvalid
+	}
+	return ""
+}
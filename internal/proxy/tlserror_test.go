@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/cache"
+	"proxy-kp/pkg/logger"
+	"proxy-kp/pkg/metrics"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// tlsBackend starts a TLS backend serving a self-signed certificate built
+// from template and returns it with a pool that trusts the certificate.
+func tlsBackend(t *testing.T, template *x509.Certificate) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template.SerialNumber = big.NewInt(1)
+	template.Subject = pkix.Name{CommonName: "backend"}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	// Handshakes the proxy rejects are expected; keep them out of test output.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return server, roots
+}
+
+func TestHandler_ClassifiesBackendTLSErrors(t *testing.T) {
+	now := time.Now()
+	loopback := []net.IP{net.ParseIP("127.0.0.1")}
+
+	cases := []struct {
+		name     string
+		template *x509.Certificate
+		trusted  bool
+		want     string
+	}{
+		{
+			name:     "expired",
+			template: &x509.Certificate{NotBefore: now.Add(-48 * time.Hour), NotAfter: now.Add(-24 * time.Hour), IPAddresses: loopback},
+			trusted:  true,
+			want:     tlsErrorExpired,
+		},
+		{
+			name:     "hostname mismatch",
+			template: &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour), DNSNames: []string{"other.example"}},
+			trusted:  true,
+			want:     tlsErrorHostnameMismatch,
+		},
+		{
+			name:     "unknown authority",
+			template: &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour), IPAddresses: loopback},
+			want:     tlsErrorUnknownAuthority,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			backend, roots := tlsBackend(t, tc.template)
+			defer backend.Close()
+
+			core, logs := observer.New(zap.ErrorLevel)
+			b := balancer.NewSRR()
+			b.AddBackend(balancer.NewBackend(backend.URL, 1))
+			registry := metrics.NewRegistry()
+			h := NewHandler(b, nil, cache.NewCache(time.Minute), logger.FromZap(zap.New(core)), registry, config.CacheConfig{}, config.ProxyConfig{})
+			if tc.trusted {
+				h.client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: roots}
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != http.StatusBadGateway {
+				t.Errorf("Expected 502, got %d", rec.Code)
+			}
+			entries := logs.FilterMessage("Backend TLS certificate verification failed").All()
+			if len(entries) != 1 {
+				t.Fatalf("Expected one TLS verification log, got %d", len(entries))
+			}
+			if got := entries[0].ContextMap()["tls_error"]; got != tc.want {
+				t.Errorf("Expected tls_error %q, got %v", tc.want, got)
+			}
+			if v := registry.Counter(metricBackendTLSErrors, "backend", backend.URL, "reason", tc.want).Value(); v != 1 {
+				t.Errorf("Expected TLS error counter 1, got %d", v)
+			}
+		})
+	}
+}
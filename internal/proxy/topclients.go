@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"cmp"
+	"container/heap"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+const defaultTopClientsN = 10
+
+// clientCount is a tracked client's request count. Error is the count
+// inherited from the client it replaced, so the true count lies within
+// [Count-Error, Count].
+type clientCount struct {
+	IP    string `json:"ip"`
+	Count int64  `json:"count"`
+	Error int64  `json:"error"`
+	index int
+}
+
+// clientHeap is a min-heap of tracked clients by count.
+type clientHeap []*clientCount
+
+func (h clientHeap) Len() int           { return len(h) }
+func (h clientHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h clientHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *clientHeap) Push(x any) {
+	c := x.(*clientCount)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+func (h *clientHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// topClients counts requests per client IP with the space-saving algorithm:
+// at most capacity IPs are tracked, and an untracked IP replaces the least
+// active one, taking over its count. A nil *topClients records nothing.
+type topClients struct {
+	mu       sync.Mutex
+	capacity int
+	byIP     map[string]*clientCount
+	heap     clientHeap
+}
+
+func newTopClients(capacity int) *topClients {
+	return &topClients{
+		capacity: capacity,
+		byIP:     make(map[string]*clientCount, capacity),
+	}
+}
+
+func (t *topClients) record(ip string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c, ok := t.byIP[ip]; ok {
+		c.Count++
+		heap.Fix(&t.heap, c.index)
+		return
+	}
+	if len(t.heap) < t.capacity {
+		c := &clientCount{IP: ip, Count: 1}
+		t.byIP[ip] = c
+		heap.Push(&t.heap, c)
+		return
+	}
+
+	c := t.heap[0]
+	delete(t.byIP, c.IP)
+	c.IP = ip
+	c.Error = c.Count
+	c.Count++
+	t.byIP[ip] = c
+	heap.Fix(&t.heap, 0)
+}
+
+// top returns up to n tracked clients, busiest first.
+func (t *topClients) top(n int) []clientCount {
+	t.mu.Lock()
+	clients := make([]clientCount, len(t.heap))
+	for i, c := range t.heap {
+		clients[i] = *c
+	}
+	t.mu.Unlock()
+
+	slices.SortFunc(clients, func(a, b clientCount) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	if len(clients) > n {
+		clients = clients[:n]
+	}
+	return clients
+}
+
+// handleTopClients reports the busiest client IPs, at most the n query
+// parameter (default 10) of them.
+func (s *Server) handleTopClients(w http.ResponseWriter, r *http.Request) {
+	if s.topClients == nil {
+		http.Error(w, "top clients tracking is disabled", http.StatusNotFound)
+		return
+	}
+
+	n := defaultTopClientsN
+	if v := r.URL.Query().Get("n"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		n = parsed
+	}
+
+	writeJSON(w, http.StatusOK, s.topClients.top(n))
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestAdmin_TopClientsReportsHeaviestIP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Admin.TopClients.Enabled = true
+	// Fewer slots than clients, so light clients are evicted and replaced.
+	cfg.Admin.TopClients.Capacity = 4
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	public := s.publicHandler()
+
+	send := func(ip string, n int) {
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = ip + ":1234"
+			public.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+	send("10.0.0.1", 50)
+	for i := 2; i < 20; i++ {
+		send(fmt.Sprintf("10.0.0.%d", i), 2)
+	}
+	send("10.0.0.99", 20)
+
+	rec := httptest.NewRecorder()
+	s.adminMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/top-clients?n=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var top []clientCount
+	if err := json.NewDecoder(rec.Body).Decode(&top); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(top) != 2 {
+		t.Fatalf("Expected 2 clients, got %d", len(top))
+	}
+	if top[0].IP != "10.0.0.1" || top[0].Count != 50 {
+		t.Errorf("Expected 10.0.0.1 with 50 requests first, got %+v", top[0])
+	}
+	if top[1].IP != "10.0.0.99" {
+		t.Errorf("Expected 10.0.0.99 second, got %+v", top[1])
+	}
+	if tracked := len(s.topClients.byIP); tracked > 4 {
+		t.Errorf("Expected at most 4 tracked clients, got %d", tracked)
+	}
+}
+
+func TestAdmin_TopClientsDisabled(t *testing.T) {
+	s, err := NewServer(testConfig("http://localhost:8001"), logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.adminMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/top-clients", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with tracking disabled, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"proxy-kp/pkg/cache"
+)
+
+// parseVary returns the canonical, sorted request header names listed in
+// h's Vary header that a cached variant must match. It reports false for
+// "Vary: *", which no request can be matched against, so such responses are
+// not cached.
+//
+// Accept-Encoding is left out: cacheable requests reach the backend without
+// the client's value (see newProxyRequest), so the cached identity body
+// suits every client.
+func parseVary(h http.Header) ([]string, bool) {
+	var names []string
+	for _, value := range h.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" && name != "Accept-Encoding" {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), true
+}
+
+// variantKey extends the base cache key with r's values of the vary
+// headers, so each variant of a response is cached separately.
+func variantKey(base string, r *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range vary {
+		b.WriteString("|")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// lookupCache finds the cached response for r with lookup. A response that
+// varies is cached in two parts: a marker entry under the base key, which
+// records the headers it varies on, and the response under the variant
+// key for those headers. It returns the key the response was found under.
+func lookupCache(r *http.Request, lookup func(key string) (*cache.Entry, bool)) (*cache.Entry, string, bool) {
+	key := getCacheKey(r)
+	entry, found := lookup(key)
+	if !found || len(entry.Vary) == 0 {
+		return entry, key, found
+	}
+
+	key = variantKey(key, r, entry.Vary)
+	entry, found = lookup(key)
+	return entry, key, found
+}
+
+// varyMarker is the entry stored under a varying response's base key.
+func varyMarker(variant *cache.Entry, base string) *cache.Entry {
+	return &cache.Entry{
+		Key:        base,
+		StatusCode: variant.StatusCode,
+		Vary:       variant.Vary,
+		CreatedAt:  variant.CreatedAt,
+		ExpiresAt:  variant.ExpiresAt,
+	}
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestParseVary(t *testing.T) {
+	tests := []struct {
+		vary   []string
+		want   []string
+		wantOK bool
+	}{
+		{nil, nil, true},
+		{[]string{"Accept-Encoding"}, nil, true},
+		{[]string{"accept-language, Accept-Encoding", "X-Tenant", "ACCEPT-LANGUAGE"}, []string{"Accept-Language", "X-Tenant"}, true},
+		{[]string{"Accept-Language, *"}, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseVary(http.Header{"Vary": tt.vary})
+		if ok != tt.wantOK || !slices.Equal(got, tt.want) {
+			t.Errorf("parseVary(%q): expected (%v, %v), got (%v, %v)", tt.vary, tt.want, tt.wantOK, got, ok)
+		}
+	}
+}
+
+// varyServer proxies to a backend that answers in the request's
+// Accept-Language and counts its hits.
+func varyServer(t *testing.T, vary string) (public http.Handler, hits *atomic.Int32) {
+	t.Helper()
+	hits = new(atomic.Int32)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Vary", vary)
+		lang := r.Header.Get("Accept-Language")
+		if lang == "" {
+			lang = "en"
+		}
+		w.Write([]byte(lang))
+	}))
+	t.Cleanup(backend.Close)
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Cache.Enabled = true
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	return s.publicHandler(), hits
+}
+
+func sendWithHeader(h http.Handler, name, value string) string {
+	req := httptest.NewRequest(http.MethodGet, "/page", nil)
+	if value != "" {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Body.String()
+}
+
+func TestServer_CachesVariantsPerVaryHeader(t *testing.T) {
+	public, hits := varyServer(t, "Accept-Encoding, Accept-Language")
+
+	steps := []struct {
+		lang     string
+		wantBody string
+		wantHits int32
+	}{
+		{"de", "de", 1},
+		{"de", "de", 1},
+		{"fr", "fr", 2},
+		{"de", "de", 2},
+		{"", "en", 3},
+		{"fr", "fr", 3},
+	}
+	for i, step := range steps {
+		if body := sendWithHeader(public, "Accept-Language", step.lang); body != step.wantBody {
+			t.Errorf("Step %d: expected %q for Accept-Language %q, got %q", i+1, step.wantBody, step.lang, body)
+		}
+		if got := hits.Load(); got != step.wantHits {
+			t.Errorf("Step %d: expected %d backend hits, got %d", i+1, step.wantHits, got)
+		}
+	}
+}
+
+func TestServer_VaryAcceptEncodingSharesIdentityEntry(t *testing.T) {
+	public, hits := varyServer(t, "Accept-Encoding")
+
+	for _, encoding := range []string{"gzip", "br", "", "gzip"} {
+		if body := sendWithHeader(public, "Accept-Encoding", encoding); body != "en" {
+			t.Errorf("Expected the identity body for Accept-Encoding %q, got %q", encoding, body)
+		}
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("Expected one backend hit shared by all encodings, got %d", got)
+	}
+}
+
+func TestServer_VaryStarNotCached(t *testing.T) {
+	public, hits := varyServer(t, "*")
+
+	for i := 0; i < 2; i++ {
+		sendWithHeader(public, "Accept-Language", "de")
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("Expected every Vary: * request to reach the backend, got %d hits", got)
+	}
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// defaultWarmInterval is how often the warm pool is topped up. It is well
+// under the transport's default idle timeout, so warmed connections are reused
+// before the proxy itself would drop them.
+const defaultWarmInterval = 15 * time.Second
+
+// connWarmer keeps at least minIdle keep-alive connections per available
+// backend in the handler's transport pool by periodically sending GET
+// requests for path.
+type connWarmer struct {
+	handler  *Handler
+	minIdle  int
+	path     string
+	interval time.Duration
+	logger   *logger.Logger
+	warmed   atomic.Bool
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newConnWarmer(h *Handler, minIdle int, path string, log *logger.Logger) *connWarmer {
+	return &connWarmer{
+		handler:  h,
+		minIdle:  minIdle,
+		path:     path,
+		interval: defaultWarmInterval,
+		logger:   log,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+func (w *connWarmer) Start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			w.warm()
+			w.warmed.Store(true)
+			select {
+			case <-w.stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Warmed reports whether the first pass over the backends has completed.
+func (w *connWarmer) Warmed() bool {
+	return w.warmed.Load()
+}
+
+func (w *connWarmer) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+	})
+	w.wg.Wait()
+}
+
+// warm tops up every available backend across all pools.
+func (w *connWarmer) warm() {
+	pools := []balancer.Balancer{w.handler.balancer}
+	for _, pool := range w.handler.upstreams {
+		pools = append(pools, pool)
+	}
+
+	var wg sync.WaitGroup
+	for _, pool := range pools {
+		for _, backend := range pool.GetBackends() {
+			if !backend.IsAvailable() {
+				continue
+			}
+			wg.Add(1)
+			go func(url string) {
+				defer wg.Done()
+				w.warmBackend(url)
+			}(backend.URL)
+		}
+	}
+	wg.Wait()
+}
+
+// warmBackend sends minIdle requests to backendURL and keeps every response
+// open until all have arrived, so each holds its own connection. Idle
+// connections already in the pool are reused and only the shortfall is
+// dialed; closing the bodies returns them all to the pool.
+func (w *connWarmer) warmBackend(backendURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		resps []*http.Response
+	)
+	for i := 0; i < w.minIdle; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, backendURL+w.path, nil)
+			if err != nil {
+				return
+			}
+			resp, err := w.handler.client.Do(req)
+			if err != nil {
+				w.logger.Debug("Failed to warm backend connection",
+					zap.String("backend", backendURL),
+					zap.Error(err))
+				return
+			}
+			mu.Lock()
+			resps = append(resps, resp)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, resp := range resps {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestConnWarmer_KeepsIdleConnections(t *testing.T) {
+	var open atomic.Int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			open.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			open.Add(-1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	cfg := testConfig(backend.URL)
+	cfg.RateLimit.Enabled = false
+	cfg.Proxy.MinIdleConnsPerBackend = 4
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	s.warmer.interval = 20 * time.Millisecond
+	s.warmer.Start()
+	defer s.warmer.Stop()
+
+	waitForConns := func(stage string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for open.Load() < 4 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: expected at least 4 warm connections, got %d", stage, open.Load())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	waitForConns("startup")
+
+	// Several warm rounds pass without traffic; they reuse the warm
+	// connections rather than dialing more.
+	time.Sleep(100 * time.Millisecond)
+	if n := open.Load(); n != 4 {
+		t.Errorf("Expected 4 connections while idle, got %d", n)
+	}
+
+	// The backend dropping its idle connections is re-dialed.
+	backend.CloseClientConnections()
+	waitForConns("after backend closed idle connections")
+}
@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/balancer"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// isWebSocketUpgrade reports whether r asks to switch the connection to the
+// WebSocket protocol.
+func isWebSocketUpgrade(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetWebSocket sets the limits applied to proxied WebSocket connections.
+func (h *Handler) SetWebSocket(cfg config.WebSocketConfig) {
+	h.websocket = cfg
+}
+
+// serveWebSocket sends the upgrade request to the backend and, once the
+// backend switches protocols, hijacks the client connection and copies
+// bytes in both directions until either side closes or a limit is hit.
+func (h *Handler) serveWebSocket(w http.ResponseWriter, r *http.Request, proxyReq *http.Request, backend *balancer.Backend, log *logger.Logger) {
+	// The client's timeout would cut the tunnel short, so the transport is
+	// used directly; the upgraded body is a read-write connection.
+	resp, err := h.client.Transport.RoundTrip(proxyReq)
+	if err != nil {
+		class := classifyError(err)
+		h.countBackendError(backend, class)
+		log.Error("WebSocket upgrade request failed",
+			zap.String("path", r.URL.Path),
+			zap.String("error_class", class),
+			zap.Error(err))
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		removeHopHeaders(resp.Header)
+		copyHeader(w.Header(), resp.Header)
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	backendConn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		log.Error("Backend switched protocols without a writable connection",
+			zap.String("path", r.URL.Path))
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer backendConn.Close()
+
+	clientConn, clientBuf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		log.Error("Failed to hijack client connection for WebSocket",
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer clientConn.Close()
+
+	// Hijacked connections keep the server's read and write deadlines.
+	clientConn.SetDeadline(time.Time{})
+
+	fmt.Fprintf(clientBuf, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(clientBuf)
+	clientBuf.WriteString("\r\n")
+	if err := clientBuf.Flush(); err != nil {
+		log.Debug("Client went away before the WebSocket upgrade completed",
+			zap.String("path", r.URL.Path))
+		return
+	}
+
+	start := time.Now()
+	reason := h.tunnel(clientConn, clientBuf.Reader, backendConn)
+	log.Info("WebSocket connection closed",
+		zap.String("path", r.URL.Path),
+		zap.String("reason", reason),
+		zap.Duration("duration", time.Since(start)))
+}
+
+const (
+	wsClosedByPeer     = "closed"
+	wsIdleTimeout      = "idle timeout"
+	wsMaxDuration      = "max connection duration"
+	wsMessageTooLarge  = "message too large"
+	wsCopyBufferLength = 32 << 10
+)
+
+// tunnel copies between the client and backend connections, enforcing the
+// configured WebSocket limits, and returns why the tunnel ended. Both
+// connections are closed on return.
+func (h *Handler) tunnel(client net.Conn, clientReader *bufio.Reader, backend io.ReadWriteCloser) string {
+	cfg := h.websocket
+
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+
+	closeBoth := sync.OnceFunc(func() {
+		client.Close()
+		backend.Close()
+	})
+	defer closeBoth()
+
+	done := make(chan string, 2)
+	pipe := func(dst io.Writer, src io.Reader) {
+		limiter := &frameLimiter{max: cfg.MaxMessageSize}
+		buf := make([]byte, wsCopyBufferLength)
+		for {
+			n, err := src.Read(buf)
+			if n > 0 {
+				lastActive.Store(time.Now().UnixNano())
+				if cfg.MaxMessageSize > 0 {
+					if limitErr := limiter.scan(buf[:n]); limitErr != nil {
+						done <- wsMessageTooLarge
+						return
+					}
+				}
+				if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+					done <- wsClosedByPeer
+					return
+				}
+			}
+			if err != nil {
+				done <- wsClosedByPeer
+				return
+			}
+		}
+	}
+	go pipe(backend, clientReader)
+	go pipe(client, backend)
+
+	var idle, expired <-chan time.Time
+	var idleTimer *time.Timer
+	if cfg.IdleTimeout > 0 {
+		idleTimer = time.NewTimer(cfg.IdleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+	if cfg.MaxConnectionDuration > 0 {
+		expiry := time.NewTimer(cfg.MaxConnectionDuration)
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+
+	for {
+		select {
+		case reason := <-done:
+			return reason
+		case <-expired:
+			return wsMaxDuration
+		case <-idle:
+			quiet := time.Since(time.Unix(0, lastActive.Load()))
+			if quiet >= cfg.IdleTimeout {
+				return wsIdleTimeout
+			}
+			idleTimer.Reset(cfg.IdleTimeout - quiet)
+		}
+	}
+}
+
+var errMessageTooLarge = errors.New("websocket message exceeds size limit")
+
+// frameLimiter follows WebSocket frame boundaries in one direction of a
+// byte stream and fails once a data message's payload exceeds max bytes.
+// Control frames are not part of a message and are not counted.
+type frameLimiter struct {
+	max int64
+
+	header    []byte
+	remaining uint64
+	message   uint64
+}
+
+func (f *frameLimiter) scan(p []byte) error {
+	for len(p) > 0 {
+		if f.remaining > 0 {
+			n := uint64(len(p))
+			if n > f.remaining {
+				n = f.remaining
+			}
+			f.remaining -= n
+			p = p[n:]
+			continue
+		}
+
+		f.header = append(f.header, p[0])
+		p = p[1:]
+		size := frameHeaderSize(f.header)
+		if size == 0 || len(f.header) < size {
+			continue
+		}
+
+		payload := framePayloadLength(f.header)
+		if opcode := f.header[0] & 0x0f; opcode < 0x8 {
+			if payload > uint64(f.max) || f.message+payload > uint64(f.max) {
+				return errMessageTooLarge
+			}
+			f.message += payload
+			if f.header[0]&0x80 != 0 {
+				f.message = 0
+			}
+		}
+		f.header = f.header[:0]
+		f.remaining = payload
+	}
+	return nil
+}
+
+// frameHeaderSize returns the full length of the frame header starting with
+// header, or 0 when too few bytes are known to tell.
+func frameHeaderSize(header []byte) int {
+	if len(header) < 2 {
+		return 0
+	}
+	size := 2
+	switch header[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if header[1]&0x80 != 0 {
+		size += 4
+	}
+	return size
+}
+
+func framePayloadLength(header []byte) uint64 {
+	switch length := header[1] & 0x7f; length {
+	case 126:
+		return uint64(binary.BigEndian.Uint16(header[2:4]))
+	case 127:
+		return binary.BigEndian.Uint64(header[2:10])
+	default:
+		return uint64(length)
+	}
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"proxy-kp/internal/config"
+	"proxy-kp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// echoWebSocketBackend completes the upgrade handshake and echoes every byte
+// it receives back to the client.
+func echoWebSocketBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWebSocketUpgrade(r) {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Backend hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+		io.Copy(conn, buf)
+	}))
+}
+
+// dialWebSocket upgrades a raw connection through the proxy at addr.
+func dialWebSocket(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: " + addr + "\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		conn.Close()
+		t.Fatalf("Failed to read upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		t.Fatalf("Expected 101, got %d", resp.StatusCode)
+	}
+	return conn, reader
+}
+
+func newWebSocketProxy(t *testing.T, backendURL string, ws config.WebSocketConfig) *httptest.Server {
+	t.Helper()
+
+	cfg := testConfig(backendURL)
+	cfg.RateLimit.Enabled = false
+	cfg.WebSocket = ws
+
+	s, err := NewServer(cfg, logger.FromZap(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	return httptest.NewServer(s.publicHandler())
+}
+
+// waitClosed reports whether the proxy closes conn within timeout.
+func waitClosed(conn net.Conn, reader *bufio.Reader, timeout time.Duration) bool {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err := io.ReadAll(reader)
+	return err == nil
+}
+
+func TestWebSocket_IdleConnectionClosed(t *testing.T) {
+	backend := echoWebSocketBackend(t)
+	defer backend.Close()
+	proxy := newWebSocketProxy(t, backend.URL, config.WebSocketConfig{IdleTimeout: 100 * time.Millisecond})
+	defer proxy.Close()
+
+	conn, reader := dialWebSocket(t, proxy.Listener.Addr().String())
+	defer conn.Close()
+
+	// Traffic within the idle timeout keeps the tunnel open.
+	for i := 0; i < 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		conn.Write([]byte("ping"))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		echo := make([]byte, 4)
+		if _, err := io.ReadFull(reader, echo); err != nil || string(echo) != "ping" {
+			t.Fatalf("Expected echo while active, got %q: %v", echo, err)
+		}
+	}
+
+	start := time.Now()
+	if !waitClosed(conn, reader, 2*time.Second) {
+		t.Fatal("Expected idle connection to be closed by the proxy")
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Connection closed after %v, before the idle timeout", elapsed)
+	}
+}
+
+func TestWebSocket_MaxConnectionDuration(t *testing.T) {
+	backend := echoWebSocketBackend(t)
+	defer backend.Close()
+	proxy := newWebSocketProxy(t, backend.URL, config.WebSocketConfig{
+		IdleTimeout:           time.Minute,
+		MaxConnectionDuration: 100 * time.Millisecond,
+	})
+	defer proxy.Close()
+
+	conn, reader := dialWebSocket(t, proxy.Listener.Addr().String())
+	defer conn.Close()
+
+	if !waitClosed(conn, reader, 2*time.Second) {
+		t.Fatal("Expected connection to be closed after max_connection_duration")
+	}
+}
+
+func TestWebSocket_MessageTooLargeClosed(t *testing.T) {
+	backend := echoWebSocketBackend(t)
+	defer backend.Close()
+	proxy := newWebSocketProxy(t, backend.URL, config.WebSocketConfig{
+		IdleTimeout:    time.Minute,
+		MaxMessageSize: 16,
+	})
+	defer proxy.Close()
+
+	conn, reader := dialWebSocket(t, proxy.Listener.Addr().String())
+	defer conn.Close()
+
+	// A masked 8-byte text frame is within the limit and is echoed.
+	small := append([]byte{0x81, 0x88, 0, 0, 0, 0}, "12345678"...)
+	conn.Write(small)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	echo := make([]byte, len(small))
+	if _, err := io.ReadFull(reader, echo); err != nil {
+		t.Fatalf("Expected small frame to be relayed: %v", err)
+	}
+
+	// A fragmented message whose frames total 20 bytes exceeds the limit.
+	conn.Write(append([]byte{0x01, 0x8a, 0, 0, 0, 0}, strings.Repeat("a", 10)...))
+	conn.Write(append([]byte{0x80, 0x8a, 0, 0, 0, 0}, strings.Repeat("b", 10)...))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	relayed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Expected oversized message to close the connection: %v", err)
+	}
+	if len(relayed) > 16 {
+		t.Errorf("Expected the oversized frame not to be relayed, got %d bytes", len(relayed))
+	}
+}
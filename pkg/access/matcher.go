@@ -0,0 +1,95 @@
+package access
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Matcher tests client IPs against a list of single addresses and CIDR
+// ranges parsed once at construction.
+type Matcher struct {
+	prefixes []netip.Prefix
+}
+
+func NewMatcher(entries []string) (*Matcher, error) {
+	m := &Matcher{prefixes: make([]netip.Prefix, 0, len(entries))}
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+			}
+			m.prefixes = append(m.prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		m.prefixes = append(m.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return m, nil
+}
+
+func (m *Matcher) Contains(ip string) bool {
+	if m == nil || len(m.prefixes) == 0 {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range m.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.prefixes)
+}
+
+// Policy combines allow and deny lists. Deny entries always win; when the
+// allow list is non-empty only matching IPs are admitted.
+type Policy struct {
+	allow *Matcher
+	deny  *Matcher
+}
+
+func NewPolicy(allow, deny []string) (*Policy, error) {
+	allowMatcher, err := NewMatcher(allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow list: %w", err)
+	}
+
+	denyMatcher, err := NewMatcher(deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny list: %w", err)
+	}
+
+	return &Policy{allow: allowMatcher, deny: denyMatcher}, nil
+}
+
+func (p *Policy) Allowed(ip string) bool {
+	if p.deny.Contains(ip) {
+		return false
+	}
+	if p.allow.Len() == 0 {
+		return true
+	}
+	return p.allow.Contains(ip)
+}
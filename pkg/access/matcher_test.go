@@ -0,0 +1,67 @@
+package access
+
+import (
+	"testing"
+)
+
+func TestMatcher_SingleIPAndCIDR(t *testing.T) {
+	m, err := NewMatcher([]string{"192.168.1.10", "10.0.0.0/24"})
+	if err != nil {
+		t.Fatalf("NewMatcher failed: %v", err)
+	}
+
+	cases := map[string]bool{
+		"192.168.1.10": true,
+		"192.168.1.11": false,
+		"10.0.0.1":     true,
+		"10.0.0.255":   true,
+		"10.0.1.1":     false,
+		"not-an-ip":    false,
+	}
+
+	for ip, expected := range cases {
+		if got := m.Contains(ip); got != expected {
+			t.Errorf("Contains(%s): expected %v, got %v", ip, expected, got)
+		}
+	}
+}
+
+func TestMatcher_InvalidEntry(t *testing.T) {
+	if _, err := NewMatcher([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+	if _, err := NewMatcher([]string{"999.1.1.1"}); err == nil {
+		t.Error("Expected error for invalid IP")
+	}
+}
+
+func TestPolicy_Allowed(t *testing.T) {
+	p, err := NewPolicy([]string{"10.0.0.0/8"}, []string{"10.0.0.5"})
+	if err != nil {
+		t.Fatalf("NewPolicy failed: %v", err)
+	}
+
+	if !p.Allowed("10.1.2.3") {
+		t.Error("Expected allowed IP to pass")
+	}
+	if p.Allowed("10.0.0.5") {
+		t.Error("Expected denied IP to be rejected")
+	}
+	if p.Allowed("192.168.1.1") {
+		t.Error("Expected IP outside allow list to be rejected")
+	}
+}
+
+func TestPolicy_EmptyAllowAdmitsAll(t *testing.T) {
+	p, err := NewPolicy(nil, []string{"192.168.0.0/16"})
+	if err != nil {
+		t.Fatalf("NewPolicy failed: %v", err)
+	}
+
+	if !p.Allowed("8.8.8.8") {
+		t.Error("Expected IP to be allowed with empty allow list")
+	}
+	if p.Allowed("192.168.5.5") {
+		t.Error("Expected denied range to be rejected")
+	}
+}
@@ -2,6 +2,10 @@ package balancer
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"proxy-kp/pkg/circuit"
 )
 
 type Backend struct {
@@ -9,7 +13,17 @@ type Backend struct {
 	Weight        int
 	CurrentWeight int
 	Healthy       bool
+	breaker       *circuit.Breaker
+	headers       map[string]string
+	priority      int
+	selections    atomic.Int64
+	active        atomic.Int64
 	mu            sync.RWMutex
+	latency       latencyWindow
+	latencyMu     sync.Mutex
+	draining      bool
+	drainStart    time.Time
+	drainFor      time.Duration
 }
 
 func NewBackend(url string, weight int) *Backend {
@@ -32,3 +46,73 @@ func (b *Backend) IsHealthy() bool {
 	defer b.mu.RUnlock()
 	return b.Healthy
 }
+
+func (b *Backend) SetBreaker(breaker *circuit.Breaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.breaker = breaker
+}
+
+func (b *Backend) Breaker() *circuit.Breaker {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.breaker
+}
+
+// SetRequestHeaders sets headers added to every request proxied to this
+// backend.
+func (b *Backend) SetRequestHeaders(headers map[string]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.headers = headers
+}
+
+func (b *Backend) RequestHeaders() map[string]string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.headers
+}
+
+// SetPriority sets the backend's priority tier: 0 for primaries, higher for
+// standby tiers.
+func (b *Backend) SetPriority(priority int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.priority = priority
+}
+
+func (b *Backend) Priority() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.priority
+}
+
+// Selections returns how many times NextBackend has picked this backend since
+// the last reset.
+func (b *Backend) Selections() int64 {
+	return b.selections.Load()
+}
+
+// ActiveRequests returns how many requests handed this backend by
+// NextBackend have not been released yet.
+func (b *Backend) ActiveRequests() int64 {
+	return b.active.Load()
+}
+
+// IsAvailable reports whether the backend is healthy and its circuit, if any,
+// allows traffic.
+func (b *Backend) IsAvailable() bool {
+	if !b.IsHealthy() {
+		return false
+	}
+
+	breaker := b.Breaker()
+	return breaker == nil || breaker.Ready()
+}
+
+// TryProbe claims the backend's circuit for a request about to be sent to it.
+// It returns false when another request holds the circuit's half-open probe.
+func (b *Backend) TryProbe() bool {
+	breaker := b.Breaker()
+	return breaker == nil || breaker.TryProbe()
+}
@@ -0,0 +1,34 @@
+package balancer
+
+// Balancer picks a backend from a pool for each request. Every backend
+// returned by NextBackend must be passed to Release once the request is done,
+// error or not. The proxy handler, server and health checker accept any
+// implementation, so new strategies and test doubles plug in without changes
+// there.
+type Balancer interface {
+	NextBackend() (*Backend, error)
+	// Acquire counts a request to a backend picked outside NextBackend,
+	// such as one pinned by session affinity. It is released the same way.
+	Acquire(backend *Backend)
+	Release(backend *Backend)
+	AddBackend(backend *Backend)
+	RemoveBackend(url string) bool
+	GetBackends() []*Backend
+	SetHealthy(url string, healthy bool) bool
+	SetWeight(url string, weight int) bool
+	HealthyCount() int
+	ResetSelections() map[string]int64
+}
+
+// KeyedBalancer is a Balancer that can pick a backend for a request key, such
+// as the client IP, so the same key keeps landing on the same backend.
+type KeyedBalancer interface {
+	Balancer
+	NextBackendFor(key string) (*Backend, error)
+}
+
+var (
+	_ Balancer      = (*SRR)(nil)
+	_ Balancer      = (*LeastConn)(nil)
+	_ KeyedBalancer = (*IPHash)(nil)
+)
@@ -0,0 +1,103 @@
+package balancer
+
+import "time"
+
+// weightScale multiplies configured weights inside NextBackend so that a
+// draining backend's weight can decline in fine steps. Smooth weighted
+// round-robin is scale-invariant, so pools without draining backends pick the
+// same sequence as with unscaled weights.
+const weightScale = 1000
+
+// DrainBackendOver linearly lowers the backend's effective weight from its
+// configured weight to zero over d, after which it receives no traffic and
+// reports Drained. A non-positive d drains the backend immediately.
+func (p *pool) DrainBackendOver(url string, d time.Duration) bool {
+	return p.drainBackendOver(url, d, time.Now())
+}
+
+func (p *pool) drainBackendOver(url string, d time.Duration, start time.Time) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, b := range p.backends {
+		if b.URL == url {
+			b.startDrain(start, d)
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Backend) startDrain(start time.Time, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.draining = true
+	b.drainStart = start
+	b.drainFor = d
+}
+
+// drainFactor returns the fraction of its configured weight the backend still
+// carries at now: 1 when not draining, 0 once fully drained.
+func (b *Backend) drainFactor(now time.Time) float64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.draining {
+		return 1
+	}
+	elapsed := now.Sub(b.drainStart)
+	if b.drainFor <= 0 || elapsed >= b.drainFor {
+		return 0
+	}
+	if elapsed < 0 {
+		return 1
+	}
+	return 1 - float64(elapsed)/float64(b.drainFor)
+}
+
+// effectiveWeight is the backend's weight in weightScale units at now.
+func (b *Backend) effectiveWeight(now time.Time) int {
+	return int(float64(b.Weight*weightScale) * b.drainFactor(now))
+}
+
+// selectionWeights returns the available backends that may be picked at now
+// with their effective weights. When every available backend's weight is
+// zero, e.g. all were set to weight 0 or their drain has nearly finished,
+// those not yet fully drained share traffic at equal weight rather than the
+// pool reporting no healthy backends.
+func selectionWeights(backends []*Backend, now time.Time) ([]*Backend, []int) {
+	candidates := make([]*Backend, 0, len(backends))
+	weights := make([]int, 0, len(backends))
+	for _, b := range backends {
+		if !b.IsAvailable() {
+			continue
+		}
+		if weight := b.effectiveWeight(now); weight > 0 {
+			candidates = append(candidates, b)
+			weights = append(weights, weight)
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates, weights
+	}
+
+	for _, b := range backends {
+		if b.IsAvailable() && b.drainFactor(now) > 0 {
+			candidates = append(candidates, b)
+			weights = append(weights, 1)
+		}
+	}
+	return candidates, weights
+}
+
+// Draining reports whether DrainBackendOver has been called for the backend.
+func (b *Backend) Draining() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.draining
+}
+
+// Drained reports whether the backend's drain window has elapsed.
+func (b *Backend) Drained() bool {
+	return b.drainFactor(time.Now()) == 0
+}
@@ -0,0 +1,120 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSRR_DrainBackendOverDeclinesTraffic(t *testing.T) {
+	srr := NewSRR()
+	srr.AddBackend(NewBackend("http://stay", 1))
+	srr.AddBackend(NewBackend("http://drain", 1))
+
+	start := time.Now()
+	if !srr.drainBackendOver("http://drain", 10*time.Second, start) {
+		t.Fatal("Expected drain to find the backend")
+	}
+	if srr.drainBackendOver("http://missing", time.Second, start) {
+		t.Error("Expected unknown backend to report false")
+	}
+
+	share := func(at time.Duration) int {
+		count := 0
+		for i := 0; i < 100; i++ {
+			b, err := srr.nextBackend(start.Add(at))
+			if err != nil {
+				t.Fatalf("nextBackend failed: %v", err)
+			}
+			if b.URL == "http://drain" {
+				count++
+			}
+		}
+		return count
+	}
+
+	prev := share(0)
+	if prev != 50 {
+		t.Errorf("Expected an even split at drain start, got %d/100", prev)
+	}
+	for _, at := range []time.Duration{time.Second, 5 * time.Second, 9 * time.Second} {
+		got := share(at)
+		if got >= prev {
+			t.Errorf("At %v: expected draining share below %d, got %d", at, prev, got)
+		}
+		prev = got
+	}
+	if got := share(10 * time.Second); got != 0 {
+		t.Errorf("Expected no traffic after the drain window, got %d", got)
+	}
+
+	var drain *Backend
+	for _, b := range srr.GetBackends() {
+		if b.URL == "http://drain" {
+			drain = b
+		}
+	}
+	if !drain.Draining() {
+		t.Error("Expected backend to report draining")
+	}
+	if drain.drainFactor(start.Add(10*time.Second)) != 0 {
+		t.Error("Expected backend to be fully drained at the end of the window")
+	}
+}
+
+func TestSRR_DrainBackendOverZeroIsImmediate(t *testing.T) {
+	srr := NewSRR()
+	srr.AddBackend(NewBackend("http://only", 1))
+
+	srr.DrainBackendOver("http://only", 0)
+
+	if _, err := srr.NextBackend(); err != ErrNoHealthyBackends {
+		t.Errorf("Expected ErrNoHealthyBackends after immediate drain, got %v", err)
+	}
+	if !srr.GetBackends()[0].Drained() {
+		t.Error("Expected backend to report drained")
+	}
+}
+
+func TestNextBackend_AllZeroEffectiveWeightsFallBackToEqual(t *testing.T) {
+	for name, b := range map[string]Balancer{"srr": NewSRR(), "least_conn": NewLeastConn(), "ip_hash": NewIPHash()} {
+		t.Run(name, func(t *testing.T) {
+			b.AddBackend(NewBackend("http://a", 1))
+			b.AddBackend(NewBackend("http://b", 1))
+			b.SetWeight("http://a", 0)
+			b.SetWeight("http://b", 0)
+
+			// Selections are held so least_conn spreads them too.
+			seen := make(map[string]int)
+			for i := 0; i < 10; i++ {
+				backend, err := b.NextBackend()
+				if err != nil {
+					t.Fatalf("Expected a backend despite zero weights, got %v", err)
+				}
+				seen[backend.URL]++
+			}
+			if name != "ip_hash" && (seen["http://a"] == 0 || seen["http://b"] == 0) {
+				t.Errorf("Expected traffic shared equally, got %v", seen)
+			}
+		})
+	}
+}
+
+func TestSRR_NearlyDrainedBackendsStillSelected(t *testing.T) {
+	srr := NewSRR()
+	srr.AddBackend(NewBackend("http://a", 1))
+	srr.AddBackend(NewBackend("http://b", 1))
+
+	// A millisecond before the end of an hour-long drain both weights round
+	// down to zero, yet neither backend is drained yet.
+	start := time.Now()
+	srr.drainBackendOver("http://a", time.Hour, start)
+	srr.drainBackendOver("http://b", time.Hour, start)
+	now := start.Add(time.Hour - time.Millisecond)
+
+	if _, err := srr.nextBackend(now); err != nil {
+		t.Errorf("Expected a backend before the drain finishes, got %v", err)
+	}
+	if _, err := srr.nextBackend(start.Add(time.Hour)); err != ErrNoHealthyBackends {
+		t.Errorf("Expected ErrNoHealthyBackends once fully drained, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package balancer
+
+import (
+	"cmp"
+	"hash/crc32"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ringReplicas is how many points each backend gets on the hash ring. More
+// points spread keys more evenly between backends.
+const ringReplicas = 160
+
+type ringPoint struct {
+	hash    uint32
+	backend *Backend
+}
+
+// IPHash maps keys onto a consistent hash ring of backends, so adding or
+// removing one backend only remaps the keys that hashed next to it. When the
+// backend a key maps to is unavailable, the next one along the ring is used.
+// Weights are not taken into account.
+type IPHash struct {
+	pool
+	ring []ringPoint
+	next atomic.Uint32
+}
+
+func NewIPHash() *IPHash {
+	return &IPHash{
+		pool: pool{backends: make([]*Backend, 0)},
+	}
+}
+
+func (h *IPHash) AddBackend(backend *Backend) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.backends = append(h.backends, backend)
+	h.buildRing()
+}
+
+func (h *IPHash) RemoveBackend(url string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range h.backends {
+		if b.URL == url {
+			h.backends = append(h.backends[:i], h.backends[i+1:]...)
+			h.buildRing()
+			return true
+		}
+	}
+	return false
+}
+
+// buildRing must be called with h.mu held for writing.
+func (h *IPHash) buildRing() {
+	ring := make([]ringPoint, 0, len(h.backends)*ringReplicas)
+	for _, b := range h.backends {
+		for i := 0; i < ringReplicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(b.URL + "#" + strconv.Itoa(i)))
+			ring = append(ring, ringPoint{hash: hash, backend: b})
+		}
+	}
+	slices.SortFunc(ring, func(a, b ringPoint) int {
+		return cmp.Compare(a.hash, b.hash)
+	})
+	h.ring = ring
+}
+
+// NextBackendFor returns the backend key maps to on the ring.
+func (h *IPHash) NextBackendFor(key string) (*Backend, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start, _ := slices.BinarySearchFunc(h.ring, hash, func(p ringPoint, target uint32) int {
+		return cmp.Compare(p.hash, target)
+	})
+	return h.walk(start, time.Now())
+}
+
+// NextBackend is used when there is no key, e.g. for retries: it starts from
+// a rotating point on the ring so such requests still spread out.
+func (h *IPHash) NextBackend() (*Backend, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.ring) == 0 {
+		return nil, ErrNoHealthyBackends
+	}
+	start := int(h.next.Add(1)) % len(h.ring)
+	return h.walk(start, time.Now())
+}
+
+// walk returns the first available backend on the ring from index start on.
+// It must be called with h.mu held.
+func (h *IPHash) walk(start int, now time.Time) (*Backend, error) {
+	candidates, _ := selectionWeights(h.backends, now)
+	for i := range h.ring {
+		b := h.ring[(start+i)%len(h.ring)].backend
+		if !slices.Contains(candidates, b) {
+			continue
+		}
+		b.selections.Add(1)
+		b.active.Add(1)
+		return b, nil
+	}
+	return nil, ErrNoHealthyBackends
+}
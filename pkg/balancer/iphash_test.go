@@ -0,0 +1,103 @@
+package balancer
+
+import (
+	"strconv"
+	"testing"
+)
+
+func newIPHashWith(urls ...string) *IPHash {
+	h := NewIPHash()
+	for _, u := range urls {
+		h.AddBackend(NewBackend(u, 1))
+	}
+	return h
+}
+
+func clientKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)
+	}
+	return keys
+}
+
+func TestIPHash_SameKeySameBackend(t *testing.T) {
+	h := newIPHashWith("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+
+	used := make(map[string]bool)
+	for _, key := range clientKeys(300) {
+		first, err := h.NextBackendFor(key)
+		if err != nil {
+			t.Fatalf("NextBackendFor failed: %v", err)
+		}
+		h.Release(first)
+		second, _ := h.NextBackendFor(key)
+		h.Release(second)
+		if first != second {
+			t.Fatalf("Key %s moved from %s to %s", key, first.URL, second.URL)
+		}
+		used[first.URL] = true
+	}
+	if len(used) != 3 {
+		t.Errorf("Expected keys spread over all 3 backends, got %d", len(used))
+	}
+}
+
+func TestIPHash_AddingBackendRemapsFewKeys(t *testing.T) {
+	h := newIPHashWith("http://localhost:8001", "http://localhost:8002", "http://localhost:8003", "http://localhost:8004")
+	keys := clientKeys(1000)
+
+	before := make(map[string]string, len(keys))
+	for _, key := range keys {
+		b, _ := h.NextBackendFor(key)
+		before[key] = b.URL
+	}
+
+	h.AddBackend(NewBackend("http://localhost:8005", 1))
+
+	moved := 0
+	for _, key := range keys {
+		b, _ := h.NextBackendFor(key)
+		if b.URL != before[key] {
+			if b.URL != "http://localhost:8005" {
+				t.Errorf("Key %s moved between existing backends: %s to %s", key, before[key], b.URL)
+			}
+			moved++
+		}
+	}
+	// Ideally 1/5 of the keys move to the new backend.
+	if moved == 0 || moved > len(keys)/3 {
+		t.Errorf("Expected roughly a fifth of %d keys remapped, got %d", len(keys), moved)
+	}
+}
+
+func TestIPHash_FallsBackAlongRing(t *testing.T) {
+	h := newIPHashWith("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+	keys := clientKeys(200)
+
+	before := make(map[string]string, len(keys))
+	for _, key := range keys {
+		b, _ := h.NextBackendFor(key)
+		before[key] = b.URL
+	}
+
+	h.SetHealthy("http://localhost:8002", false)
+	for _, key := range keys {
+		b, err := h.NextBackendFor(key)
+		if err != nil {
+			t.Fatalf("NextBackendFor failed: %v", err)
+		}
+		if b.URL == "http://localhost:8002" {
+			t.Fatalf("Key %s mapped to the unhealthy backend", key)
+		}
+		if before[key] != "http://localhost:8002" && b.URL != before[key] {
+			t.Errorf("Key %s on a healthy backend moved from %s to %s", key, before[key], b.URL)
+		}
+	}
+
+	h.SetHealthy("http://localhost:8001", false)
+	h.SetHealthy("http://localhost:8003", false)
+	if _, err := h.NextBackendFor("10.0.0.1"); err != ErrNoHealthyBackends {
+		t.Errorf("Expected ErrNoHealthyBackends, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package balancer
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const latencyWindowSize = 512
+
+// latencyEWMAWeight is the weight of each new sample in the moving average.
+const latencyEWMAWeight = 0.2
+
+// latencyWindow keeps the most recent latency samples in a ring buffer,
+// along with an exponentially weighted moving average of all samples.
+type latencyWindow struct {
+	samples [latencyWindowSize]time.Duration
+	next    int
+	count   int
+	ewma    time.Duration
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	if w.count == 0 {
+		w.ewma = d
+	} else {
+		w.ewma += time.Duration(latencyEWMAWeight * float64(d-w.ewma))
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencyWindowSize
+	if w.count < latencyWindowSize {
+		w.count++
+	}
+}
+
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	if w.count == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, w.count)
+	copy(sorted, w.samples[:w.count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	idx := int(math.Ceil(p*float64(w.count))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+func (w *latencyWindow) mean() time.Duration {
+	if w.count == 0 {
+		return 0
+	}
+
+	var total time.Duration
+	for _, d := range w.samples[:w.count] {
+		total += d
+	}
+	return total / time.Duration(w.count)
+}
+
+func (b *Backend) RecordLatency(d time.Duration) {
+	b.latencyMu.Lock()
+	defer b.latencyMu.Unlock()
+	b.latency.add(d)
+}
+
+// LatencyPercentile returns the p-th percentile (0 < p <= 1) of the most
+// recent latency samples and the number of samples it was computed from.
+func (b *Backend) LatencyPercentile(p float64) (time.Duration, int) {
+	b.latencyMu.Lock()
+	defer b.latencyMu.Unlock()
+	return b.latency.percentile(p), b.latency.count
+}
+
+// LatencyMean returns the mean of the most recent latency samples and the
+// number of samples it was computed from.
+func (b *Backend) LatencyMean() (time.Duration, int) {
+	b.latencyMu.Lock()
+	defer b.latencyMu.Unlock()
+	return b.latency.mean(), b.latency.count
+}
+
+// LatencyEWMA returns the exponentially weighted moving average of the
+// backend's latency and the number of recent samples behind it.
+func (b *Backend) LatencyEWMA() (time.Duration, int) {
+	b.latencyMu.Lock()
+	defer b.latencyMu.Unlock()
+	return b.latency.ewma, b.latency.count
+}
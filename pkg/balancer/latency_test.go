@@ -0,0 +1,50 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackend_LatencyPercentile(t *testing.T) {
+	backend := NewBackend("http://localhost:8001", 1)
+
+	if p99, n := backend.LatencyPercentile(0.99); p99 != 0 || n != 0 {
+		t.Errorf("Expected no samples, got %v from %d", p99, n)
+	}
+
+	for i := 1; i <= 100; i++ {
+		backend.RecordLatency(time.Duration(i) * time.Millisecond)
+	}
+
+	p99, n := backend.LatencyPercentile(0.99)
+	if n != 100 {
+		t.Errorf("Expected 100 samples, got %d", n)
+	}
+	if p99 != 99*time.Millisecond {
+		t.Errorf("Expected p99 of 99ms, got %v", p99)
+	}
+
+	p50, _ := backend.LatencyPercentile(0.5)
+	if p50 != 50*time.Millisecond {
+		t.Errorf("Expected p50 of 50ms, got %v", p50)
+	}
+}
+
+func TestBackend_LatencyWindowRolls(t *testing.T) {
+	backend := NewBackend("http://localhost:8001", 1)
+
+	for i := 0; i < latencyWindowSize; i++ {
+		backend.RecordLatency(time.Second)
+	}
+	for i := 0; i < latencyWindowSize; i++ {
+		backend.RecordLatency(time.Millisecond)
+	}
+
+	p99, n := backend.LatencyPercentile(0.99)
+	if n != latencyWindowSize {
+		t.Errorf("Expected %d samples, got %d", latencyWindowSize, n)
+	}
+	if p99 != time.Millisecond {
+		t.Errorf("Expected old samples to roll out, got p99 %v", p99)
+	}
+}
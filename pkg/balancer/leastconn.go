@@ -0,0 +1,44 @@
+package balancer
+
+import "time"
+
+// LeastConn sends each request to the available backend with the fewest
+// requests in flight, preferring the higher weight on a tie. Draining
+// backends are skipped once fully drained.
+type LeastConn struct {
+	pool
+}
+
+func NewLeastConn() *LeastConn {
+	return &LeastConn{
+		pool: pool{backends: make([]*Backend, 0)},
+	}
+}
+
+func (l *LeastConn) NextBackend() (*Backend, error) {
+	return l.nextBackend(time.Now())
+}
+
+func (l *LeastConn) nextBackend(now time.Time) (*Backend, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var best *Backend
+	var bestActive int64
+	candidates, _ := selectionWeights(l.backends, now)
+	for _, b := range candidates {
+		active := b.active.Load()
+		if best == nil || active < bestActive || (active == bestActive && b.Weight > best.Weight) {
+			best = b
+			bestActive = active
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoHealthyBackends
+	}
+
+	best.selections.Add(1)
+	best.active.Add(1)
+	return best, nil
+}
@@ -0,0 +1,65 @@
+package balancer
+
+import "testing"
+
+func TestLeastConn_PicksFewestActive(t *testing.T) {
+	lc := NewLeastConn()
+	light := NewBackend("http://localhost:8001", 1)
+	heavy := NewBackend("http://localhost:8002", 5)
+	lc.AddBackend(light)
+	lc.AddBackend(heavy)
+
+	// Equal counts go to the higher weight.
+	first, err := lc.NextBackend()
+	if err != nil {
+		t.Fatalf("NextBackend failed: %v", err)
+	}
+	if first != heavy {
+		t.Errorf("Expected tie broken by weight towards %s, got %s", heavy.URL, first.URL)
+	}
+
+	second, _ := lc.NextBackend()
+	if second != light {
+		t.Errorf("Expected the idle backend %s, got %s", light.URL, second.URL)
+	}
+
+	third, _ := lc.NextBackend()
+	if third != heavy {
+		t.Errorf("Expected tie broken by weight towards %s, got %s", heavy.URL, third.URL)
+	}
+
+	lc.Release(first)
+	lc.Release(third)
+	if heavy.ActiveRequests() != 0 || light.ActiveRequests() != 1 {
+		t.Errorf("Expected active counts 0 and 1, got %d and %d", heavy.ActiveRequests(), light.ActiveRequests())
+	}
+
+	next, _ := lc.NextBackend()
+	if next != heavy {
+		t.Errorf("Expected released backend %s, got %s", heavy.URL, next.URL)
+	}
+}
+
+func TestLeastConn_SkipsUnavailable(t *testing.T) {
+	lc := NewLeastConn()
+	down := NewBackend("http://localhost:8001", 10)
+	up := NewBackend("http://localhost:8002", 1)
+	lc.AddBackend(down)
+	lc.AddBackend(up)
+	lc.SetHealthy(down.URL, false)
+
+	for i := 0; i < 3; i++ {
+		b, err := lc.NextBackend()
+		if err != nil {
+			t.Fatalf("NextBackend failed: %v", err)
+		}
+		if b != up {
+			t.Errorf("Expected healthy backend %s, got %s", up.URL, b.URL)
+		}
+	}
+
+	lc.SetHealthy(up.URL, false)
+	if _, err := lc.NextBackend(); err != ErrNoHealthyBackends {
+		t.Errorf("Expected ErrNoHealthyBackends, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package balancer
+
+import "sync"
+
+// pool is the backend list shared by every balancing strategy.
+type pool struct {
+	backends []*Backend
+	mu       sync.RWMutex
+}
+
+func (p *pool) AddBackend(backend *Backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backends = append(p.backends, backend)
+}
+
+func (p *pool) RemoveBackend(url string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, b := range p.backends {
+		if b.URL == url {
+			p.backends = append(p.backends[:i], p.backends[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pool) SetHealthy(url string, healthy bool) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, b := range p.backends {
+		if b.URL == url {
+			b.SetHealthy(healthy)
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pool) GetBackends() []*Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]*Backend, 0, len(p.backends))
+	for _, b := range p.backends {
+		result = append(result, b)
+	}
+	return result
+}
+
+func (p *pool) Acquire(backend *Backend) {
+	backend.selections.Add(1)
+	backend.active.Add(1)
+}
+
+// Release marks a request to backend, handed out by NextBackend, as done.
+func (p *pool) Release(backend *Backend) {
+	backend.active.Add(-1)
+}
+
+// ResetSelections zeroes every backend's selection counter and returns the
+// counts it had, keyed by backend URL.
+func (p *pool) ResetSelections() map[string]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snapshot := make(map[string]int64, len(p.backends))
+	for _, b := range p.backends {
+		snapshot[b.URL] = b.selections.Swap(0)
+	}
+	return snapshot
+}
+
+func (p *pool) HealthyCount() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	count := 0
+	for _, b := range p.backends {
+		if b.IsHealthy() {
+			count++
+		}
+	}
+	return count
+}
+
+// SetWeight changes the weight of the backend with url, reporting whether it
+// was found.
+func (p *pool) SetWeight(url string, weight int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, b := range p.backends {
+		if b.URL == url {
+			b.Weight = weight
+			return true
+		}
+	}
+	return false
+}
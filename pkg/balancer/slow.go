@@ -0,0 +1,54 @@
+package balancer
+
+import (
+	"slices"
+	"time"
+)
+
+// slowMinSamples is how many latency samples a backend needs before it
+// counts towards the pool median or can be penalized.
+const slowMinSamples = 10
+
+// SetSlowPenalty lowers the weight of backends whose latency EWMA exceeds
+// multiple times the pool's median, in proportion to how far above it they
+// are: a backend at twice the threshold gets half its weight. The weight
+// recovers as its latency comes back down. 0 disables the penalty.
+func (s *SRR) SetSlowPenalty(multiple float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slowPenalty = multiple
+}
+
+// penalizeSlow scales down in place the weights of candidates slower than
+// multiple times the lower median EWMA of the candidates with enough
+// samples. Penalized weights stay at least 1.
+func penalizeSlow(candidates []*Backend, weights []int, multiple float64) {
+	if multiple <= 0 || len(candidates) < 2 {
+		return
+	}
+
+	ewmas := make([]time.Duration, len(candidates))
+	var measured []time.Duration
+	for i, b := range candidates {
+		ewma, samples := b.LatencyEWMA()
+		if samples < slowMinSamples {
+			continue
+		}
+		ewmas[i] = ewma
+		measured = append(measured, ewma)
+	}
+	if len(measured) < 2 {
+		return
+	}
+	slices.Sort(measured)
+	threshold := multiple * float64(measured[(len(measured)-1)/2])
+	if threshold <= 0 {
+		return
+	}
+
+	for i, ewma := range ewmas {
+		if float64(ewma) > threshold {
+			weights[i] = max(int(float64(weights[i])*threshold/float64(ewma)), 1)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSRR_SlowPenaltyShiftsTraffic(t *testing.T) {
+	srr := NewSRR()
+	srr.SetSlowPenalty(2)
+
+	fast1 := NewBackend("http://fast1", 1)
+	fast2 := NewBackend("http://fast2", 1)
+	slow := NewBackend("http://slow", 1)
+	for _, b := range []*Backend{fast1, fast2, slow} {
+		srr.AddBackend(b)
+	}
+
+	record := func(b *Backend, d time.Duration, n int) {
+		for i := 0; i < n; i++ {
+			b.RecordLatency(d)
+		}
+	}
+	share := func() map[*Backend]int {
+		counts := make(map[*Backend]int)
+		for i := 0; i < 300; i++ {
+			b, err := srr.NextBackend()
+			if err != nil {
+				t.Fatalf("NextBackend failed: %v", err)
+			}
+			counts[b]++
+			srr.Release(b)
+		}
+		return counts
+	}
+
+	record(fast1, 10*time.Millisecond, 20)
+	record(fast2, 10*time.Millisecond, 20)
+	record(slow, 10*time.Millisecond, 20)
+	if counts := share(); counts[slow] != 100 {
+		t.Errorf("Expected an even split while latencies match, got %d of 300 on the slow backend", counts[slow])
+	}
+
+	// 80ms against a 20ms threshold leaves a quarter of the weight.
+	record(slow, 80*time.Millisecond, 40)
+	counts := share()
+	if counts[slow] >= counts[fast1]/2 || counts[slow] == 0 {
+		t.Errorf("Expected the slow backend's share to drop but not vanish, got slow=%d fast1=%d fast2=%d",
+			counts[slow], counts[fast1], counts[fast2])
+	}
+
+	record(slow, 10*time.Millisecond, 40)
+	if counts := share(); counts[slow] != 100 {
+		t.Errorf("Expected the share to recover with latency, got %d of 300", counts[slow])
+	}
+}
+
+func TestSRR_SlowPenaltyNeedsSamples(t *testing.T) {
+	candidates := []*Backend{NewBackend("http://a", 1), NewBackend("http://b", 1)}
+	candidates[0].RecordLatency(time.Millisecond)
+	for i := 0; i < slowMinSamples; i++ {
+		candidates[1].RecordLatency(time.Second)
+	}
+	weights := []int{1000, 1000}
+	penalizeSlow(candidates, weights, 2)
+	if weights[0] != 1000 || weights[1] != 1000 {
+		t.Errorf("Expected no penalty without enough samples on both backends, got %v", weights)
+	}
+}
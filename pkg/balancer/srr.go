@@ -2,66 +2,27 @@ package balancer
 
 import (
 	"errors"
-	"sync"
+	"time"
 )
 
 var ErrNoHealthyBackends = errors.New("no healthy backends available")
 
 type SRR struct {
-	backends []*Backend
-	mu       sync.RWMutex
+	pool
+	slowPenalty float64
 }
 
 func NewSRR() *SRR {
 	return &SRR{
-		backends: make([]*Backend, 0),
+		pool: pool{backends: make([]*Backend, 0)},
 	}
 }
 
-func (s *SRR) AddBackend(backend *Backend) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.backends = append(s.backends, backend)
-}
-
-func (s *SRR) RemoveBackend(url string) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	for i, b := range s.backends {
-		if b.URL == url {
-			s.backends = append(s.backends[:i], s.backends[i+1:]...)
-			return true
-		}
-	}
-	return false
-}
-
-func (s *SRR) SetHealthy(url string, healthy bool) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	for _, b := range s.backends {
-		if b.URL == url {
-			b.SetHealthy(healthy)
-			return true
-		}
-	}
-	return false
-}
-
-func (s *SRR) GetBackends() []*Backend {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	result := make([]*Backend, 0, len(s.backends))
-	for _, b := range s.backends {
-		result = append(result, b)
-	}
-	return result
+func (s *SRR) NextBackend() (*Backend, error) {
+	return s.nextBackend(time.Now())
 }
 
-func (s *SRR) NextBackend() (*Backend, error) {
+func (s *SRR) nextBackend(now time.Time) (*Backend, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -71,24 +32,19 @@ func (s *SRR) NextBackend() (*Backend, error) {
 
 	var best *Backend
 	totalWeight := 0
+	candidates, weights := selectionWeights(s.backends, now)
+	penalizeSlow(candidates, weights, s.slowPenalty)
 
-	for _, b := range s.backends {
-		if !b.IsHealthy() {
-			continue
-		}
-		totalWeight += b.Weight
-		b.CurrentWeight += b.Weight
+	for i, b := range candidates {
+		totalWeight += weights[i]
+		b.CurrentWeight += weights[i]
 	}
 
 	if totalWeight == 0 {
 		return nil, ErrNoHealthyBackends
 	}
 
-	for _, b := range s.backends {
-		if !b.IsHealthy() {
-			continue
-		}
-
+	for _, b := range candidates {
 		if best == nil || b.CurrentWeight > best.CurrentWeight {
 			best = b
 		}
@@ -99,19 +55,8 @@ func (s *SRR) NextBackend() (*Backend, error) {
 	}
 
 	best.CurrentWeight -= totalWeight
+	best.selections.Add(1)
+	best.active.Add(1)
 
 	return best, nil
 }
-
-func (s *SRR) HealthyCount() int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	count := 0
-	for _, b := range s.backends {
-		if b.IsHealthy() {
-			count++
-		}
-	}
-	return count
-}
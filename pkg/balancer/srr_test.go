@@ -3,6 +3,9 @@ package balancer
 import (
 	"sync"
 	"testing"
+	"time"
+
+	"proxy-kp/pkg/circuit"
 )
 
 func TestSRR_AddBackend(t *testing.T) {
@@ -196,3 +199,63 @@ func TestBackend_ThreadSafety(t *testing.T) {
 		t.Error("Backend should be healthy after concurrent operations")
 	}
 }
+
+func TestSRR_NextBackend_SkipsOpenCircuit(t *testing.T) {
+	srr := NewSRR()
+
+	backend1 := NewBackend("http://localhost:8001", 10)
+	backend2 := NewBackend("http://localhost:8002", 10)
+	backend1.SetBreaker(circuit.NewBreaker(1, time.Minute, nil))
+	backend1.Breaker().RecordFailure("dial error")
+
+	srr.AddBackend(backend1)
+	srr.AddBackend(backend2)
+
+	for i := 0; i < 10; i++ {
+		backend, err := srr.NextBackend()
+		if err != nil {
+			t.Fatalf("NextBackend failed: %v", err)
+		}
+		if backend.URL != "http://localhost:8002" {
+			t.Errorf("Expected backend with closed circuit, got %s", backend.URL)
+		}
+	}
+}
+
+func TestSRR_SelectionCounters(t *testing.T) {
+	b := NewSRR()
+	b.AddBackend(NewBackend("http://localhost:8001", 2))
+	b.AddBackend(NewBackend("http://localhost:8002", 1))
+
+	sequence := make([]string, 0, 6)
+	for i := 0; i < 6; i++ {
+		backend, err := b.NextBackend()
+		if err != nil {
+			t.Fatalf("NextBackend failed: %v", err)
+		}
+		sequence = append(sequence, backend.URL)
+	}
+
+	expected := map[string]int64{}
+	for _, url := range sequence {
+		expected[url]++
+	}
+	for _, backend := range b.GetBackends() {
+		if backend.Selections() != expected[backend.URL] {
+			t.Errorf("%s: expected %d selections, got %d", backend.URL, expected[backend.URL], backend.Selections())
+		}
+	}
+	if expected["http://localhost:8001"] != 4 || expected["http://localhost:8002"] != 2 {
+		t.Errorf("Expected 4:2 split for 2:1 weights, got %v", expected)
+	}
+
+	snapshot := b.ResetSelections()
+	if snapshot["http://localhost:8001"] != 4 || snapshot["http://localhost:8002"] != 2 {
+		t.Errorf("Expected reset to return the counts, got %v", snapshot)
+	}
+	for _, backend := range b.GetBackends() {
+		if backend.Selections() != 0 {
+			t.Errorf("%s: expected counter reset to 0, got %d", backend.URL, backend.Selections())
+		}
+	}
+}
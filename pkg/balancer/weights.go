@@ -0,0 +1,48 @@
+package balancer
+
+import "math"
+
+// maxWeightPrecision bounds the decimal places kept when normalizing, so a
+// weight like 0.3333333 does not blow up into a huge integer.
+const maxWeightPrecision = 3
+
+// NormalizeWeights converts fractional weights into the smallest integers
+// with the same ratios, to at most maxWeightPrecision decimal places. For
+// example 1.5, 1.0 and 0.5 become 3, 2 and 1. Every result is at least 1.
+func NormalizeWeights(weights []float64) []int {
+	scale := 1.0
+	for p := 0; p < maxWeightPrecision && !allIntegral(weights, scale); p++ {
+		scale *= 10
+	}
+
+	ints := make([]int, len(weights))
+	divisor := 0
+	for i, w := range weights {
+		ints[i] = max(int(math.Round(w*scale)), 1)
+		divisor = gcd(divisor, ints[i])
+	}
+
+	if divisor > 1 {
+		for i := range ints {
+			ints[i] /= divisor
+		}
+	}
+	return ints
+}
+
+func allIntegral(weights []float64, scale float64) bool {
+	for _, w := range weights {
+		scaled := w * scale
+		if math.Abs(scaled-math.Round(scaled)) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,54 @@
+package balancer
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeWeights(t *testing.T) {
+	tests := []struct {
+		weights []float64
+		want    []int
+	}{
+		{weights: []float64{1.5, 1.0, 0.5}, want: []int{3, 2, 1}},
+		{weights: []float64{10, 5}, want: []int{2, 1}},
+		{weights: []float64{33.3, 33.3, 33.4}, want: []int{333, 333, 334}},
+		{weights: []float64{0.25, 0.75}, want: []int{1, 3}},
+		{weights: []float64{1.0 / 3, 2.0 / 3}, want: []int{333, 667}},
+		{weights: []float64{7}, want: []int{1}},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeWeights(tt.weights); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NormalizeWeights(%v) = %v, want %v", tt.weights, got, tt.want)
+		}
+	}
+}
+
+func TestSRR_FractionalWeightDistribution(t *testing.T) {
+	weights := NormalizeWeights([]float64{1.5, 1.0, 0.5})
+
+	b := NewSRR()
+	for i, w := range weights {
+		b.AddBackend(NewBackend(fmt.Sprintf("http://localhost:800%d", i+1), w))
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 600; i++ {
+		backend, err := b.NextBackend()
+		if err != nil {
+			t.Fatalf("NextBackend failed: %v", err)
+		}
+		counts[backend.URL]++
+	}
+
+	want := map[string]int{
+		"http://localhost:8001": 300,
+		"http://localhost:8002": 200,
+		"http://localhost:8003": 100,
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("Expected 3:2:1 distribution %v, got %v", want, counts)
+	}
+}
@@ -0,0 +1,49 @@
+package cache
+
+import "time"
+
+// StartCleanup removes expired entries every interval in a background
+// goroutine until StopCleanup is called. Entries are kept for retain past
+// their expiry, so they can still be served stale or revalidated. Calling
+// it while cleanup is already running does nothing.
+func (c *Cache) StartCleanup(interval, retain time.Duration) {
+	c.cleanupMu.Lock()
+	defer c.cleanupMu.Unlock()
+
+	if c.stopCh != nil {
+		return
+	}
+	stopCh := make(chan struct{})
+	c.stopCh = stopCh
+
+	c.cleanupWG.Add(1)
+	go func() {
+		defer c.cleanupWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				c.cleanupExpired(retain)
+			}
+		}
+	}()
+}
+
+// StopCleanup stops the cleanup goroutine and waits for it to exit. It is
+// safe to call more than once, or without StartCleanup.
+func (c *Cache) StopCleanup() {
+	c.cleanupMu.Lock()
+	if c.stopCh == nil {
+		c.cleanupMu.Unlock()
+		return
+	}
+	close(c.stopCh)
+	c.stopCh = nil
+	c.cleanupMu.Unlock()
+
+	c.cleanupWG.Wait()
+}
@@ -6,24 +6,44 @@ import (
 )
 
 type Entry struct {
-	Key       string
-	Value     []byte
-	Header    http.Header
-	ExpiresAt time.Time
-	CreatedAt time.Time
+	Key        string
+	StatusCode int
+	Value      []byte
+	Header     http.Header
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	// Backend is the URL of the backend that served the response, when
+	// known.
+	Backend string `json:",omitempty"`
+	// Vary lists the request headers the response varies on. An entry
+	// with Vary set under a request's base key marks that the response
+	// itself is stored under a key that includes those headers.
+	Vary []string `json:",omitempty"`
 }
 
 func NewEntry(key string, value []byte, header http.Header, ttl time.Duration) *Entry {
 	now := time.Now()
 	return &Entry{
-		Key:       key,
-		Value:     value,
-		Header:    header,
-		CreatedAt: now,
-		ExpiresAt: now.Add(ttl),
+		Key:        key,
+		StatusCode: http.StatusOK,
+		Value:      value,
+		Header:     header,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
 	}
 }
 
 func (e *Entry) IsExpired() bool {
 	return time.Now().After(e.ExpiresAt)
 }
+
+// EntryInfo describes a cached entry without its body.
+type EntryInfo struct {
+	Key        string
+	StatusCode int
+	// Size is the entry's accounted size; see Cache.SetLimits.
+	Size      int64
+	Backend   string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,39 @@
+package cache
+
+import "container/heap"
+
+// cleanupBatchSize bounds how many expired entries cleanup removes per lock
+// acquisition, so Get and Set are never stalled for long by a large purge.
+const cleanupBatchSize = 256
+
+// expiryHeap orders cached items by expiry, soonest first, so cleanup only
+// visits entries that have actually expired.
+type expiryHeap []*lruItem
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].entry.ExpiresAt.Before(h[j].entry.ExpiresAt)
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*lruItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+var _ heap.Interface = (*expiryHeap)(nil)
@@ -1,82 +1,293 @@
 package cache
 
 import (
+	"container/heap"
+	"container/list"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// lruItem is a cached entry with the size it was accounted at and its
+// position in the expiry heap.
+type lruItem struct {
+	entry *Entry
+	size  int64
+	index int
+}
+
 type Cache struct {
-	entries map[string]*Entry
-	mutex   sync.RWMutex
-	ttl     time.Duration
+	entries map[string]*list.Element
+	// order holds entries most recently used first.
+	order *list.List
+	// expiry holds the same items ordered by expiry time.
+	expiry expiryHeap
+	mutex  sync.Mutex
+	ttl    time.Duration
+
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	onEvict    func()
+	evictions  atomic.Int64
+
+	cleanupMu sync.Mutex
+	stopCh    chan struct{}
+	cleanupWG sync.WaitGroup
 }
 
 func NewCache(ttl time.Duration) *Cache {
 	return &Cache{
-		entries: make(map[string]*Entry),
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
 		ttl:     ttl,
 	}
 }
 
-func (c *Cache) Get(key string) ([]byte, http.Header, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+// SetLimits bounds the cache to maxEntries entries and maxBytes bytes of
+// keys, bodies and headers (0 = unbounded). Once full, Set evicts the least
+// recently used entries and calls onEvict, if non-nil, for each one.
+func (c *Cache) SetLimits(maxEntries int, maxBytes int64, onEvict func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.maxEntries = maxEntries
+	c.maxBytes = maxBytes
+	c.onEvict = onEvict
+	c.evictLocked()
+}
+
+// Evictions returns how many entries were evicted to stay within the
+// limits.
+func (c *Cache) Evictions() int64 {
+	return c.evictions.Load()
+}
 
-	entry, exists := c.entries[key]
+// lookup returns the entry for key, marking it most recently used.
+func (c *Cache) lookup(key string) (*Entry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, exists := c.entries[key]
 	if !exists {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruItem).entry, true
+}
+
+func (c *Cache) Get(key string) ([]byte, http.Header, bool) {
+	entry, exists := c.lookup(key)
+	if !exists || entry.IsExpired() {
 		return nil, nil, false
 	}
 
-	if entry.IsExpired() {
+	return entry.Value, entry.Header, true
+}
+
+// GetStale returns the entry for key even if it has expired, as long as it
+// has not been removed from the cache yet.
+func (c *Cache) GetStale(key string) ([]byte, http.Header, bool) {
+	entry, exists := c.lookup(key)
+	if !exists {
 		return nil, nil, false
 	}
 
 	return entry.Value, entry.Header, true
 }
 
+// GetEntry returns the unexpired entry for key, including its status code.
+func (c *Cache) GetEntry(key string) (*Entry, bool) {
+	entry, exists := c.lookup(key)
+	if !exists || entry.IsExpired() {
+		return nil, false
+	}
+	return entry, true
+}
+
+// GetStaleEntry is GetEntry without the expiry check; see GetStale.
+func (c *Cache) GetStaleEntry(key string) (*Entry, bool) {
+	return c.lookup(key)
+}
+
+// Keys returns the cached keys, most recently used first. Expired entries
+// not yet cleaned up are included.
+func (c *Cache) Keys() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	keys := make([]string, 0, c.order.Len())
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*lruItem).entry.Key)
+	}
+	return keys
+}
+
+// Info describes the entry for key, expired or not, without marking it
+// used.
+func (c *Cache) Info(key string) (EntryInfo, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		return EntryInfo{}, false
+	}
+	item := elem.Value.(*lruItem)
+	return EntryInfo{
+		Key:        item.entry.Key,
+		StatusCode: item.entry.StatusCode,
+		Size:       item.size,
+		Backend:    item.entry.Backend,
+		CreatedAt:  item.entry.CreatedAt,
+		ExpiresAt:  item.entry.ExpiresAt,
+	}, true
+}
+
 func (c *Cache) Set(key string, value []byte, header http.Header) {
+	c.SetWithTTL(key, http.StatusOK, value, header, c.ttl)
+}
+
+// SetWithTTL stores a response with its status code under key, expiring
+// after ttl rather than the cache-wide default.
+func (c *Cache) SetWithTTL(key string, statusCode int, value []byte, header http.Header, ttl time.Duration) {
+	entry := NewEntry(key, value, header, ttl)
+	entry.StatusCode = statusCode
+	c.SetEntry(entry)
+}
+
+// SetEntry stores entry as the most recently used one. An entry larger
+// than the byte limit on its own is not stored.
+func (c *Cache) SetEntry(entry *Entry) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	entry := NewEntry(key, value, header, c.ttl)
-	c.entries[key] = entry
+	if elem, exists := c.entries[entry.Key]; exists {
+		c.removeLocked(elem)
+	}
+	size := entrySize(entry)
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+
+	item := &lruItem{entry: entry, size: size}
+	c.entries[entry.Key] = c.order.PushFront(item)
+	heap.Push(&c.expiry, item)
+	c.bytes += size
+	c.evictLocked()
 }
 
 func (c *Cache) Delete(key string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	delete(c.entries, key)
+	if elem, exists := c.entries[key]; exists {
+		c.removeLocked(elem)
+	}
 }
 
-func (c *Cache) CleanupExpired() int {
+func (c *Cache) DeletePrefix(prefix string) int {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	count := 0
-	now := time.Now()
-
-	for key, entry := range c.entries {
-		if now.After(entry.ExpiresAt) {
-			delete(c.entries, key)
+	for key, elem := range c.entries {
+		if keyHasURLPrefix(key, prefix) {
+			c.removeLocked(elem)
 			count++
 		}
 	}
+	return count
+}
 
+func (c *Cache) CleanupExpired() int {
+	return c.cleanupExpired(0)
+}
+
+// cleanupExpired removes entries that expired more than retain ago. Only
+// expired entries are visited, in batches of cleanupBatchSize with the lock
+// released in between.
+func (c *Cache) cleanupExpired(retain time.Duration) int {
+	cutoff := time.Now().Add(-retain)
+	count := 0
+	for {
+		removed := c.cleanupBatch(cutoff)
+		count += removed
+		if removed < cleanupBatchSize {
+			return count
+		}
+	}
+}
+
+// cleanupBatch removes up to cleanupBatchSize entries that expired before
+// cutoff.
+func (c *Cache) cleanupBatch(cutoff time.Time) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	count := 0
+	for count < cleanupBatchSize && len(c.expiry) > 0 && cutoff.After(c.expiry[0].entry.ExpiresAt) {
+		c.removeLocked(c.entries[c.expiry[0].entry.Key])
+		count++
+	}
 	return count
 }
 
 func (c *Cache) Size() int {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
 	return len(c.entries)
 }
 
+// Bytes returns the accounted size of all entries; see SetLimits.
+func (c *Cache) Bytes() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.bytes
+}
+
 func (c *Cache) Clear() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	c.entries = make(map[string]*Entry)
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.expiry = nil
+	c.bytes = 0
+}
+
+// evictLocked drops least recently used entries until the cache is within
+// its limits.
+func (c *Cache) evictLocked() {
+	for c.order.Len() > 0 &&
+		((c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+		c.removeLocked(c.order.Back())
+		c.evictions.Add(1)
+		if c.onEvict != nil {
+			c.onEvict()
+		}
+	}
+}
+
+func (c *Cache) removeLocked(elem *list.Element) {
+	item := c.order.Remove(elem).(*lruItem)
+	heap.Remove(&c.expiry, item.index)
+	delete(c.entries, item.entry.Key)
+	c.bytes -= item.size
+}
+
+// entrySize approximates the memory held by entry: its key, body and
+// header names and values.
+func entrySize(entry *Entry) int64 {
+	size := int64(len(entry.Key) + len(entry.Value))
+	for name, values := range entry.Header {
+		size += int64(len(name))
+		for _, v := range values {
+			size += int64(len(v))
+		}
+	}
+	return size
 }
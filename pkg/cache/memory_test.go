@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"fmt"
 	"net/http"
 	"sync"
 	"testing"
@@ -220,3 +221,226 @@ func TestCache_MultipleKeys(t *testing.T) {
 		}
 	}
 }
+
+func TestCache_GetStale(t *testing.T) {
+	cache := NewCache(10 * time.Millisecond)
+
+	cache.Set("key", []byte("value"), http.Header{})
+	time.Sleep(20 * time.Millisecond)
+
+	if _, _, found := cache.Get("key"); found {
+		t.Error("Expected Get to miss an expired entry")
+	}
+
+	value, _, found := cache.GetStale("key")
+	if !found {
+		t.Fatal("Expected GetStale to return the expired entry")
+	}
+	if string(value) != "value" {
+		t.Errorf("Expected value, got %s", string(value))
+	}
+
+	cache.CleanupExpired()
+	if _, _, found := cache.GetStale("key"); found {
+		t.Error("Expected GetStale to miss after cleanup")
+	}
+}
+
+func TestCache_SetWithTTL(t *testing.T) {
+	cache := NewCache(time.Hour)
+
+	cache.SetWithTTL("short", http.StatusMovedPermanently, []byte("moved"), http.Header{}, 10*time.Millisecond)
+
+	entry, found := cache.GetEntry("short")
+	if !found {
+		t.Fatal("Expected entry to be found")
+	}
+	if entry.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("Expected status 301, got %d", entry.StatusCode)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, found := cache.GetEntry("short"); found {
+		t.Error("Expected per-entry TTL to override the cache default")
+	}
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(60 * time.Second)
+	evicted := 0
+	cache.SetLimits(2, 0, func() { evicted++ })
+
+	cache.Set("a", []byte("1"), http.Header{})
+	cache.Set("b", []byte("2"), http.Header{})
+	// Reading "a" makes "b" the least recently used entry.
+	cache.Get("a")
+	cache.Set("c", []byte("3"), http.Header{})
+
+	if _, _, found := cache.Get("b"); found {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, _, found := cache.Get(key); !found {
+			t.Errorf("Expected %s to stay cached", key)
+		}
+	}
+	if cache.Size() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.Size())
+	}
+	if evicted != 1 || cache.Evictions() != 1 {
+		t.Errorf("Expected 1 eviction, got callback %d, counter %d", evicted, cache.Evictions())
+	}
+}
+
+func TestCache_EvictsToStayUnderMaxBytes(t *testing.T) {
+	cache := NewCache(60 * time.Second)
+	// Each entry is a 1-byte key plus a 10-byte body.
+	cache.SetLimits(0, 25, nil)
+
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set(key, make([]byte, 10), http.Header{})
+	}
+
+	if _, _, found := cache.Get("a"); found {
+		t.Error("Expected a to be evicted")
+	}
+	if cache.Bytes() != 22 {
+		t.Errorf("Expected 22 bytes cached, got %d", cache.Bytes())
+	}
+
+	// Replacing an entry accounts for its new size rather than adding to it.
+	cache.Set("b", make([]byte, 5), http.Header{})
+	if cache.Bytes() != 17 || cache.Evictions() != 1 {
+		t.Errorf("Expected 17 bytes and 1 eviction, got %d bytes, %d evictions", cache.Bytes(), cache.Evictions())
+	}
+
+	// An entry over the limit on its own is not stored.
+	cache.Set("huge", make([]byte, 100), http.Header{})
+	if _, _, found := cache.Get("huge"); found {
+		t.Error("Expected an oversized entry not to be cached")
+	}
+	if cache.Size() != 2 {
+		t.Errorf("Expected the oversized entry to leave others in place, got %d entries", cache.Size())
+	}
+}
+
+func TestCache_KeysAndInfoDoNotTouchOrder(t *testing.T) {
+	cache := NewCache(60 * time.Second)
+	cache.Set("a", []byte("1"), http.Header{})
+	cache.Set("b", []byte("22"), http.Header{"X": {"y"}})
+
+	keys := cache.Keys()
+	if len(keys) != 2 || keys[0] != "b" || keys[1] != "a" {
+		t.Errorf("Expected keys most recently used first, got %v", keys)
+	}
+
+	info, found := cache.Info("a")
+	if !found || info.StatusCode != http.StatusOK || info.Size != 2 {
+		t.Errorf("Unexpected info for a: %+v", info)
+	}
+	if info, _ := cache.Info("b"); info.Size != 5 {
+		t.Errorf("Expected b to account key, body and header bytes (5), got %d", info.Size)
+	}
+	if keys := cache.Keys(); keys[0] != "b" {
+		t.Errorf("Expected Info not to mark a as used, got %v", keys)
+	}
+}
+
+func TestCache_BackgroundCleanupRemovesExpired(t *testing.T) {
+	cache := NewCache(10 * time.Millisecond)
+	cache.Set("short", []byte("1"), http.Header{})
+	cache.SetWithTTL("long", http.StatusOK, []byte("2"), http.Header{}, time.Hour)
+
+	cache.StartCleanup(5*time.Millisecond, 0)
+	defer cache.StopCleanup()
+
+	deadline := time.Now().Add(time.Second)
+	for cache.Size() > 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, found := cache.GetStaleEntry("short"); found {
+		t.Error("Expected the expired entry to be removed without any access")
+	}
+	if _, found := cache.GetEntry("long"); !found {
+		t.Error("Expected the unexpired entry to stay")
+	}
+}
+
+func TestCache_BackgroundCleanupRetainsRecentlyExpired(t *testing.T) {
+	cache := NewCache(time.Millisecond)
+	cache.Set("key", []byte("1"), http.Header{})
+
+	cache.StartCleanup(5*time.Millisecond, time.Hour)
+	time.Sleep(30 * time.Millisecond)
+	cache.StopCleanup()
+	// Stopping twice is harmless.
+	cache.StopCleanup()
+
+	if _, found := cache.GetStaleEntry("key"); !found {
+		t.Error("Expected an entry within the retention window to be kept for stale use")
+	}
+}
+
+func TestCache_CleanupExpiredInBatches(t *testing.T) {
+	cache := NewCache(time.Hour)
+	expired := 3*cleanupBatchSize + 7
+	for i := 0; i < expired; i++ {
+		cache.SetWithTTL(fmt.Sprintf("old-%d", i), http.StatusOK, []byte("x"), http.Header{}, time.Duration(i%5+1)*time.Millisecond)
+	}
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("fresh-%d", i), []byte("x"), http.Header{})
+	}
+	// Replacing an entry must drop its old expiry.
+	cache.SetWithTTL("old-0", http.StatusOK, []byte("x"), http.Header{}, time.Hour)
+	time.Sleep(20 * time.Millisecond)
+
+	if n := cache.CleanupExpired(); n != expired-1 {
+		t.Errorf("Expected %d expired entries removed, got %d", expired-1, n)
+	}
+	if n := cache.Size(); n != 101 {
+		t.Errorf("Expected 101 live entries left, got %d", n)
+	}
+	if _, _, found := cache.Get("old-0"); !found {
+		t.Error("Expected the replaced entry to survive cleanup")
+	}
+	if n := len(cache.expiry); n != cache.Size() {
+		t.Errorf("Expected the expiry index to track %d entries, got %d", cache.Size(), n)
+	}
+	if n := cache.CleanupExpired(); n != 0 {
+		t.Errorf("Expected nothing left to clean up, got %d", n)
+	}
+}
+
+// BenchmarkCache_CleanupExpired cleans 1% expired entries out of a large
+// cache. Only expired entries are visited, in batches, so the longest lock
+// hold (reported as max-lock-ns) stays small however big the cache is.
+func BenchmarkCache_CleanupExpired(b *testing.B) {
+	const live, expired = 100000, 1000
+	cache := NewCache(time.Hour)
+	for i := 0; i < live; i++ {
+		cache.Set(fmt.Sprintf("live-%d", i), []byte("x"), http.Header{})
+	}
+	past := time.Now().Add(-time.Minute)
+
+	var maxHold time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j := 0; j < expired; j++ {
+			entry := NewEntry(fmt.Sprintf("expired-%d", j), []byte("x"), http.Header{}, time.Hour)
+			entry.ExpiresAt = past
+			cache.SetEntry(entry)
+		}
+		b.StartTimer()
+
+		for {
+			start := time.Now()
+			removed := cache.cleanupBatch(time.Now())
+			maxHold = max(maxHold, time.Since(start))
+			if removed < cleanupBatchSize {
+				break
+			}
+		}
+	}
+	b.ReportMetric(float64(maxHold.Nanoseconds()), "max-lock-ns")
+}
@@ -0,0 +1,326 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redisMaxIdleConns = 8
+
+type RedisOptions struct {
+	Addr      string
+	Password  string
+	DB        int
+	KeyPrefix string
+	Timeout   time.Duration
+	// TTL is used by Set; SetWithTTL takes its own.
+	TTL time.Duration
+	// OnError is called when a command fails. Failed reads are treated as
+	// misses and failed writes are dropped, so the proxy keeps serving.
+	OnError func(op string, err error)
+}
+
+// RedisStore is a Store backed by a Redis server, speaking RESP directly over
+// a small pool of connections. Redis expires entries itself, so
+// GetStaleEntry cannot return anything past its TTL.
+type RedisStore struct {
+	opts RedisOptions
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func NewRedisStore(opts RedisOptions) *RedisStore {
+	return &RedisStore{opts: opts}
+}
+
+func (s *RedisStore) Get(key string) ([]byte, http.Header, bool) {
+	entry, found := s.GetEntry(key)
+	if !found {
+		return nil, nil, false
+	}
+	return entry.Value, entry.Header, true
+}
+
+func (s *RedisStore) GetEntry(key string) (*Entry, bool) {
+	reply, err := s.do("GET", s.opts.KeyPrefix+key)
+	if err != nil {
+		s.fail("GET", err)
+		return nil, false
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, false
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		s.fail("GET", fmt.Errorf("decode entry %s: %w", key, err))
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (s *RedisStore) GetStaleEntry(key string) (*Entry, bool) {
+	return s.GetEntry(key)
+}
+
+func (s *RedisStore) Set(key string, value []byte, header http.Header) {
+	s.SetWithTTL(key, http.StatusOK, value, header, s.opts.TTL)
+}
+
+func (s *RedisStore) SetWithTTL(key string, statusCode int, value []byte, header http.Header, ttl time.Duration) {
+	entry := NewEntry(key, value, header, ttl)
+	entry.StatusCode = statusCode
+	s.SetEntry(entry)
+}
+
+func (s *RedisStore) SetEntry(entry *Entry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		s.fail("SET", err)
+		return
+	}
+
+	ms := max(time.Until(entry.ExpiresAt).Milliseconds(), 1)
+	if _, err := s.do("SET", s.opts.KeyPrefix+entry.Key, string(data), "PX", strconv.FormatInt(ms, 10)); err != nil {
+		s.fail("SET", err)
+	}
+}
+
+func (s *RedisStore) Delete(key string) {
+	if _, err := s.do("DEL", s.opts.KeyPrefix+key); err != nil {
+		s.fail("DEL", err)
+	}
+}
+
+// DeletePrefix scans the keys under the configured key prefix, so like Size
+// it is not meant for the request path.
+func (s *RedisStore) DeletePrefix(prefix string) int {
+	count := 0
+	err := s.scan(func(keys []string) error {
+		var matched []string
+		for _, key := range keys {
+			if keyHasURLPrefix(strings.TrimPrefix(key, s.opts.KeyPrefix), prefix) {
+				matched = append(matched, key)
+			}
+		}
+		if len(matched) == 0 {
+			return nil
+		}
+		if _, err := s.do(append([]string{"DEL"}, matched...)...); err != nil {
+			return err
+		}
+		count += len(matched)
+		return nil
+	})
+	if err != nil {
+		s.fail("DEL", err)
+	}
+	return count
+}
+
+// Size counts the keys under the configured prefix. It scans the keyspace,
+// so it is meant for status reporting rather than the request path.
+func (s *RedisStore) Size() int {
+	count := 0
+	if err := s.scan(func(keys []string) error {
+		count += len(keys)
+		return nil
+	}); err != nil {
+		s.fail("SCAN", err)
+	}
+	return count
+}
+
+// Clear deletes every key under the configured prefix, leaving other data in
+// the same Redis database alone.
+func (s *RedisStore) Clear() {
+	err := s.scan(func(keys []string) error {
+		if len(keys) == 0 {
+			return nil
+		}
+		_, err := s.do(append([]string{"DEL"}, keys...)...)
+		return err
+	})
+	if err != nil {
+		s.fail("DEL", err)
+	}
+}
+
+func (s *RedisStore) scan(fn func(keys []string) error) error {
+	cursor := "0"
+	for {
+		reply, err := s.do("SCAN", cursor, "MATCH", s.opts.KeyPrefix+"*", "COUNT", "100")
+		if err != nil {
+			return err
+		}
+
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return errors.New("unexpected SCAN reply")
+		}
+		next, _ := parts[0].([]byte)
+		items, _ := parts[1].([]interface{})
+
+		keys := make([]string, 0, len(items))
+		for _, item := range items {
+			if key, ok := item.([]byte); ok {
+				keys = append(keys, string(key))
+			}
+		}
+		if err := fn(keys); err != nil {
+			return err
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+func (s *RedisStore) fail(op string, err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(op, err)
+	}
+}
+
+// do runs a single command and returns its reply: nil, int64, []byte (simple
+// and bulk strings) or []interface{} for arrays.
+func (s *RedisStore) do(args ...string) (interface{}, error) {
+	c, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(s.opts.Timeout, args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		c.conn.Close()
+		return nil, err
+	}
+
+	s.put(c)
+	return reply, err
+}
+
+func (s *RedisStore) get() (*redisConn, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+
+	conn, err := net.DialTimeout("tcp", s.opts.Addr, s.opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, rd: bufio.NewReader(conn)}
+
+	if s.opts.Password != "" {
+		if _, err := c.do(s.opts.Timeout, "AUTH", s.opts.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.opts.DB != 0 {
+		if _, err := c.do(s.opts.Timeout, "SELECT", strconv.Itoa(s.opts.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *RedisStore) put(c *redisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.idle) >= redisMaxIdleConns {
+		c.conn.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (c *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	if timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(c.rd)
+}
+
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return []byte(body), nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+	}
+}
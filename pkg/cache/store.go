@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Store is the cache storage the proxy depends on. Cache is the in-process
+// implementation; RedisStore shares entries across proxy replicas.
+type Store interface {
+	Get(key string) ([]byte, http.Header, bool)
+	// GetEntry is Get plus the cached status code.
+	GetEntry(key string) (*Entry, bool)
+	// GetStaleEntry may also return expired entries the store still holds.
+	GetStaleEntry(key string) (*Entry, bool)
+	Set(key string, value []byte, header http.Header)
+	SetWithTTL(key string, statusCode int, value []byte, header http.Header, ttl time.Duration)
+	// SetEntry stores entry under entry.Key until entry.ExpiresAt.
+	SetEntry(entry *Entry)
+	Delete(key string)
+	// DeletePrefix removes the entries whose URL starts with prefix and
+	// returns how many it removed; see keyHasURLPrefix.
+	DeletePrefix(prefix string) int
+	Size() int
+	Clear()
+}
+
+var (
+	_ Store = (*Cache)(nil)
+	_ Store = (*RedisStore)(nil)
+)
+
+// keyHasURLPrefix reports whether a "method:URL" cache key is for a URL
+// starting with prefix. Keys in other forms never match.
+func keyHasURLPrefix(key, prefix string) bool {
+	_, url, ok := strings.Cut(key, ":")
+	return ok && strings.HasPrefix(url, prefix)
+}
@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a minimal in-process RESP server supporting the commands
+// RedisStore issues.
+type fakeRedis struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	data    map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	f := &fakeRedis{ln: ln, data: make(map[string]string), expires: make(map[string]time.Time)}
+	go f.serve()
+	t.Cleanup(func() { ln.Close() })
+	return f
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+
+	for {
+		reply, err := readReply(rd)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			b, _ := item.([]byte)
+			args[i] = string(b)
+		}
+		conn.Write([]byte(f.exec(args)))
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key, at := range f.expires {
+		if time.Now().After(at) {
+			delete(f.data, key)
+			delete(f.expires, key)
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		v, ok := f.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		f.data[args[1]] = args[2]
+		delete(f.expires, args[1])
+		if len(args) == 5 && strings.EqualFold(args[3], "PX") {
+			ms, _ := strconv.Atoi(args[4])
+			f.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := f.data[key]; ok {
+				delete(f.data, key)
+				delete(f.expires, key)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "SCAN":
+		var keys []string
+		// Redis globs, unlike path.Match, let "*" match "/" too.
+		pattern := strings.ReplaceAll(args[3], "/", "\x00")
+		for key := range f.data {
+			if ok, _ := path.Match(pattern, strings.ReplaceAll(key, "/", "\x00")); ok {
+				keys = append(keys, key)
+			}
+		}
+		out := fmt.Sprintf("*2\r\n$1\r\n0\r\n*%d\r\n", len(keys))
+		for _, key := range keys {
+			out += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+		}
+		return out
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func testStoreConformance(t *testing.T, store Store) {
+	t.Helper()
+
+	store.Clear()
+
+	store.Set("a", []byte("alpha"), http.Header{"Content-Type": {"text/plain"}})
+	value, header, found := store.Get("a")
+	if !found || string(value) != "alpha" {
+		t.Fatalf("Expected alpha, got %q (found=%v)", value, found)
+	}
+	if header.Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected header round-trip, got %v", header)
+	}
+
+	store.SetWithTTL("moved", http.StatusMovedPermanently, nil, http.Header{"Location": {"/new"}}, time.Hour)
+	entry, found := store.GetEntry("moved")
+	if !found {
+		t.Fatal("Expected entry set with TTL to be found")
+	}
+	if entry.StatusCode != http.StatusMovedPermanently || entry.Header.Get("Location") != "/new" {
+		t.Errorf("Unexpected entry: status %d, header %v", entry.StatusCode, entry.Header)
+	}
+	if ttl := entry.ExpiresAt.Sub(entry.CreatedAt); ttl != time.Hour {
+		t.Errorf("Expected TTL of 1h, got %v", ttl)
+	}
+
+	if n := store.Size(); n != 2 {
+		t.Errorf("Expected size 2, got %d", n)
+	}
+
+	store.SetWithTTL("short", http.StatusOK, []byte("x"), http.Header{}, 20*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	if _, _, found := store.Get("short"); found {
+		t.Error("Expected short-lived entry to expire")
+	}
+
+	store.Delete("a")
+	if _, _, found := store.Get("a"); found {
+		t.Error("Expected deleted entry to be gone")
+	}
+
+	store.Clear()
+	for _, key := range []string{"GET:/assets/app.js", "GET:/assets/css/site.css|Accept-Language=de", "HEAD:/assets/logo.png", "GET:/api/assets/x", "idempotency:POST:/assets/upload:k"} {
+		store.Set(key, []byte("x"), http.Header{})
+	}
+	if n := store.DeletePrefix("/assets/"); n != 3 {
+		t.Errorf("Expected 3 entries purged under /assets/, got %d", n)
+	}
+	for _, key := range []string{"GET:/api/assets/x", "idempotency:POST:/assets/upload:k"} {
+		if _, _, found := store.Get(key); !found {
+			t.Errorf("Expected %s to survive the purge", key)
+		}
+	}
+
+	store.Clear()
+	if n := store.Size(); n != 0 {
+		t.Errorf("Expected empty store after Clear, got %d", n)
+	}
+}
+
+func TestStore_Memory(t *testing.T) {
+	testStoreConformance(t, NewCache(time.Minute))
+}
+
+func TestStore_Redis(t *testing.T) {
+	f := newFakeRedis(t)
+
+	var errs []string
+	store := NewRedisStore(RedisOptions{
+		Addr:      f.ln.Addr().String(),
+		KeyPrefix: "proxy-kp:",
+		Timeout:   time.Second,
+		TTL:       time.Minute,
+		OnError:   func(op string, err error) { errs = append(errs, op+": "+err.Error()) },
+	})
+
+	testStoreConformance(t, store)
+
+	if len(errs) != 0 {
+		t.Errorf("Unexpected Redis errors: %v", errs)
+	}
+}
+
+func TestStore_RedisLeavesOtherKeys(t *testing.T) {
+	f := newFakeRedis(t)
+	f.mu.Lock()
+	f.data["unrelated"] = "keep"
+	f.mu.Unlock()
+
+	store := NewRedisStore(RedisOptions{Addr: f.ln.Addr().String(), KeyPrefix: "proxy-kp:", Timeout: time.Second})
+	store.Set("a", []byte("alpha"), http.Header{})
+	store.Clear()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.data["unrelated"] != "keep" {
+		t.Error("Expected Clear to leave keys outside the prefix")
+	}
+}
+
+func TestStore_RedisUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var failures int
+	store := NewRedisStore(RedisOptions{
+		Addr:    addr,
+		Timeout: 100 * time.Millisecond,
+		OnError: func(op string, err error) { failures++ },
+	})
+
+	store.Set("a", []byte("alpha"), http.Header{})
+	if _, _, found := store.Get("a"); found {
+		t.Error("Expected miss when Redis is unreachable")
+	}
+	if failures != 2 {
+		t.Errorf("Expected 2 reported failures, got %d", failures)
+	}
+}
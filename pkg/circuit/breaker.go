@@ -0,0 +1,157 @@
+package circuit
+
+import (
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// StateChangeFunc is invoked after every state transition. It must not call
+// back into the breaker.
+type StateChangeFunc func(from, to State, reason string)
+
+type Breaker struct {
+	mu          sync.Mutex
+	state       State
+	failures    int
+	threshold   int
+	openTimeout time.Duration
+	openedAt    time.Time
+	// probeAt is when the in-flight half-open probe was admitted; zero when
+	// there is none.
+	probeAt  time.Time
+	onChange StateChangeFunc
+}
+
+func NewBreaker(threshold int, openTimeout time.Duration, onChange StateChangeFunc) *Breaker {
+	return &Breaker{
+		state:       StateClosed,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		onChange:    onChange,
+	}
+}
+
+// Ready reports whether traffic may be sent through the breaker without
+// changing its state, so it is safe for scans of a pool: true when closed,
+// when open past the open timeout, or when half-open with no probe in flight.
+// Callers about to send a request claim it with TryProbe.
+func (b *Breaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		return time.Since(b.openedAt) >= b.openTimeout
+	case StateHalfOpen:
+		return !b.probing()
+	default:
+		return true
+	}
+}
+
+// TryProbe claims the breaker for a request about to be sent. An open breaker
+// moves to half-open once the open timeout has elapsed. A half-open breaker
+// admits a single probe: TryProbe returns true to one caller and false to the
+// rest until the probe's outcome is recorded. A probe whose outcome never
+// arrives is given up after another open timeout.
+func (b *Breaker) TryProbe() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateClosed:
+		return true
+	case StateOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.transition(StateHalfOpen, "open timeout elapsed")
+	case StateHalfOpen:
+		if b.probing() {
+			return false
+		}
+	}
+
+	b.probeAt = time.Now()
+	return true
+}
+
+// probing reports whether a half-open probe is in flight. b.mu must be held.
+func (b *Breaker) probing() bool {
+	return !b.probeAt.IsZero() && time.Since(b.probeAt) < b.openTimeout
+}
+
+func (b *Breaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	if b.state == StateHalfOpen {
+		b.transition(StateClosed, "probe request succeeded")
+	}
+}
+
+func (b *Breaker) RecordFailure(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateHalfOpen:
+		b.transition(StateOpen, reason)
+	case StateClosed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.transition(StateOpen, reason)
+		}
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Detach stops the breaker reporting state changes and returns its current
+// state, for a breaker whose backend is being discarded.
+func (b *Breaker) Detach() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = nil
+	return b.state
+}
+
+func (b *Breaker) transition(to State, reason string) {
+	from := b.state
+	b.state = to
+	b.failures = 0
+	b.probeAt = time.Time{}
+	if to == StateOpen {
+		b.openedAt = time.Now()
+	}
+
+	if b.onChange != nil {
+		b.onChange(from, to, reason)
+	}
+}
@@ -0,0 +1,149 @@
+package circuit
+
+import (
+	"testing"
+	"time"
+)
+
+type transition struct {
+	from, to State
+}
+
+func TestBreaker_TripsAfterThreshold(t *testing.T) {
+	var got []transition
+	b := NewBreaker(3, time.Minute, func(from, to State, reason string) {
+		got = append(got, transition{from, to})
+	})
+
+	b.RecordFailure("dial error")
+	b.RecordFailure("dial error")
+	if b.State() != StateClosed {
+		t.Fatalf("Expected closed before threshold, got %s", b.State())
+	}
+
+	b.RecordFailure("dial error")
+	if b.State() != StateOpen {
+		t.Fatalf("Expected open after threshold, got %s", b.State())
+	}
+
+	if b.Ready() {
+		t.Error("Open breaker should not be ready before timeout")
+	}
+
+	if len(got) != 1 || got[0] != (transition{StateClosed, StateOpen}) {
+		t.Errorf("Unexpected transitions: %v", got)
+	}
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	b := NewBreaker(2, time.Minute, nil)
+
+	b.RecordFailure("timeout")
+	b.RecordSuccess()
+	b.RecordFailure("timeout")
+
+	if b.State() != StateClosed {
+		t.Errorf("Expected closed, got %s", b.State())
+	}
+}
+
+func TestBreaker_HalfOpenRecovery(t *testing.T) {
+	var got []transition
+	b := NewBreaker(1, 10*time.Millisecond, func(from, to State, reason string) {
+		got = append(got, transition{from, to})
+	})
+
+	b.RecordFailure("status 503")
+	time.Sleep(20 * time.Millisecond)
+
+	if !b.TryProbe() {
+		t.Fatal("Breaker should admit a probe after open timeout")
+	}
+	if b.State() != StateHalfOpen {
+		t.Fatalf("Expected half-open, got %s", b.State())
+	}
+
+	b.RecordSuccess()
+	if b.State() != StateClosed {
+		t.Fatalf("Expected closed, got %s", b.State())
+	}
+
+	expected := []transition{
+		{StateClosed, StateOpen},
+		{StateOpen, StateHalfOpen},
+		{StateHalfOpen, StateClosed},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d transitions, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Transition %d: expected %v, got %v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestBreaker_HalfOpenFailureReopens(t *testing.T) {
+	b := NewBreaker(1, 10*time.Millisecond, nil)
+
+	b.RecordFailure("status 503")
+	time.Sleep(20 * time.Millisecond)
+	b.TryProbe()
+
+	b.RecordFailure("status 503")
+	if b.State() != StateOpen {
+		t.Errorf("Expected open after failed probe, got %s", b.State())
+	}
+}
+
+func TestBreaker_HalfOpenAdmitsOneProbe(t *testing.T) {
+	b := NewBreaker(1, 20*time.Millisecond, nil)
+
+	b.RecordFailure("status 503")
+	time.Sleep(30 * time.Millisecond)
+
+	// Checking readiness does not use up the probe.
+	for i := 0; i < 3; i++ {
+		if !b.Ready() {
+			t.Fatal("Expected the breaker to be ready once the open timeout elapsed")
+		}
+	}
+	if b.State() != StateOpen {
+		t.Errorf("Expected Ready to leave the breaker open, got %s", b.State())
+	}
+
+	if !b.TryProbe() {
+		t.Fatal("Expected the first caller after the open timeout to get the probe")
+	}
+	for i := 0; i < 3; i++ {
+		if b.Ready() || b.TryProbe() {
+			t.Fatal("Expected no further callers while the probe is in flight")
+		}
+	}
+
+	// A probe that never reports back is given up after the open timeout.
+	time.Sleep(30 * time.Millisecond)
+	if !b.TryProbe() {
+		t.Fatal("Expected a new probe once the previous one went stale")
+	}
+
+	b.RecordSuccess()
+	if !b.TryProbe() || !b.TryProbe() {
+		t.Error("Expected a closed breaker to admit every caller")
+	}
+}
+
+func TestBreaker_DetachStopsNotifications(t *testing.T) {
+	var changes int
+	b := NewBreaker(1, time.Minute, func(from, to State, reason string) { changes++ })
+
+	b.RecordFailure("status 503")
+	if state := b.Detach(); state != StateOpen {
+		t.Errorf("Expected Detach to report open, got %s", state)
+	}
+	b.RecordSuccess()
+	b.RecordFailure("status 503")
+	if changes != 1 {
+		t.Errorf("Expected no notifications after Detach, got %d in total", changes)
+	}
+}
@@ -3,6 +3,7 @@ package health
 import (
 	"context"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
@@ -11,25 +12,31 @@ import (
 	"go.uber.org/zap"
 )
 
+type StateChangeFunc func(backend *balancer.Backend, healthy bool, failures int)
+
 type Checker struct {
-	balancer          *balancer.SRR
-	interval          time.Duration
-	timeout           time.Duration
-	endpoint          string
-	failureThreshold  int
-	recoveryInterval  time.Duration
-	client            *http.Client
-	logger            *zap.Logger
-	mu                sync.RWMutex
+	balancer         balancer.Balancer
+	interval         time.Duration
+	timeout          time.Duration
+	endpoint         string
+	failureThreshold int
+	recoveryInterval time.Duration
+	client           *http.Client
+	logger           *zap.Logger
+	mu               sync.RWMutex
 	failures         map[string]int
 	lastCheck        map[string]time.Time
+	listeners        []StateChangeFunc
+	jsonChecks       *JSONMatcher
+	tierIntervals    map[int]time.Duration
+	lastProbe        map[string]time.Time
 	stopCh           chan struct{}
 	stopOnce         sync.Once
 	wg               sync.WaitGroup
 }
 
 func NewChecker(
-	b *balancer.SRR,
+	b balancer.Balancer,
 	interval time.Duration,
 	timeout time.Duration,
 	endpoint string,
@@ -50,10 +57,31 @@ func NewChecker(
 		logger:    logger,
 		failures:  make(map[string]int),
 		lastCheck: make(map[string]time.Time),
+		lastProbe: make(map[string]time.Time),
 		stopCh:    make(chan struct{}),
 	}
 }
 
+// SetProxy sends health checks through the proxy chosen by proxy, as
+// http.Transport.Proxy does; the default client uses the environment's
+// proxy settings.
+func (c *Checker) SetProxy(proxy func(*http.Request) (*url.URL, error)) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	c.client.Transport = transport
+}
+
+// SetJSONChecks makes a 200 response pass only when its JSON body satisfies m.
+func (c *Checker) SetJSONChecks(m *JSONMatcher) {
+	c.jsonChecks = m
+}
+
+// SetTierIntervals probes backends of the given priority tiers every
+// interval instead of on every tick. Intervals are rounded up to whole ticks.
+func (c *Checker) SetTierIntervals(intervals map[int]time.Duration) {
+	c.tierIntervals = intervals
+}
+
 func (c *Checker) Start(ctx context.Context) {
 	c.wg.Add(1)
 	go c.run(ctx)
@@ -87,11 +115,34 @@ func (c *Checker) run(ctx context.Context) {
 func (c *Checker) checkAllBackends() {
 	backends := c.balancer.GetBackends()
 
+	now := time.Now()
 	for _, backend := range backends {
+		if !c.probeDue(backend, now) {
+			continue
+		}
 		go c.checkBackend(backend)
 	}
 }
 
+// probeDue reports whether backend's tier interval has passed since its last
+// probe, recording the probe if so.
+func (c *Checker) probeDue(backend *balancer.Backend, now time.Time) bool {
+	interval, ok := c.tierIntervals[backend.Priority()]
+	if !ok || interval <= c.interval {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Allow half a tick of slack so ticker jitter does not push a probe a
+	// whole tick late.
+	if last, probed := c.lastProbe[backend.URL]; probed && now.Sub(last) < interval-c.interval/2 {
+		return false
+	}
+	c.lastProbe[backend.URL] = now
+	return true
+}
+
 func (c *Checker) checkBackend(backend *balancer.Backend) {
 	var wasHealthy bool
 	var lastCheck time.Time
@@ -129,9 +180,19 @@ func (c *Checker) checkBackend(backend *balancer.Backend) {
 	defer resp.Body.Close()
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	c.lastCheck[backend.URL] = time.Now()
+	c.mu.Unlock()
+
+	if resp.StatusCode == http.StatusOK && c.jsonChecks != nil {
+		if err := c.jsonChecks.Match(resp.Body); err != nil {
+			c.logger.Warn("Backend health check failed",
+				zap.String("backend", backend.URL),
+				zap.String("reason", err.Error()),
+				zap.Duration("duration", duration))
+			c.handleFailure(backend)
+			return
+		}
+	}
 
 	if resp.StatusCode == http.StatusOK {
 		c.handleSuccess(backend)
@@ -149,33 +210,65 @@ func (c *Checker) checkBackend(backend *balancer.Backend) {
 
 func (c *Checker) handleFailure(backend *balancer.Backend) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 
 	c.failures[backend.URL]++
+	failures := c.failures[backend.URL]
 
-	if c.failures[backend.URL] >= c.failureThreshold {
+	changed := false
+	if failures >= c.failureThreshold {
 		if backend.IsHealthy() {
 			backend.SetHealthy(false)
+			changed = true
 			c.logger.Error("Backend marked unhealthy",
 				zap.String("backend", backend.URL),
-				zap.Int("failures", c.failures[backend.URL]))
+				zap.Int("failures", failures))
 		}
 	}
+	c.mu.Unlock()
+
+	if changed {
+		c.notify(backend, false, failures)
+	}
 }
 
 func (c *Checker) handleSuccess(backend *balancer.Backend) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 
 	if c.failures[backend.URL] > 0 {
 		c.failures[backend.URL] = 0
 	}
 
+	changed := false
 	if !backend.IsHealthy() {
 		backend.SetHealthy(true)
+		changed = true
 		c.logger.Info("Backend recovered and marked healthy",
 			zap.String("backend", backend.URL))
 	}
+	c.mu.Unlock()
+
+	if changed {
+		c.notify(backend, true, 0)
+	}
+}
+
+// OnStateChange registers fn to be called whenever a backend transitions
+// between healthy and unhealthy. Listeners run outside the checker's lock.
+func (c *Checker) OnStateChange(fn StateChangeFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+func (c *Checker) notify(backend *balancer.Backend, healthy bool, failures int) {
+	c.mu.RLock()
+	listeners := make([]StateChangeFunc, len(c.listeners))
+	copy(listeners, c.listeners)
+	c.mu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(backend, healthy, failures)
+	}
 }
 
 func (c *Checker) GetFailureCount(url string) int {
@@ -4,6 +4,8 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -76,3 +78,126 @@ func TestChecker_Stop(t *testing.T) {
 		t.Error("Backend should still be healthy after stop")
 	}
 }
+
+func TestChecker_BackendRecovers(t *testing.T) {
+	b := balancer.NewSRR()
+	logger := zap.NewNop()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	backend := balancer.NewBackend(server.URL, 10)
+	backend.SetHealthy(false)
+	b.AddBackend(backend)
+
+	checker := NewChecker(b, 50*time.Millisecond, time.Second, "/healthz", 1, 10*time.Millisecond, logger)
+
+	var recovered []string
+	checker.OnStateChange(func(backend *balancer.Backend, healthy bool, failures int) {
+		if healthy {
+			recovered = append(recovered, backend.URL)
+		}
+	})
+
+	checker.checkBackend(backend)
+
+	if !backend.IsHealthy() {
+		t.Error("Backend should be marked healthy after a successful check")
+	}
+	if len(recovered) != 1 || recovered[0] != server.URL {
+		t.Errorf("Expected one recovery event for %s, got %v", server.URL, recovered)
+	}
+}
+
+func TestChecker_JSONChecks(t *testing.T) {
+	cases := []struct {
+		name    string
+		body    string
+		healthy bool
+	}{
+		{"all up", `{"status":"UP","db":"UP","cache":{"status":"UP"}}`, true},
+		{"db down", `{"status":"UP","db":"DOWN","cache":{"status":"UP"}}`, false},
+		{"field missing", `{"status":"UP","cache":{"status":"UP"}}`, false},
+		{"not json", `OK`, false},
+	}
+
+	matcher, err := NewJSONMatcher(map[string]string{"status": "UP", "db": "UP", "$.cache.status": "UP"})
+	if err != nil {
+		t.Fatalf("NewJSONMatcher failed: %v", err)
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			b := balancer.NewSRR()
+			backend := balancer.NewBackend(server.URL, 10)
+			b.AddBackend(backend)
+
+			checker := NewChecker(b, time.Second, time.Second, "/healthz", 1, time.Second, zap.NewNop())
+			checker.SetJSONChecks(matcher)
+			checker.checkBackend(backend)
+
+			if backend.IsHealthy() != tc.healthy {
+				t.Errorf("Expected healthy %v, got %v", tc.healthy, backend.IsHealthy())
+			}
+		})
+	}
+}
+
+func TestChecker_JSONChecksBoundBody(t *testing.T) {
+	matcher, err := NewJSONMatcher(map[string]string{"status": "UP"})
+	if err != nil {
+		t.Fatalf("NewJSONMatcher failed: %v", err)
+	}
+
+	body := `{"status":"UP","pad":"` + strings.Repeat("x", maxHealthBodyBytes) + `"}`
+	if err := matcher.Match(strings.NewReader(body)); err == nil {
+		t.Error("Expected an oversized health body to fail the check")
+	}
+}
+
+func TestNewJSONMatcher_RejectsInvalidPath(t *testing.T) {
+	for _, path := range []string{"", "db..status", "$.", "status."} {
+		if _, err := NewJSONMatcher(map[string]string{path: "UP"}); err == nil {
+			t.Errorf("Expected path %q to be rejected", path)
+		}
+	}
+}
+
+func TestChecker_StandbyTierProbedLessOften(t *testing.T) {
+	var primaryProbes, standbyProbes atomic.Int32
+	counting := func(n *atomic.Int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n.Add(1)
+		}))
+	}
+	primaryServer := counting(&primaryProbes)
+	defer primaryServer.Close()
+	standbyServer := counting(&standbyProbes)
+	defer standbyServer.Close()
+
+	b := balancer.NewSRR()
+	b.AddBackend(balancer.NewBackend(primaryServer.URL, 1))
+	standby := balancer.NewBackend(standbyServer.URL, 1)
+	standby.SetPriority(1)
+	b.AddBackend(standby)
+
+	checker := NewChecker(b, 10*time.Millisecond, time.Second, "/healthz", 3, time.Second, zap.NewNop())
+	checker.SetTierIntervals(map[int]time.Duration{1: 100 * time.Millisecond})
+	checker.Start(context.Background())
+	time.Sleep(250 * time.Millisecond)
+	checker.Stop()
+
+	if n := primaryProbes.Load(); n < 15 {
+		t.Errorf("Expected the primary probed every 10ms, got %d probes", n)
+	}
+	if n := standbyProbes.Load(); n < 2 || n > 3 {
+		t.Errorf("Expected the standby probed every 100ms, got %d probes", n)
+	}
+}
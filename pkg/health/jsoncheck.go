@@ -0,0 +1,109 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxHealthBodyBytes bounds how much of a health response body is read for
+// JSON checks; larger bodies fail the check.
+const maxHealthBodyBytes = 64 << 10
+
+type jsonCheck struct {
+	path     string
+	segments []string
+	expected string
+}
+
+// JSONMatcher requires fields of a JSON health response to hold expected
+// values. Paths are dot-separated ("db.status", "checks.0.state"), with an
+// optional leading "$.".
+type JSONMatcher struct {
+	checks []jsonCheck
+}
+
+func NewJSONMatcher(checks map[string]string) (*JSONMatcher, error) {
+	m := &JSONMatcher{checks: make([]jsonCheck, 0, len(checks))}
+	for path, expected := range checks {
+		trimmed := strings.TrimPrefix(path, "$.")
+		segments := strings.Split(trimmed, ".")
+		for _, segment := range segments {
+			if segment == "" {
+				return nil, fmt.Errorf("invalid JSON check path %q", path)
+			}
+		}
+		m.checks = append(m.checks, jsonCheck{path: path, segments: segments, expected: expected})
+	}
+	return m, nil
+}
+
+// Match reads at most maxHealthBodyBytes from body and returns an error
+// describing the first field that is missing or differs from its expected
+// value.
+func (m *JSONMatcher) Match(body io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(body, maxHealthBodyBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed to read health response: %w", err)
+	}
+	if len(data) > maxHealthBodyBytes {
+		return fmt.Errorf("health response exceeds %d bytes", maxHealthBodyBytes)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("health response is not valid JSON: %w", err)
+	}
+
+	for _, check := range m.checks {
+		actual, ok := lookup(doc, check.segments)
+		if !ok {
+			return fmt.Errorf("field %q missing from health response", check.path)
+		}
+		if actual != check.expected {
+			return fmt.Errorf("field %q is %q, expected %q", check.path, actual, check.expected)
+		}
+	}
+	return nil
+}
+
+// lookup follows segments through objects and arrays and returns the scalar
+// found there as text.
+func lookup(doc interface{}, segments []string) (string, bool) {
+	current := doc
+	for _, segment := range segments {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[segment]
+			if !ok {
+				return "", false
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			current = node[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case nil:
+		return "null", true
+	default:
+		return "", false
+	}
+}
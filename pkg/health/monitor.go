@@ -2,16 +2,25 @@ package health
 
 import (
 	"sync"
+
+	"proxy-kp/pkg/balancer"
+
+	"go.uber.org/zap"
 )
 
 type Monitor struct {
-	checker *Checker
-	mu      sync.RWMutex
+	checker    *Checker
+	mu         sync.RWMutex
+	minHealthy int
+	degraded   bool
+	logger     *zap.Logger
+	onDegraded []func(degraded bool, healthy int)
 }
 
 func NewMonitor(checker *Checker) *Monitor {
 	return &Monitor{
 		checker: checker,
+		logger:  zap.NewNop(),
 	}
 }
 
@@ -43,3 +52,71 @@ func (m *Monitor) HealthyCount() int {
 func (m *Monitor) TotalCount() int {
 	return len(m.checker.balancer.GetBackends())
 }
+
+// SetMinHealthy enables the global degraded signal: whenever the healthy
+// backend count drops below min the monitor logs an error and notifies
+// OnDegradedChange listeners, and it signals recovery once the count rises
+// back. A min of zero disables the signal.
+func (m *Monitor) SetMinHealthy(min int, logger *zap.Logger) {
+	m.mu.Lock()
+	m.minHealthy = min
+	if logger != nil {
+		m.logger = logger
+	}
+	m.mu.Unlock()
+
+	if min > 0 {
+		m.checker.OnStateChange(func(*balancer.Backend, bool, int) {
+			m.Evaluate()
+		})
+	}
+}
+
+func (m *Monitor) OnDegradedChange(fn func(degraded bool, healthy int)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onDegraded = append(m.onDegraded, fn)
+}
+
+// Evaluate compares the current healthy count against the configured minimum
+// and fires listeners when the degraded state changes.
+func (m *Monitor) Evaluate() {
+	healthy := m.HealthyCount()
+
+	m.mu.Lock()
+	if m.minHealthy <= 0 {
+		m.mu.Unlock()
+		return
+	}
+
+	degraded := healthy < m.minHealthy
+	if degraded == m.degraded {
+		m.mu.Unlock()
+		return
+	}
+	m.degraded = degraded
+	min := m.minHealthy
+	listeners := make([]func(bool, int), len(m.onDegraded))
+	copy(listeners, m.onDegraded)
+	m.mu.Unlock()
+
+	if degraded {
+		m.logger.Error("Healthy backends below minimum",
+			zap.Int("healthy", healthy),
+			zap.Int("min_healthy", min))
+	} else {
+		m.logger.Info("Healthy backends recovered above minimum",
+			zap.Int("healthy", healthy),
+			zap.Int("min_healthy", min))
+	}
+
+	for _, fn := range listeners {
+		fn(degraded, healthy)
+	}
+}
+
+func (m *Monitor) Degraded() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.degraded
+}
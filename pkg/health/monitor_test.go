@@ -0,0 +1,76 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"proxy-kp/pkg/balancer"
+
+	"go.uber.org/zap"
+)
+
+func TestMonitor_MinHealthyThreshold(t *testing.T) {
+	b := balancer.NewSRR()
+	backend1 := balancer.NewBackend("http://localhost:8001", 10)
+	backend2 := balancer.NewBackend("http://localhost:8002", 10)
+	backend3 := balancer.NewBackend("http://localhost:8003", 10)
+	b.AddBackend(backend1)
+	b.AddBackend(backend2)
+	b.AddBackend(backend3)
+
+	checker := NewChecker(b, time.Second, time.Second, "/healthz", 1, time.Second, zap.NewNop())
+	monitor := NewMonitor(checker)
+
+	var events []bool
+	monitor.OnDegradedChange(func(degraded bool, healthy int) {
+		events = append(events, degraded)
+	})
+	monitor.SetMinHealthy(2, zap.NewNop())
+
+	checker.handleFailure(backend1)
+	if monitor.Degraded() {
+		t.Error("Should not be degraded with 2 of 3 healthy")
+	}
+
+	checker.handleFailure(backend2)
+	if !monitor.Degraded() {
+		t.Error("Should be degraded with 1 of 3 healthy")
+	}
+
+	checker.handleFailure(backend3)
+	checker.handleSuccess(backend3)
+	if !monitor.Degraded() {
+		t.Error("Should remain degraded while below minimum")
+	}
+
+	checker.handleSuccess(backend1)
+	if monitor.Degraded() {
+		t.Error("Should recover once healthy count reaches minimum")
+	}
+
+	expected := []bool{true, false}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Event %d: expected %v, got %v", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestMonitor_DisabledByDefault(t *testing.T) {
+	b := balancer.NewSRR()
+	backend := balancer.NewBackend("http://localhost:8001", 10)
+	b.AddBackend(backend)
+
+	checker := NewChecker(b, time.Second, time.Second, "/healthz", 1, time.Second, zap.NewNop())
+	monitor := NewMonitor(checker)
+
+	checker.handleFailure(backend)
+	monitor.Evaluate()
+
+	if monitor.Degraded() {
+		t.Error("Monitor without min_healthy should never be degraded")
+	}
+}
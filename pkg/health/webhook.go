@@ -0,0 +1,145 @@
+package health
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"proxy-kp/pkg/balancer"
+
+	"go.uber.org/zap"
+)
+
+const webhookQueueSize = 64
+
+type WebhookEvent struct {
+	Backend   string    `json:"backend"`
+	OldState  string    `json:"old_state"`
+	NewState  string    `json:"new_state"`
+	Failures  int       `json:"failures"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Webhook posts health state transitions to an external URL. Events are
+// queued and delivered by a background worker so the check loop never blocks.
+type Webhook struct {
+	url      string
+	client   *http.Client
+	retries  int
+	backoff  time.Duration
+	logger   *zap.Logger
+	queue    chan WebhookEvent
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewWebhook(url string, timeout time.Duration, retries int, logger *zap.Logger) *Webhook {
+	return &Webhook{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		retries: retries,
+		backoff: 500 * time.Millisecond,
+		logger:  logger,
+		queue:   make(chan WebhookEvent, webhookQueueSize),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+func (w *Webhook) Start() {
+	w.wg.Add(1)
+	go w.run()
+}
+
+func (w *Webhook) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+	})
+	w.wg.Wait()
+}
+
+// Notify is a StateChangeFunc that enqueues an event for delivery. Events are
+// dropped with a warning if the queue is full.
+func (w *Webhook) Notify(backend *balancer.Backend, healthy bool, failures int) {
+	event := WebhookEvent{
+		Backend:   backend.URL,
+		OldState:  stateName(!healthy),
+		NewState:  stateName(healthy),
+		Failures:  failures,
+		Timestamp: time.Now().UTC(),
+	}
+
+	select {
+	case w.queue <- event:
+	default:
+		w.logger.Warn("Health webhook queue full, dropping event",
+			zap.String("backend", backend.URL))
+	}
+}
+
+func (w *Webhook) run() {
+	defer w.wg.Done()
+
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case event := <-w.queue:
+			w.deliver(event)
+		}
+	}
+}
+
+func (w *Webhook) deliver(event WebhookEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		w.logger.Error("Failed to encode health webhook event", zap.Error(err))
+		return
+	}
+
+	for attempt := 0; attempt <= w.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-w.stopCh:
+				return
+			case <-time.After(w.backoff * time.Duration(attempt)):
+			}
+		}
+
+		err = w.post(payload)
+		if err == nil {
+			return
+		}
+		w.logger.Warn("Health webhook delivery failed",
+			zap.String("backend", event.Backend),
+			zap.Int("attempt", attempt+1),
+			zap.Error(err))
+	}
+
+	w.logger.Error("Health webhook delivery gave up",
+		zap.String("backend", event.Backend),
+		zap.Int("attempts", w.retries+1))
+}
+
+func (w *Webhook) post(payload []byte) error {
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func stateName(healthy bool) string {
+	if healthy {
+		return "healthy"
+	}
+	return "unhealthy"
+}
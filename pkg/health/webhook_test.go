@@ -0,0 +1,103 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxy-kp/pkg/balancer"
+
+	"go.uber.org/zap"
+)
+
+func TestWebhook_PostsTransitions(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []WebhookEvent
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Invalid payload: %v", err)
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	b := balancer.NewSRR()
+	backend := balancer.NewBackend("http://localhost:8001", 10)
+	b.AddBackend(backend)
+
+	checker := NewChecker(b, time.Second, time.Second, "/healthz", 2, time.Second, zap.NewNop())
+	webhook := NewWebhook(receiver.URL, time.Second, 0, zap.NewNop())
+	checker.OnStateChange(webhook.Notify)
+	webhook.Start()
+	defer webhook.Stop()
+
+	checker.handleFailure(backend)
+	checker.handleFailure(backend)
+	checker.handleSuccess(backend)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(events)
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	down := events[0]
+	if down.Backend != backend.URL || down.OldState != "healthy" || down.NewState != "unhealthy" || down.Failures != 2 {
+		t.Errorf("Unexpected unhealthy event: %+v", down)
+	}
+	if down.Timestamp.IsZero() {
+		t.Error("Expected timestamp in payload")
+	}
+
+	up := events[1]
+	if up.OldState != "unhealthy" || up.NewState != "healthy" {
+		t.Errorf("Unexpected recovery event: %+v", up)
+	}
+}
+
+func TestWebhook_RetriesOnFailure(t *testing.T) {
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	webhook := NewWebhook(receiver.URL, time.Second, 3, zap.NewNop())
+	webhook.backoff = time.Millisecond
+	webhook.Start()
+	defer webhook.Stop()
+
+	webhook.Notify(balancer.NewBackend("http://localhost:8001", 1), false, 3)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for attempts.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("Expected delivery to succeed on attempt 3, got %d attempts", n)
+	}
+}
@@ -0,0 +1,28 @@
+package logger
+
+import "go.uber.org/zap"
+
+// structured splits args of the "message, fields..." form the proxy logs
+// with, e.g. Info("Backend added", zap.String("url", u)), into a message and
+// zap fields. Any other args report false and are left to the sugared
+// logger, which concatenates them into the message as before.
+func structured(args []interface{}) (string, []zap.Field, bool) {
+	if len(args) == 0 {
+		return "", nil, false
+	}
+
+	msg, ok := args[0].(string)
+	if !ok {
+		return "", nil, false
+	}
+
+	fields := make([]zap.Field, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		field, ok := arg.(zap.Field)
+		if !ok {
+			return "", nil, false
+		}
+		fields = append(fields, field)
+	}
+	return msg, fields, true
+}
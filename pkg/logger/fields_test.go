@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestStructured(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []interface{}
+		ok         bool
+		msg        string
+		fieldCount int
+	}{
+		{"no args", nil, false, "", 0},
+		{"message only", []interface{}{"Server started"}, true, "Server started", 0},
+		{"message and fields", []interface{}{"Backend added", zap.String("url", "http://a"), zap.Int("weight", 2)}, true, "Backend added", 2},
+		{"error field", []interface{}{"Dial failed", zap.Error(errors.New("refused"))}, true, "Dial failed", 1},
+		{"non-string first arg", []interface{}{42, zap.String("k", "v")}, false, "", 0},
+		{"plain values", []interface{}{"retry ", 3}, false, "", 0},
+		{"field then plain value", []interface{}{"Mixed", zap.String("k", "v"), "tail"}, false, "", 0},
+		{"nil arg", []interface{}{"Nil", nil}, false, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, fields, ok := structured(tt.args)
+			if ok != tt.ok || msg != tt.msg || len(fields) != tt.fieldCount {
+				t.Errorf("Expected (%q, %d fields, %v), got (%q, %d fields, %v)",
+					tt.msg, tt.fieldCount, tt.ok, msg, len(fields), ok)
+			}
+		})
+	}
+}
+
+func TestLogger_LevelsLogStructuredFields(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	log := FromZap(zap.New(core))
+
+	levels := []struct {
+		level zapcore.Level
+		log   func(args ...interface{})
+	}{
+		{zap.DebugLevel, log.Debug},
+		{zap.InfoLevel, log.Info},
+		{zap.WarnLevel, log.Warn},
+		{zap.ErrorLevel, log.Error},
+	}
+
+	for _, l := range levels {
+		t.Run(l.level.String(), func(t *testing.T) {
+			l.log("Request completed", zap.String("path", "/"), zap.Int("status", 200))
+			l.log("retry ", 3)
+
+			entries := logs.TakeAll()
+			if len(entries) != 2 {
+				t.Fatalf("Expected 2 entries, got %d", len(entries))
+			}
+			structuredEntry, sugared := entries[0], entries[1]
+			if structuredEntry.Level != l.level || structuredEntry.Message != "Request completed" {
+				t.Errorf("Expected %s %q, got %s %q", l.level, "Request completed", structuredEntry.Level, structuredEntry.Message)
+			}
+			fields := structuredEntry.ContextMap()
+			if fields["path"] != "/" || fields["status"] != int64(200) {
+				t.Errorf("Unexpected fields: %v", fields)
+			}
+			if sugared.Message != "retry 3" || len(sugared.Context) != 0 {
+				t.Errorf("Expected plain args concatenated into the message, got %q %v", sugared.Message, sugared.Context)
+			}
+		})
+	}
+}
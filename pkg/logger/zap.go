@@ -13,6 +13,16 @@ type Logger struct {
 }
 
 func New(level string, format string) (*Logger, error) {
+	return build(level, format, false)
+}
+
+// NewWithFallback is like New, but an unparseable level falls back to info
+// with a warning instead of failing.
+func NewWithFallback(level string, format string) (*Logger, error) {
+	return build(level, format, true)
+}
+
+func build(level string, format string, fallback bool) (*Logger, error) {
 	var config zap.Config
 
 	if format == "console" {
@@ -22,10 +32,15 @@ func New(level string, format string) (*Logger, error) {
 		config = zap.NewProductionConfig()
 	}
 
+	invalidLevel := false
 	if level != "" {
 		var lvl zapcore.Level
 		if err := lvl.UnmarshalText([]byte(level)); err != nil {
-			return nil, fmt.Errorf("invalid log level: %s", level)
+			if !fallback {
+				return nil, fmt.Errorf("invalid log level: %s", level)
+			}
+			invalidLevel = true
+			lvl = zapcore.InfoLevel
 		}
 		config.Level = zap.NewAtomicLevelAt(lvl)
 	}
@@ -38,12 +53,40 @@ func New(level string, format string) (*Logger, error) {
 		return nil, fmt.Errorf("failed to create logger: %w", err)
 	}
 
+	if invalidLevel {
+		zapLogger.Warn("Invalid log level, falling back to info",
+			zap.String("level", level))
+	}
+
 	return &Logger{
 		zapLogger: zapLogger,
 		sugar:     zapLogger.Sugar(),
 	}, nil
 }
 
+// NewAudit returns a JSON logger writing info-level entries to path ("stdout",
+// "stderr" or a file), kept apart from the application log.
+func NewAudit(path string) (*Logger, error) {
+	config := zap.NewProductionConfig()
+	config.OutputPaths = []string{path}
+	config.Sampling = nil
+	config.DisableCaller = true
+	config.DisableStacktrace = true
+
+	zapLogger, err := config.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit logger: %w", err)
+	}
+	return FromZap(zapLogger), nil
+}
+
+func FromZap(zapLogger *zap.Logger) *Logger {
+	return &Logger{
+		zapLogger: zapLogger,
+		sugar:     zapLogger.Sugar(),
+	}
+}
+
 func (l *Logger) Sync() error {
 	return l.zapLogger.Sync()
 }
@@ -57,6 +100,10 @@ func (l *Logger) With(fields ...zap.Field) *Logger {
 }
 
 func (l *Logger) Debug(args ...interface{}) {
+	if msg, fields, ok := structured(args); ok {
+		l.zapLogger.Debug(msg, fields...)
+		return
+	}
 	l.sugar.Debug(args...)
 }
 
@@ -65,6 +112,10 @@ func (l *Logger) Debugf(template string, args ...interface{}) {
 }
 
 func (l *Logger) Info(args ...interface{}) {
+	if msg, fields, ok := structured(args); ok {
+		l.zapLogger.Info(msg, fields...)
+		return
+	}
 	l.sugar.Info(args...)
 }
 
@@ -73,6 +124,10 @@ func (l *Logger) Infof(template string, args ...interface{}) {
 }
 
 func (l *Logger) Warn(args ...interface{}) {
+	if msg, fields, ok := structured(args); ok {
+		l.zapLogger.Warn(msg, fields...)
+		return
+	}
 	l.sugar.Warn(args...)
 }
 
@@ -81,6 +136,10 @@ func (l *Logger) Warnf(template string, args ...interface{}) {
 }
 
 func (l *Logger) Error(args ...interface{}) {
+	if msg, fields, ok := structured(args); ok {
+		l.zapLogger.Error(msg, fields...)
+		return
+	}
 	l.sugar.Error(args...)
 }
 
@@ -89,6 +148,10 @@ func (l *Logger) Errorf(template string, args ...interface{}) {
 }
 
 func (l *Logger) Fatal(args ...interface{}) {
+	if msg, fields, ok := structured(args); ok {
+		l.zapLogger.Fatal(msg, fields...)
+		return
+	}
 	l.sugar.Fatal(args...)
 }
 
@@ -0,0 +1,22 @@
+package logger
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNewWithFallback_InvalidLevel(t *testing.T) {
+	if _, err := New("loud", "json"); err == nil {
+		t.Fatal("Expected New to reject an invalid level")
+	}
+
+	log, err := NewWithFallback("loud", "json")
+	if err != nil {
+		t.Fatalf("Expected fallback instead of an error, got %v", err)
+	}
+	core := log.Zap().Core()
+	if !core.Enabled(zap.InfoLevel) || core.Enabled(zap.DebugLevel) {
+		t.Error("Expected the fallback logger to log at info level")
+	}
+}
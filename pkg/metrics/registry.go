@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type Counter struct {
+	value atomic.Int64
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n int64) {
+	c.value.Add(n)
+}
+
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if g.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Registry holds named counters and gauges. Labels are passed as key/value
+// pairs and become part of the series name.
+type Registry struct {
+	mu       sync.RWMutex
+	counters map[string]*Counter
+	gauges   map[string]*Gauge
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		counters: make(map[string]*Counter),
+		gauges:   make(map[string]*Gauge),
+	}
+}
+
+func (r *Registry) Counter(name string, labels ...string) *Counter {
+	key := seriesName(name, labels)
+
+	r.mu.RLock()
+	c, exists := r.counters[key]
+	r.mu.RUnlock()
+	if exists {
+		return c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, exists := r.counters[key]; exists {
+		return c
+	}
+	c = &Counter{}
+	r.counters[key] = c
+	return c
+}
+
+func (r *Registry) Gauge(name string, labels ...string) *Gauge {
+	key := seriesName(name, labels)
+
+	r.mu.RLock()
+	g, exists := r.gauges[key]
+	r.mu.RUnlock()
+	if exists {
+		return g
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if g, exists := r.gauges[key]; exists {
+		return g
+	}
+	g = &Gauge{}
+	r.gauges[key] = g
+	return g
+}
+
+// Snapshot returns the current value of every series keyed by series name.
+func (r *Registry) Snapshot() map[string]float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string]float64, len(r.counters)+len(r.gauges))
+	for key, c := range r.counters {
+		result[key] = float64(c.Value())
+	}
+	for key, g := range r.gauges {
+		result[key] = g.Value()
+	}
+	return result
+}
+
+// WriteText writes all series in the Prometheus text exposition format,
+// sorted by series name.
+func (r *Registry) WriteText(w io.Writer) error {
+	snapshot := r.Snapshot()
+
+	keys := make([]string, 0, len(snapshot))
+	for key := range snapshot {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s %g\n", key, snapshot[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func seriesName(name string, labels []string) string {
+	if len(labels) < 2 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegistry_CounterReuse(t *testing.T) {
+	r := NewRegistry()
+
+	r.Counter("requests_total", "backend", "a").Inc()
+	r.Counter("requests_total", "backend", "a").Inc()
+	r.Counter("requests_total", "backend", "b").Inc()
+
+	if v := r.Counter("requests_total", "backend", "a").Value(); v != 2 {
+		t.Errorf("Expected 2, got %d", v)
+	}
+	if v := r.Counter("requests_total", "backend", "b").Value(); v != 1 {
+		t.Errorf("Expected 1, got %d", v)
+	}
+}
+
+func TestRegistry_Gauge(t *testing.T) {
+	r := NewRegistry()
+
+	g := r.Gauge("open_circuits")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	if v := r.Gauge("open_circuits").Value(); v != 1 {
+		t.Errorf("Expected 1, got %v", v)
+	}
+}
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+
+	r.Counter("b_total").Add(3)
+	r.Gauge("a_gauge", "backend", "http://x").Set(1.5)
+
+	var sb strings.Builder
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+
+	expected := "a_gauge{backend=\"http://x\"} 1.5\nb_total 3\n"
+	if sb.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, sb.String())
+	}
+}
+
+func TestRegistry_ConcurrentAccess(t *testing.T) {
+	r := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r.Counter("hits_total").Inc()
+		}()
+		go func() {
+			defer wg.Done()
+			r.Gauge("inflight").Add(1)
+		}()
+	}
+	wg.Wait()
+
+	if v := r.Counter("hits_total").Value(); v != 100 {
+		t.Errorf("Expected 100, got %d", v)
+	}
+	if v := r.Gauge("inflight").Value(); v != 100 {
+		t.Errorf("Expected 100, got %v", v)
+	}
+}
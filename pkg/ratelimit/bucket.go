@@ -0,0 +1,40 @@
+package ratelimit
+
+import "golang.org/x/time/rate"
+
+// bucket admits or rejects the requests of one client, or of every client
+// sharing the overflow or global bucket.
+type bucket interface {
+	Allow() bool
+	// setLimit changes the rate in place, keeping the current state.
+	setLimit(requestsPerMinute int, burst int)
+	// tokens is how many requests would be allowed right now.
+	tokens() float64
+}
+
+// tokenBucket refills at requestsPerMinute and allows bursts of up to burst
+// requests after a quiet period.
+type tokenBucket struct {
+	limiter *rate.Limiter
+}
+
+func newTokenBucket(requestsPerMinute int, burst int) bucket {
+	return &tokenBucket{limiter: rate.NewLimiter(perSecond(requestsPerMinute), burst)}
+}
+
+func (b *tokenBucket) Allow() bool {
+	return b.limiter.Allow()
+}
+
+func (b *tokenBucket) setLimit(requestsPerMinute int, burst int) {
+	b.limiter.SetLimit(perSecond(requestsPerMinute))
+	b.limiter.SetBurst(burst)
+}
+
+func (b *tokenBucket) tokens() float64 {
+	return b.limiter.Tokens()
+}
+
+func perSecond(requestsPerMinute int) rate.Limit {
+	return rate.Limit(float64(requestsPerMinute) / 60.0)
+}
@@ -7,7 +7,6 @@ import (
 
 func (r *Limiter) CleanupStale(idleTimeout time.Duration) int {
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
 
 	now := time.Now()
 	count := 0
@@ -19,6 +18,13 @@ func (r *Limiter) CleanupStale(idleTimeout time.Duration) int {
 		}
 	}
 
+	notify := func() {}
+	if r.degraded && len(r.limiters) < r.maxClients {
+		notify = r.setDegraded(false)
+	}
+	r.mutex.Unlock()
+	notify()
+
 	return count
 }
 
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"net"
+	"sync"
+)
+
+// ConnLimitListener caps simultaneous TCP connections per source IP. Accepted
+// connections beyond the cap are closed immediately and never reach the HTTP
+// server.
+type ConnLimitListener struct {
+	net.Listener
+	maxPerIP int
+	onReject func(ip string)
+	mutex    sync.Mutex
+	conns    map[string]int
+}
+
+func NewConnLimitListener(inner net.Listener, maxPerIP int, onReject func(ip string)) *ConnLimitListener {
+	return &ConnLimitListener{
+		Listener: inner,
+		maxPerIP: maxPerIP,
+		onReject: onReject,
+		conns:    make(map[string]int),
+	}
+}
+
+func (l *ConnLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip := remoteIP(conn)
+		if l.acquire(ip) {
+			return &limitedConn{Conn: conn, release: func() { l.release(ip) }}, nil
+		}
+
+		conn.Close()
+		if l.onReject != nil {
+			l.onReject(ip)
+		}
+	}
+}
+
+func (l *ConnLimitListener) Count(ip string) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.conns[ip]
+}
+
+func (l *ConnLimitListener) acquire(ip string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conns[ip] >= l.maxPerIP {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *ConnLimitListener) release(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.conns[ip]--
+	if l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnLimitListener_RefusesExcessConnections(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	var rejected atomic.Int32
+	ln := NewConnLimitListener(inner, 2, func(ip string) {
+		if ip != "127.0.0.1" {
+			t.Errorf("Expected rejection for 127.0.0.1, got %s", ip)
+		}
+		rejected.Add(1)
+	})
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		return conn
+	}
+
+	var clients []net.Conn
+	for i := 0; i < 2; i++ {
+		clients = append(clients, dial())
+		select {
+		case <-accepted:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Connection %d was not accepted", i)
+		}
+	}
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+
+	excess := dial()
+	defer excess.Close()
+	excess.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := excess.Read(make([]byte, 1)); err == nil {
+		t.Error("Expected excess connection to be closed by the listener")
+	}
+	if n := rejected.Load(); n != 1 {
+		t.Errorf("Expected 1 rejected connection, got %d", n)
+	}
+	if n := ln.Count("127.0.0.1"); n != 2 {
+		t.Errorf("Expected 2 tracked connections, got %d", n)
+	}
+}
+
+func TestConnLimitListener_ReleasesOnClose(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	ln := NewConnLimitListener(inner, 1, nil)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+
+		select {
+		case conn := <-accepted:
+			conn.Close()
+			conn.Close()
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Connection %d was not accepted after previous close", i)
+		}
+		client.Close()
+	}
+
+	if n := ln.Count("127.0.0.1"); n != 0 {
+		t.Errorf("Expected no tracked connections, got %d", n)
+	}
+}
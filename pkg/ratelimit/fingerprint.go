@@ -0,0 +1,20 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// FingerprintKey returns a limiter key combining ip with a short hash of the
+// request's User-Agent and the given headers, so clients sharing an IP but
+// presenting different fingerprints get separate buckets.
+func FingerprintKey(ip string, r *http.Request, headers []string) string {
+	h := sha256.New()
+	h.Write([]byte(r.UserAgent()))
+	for _, name := range headers {
+		h.Write([]byte{0})
+		h.Write([]byte(r.Header.Get(name)))
+	}
+	return ip + "|" + hex.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFingerprintKey(t *testing.T) {
+	headers := []string{"Accept-Language"}
+
+	a := httptest.NewRequest("GET", "/", nil)
+	a.Header.Set("User-Agent", "curl/8.0")
+	b := httptest.NewRequest("GET", "/", nil)
+	b.Header.Set("User-Agent", "Mozilla/5.0")
+	c := httptest.NewRequest("GET", "/other", nil)
+	c.Header.Set("User-Agent", "curl/8.0")
+	d := httptest.NewRequest("GET", "/", nil)
+	d.Header.Set("User-Agent", "curl/8.0")
+	d.Header.Set("Accept-Language", "en-US")
+
+	keyA := FingerprintKey("10.0.0.1", a, headers)
+	if !strings.HasPrefix(keyA, "10.0.0.1|") {
+		t.Errorf("Expected key to start with the IP, got %q", keyA)
+	}
+	if keyA == FingerprintKey("10.0.0.1", b, headers) {
+		t.Error("Expected different User-Agents to produce different keys")
+	}
+	if keyA != FingerprintKey("10.0.0.1", c, headers) {
+		t.Error("Expected identical fingerprints to produce the same key")
+	}
+	if keyA == FingerprintKey("10.0.0.1", d, headers) {
+		t.Error("Expected a selected header to change the key")
+	}
+	if keyA == FingerprintKey("10.0.0.2", a, headers) {
+		t.Error("Expected different IPs to produce different keys")
+	}
+}
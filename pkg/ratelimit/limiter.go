@@ -1,39 +1,64 @@
 package ratelimit
 
 import (
+	"strings"
 	"sync"
 	"time"
-
-	"golang.org/x/time/rate"
 )
 
 type Limiter struct {
-	limiters map[string]*clientLimiter
-	mutex    sync.RWMutex
-	limit    rate.Limit
-	burst    int
+	limiters          map[string]*clientLimiter
+	mutex             sync.RWMutex
+	requestsPerMinute int
+	burst             int
+	newBucket         func(requestsPerMinute int, burst int) bucket
+
+	maxClients int
+	overflow   bucket
+	degraded   bool
+	onDegraded func(degraded bool, clients int)
+
+	// global, when set, is the one bucket shared by every client.
+	global bucket
 }
 
 type clientLimiter struct {
-	limiter  *rate.Limiter
+	limiter  bucket
 	lastSeen time.Time
 }
 
+// NewLimiter returns a token bucket limiter: each client refills at
+// requestsPerMinute and may burst up to burst requests.
 func NewLimiter(requestsPerMinute int, burst int) *Limiter {
-	reqPerSec := float64(requestsPerMinute) / 60.0
+	return newLimiter(requestsPerMinute, burst, newTokenBucket)
+}
+
+// NewSlidingWindowLimiter returns a limiter allowing each client at most
+// requestsPerMinute requests over any trailing minute, with no burst
+// allowance after a quiet period.
+func NewSlidingWindowLimiter(requestsPerMinute int) *Limiter {
+	return newLimiter(requestsPerMinute, 0, newSlidingWindow)
+}
 
+func newLimiter(requestsPerMinute int, burst int, newBucket func(int, int) bucket) *Limiter {
 	return &Limiter{
-		limiters: make(map[string]*clientLimiter),
-		limit:    rate.Limit(reqPerSec),
-		burst:    burst,
+		limiters:          make(map[string]*clientLimiter),
+		requestsPerMinute: requestsPerMinute,
+		burst:             burst,
+		newBucket:         newBucket,
 	}
 }
 
 func (r *Limiter) Allow(ip string) bool {
 	r.mutex.RLock()
+	global := r.global
 	limiter, exists := r.limiters[ip]
 	r.mutex.RUnlock()
 
+	if global != nil {
+		return global.Allow()
+	}
+
 	if !exists {
 		return r.createNewLimiter(ip)
 	}
@@ -45,31 +70,135 @@ func (r *Limiter) Allow(ip string) bool {
 	return limiter.limiter.Allow()
 }
 
-func (r *Limiter) createNewLimiter(ip string) bool {
+// SetMaxClients caps the number of per-client buckets. Once max clients are
+// tracked, new clients share a single overflow bucket allowing
+// requestsPerMinute and burst, until cleanup brings the count back under max.
+// onChange, if not nil, is called on entering and leaving that degraded mode.
+func (r *Limiter) SetMaxClients(max int, requestsPerMinute int, burst int, onChange func(degraded bool, clients int)) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	r.maxClients = max
+	r.overflow = r.newBucket(requestsPerMinute, burst)
+	r.onDegraded = onChange
+}
+
+// SetGlobal switches between one bucket per client and a single bucket
+// shared by all requests, allowing requestsPerMinute and burst in total.
+// Client buckets are kept but not consulted while global.
+func (r *Limiter) SetGlobal(global bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !global {
+		r.global = nil
+		return
+	}
+	if r.global == nil {
+		r.global = r.newBucket(r.requestsPerMinute, r.burst)
+	}
+}
+
+// Global reports whether all requests share a single bucket.
+func (r *Limiter) Global() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.global != nil
+}
+
+// Degraded reports whether new clients currently share the overflow bucket.
+func (r *Limiter) Degraded() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.degraded
+}
+
+func (r *Limiter) createNewLimiter(ip string) bool {
+	r.mutex.Lock()
+
 	if limiter, exists := r.limiters[ip]; exists {
 		limiter.lastSeen = time.Now()
+		r.mutex.Unlock()
 		return limiter.limiter.Allow()
 	}
 
+	if r.maxClients > 0 && len(r.limiters) >= r.maxClients {
+		notify := r.setDegraded(true)
+		r.mutex.Unlock()
+		notify()
+		return r.overflow.Allow()
+	}
+
 	limiter := &clientLimiter{
-		limiter:  rate.NewLimiter(r.limit, r.burst),
+		limiter:  r.newBucket(r.requestsPerMinute, r.burst),
 		lastSeen: time.Now(),
 	}
 	r.limiters[ip] = limiter
+	notify := r.setDegraded(false)
+	r.mutex.Unlock()
+	notify()
 
 	return limiter.limiter.Allow()
 }
 
-func (r *Limiter) getLimiter(ip string) *rate.Limiter {
+// setDegraded records the degraded mode and returns a function reporting a
+// change to onDegraded, to be called once the mutex is released. It must be
+// called with the mutex held for writing.
+func (r *Limiter) setDegraded(degraded bool) func() {
+	if r.degraded == degraded || r.onDegraded == nil {
+		r.degraded = degraded
+		return func() {}
+	}
+	r.degraded = degraded
+	fn, clients := r.onDegraded, len(r.limiters)
+	return func() { fn(degraded, clients) }
+}
+
+// Reset forgets the bucket of ip, and any fingerprinted buckets keyed on
+// it, so the client starts over with a full allowance. It reports whether
+// anything was removed.
+func (r *Limiter) Reset(ip string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	removed := false
+	for key := range r.limiters {
+		if key == ip || strings.HasPrefix(key, ip+"|") {
+			delete(r.limiters, key)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// Stats reports how many requests the bucket keyed on ip would allow right
+// now and when it was last used. ok is false for untracked keys.
+func (r *Limiter) Stats(ip string) (tokens float64, lastSeen time.Time, ok bool) {
 	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+	client, exists := r.limiters[ip]
+	if exists {
+		lastSeen = client.lastSeen
+	}
+	r.mutex.RUnlock()
 
-	if limiter, exists := r.limiters[ip]; exists {
-		return limiter.limiter
+	if !exists {
+		return 0, time.Time{}, false
 	}
+	return client.limiter.tokens(), lastSeen, true
+}
+
+// SetLimit changes the rate and burst for all clients, including those
+// already tracked.
+func (r *Limiter) SetLimit(requestsPerMinute int, burst int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 
-	return nil
+	r.requestsPerMinute = requestsPerMinute
+	r.burst = burst
+	if r.global != nil {
+		r.global.setLimit(requestsPerMinute, burst)
+	}
+	for _, client := range r.limiters {
+		client.limiter.setLimit(requestsPerMinute, burst)
+	}
 }
@@ -189,3 +189,73 @@ func TestLimiter_RefillRate(t *testing.T) {
 		t.Log("Request after refill may be allowed depending on timing")
 	}
 }
+
+func TestLimiter_MaxClients_DegradesAndRecovers(t *testing.T) {
+	limiter := NewLimiter(60, 5)
+
+	var changes []bool
+	limiter.SetMaxClients(2, 60, 1, func(degraded bool, clients int) {
+		changes = append(changes, degraded)
+	})
+
+	limiter.Allow("10.0.0.1")
+	limiter.Allow("10.0.0.2")
+	if limiter.Degraded() || len(changes) != 0 {
+		t.Fatalf("Expected per-client mode below the limit, changes %v", changes)
+	}
+
+	// Overflow clients share one bucket with a burst of 1.
+	if !limiter.Allow("10.0.0.3") {
+		t.Error("Expected first overflow request to be allowed")
+	}
+	if limiter.Allow("10.0.0.4") {
+		t.Error("Expected second overflow client to share the exhausted bucket")
+	}
+	if !limiter.Degraded() {
+		t.Error("Expected degraded mode past the limit")
+	}
+	if limiter.Size() != 2 {
+		t.Errorf("Expected no new buckets in degraded mode, got %d", limiter.Size())
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	limiter.CleanupStale(time.Millisecond)
+
+	if limiter.Degraded() {
+		t.Error("Expected recovery once cleanup drops below the limit")
+	}
+	if !limiter.Allow("10.0.0.4") {
+		t.Error("Expected a recovered client to get its own bucket")
+	}
+	if limiter.Size() != 1 {
+		t.Errorf("Expected 1 tracked client after recovery, got %d", limiter.Size())
+	}
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("Expected degraded then recovered notifications, got %v", changes)
+	}
+}
+
+func TestLimiter_ResetAndStats(t *testing.T) {
+	limiter := NewLimiter(60, 3)
+
+	if _, _, ok := limiter.Stats("192.168.1.1"); ok {
+		t.Error("Expected no stats for an unseen client")
+	}
+
+	limiter.Allow("192.168.1.1")
+	limiter.Allow("192.168.1.1|abcd")
+	tokens, lastSeen, ok := limiter.Stats("192.168.1.1")
+	if !ok || tokens < 1.9 || tokens > 2.1 || lastSeen.IsZero() {
+		t.Errorf("Expected about 2 tokens left and a last seen time, got %v %v %v", tokens, lastSeen, ok)
+	}
+
+	if !limiter.Reset("192.168.1.1") {
+		t.Fatal("Expected Reset to remove the client")
+	}
+	if limiter.Size() != 0 {
+		t.Errorf("Expected the fingerprinted bucket to be reset too, %d left", limiter.Size())
+	}
+	if limiter.Reset("192.168.1.1") {
+		t.Error("Expected a second Reset to find nothing")
+	}
+}
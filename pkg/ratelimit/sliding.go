@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// slidingWindowSize is the trailing window requests are counted over.
+const slidingWindowSize = time.Minute
+
+// slidingWindow is a sliding window counter: it allows at most limit
+// requests over any trailing minute, estimating the count from the current
+// and previous fixed windows weighted by their overlap with it. Unlike a
+// token bucket it gives no full burst after a quiet period.
+type slidingWindow struct {
+	mu       sync.Mutex
+	limit    int
+	start    time.Time
+	current  int
+	previous int
+}
+
+func newSlidingWindow(requestsPerMinute int, _ int) bucket {
+	return &slidingWindow{limit: requestsPerMinute}
+}
+
+func (w *slidingWindow) Allow() bool {
+	return w.allowAt(time.Now())
+}
+
+func (w *slidingWindow) allowAt(now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch elapsed := now.Sub(w.start); {
+	case w.start.IsZero() || elapsed >= 2*slidingWindowSize:
+		w.start = now.Truncate(slidingWindowSize)
+		w.previous, w.current = 0, 0
+	case elapsed >= slidingWindowSize:
+		w.start = w.start.Add(slidingWindowSize)
+		w.previous, w.current = w.current, 0
+	}
+
+	overlap := 1 - float64(now.Sub(w.start))/float64(slidingWindowSize)
+	if float64(w.previous)*overlap+float64(w.current) >= float64(w.limit) {
+		return false
+	}
+	w.current++
+	return true
+}
+
+func (w *slidingWindow) tokens() float64 {
+	return w.tokensAt(time.Now())
+}
+
+// tokensAt is the room left in the trailing window at now.
+func (w *slidingWindow) tokensAt(now time.Time) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var used float64
+	switch elapsed := now.Sub(w.start); {
+	case w.start.IsZero() || elapsed >= 2*slidingWindowSize:
+	case elapsed >= slidingWindowSize:
+		used = float64(w.current) * (1 - float64(elapsed-slidingWindowSize)/float64(slidingWindowSize))
+	default:
+		used = float64(w.previous)*(1-float64(elapsed)/float64(slidingWindowSize)) + float64(w.current)
+	}
+	return max(float64(w.limit)-used, 0)
+}
+
+func (w *slidingWindow) setLimit(requestsPerMinute int, _ int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.limit = requestsPerMinute
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingWindow_NoBurstAfterQuietPeriod(t *testing.T) {
+	w := newSlidingWindow(10, 0).(*slidingWindow)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if w.allowAt(start) {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Fatalf("Expected 10 requests allowed in the first minute, got %d", allowed)
+	}
+
+	// Half a minute into the next window, half of the previous window's
+	// count still falls inside the trailing minute.
+	mid := start.Add(90 * time.Second)
+	allowed = 0
+	for i := 0; i < 20; i++ {
+		if w.allowAt(mid) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("Expected 5 requests allowed with half the previous window counted, got %d", allowed)
+	}
+
+	// After two quiet minutes the count starts over, but never above limit.
+	later := start.Add(5 * time.Minute)
+	allowed = 0
+	for i := 0; i < 20; i++ {
+		if w.allowAt(later) {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("Expected the limit, not a larger burst, after a quiet period, got %d", allowed)
+	}
+}
+
+func TestSlidingWindowLimiter_PerClient(t *testing.T) {
+	limiter := NewSlidingWindowLimiter(3)
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow("192.168.1.1") {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	if limiter.Allow("192.168.1.1") {
+		t.Error("Expected the fourth request in the window to be rejected")
+	}
+	if !limiter.Allow("192.168.1.2") {
+		t.Error("Expected another client to have its own window")
+	}
+
+	limiter.SetLimit(4, 0)
+	if !limiter.Allow("192.168.1.1") {
+		t.Error("Expected a raised limit to apply to tracked clients")
+	}
+}
+
+func TestSlidingWindow_Tokens(t *testing.T) {
+	w := newSlidingWindow(10, 0).(*slidingWindow)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		w.allowAt(start)
+	}
+	if got := w.tokensAt(start); got != 6 {
+		t.Errorf("Expected 6 requests left, got %v", got)
+	}
+	if got := w.tokensAt(start.Add(90 * time.Second)); got != 8 {
+		t.Errorf("Expected 8 left with half the previous window counted, got %v", got)
+	}
+}
@@ -4,12 +4,17 @@ import (
 	"crypto/tls"
 	"fmt"
 	"os"
+	"strings"
 )
 
+// DefaultNextProtos offers HTTP/2 with a fallback to HTTP/1.1.
+var DefaultNextProtos = []string{"h2", "http/1.1"}
+
 type Config struct {
 	CertFile string
 	KeyFile  string
 	MinVersion uint16
+	NextProtos []string
 }
 
 func NewConfig(certFile, keyFile string) *Config {
@@ -17,6 +22,7 @@ func NewConfig(certFile, keyFile string) *Config {
 		CertFile:  certFile,
 		KeyFile:   keyFile,
 		MinVersion: tls.VersionTLS12,
+		NextProtos: DefaultNextProtos,
 	}
 }
 
@@ -39,6 +45,7 @@ func (c *Config) Load() (*tls.Config, error) {
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{certificate},
 		MinVersion:   c.MinVersion,
+		NextProtos:   append([]string(nil), c.NextProtos...),
 		ServerName:   "",
 	}
 
@@ -48,3 +55,24 @@ func (c *Config) Load() (*tls.Config, error) {
 func (c *Config) SetMinVersion(version uint16) {
 	c.MinVersion = version
 }
+
+// SetNextProtos sets the protocols offered during ALPN, in preference order.
+func (c *Config) SetNextProtos(protos []string) {
+	c.NextProtos = protos
+}
+
+// ParseVersion maps a version name such as "1.2" or "TLS1.3" to its
+// crypto/tls constant.
+func ParseVersion(name string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "TLS") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q", name)
+}
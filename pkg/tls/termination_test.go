@@ -0,0 +1,85 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func writeCertPair(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestConfig_NextProtos(t *testing.T) {
+	certFile, keyFile := writeCertPair(t)
+
+	cfg, err := NewConfig(certFile, keyFile).Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !slices.Equal(cfg.NextProtos, []string{"h2", "http/1.1"}) {
+		t.Errorf("Expected h2 and http/1.1 by default, got %v", cfg.NextProtos)
+	}
+
+	c := NewConfig(certFile, keyFile)
+	c.SetNextProtos([]string{"http/1.1"})
+	cfg, err = c.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !slices.Equal(cfg.NextProtos, []string{"http/1.1"}) {
+		t.Errorf("Expected configured protocols, got %v", cfg.NextProtos)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for name, want := range map[string]uint16{"1.2": tls.VersionTLS12, "TLS1.3": tls.VersionTLS13, "tls1.0": tls.VersionTLS10, "1.1": tls.VersionTLS11} {
+		got, err := ParseVersion(name)
+		if err != nil || got != want {
+			t.Errorf("ParseVersion(%q) = %x, %v; want %x", name, got, err, want)
+		}
+	}
+	if _, err := ParseVersion("1.4"); err == nil {
+		t.Error("Expected an error for an unknown version")
+	}
+}
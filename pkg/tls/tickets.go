@@ -0,0 +1,106 @@
+package tls
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ticketKeysKept is how many keys stay installed: the current key encrypts
+// new tickets, the previous one still decrypts tickets issued before the
+// last rotation so resumption survives a single rotation boundary.
+const ticketKeysKept = 2
+
+// TicketRotator periodically replaces the session ticket keys of one or
+// more tls.Configs via SetSessionTicketKeys.
+type TicketRotator struct {
+	configs  []*tls.Config
+	interval time.Duration
+
+	mu   sync.Mutex
+	keys [][32]byte
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewTicketRotator installs a fresh ticket key on config and returns a
+// rotator that replaces it every interval once started.
+func NewTicketRotator(config *tls.Config, interval time.Duration) (*TicketRotator, error) {
+	r := &TicketRotator{
+		configs:  []*tls.Config{config},
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+	if err := r.Rotate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Rotate generates a new current key and keeps the previous one for
+// decryption only.
+func (r *TicketRotator) Rotate() error {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return fmt.Errorf("failed to generate session ticket key: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := append([][32]byte{key}, r.keys...)
+	if len(keys) > ticketKeysKept {
+		keys = keys[:ticketKeysKept]
+	}
+	r.keys = keys
+	for _, config := range r.configs {
+		config.SetSessionTicketKeys(keys)
+	}
+	return nil
+}
+
+// AddConfig installs the current keys on config and keeps them in sync on
+// every later rotation, e.g. for a listener using a clone of the original
+// config.
+func (r *TicketRotator) AddConfig(config *tls.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.configs = append(r.configs, config)
+	config.SetSessionTicketKeys(r.keys)
+}
+
+// Keys returns a copy of the installed keys, current key first.
+func (r *TicketRotator) Keys() [][32]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][32]byte(nil), r.keys...)
+}
+
+func (r *TicketRotator) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stopCh:
+				return
+			case <-ticker.C:
+				r.Rotate()
+			}
+		}
+	}()
+}
+
+func (r *TicketRotator) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+	r.wg.Wait()
+}
@@ -0,0 +1,58 @@
+package tls
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+func TestTicketRotator_RotatesOverInterval(t *testing.T) {
+	r, err := NewTicketRotator(&tls.Config{}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewTicketRotator failed: %v", err)
+	}
+
+	initial := r.Keys()
+	if len(initial) != 1 {
+		t.Fatalf("Expected one key before rotation, got %d", len(initial))
+	}
+
+	r.Start()
+	defer r.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		keys := r.Keys()
+		if len(keys) == ticketKeysKept && keys[0] != initial[0] {
+			if keys[1] == keys[0] {
+				t.Error("Expected current and previous keys to differ")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Keys did not rotate within deadline: %v", keys)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if keys := r.Keys(); len(keys) != ticketKeysKept {
+		t.Errorf("Expected at most %d keys kept, got %d", ticketKeysKept, len(keys))
+	}
+}
+
+func TestTicketRotator_KeepsPreviousKey(t *testing.T) {
+	r, err := NewTicketRotator(&tls.Config{}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewTicketRotator failed: %v", err)
+	}
+	first := r.Keys()[0]
+
+	if err := r.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	keys := r.Keys()
+	if keys[0] == first || keys[1] != first {
+		t.Error("Expected the previous key to move to the decrypt-only slot")
+	}
+}